@@ -0,0 +1,308 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+	"siapp/internal/service"
+)
+
+type approvalDecisionRequest struct {
+	Comment string `json:"comment"`
+}
+
+type approverRequest struct {
+	Approver *bool `json:"approver"`
+}
+
+// getApprovalPeriod 读取审批涉及的账期：账期所有人，或与所有人同公司、有审批权限的用户可访问
+func (h *Handler) getApprovalPeriod(r *http.Request, user *models.User) (*models.Period, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "periodID"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid periodID: %w", err)
+	}
+	query := h.db.Where("id = ?", id)
+	if user.Approver && user.CompanyID != "" {
+		query = query.Where("user_id = ? OR user_id IN (?)", user.ID,
+			h.db.Model(&models.User{}).Select("id").Where("company_id = ?", user.CompanyID))
+	} else {
+		query = query.Where("user_id = ?", user.ID)
+	}
+	var period models.Period
+	if err := query.First(&period).Error; err != nil {
+		return nil, err
+	}
+	return &period, nil
+}
+
+// approvalStatus 审批操作出错时的响应码
+func approvalStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrNotApprover), errors.Is(err, service.ErrSelfApproval):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrRejectCommentRequired), errors.Is(err, service.ErrSelfRevoke):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrNotSubmittable), errors.Is(err, service.ErrApprovalExists),
+		errors.Is(err, service.ErrApprovalNotPending), errors.Is(err, service.ErrSummaryChanged):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// getApproval 账期当前的审批状态与历史记录；从未提交时 current 为 null
+func (h *Handler) getApproval(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	period, err := h.getApprovalPeriod(r, user)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	history, err := h.process.ApprovalHistory(period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load approvals", err)
+		return
+	}
+	var current *models.PeriodApproval
+	if len(history) > 0 {
+		current = &history[0]
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"current":   current,
+		"history":   history,
+		"watermark": service.ApprovalWatermark(current),
+	})
+}
+
+// submitApproval 提交人提交处理完成的账期，等待同公司的审批人审批
+func (h *Handler) submitApproval(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	approval, err := h.process.SubmitForApproval(period, user.ID)
+	if err != nil {
+		status := approvalStatus(err)
+		if status == http.StatusInternalServerError {
+			respondError(w, status, "failed to submit approval", err)
+		} else {
+			respondError(w, status, err.Error(), nil)
+		}
+		return
+	}
+	respondJSON(w, http.StatusCreated, approval)
+}
+
+// approvePeriod 批准待审批的提交，可附审批意见
+func (h *Handler) approvePeriod(w http.ResponseWriter, r *http.Request) {
+	h.decideApproval(w, r, true)
+}
+
+// rejectPeriod 驳回待审批的提交，审批意见必填
+func (h *Handler) rejectPeriod(w http.ResponseWriter, r *http.Request) {
+	h.decideApproval(w, r, false)
+}
+
+func (h *Handler) decideApproval(w http.ResponseWriter, r *http.Request, approve bool) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	period, err := h.getApprovalPeriod(r, user)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+	var req approvalDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+
+	approval, err := h.process.DecideApproval(period, user, approve, req.Comment)
+	if err != nil {
+		status := approvalStatus(err)
+		if status == http.StatusInternalServerError {
+			respondError(w, status, "failed to update approval", err)
+		} else {
+			respondError(w, status, err.Error(), nil)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, approval)
+}
+
+// listPendingApprovals 审批人待处理的提交
+func (h *Handler) listPendingApprovals(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	pending, err := h.process.PendingApprovals(user)
+	if err != nil {
+		status := approvalStatus(err)
+		if status == http.StatusInternalServerError {
+			respondError(w, status, "failed to load pending approvals", err)
+		} else {
+			respondError(w, status, err.Error(), nil)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, pending)
+}
+
+// listCompanyUsers 审批人查看同公司的用户及其审批权限
+func (h *Handler) listCompanyUsers(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	users, err := h.process.CompanyUsers(user)
+	if err != nil {
+		status := approvalStatus(err)
+		if status == http.StatusInternalServerError {
+			respondError(w, status, "failed to load users", err)
+		} else {
+			respondError(w, status, err.Error(), nil)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, users)
+}
+
+// setApprover 审批人授予或撤销同公司用户的审批权限，JSON {"approver": true|false}
+func (h *Handler) setApprover(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	targetID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid userID", err)
+		return
+	}
+	var req approverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Approver == nil {
+		respondError(w, http.StatusBadRequest, "approver is required", err)
+		return
+	}
+
+	target, err := h.process.SetApprover(user, uint(targetID), *req.Approver)
+	if err != nil {
+		status := approvalStatus(err)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			respondError(w, http.StatusNotFound, "user not found", nil)
+		case status == http.StatusInternalServerError:
+			respondError(w, status, "failed to update approver", err)
+		default:
+			respondError(w, status, err.Error(), nil)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, target)
+}
+
+// applyApprovalWatermark 在导出文件各工作表的页眉页脚标注审批状态（打印与页面视图中可见），返回状态文字供文件名使用
+func (h *Handler) applyApprovalWatermark(f *excelize.File, period *models.Period) (string, error) {
+	approval, err := h.process.CurrentApproval(period)
+	if err != nil {
+		return "", err
+	}
+	watermark := service.ApprovalWatermark(approval)
+	detail := watermark
+	if approval != nil && approval.Status == models.ApprovalApproved && approval.DecidedAt != nil {
+		detail = fmt.Sprintf("%s（%s）", watermark, approval.DecidedAt.Format("2006-01-02 15:04"))
+	}
+	return watermark, setWatermarkHeaderFooter(f, period.YearMonth, detail)
+}
+
+// applyPeriodsApprovalWatermark 跨账期导出的审批标注：涉及的账期全部已批准时标“已审批”，
+// 否则标“未审批”并在页眉列出未批准的账期
+func (h *Handler) applyPeriodsApprovalWatermark(f *excelize.File, userID uint, yearMonths []string) (string, error) {
+	var periods []models.Period
+	if len(yearMonths) > 0 {
+		if err := h.db.Where("user_id = ? AND year_month IN ?", userID, yearMonths).Order("year_month").Find(&periods).Error; err != nil {
+			return "", err
+		}
+	}
+	if len(periods) == 0 {
+		return service.WatermarkUnapproved, setWatermarkHeaderFooter(f, "", service.WatermarkUnapproved)
+	}
+
+	var unapproved []string
+	for i := range periods {
+		approval, err := h.process.CurrentApproval(&periods[i])
+		if err != nil {
+			return "", err
+		}
+		if service.ApprovalWatermark(approval) != service.WatermarkApproved {
+			unapproved = append(unapproved, periods[i].YearMonth)
+		}
+	}
+	watermark, detail := service.WatermarkApproved, service.WatermarkApproved
+	if len(unapproved) > 0 {
+		watermark = service.WatermarkUnapproved
+		detail = fmt.Sprintf("%s（%s）", watermark, strings.Join(unapproved, "、"))
+	}
+	span := periods[0].YearMonth
+	if last := periods[len(periods)-1].YearMonth; last != span {
+		span += "至" + last
+	}
+	return watermark, setWatermarkHeaderFooter(f, span, detail)
+}
+
+// setWatermarkHeaderFooter 在各工作表页眉居中标注审批状态，页脚标注账期与页码
+func setWatermarkHeaderFooter(f *excelize.File, span, detail string) error {
+	footer := detail
+	if span != "" {
+		footer = span + " " + detail
+	}
+	for _, sheet := range f.GetSheetList() {
+		if err := f.SetHeaderFooter(sheet, &excelize.HeaderFooterOptions{
+			OddHeader: `&C&"-,Bold"&14` + detail,
+			OddFooter: "&L" + footer + "&R&P / &N",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+
+	"siapp/internal/auth"
+	"siapp/internal/models"
+	"siapp/internal/service"
+)
+
+// getAdjustmentsByMonth 账期补退按费款所属期的分布
+func (h *Handler) getAdjustmentsByMonth(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	adjustments, err := h.process.PeriodAdjustmentsByMonth(period)
+	if err != nil {
+		if errors.Is(err, service.ErrNoAdjustments) {
+			respondError(w, http.StatusNotFound, err.Error(), nil)
+		} else {
+			respondError(w, http.StatusInternalServerError, "failed to load adjustments", err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, adjustments)
+}
+
+// loadArrearsLedgers 读取 from / to 参数（费款所属期，YYYY-MM，可省略）并生成补退台账，出错时直接写入响应
+func (h *Handler) loadArrearsLedgers(w http.ResponseWriter, r *http.Request, idNumbers []string) ([]*service.ArrearsLedger, bool) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return nil, false
+	}
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	if (from != "" && !service.ValidYearMonth(from)) || (to != "" && !service.ValidYearMonth(to)) ||
+		(from != "" && to != "" && from > to) {
+		respondError(w, http.StatusBadRequest, "from 与 to 应为 YYYY-MM，且 from 不晚于 to", nil)
+		return nil, false
+	}
+
+	ledgers, err := h.process.BuildArrearsLedgers(userID, idNumbers, from, to)
+	if err != nil {
+		if errors.Is(err, service.ErrNoArrearsData) {
+			respondError(w, http.StatusNotFound, err.Error(), nil)
+		} else {
+			respondError(w, http.StatusInternalServerError, "failed to build arrears ledger", err)
+		}
+		return nil, false
+	}
+	return ledgers, true
+}
+
+// getEmployeeArrears 员工补退台账：各费款所属期在哪个账期补缴或退还、金额多少
+func (h *Handler) getEmployeeArrears(w http.ResponseWriter, r *http.Request) {
+	ledgers, ok := h.loadArrearsLedgers(w, r, []string{chi.URLParam(r, "idNumber")})
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, ledgers[0])
+}
+
+// exportArrearsExcel 导出补退台账：“汇总”每人一行，“台账”每人每个费款所属期、补退账期一行
+func (h *Handler) exportArrearsExcel(w http.ResponseWriter, r *http.Request) {
+	ledgers, ok := h.loadArrearsLedgers(w, r, idNumbersParam(r))
+	if !ok {
+		return
+	}
+	userID, _ := auth.GetUserIDFromContext(r.Context())
+	schemes, err := service.LoadSchemeRegistry(h.db, &userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
+		return
+	}
+	var personalAmounts, unitAmounts []models.SchemeAmounts
+	for _, ledger := range ledgers {
+		for _, entry := range ledger.Entries {
+			personalAmounts = append(personalAmounts, entry.Personal)
+			unitAmounts = append(unitAmounts, entry.Unit)
+		}
+	}
+	personalColumns := schemes.Columns(models.PartPersonal, personalAmounts...)
+	unitColumns := schemes.Columns(models.PartUnit, unitAmounts...)
+
+	summary := diffSheet{name: "汇总", headers: []string{"证件号码", "姓名", "部门", "更正月数", "最早所属期", "最晚所属期", "个人合计", "单位合计", "合计"}}
+	detail := diffSheet{name: "台账", headers: []string{"证件号码", "姓名", "部门", "费款所属期", "补退账期", "个人缴费基数", "单位缴费基数"}}
+	for _, col := range personalColumns {
+		detail.headers = append(detail.headers, "个人"+col.Label)
+	}
+	detail.headers = append(detail.headers, "个人合计")
+	for _, col := range unitColumns {
+		detail.headers = append(detail.headers, "单位"+col.Label)
+	}
+	detail.headers = append(detail.headers, "单位合计")
+
+	for _, ledger := range ledgers {
+		var first, last string
+		if n := len(ledger.Months); n > 0 {
+			first, last = ledger.Months[0], ledger.Months[n-1]
+		}
+		summary.rows = append(summary.rows, []any{ledger.IDNumber, ledger.Name, ledger.Department, len(ledger.Months),
+			first, last, ledger.PersonalTotal, ledger.UnitTotal, ledger.Total})
+		for _, entry := range ledger.Entries {
+			month := entry.ContributionMonth
+			if month == "" {
+				month = "未注明"
+			}
+			row := []any{ledger.IDNumber, ledger.Name, ledger.Department, month, entry.PaidYearMonth, entry.PersonalBase, entry.UnitBase}
+			for _, col := range personalColumns {
+				row = append(row, col.Sum(entry.Personal))
+			}
+			row = append(row, entry.PersonalTotal)
+			for _, col := range unitColumns {
+				row = append(row, col.Sum(entry.Unit))
+			}
+			detail.rows = append(detail.rows, append(row, entry.UnitTotal))
+		}
+	}
+
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+	for idx, sheet := range []diffSheet{summary, detail} {
+		if idx == 0 {
+			if err := f.SetSheetName(f.GetSheetName(0), sheet.name); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to create sheet", err)
+				return
+			}
+		} else if _, err := f.NewSheet(sheet.name); err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to create sheet", err)
+			return
+		}
+		for colIdx, header := range sheet.headers {
+			cell, _ := excelize.CoordinatesToCellName(colIdx+1, 1)
+			if err := f.SetCellValue(sheet.name, cell, header); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to write header", err)
+				return
+			}
+		}
+		for rowIdx, row := range sheet.rows {
+			for colIdx, value := range row {
+				cell, _ := excelize.CoordinatesToCellName(colIdx+1, rowIdx+2)
+				if err := f.SetCellValue(sheet.name, cell, cellValue(value)); err != nil {
+					respondError(w, http.StatusInternalServerError, "failed to write data", err)
+					return
+				}
+			}
+		}
+		lastCell, _ := excelize.CoordinatesToCellName(len(sheet.headers), len(sheet.rows)+1)
+		if err := f.AutoFilter(sheet.name, "A1:"+lastCell, nil); err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to set filter", err)
+			return
+		}
+	}
+
+	// 补退台账涉及的是支付补退的账期
+	var paidMonths []string
+	seen := map[string]bool{}
+	for _, ledger := range ledgers {
+		for _, entry := range ledger.Entries {
+			if !seen[entry.PaidYearMonth] {
+				seen[entry.PaidYearMonth] = true
+				paidMonths = append(paidMonths, entry.PaidYearMonth)
+			}
+		}
+	}
+	watermark, err := h.applyPeriodsApprovalWatermark(f, userID, paidMonths)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load approval", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to encode excel", err)
+		return
+	}
+
+	filename := fmt.Sprintf("补退台账（%s）.xlsx", watermark)
+	if len(ledgers) == 1 {
+		filename = fmt.Sprintf("%s-补退台账（%s）.xlsx", ledgers[0].Name, watermark)
+	}
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	http.ServeContent(w, r, filename, time.Now(), bytes.NewReader(buf.Bytes()))
+}
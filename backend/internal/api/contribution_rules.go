@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+	"siapp/internal/service"
+)
+
+type contributionRuleSetRequest struct {
+	City           string                    `json:"city"`
+	EffectiveFrom  string                    `json:"effective_from"`
+	AverageWage    models.Money              `json:"average_wage"`
+	FloorPercent   float64                   `json:"floor_percent"`
+	CeilingPercent float64                   `json:"ceiling_percent"`
+	BaseFloor      models.Money              `json:"base_floor"`
+	BaseCeiling    models.Money              `json:"base_ceiling"`
+	Rates          []models.ContributionRate `json:"rates"`
+	Tolerance      models.Money              `json:"tolerance"`
+	Notes          string                    `json:"notes"`
+
+	RoundingPolicies []models.RoundingPolicy `json:"rounding_policies"`
+}
+
+// apply 将请求内容写入规则（不含归属信息）
+func (req contributionRuleSetRequest) apply(rs *models.ContributionRuleSet) {
+	rs.City = req.City
+	rs.EffectiveFrom = req.EffectiveFrom
+	rs.AverageWage = req.AverageWage
+	rs.FloorPercent = req.FloorPercent
+	rs.CeilingPercent = req.CeilingPercent
+	rs.BaseFloor = req.BaseFloor
+	rs.BaseCeiling = req.BaseCeiling
+	rs.Rates = req.Rates
+	rs.Tolerance = req.Tolerance
+	rs.Notes = req.Notes
+	rs.RoundingPolicies = req.RoundingPolicies
+}
+
+func (h *Handler) getContributionRuleSetByParam(r *http.Request) (*models.ContributionRuleSet, *models.User, error) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unauthorized: %w", err)
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "ruleID"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid ruleID: %w", err)
+	}
+	var rs models.ContributionRuleSet
+	if err := service.ContributionRuleScope(h.db, user).Where("id = ?", id).First(&rs).Error; err != nil {
+		return nil, nil, err
+	}
+	return &rs, user, nil
+}
+
+// contributionRuleTaken 判断同一公司（或个人）是否已有相同城市、生效月份的规则
+func (h *Handler) contributionRuleTaken(user *models.User, rs *models.ContributionRuleSet) (bool, error) {
+	var count int64
+	err := service.ContributionRuleScope(h.db, user).
+		Where("city = ? AND effective_from = ? AND id <> ?", rs.City, rs.EffectiveFrom, rs.ID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// saveContributionRuleSet 校验并保存规则，返回应答状态码与错误信息；成功时状态码为 0
+func (h *Handler) saveContributionRuleSet(user *models.User, rs *models.ContributionRuleSet) (int, string, error) {
+	schemes, err := service.LoadSchemeRegistry(h.db, &user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, "failed to load schemes", err
+	}
+	if err := service.ValidateContributionRuleSet(rs, schemes); err != nil {
+		return http.StatusBadRequest, err.Error(), nil
+	}
+	taken, err := h.contributionRuleTaken(user, rs)
+	if err != nil {
+		return http.StatusInternalServerError, "failed to check contribution rules", err
+	}
+	if taken {
+		return http.StatusConflict, fmt.Sprintf("%s 自 %s 生效的缴费规则已存在", rs.City, rs.EffectiveFrom), nil
+	}
+	if err := h.db.Save(rs).Error; err != nil {
+		return http.StatusInternalServerError, "failed to save contribution rules", err
+	}
+	return 0, "", nil
+}
+
+// listContributionRules 返回当前公司的城市缴费规则，可按 city 过滤，按城市与生效月份（新的在前）排列
+func (h *Handler) listContributionRules(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	query := service.ContributionRuleScope(h.db, user)
+	if city := r.URL.Query().Get("city"); city != "" {
+		query = query.Where("city = ?", city)
+	}
+	var rules []models.ContributionRuleSet
+	if err := query.Order("city ASC, effective_from DESC").Find(&rules).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to fetch contribution rules", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, rules)
+}
+
+// createContributionRule 新增城市缴费规则；同一城市每个生效月份只能有一套
+func (h *Handler) createContributionRule(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+
+	var req contributionRuleSetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	rs := models.ContributionRuleSet{UserID: &user.ID, CompanyID: user.CompanyID}
+	req.apply(&rs)
+	if status, msg, err := h.saveContributionRuleSet(user, &rs); status != 0 {
+		respondError(w, status, msg, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, rs)
+}
+
+// updateContributionRule 修改城市缴费规则
+func (h *Handler) updateContributionRule(w http.ResponseWriter, r *http.Request) {
+	rs, user, err := h.getContributionRuleSetByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	var req contributionRuleSetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	req.apply(rs)
+	if status, msg, err := h.saveContributionRuleSet(user, rs); status != 0 {
+		respondError(w, status, msg, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, rs)
+}
+
+// deleteContributionRule 删除城市缴费规则
+func (h *Handler) deleteContributionRule(w http.ResponseWriter, r *http.Request) {
+	rs, _, err := h.getContributionRuleSetByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	if err := h.db.Delete(&models.ContributionRuleSet{}, rs.ID).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to delete contribution rules", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"message": "缴费规则已删除",
+	})
+}
+
+// checkContributions 按城市缴费规则核对账期内社保局文件的应缴金额，列出每一条不一致的记录；
+// 可用 city 参数指定城市，默认使用账期的参保城市
+func (h *Handler) checkContributions(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	result, err := h.process.CheckContributions(period.ID, r.URL.Query().Get("city"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrContributionCityRequired):
+			respondError(w, http.StatusBadRequest, err.Error(), nil)
+		case errors.Is(err, service.ErrContributionRuleNotFound):
+			respondError(w, http.StatusNotFound, err.Error(), nil)
+		default:
+			respondError(w, http.StatusInternalServerError, "failed to check contributions", err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
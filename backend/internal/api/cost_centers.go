@@ -0,0 +1,436 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+
+	"siapp/internal/auth"
+	"siapp/internal/models"
+	"siapp/internal/service"
+)
+
+type costCenterMappingRequest struct {
+	Department     string `json:"department"`
+	CostCenter     string `json:"cost_center"`
+	CostCenterName string `json:"cost_center_name"`
+}
+
+type costCenterSplitRequest struct {
+	IDNumber string                   `json:"id_number"`
+	Name     string                   `json:"name"`
+	Shares   []models.CostCenterShare `json:"shares"`
+}
+
+func (h *Handler) getCostCenterMappingByParam(r *http.Request) (*models.CostCenterMapping, *models.User, error) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unauthorized: %w", err)
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "mappingID"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid mappingID: %w", err)
+	}
+	var m models.CostCenterMapping
+	if err := service.CostCenterMappingScope(h.db, user).Where("id = ?", id).First(&m).Error; err != nil {
+		return nil, nil, err
+	}
+	return &m, user, nil
+}
+
+func (h *Handler) getCostCenterSplitByParam(r *http.Request) (*models.CostCenterSplit, *models.User, error) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unauthorized: %w", err)
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "splitID"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid splitID: %w", err)
+	}
+	var s models.CostCenterSplit
+	if err := service.CostCenterSplitScope(h.db, user).Where("id = ?", id).First(&s).Error; err != nil {
+		return nil, nil, err
+	}
+	return &s, user, nil
+}
+
+// saveCostCenterMapping 校验并保存部门对应关系，返回应答状态码与错误信息；成功时状态码为 0
+func (h *Handler) saveCostCenterMapping(user *models.User, m *models.CostCenterMapping) (int, string, error) {
+	if err := service.ValidateCostCenterMapping(m); err != nil {
+		return http.StatusBadRequest, err.Error(), nil
+	}
+	var count int64
+	if err := service.CostCenterMappingScope(h.db, user).
+		Where("department = ? AND id <> ?", m.Department, m.ID).
+		Count(&count).Error; err != nil {
+		return http.StatusInternalServerError, "failed to check cost center mappings", err
+	}
+	if count > 0 {
+		return http.StatusConflict, fmt.Sprintf("部门 %s 已有对应的成本中心", m.Department), nil
+	}
+	if err := h.db.Save(m).Error; err != nil {
+		return http.StatusInternalServerError, "failed to save cost center mapping", err
+	}
+	return 0, "", nil
+}
+
+// saveCostCenterSplit 校验并保存员工分摊比例，返回应答状态码与错误信息；成功时状态码为 0
+func (h *Handler) saveCostCenterSplit(user *models.User, s *models.CostCenterSplit) (int, string, error) {
+	if err := service.ValidateCostCenterSplit(s); err != nil {
+		return http.StatusBadRequest, err.Error(), nil
+	}
+	var count int64
+	if err := service.CostCenterSplitScope(h.db, user).
+		Where("id_number = ? AND id <> ?", s.IDNumber, s.ID).
+		Count(&count).Error; err != nil {
+		return http.StatusInternalServerError, "failed to check cost center splits", err
+	}
+	if count > 0 {
+		return http.StatusConflict, fmt.Sprintf("证件号码 %s 已设置分摊比例", s.IDNumber), nil
+	}
+	if err := h.db.Save(s).Error; err != nil {
+		return http.StatusInternalServerError, "failed to save cost center split", err
+	}
+	return 0, "", nil
+}
+
+// listCostCenterMappings 返回当前公司的部门成本中心对应关系，按部门排列
+func (h *Handler) listCostCenterMappings(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	var mappings []models.CostCenterMapping
+	if err := service.CostCenterMappingScope(h.db, user).Order("department ASC").Find(&mappings).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to fetch cost center mappings", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, mappings)
+}
+
+// createCostCenterMapping 新增部门对应的成本中心
+func (h *Handler) createCostCenterMapping(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	var req costCenterMappingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	m := models.CostCenterMapping{
+		UserID: &user.ID, CompanyID: user.CompanyID,
+		Department: req.Department, CostCenter: req.CostCenter, CostCenterName: req.CostCenterName,
+	}
+	if status, msg, err := h.saveCostCenterMapping(user, &m); status != 0 {
+		respondError(w, status, msg, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, m)
+}
+
+// updateCostCenterMapping 修改部门对应的成本中心
+func (h *Handler) updateCostCenterMapping(w http.ResponseWriter, r *http.Request) {
+	m, user, err := h.getCostCenterMappingByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+	var req costCenterMappingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	m.Department, m.CostCenter, m.CostCenterName = req.Department, req.CostCenter, req.CostCenterName
+	if status, msg, err := h.saveCostCenterMapping(user, m); status != 0 {
+		respondError(w, status, msg, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, m)
+}
+
+// deleteCostCenterMapping 删除部门对应的成本中心
+func (h *Handler) deleteCostCenterMapping(w http.ResponseWriter, r *http.Request) {
+	m, _, err := h.getCostCenterMappingByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+	if err := h.db.Delete(&models.CostCenterMapping{}, m.ID).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to delete cost center mapping", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"message": "成本中心对应关系已删除",
+	})
+}
+
+// listCostCenterSplits 返回当前公司的员工分摊比例，按证件号码排列
+func (h *Handler) listCostCenterSplits(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	var splits []models.CostCenterSplit
+	if err := service.CostCenterSplitScope(h.db, user).Order("id_number ASC").Find(&splits).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to fetch cost center splits", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, splits)
+}
+
+// createCostCenterSplit 设置员工分摊到多个成本中心的比例，合计须为 100
+func (h *Handler) createCostCenterSplit(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	var req costCenterSplitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	s := models.CostCenterSplit{
+		UserID: &user.ID, CompanyID: user.CompanyID,
+		IDNumber: req.IDNumber, Name: req.Name, Shares: req.Shares,
+	}
+	if status, msg, err := h.saveCostCenterSplit(user, &s); status != 0 {
+		respondError(w, status, msg, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, s)
+}
+
+// updateCostCenterSplit 修改员工分摊比例
+func (h *Handler) updateCostCenterSplit(w http.ResponseWriter, r *http.Request) {
+	s, user, err := h.getCostCenterSplitByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+	var req costCenterSplitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	s.IDNumber, s.Name, s.Shares = req.IDNumber, req.Name, req.Shares
+	if status, msg, err := h.saveCostCenterSplit(user, s); status != 0 {
+		respondError(w, status, msg, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, s)
+}
+
+// deleteCostCenterSplit 删除员工分摊比例，之后按所在部门的成本中心归集
+func (h *Handler) deleteCostCenterSplit(w http.ResponseWriter, r *http.Request) {
+	s, _, err := h.getCostCenterSplitByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+	if err := h.db.Delete(&models.CostCenterSplit{}, s.ID).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to delete cost center split", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"message": "分摊比例已删除",
+	})
+}
+
+// loadAllocationReport 按查询参数生成分摊报表：period_id 指定单个账期，或 from / to（YYYY-MM）指定月份范围；
+// group_by 为 department（默认）或 cost_center。出错时直接写入响应
+func (h *Handler) loadAllocationReport(w http.ResponseWriter, r *http.Request) (*service.AllocationReport, bool) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return nil, false
+	}
+	q := r.URL.Query()
+	groupBy, err := service.ParseAllocationGroup(q.Get("group_by"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), nil)
+		return nil, false
+	}
+
+	query := h.db.Where("user_id = ?", user.ID)
+	if param := q.Get("period_id"); param != "" {
+		id, err := strconv.Atoi(param)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid period_id", err)
+			return nil, false
+		}
+		query = query.Where("id = ?", id)
+	} else {
+		from, to := q.Get("from"), q.Get("to")
+		if from == "" || to == "" {
+			respondError(w, http.StatusBadRequest, "需要 period_id，或 from 与 to", nil)
+			return nil, false
+		}
+		if !service.ValidYearMonth(from) || !service.ValidYearMonth(to) || from > to {
+			respondError(w, http.StatusBadRequest, "from 与 to 应为 YYYY-MM，且 from 不晚于 to", nil)
+			return nil, false
+		}
+		query = query.Where("year_month >= ? AND year_month <= ?", from, to)
+	}
+	var periods []models.Period
+	if err := query.Find(&periods).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load periods", err)
+		return nil, false
+	}
+
+	report, err := h.process.BuildAllocationReport(user, periods, groupBy)
+	if err != nil {
+		if errors.Is(err, service.ErrNoAllocationPeriods) {
+			respondError(w, http.StatusNotFound, err.Error(), nil)
+		} else {
+			respondError(w, http.StatusInternalServerError, "failed to build allocation report", err)
+		}
+		return nil, false
+	}
+	return report, true
+}
+
+// getAllocationReport 按部门或成本中心汇总个人、单位各险种扣款
+func (h *Handler) getAllocationReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.loadAllocationReport(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// exportAllocationReport 导出分摊报表，format=json 时下载 JSON 文件，否则为 Excel
+func (h *Handler) exportAllocationReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.loadAllocationReport(w, r)
+	if !ok {
+		return
+	}
+
+	groupLabel := "部门"
+	if report.GroupBy == service.AllocationByCostCenter {
+		groupLabel = "成本中心"
+	}
+	span := report.From
+	if report.To != report.From {
+		span = report.From + "至" + report.To
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to encode json", err)
+			return
+		}
+		filename := fmt.Sprintf("%s-%s分摊.json", span, groupLabel)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+		http.ServeContent(w, r, filename, time.Now(), bytes.NewReader(data))
+		return
+	}
+
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+	sheetName := f.GetSheetName(0)
+
+	headers := []string{groupLabel}
+	if report.GroupBy == service.AllocationByCostCenter {
+		headers = append(headers, "成本中心名称")
+	}
+	headers = append(headers, "人数")
+	for _, col := range report.PersonalColumns {
+		headers = append(headers, "个人"+col.Label)
+	}
+	headers = append(headers, "个人合计")
+	for _, col := range report.UnitColumns {
+		headers = append(headers, "单位"+col.Label)
+	}
+	headers = append(headers, "单位合计", "合计")
+	for idx, header := range headers {
+		cell, _ := excelize.CoordinatesToCellName(idx+1, 1)
+		if err := f.SetCellValue(sheetName, cell, header); err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to write header", err)
+			return
+		}
+	}
+
+	rowValues := func(row service.AllocationRow, key string) []any {
+		values := []any{key}
+		if report.GroupBy == service.AllocationByCostCenter {
+			values = append(values, row.Name)
+		}
+		values = append(values, row.Headcount)
+		for _, col := range report.PersonalColumns {
+			values = append(values, col.Sum(row.Personal))
+		}
+		values = append(values, row.PersonalTotal)
+		for _, col := range report.UnitColumns {
+			values = append(values, col.Sum(row.Unit))
+		}
+		return append(values, row.UnitTotal, row.Total)
+	}
+	rows := make([][]any, 0, len(report.Rows)+1)
+	for _, row := range report.Rows {
+		key := row.Key
+		if key == "" {
+			key = "未分配"
+		}
+		rows = append(rows, rowValues(row, key))
+	}
+	rows = append(rows, rowValues(report.Totals, "合计"))
+	for rowIdx, values := range rows {
+		for colIdx, value := range values {
+			cell, _ := excelize.CoordinatesToCellName(colIdx+1, rowIdx+2)
+			if err := f.SetCellValue(sheetName, cell, cellValue(value)); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to write data", err)
+				return
+			}
+		}
+	}
+
+	userID, _ := auth.GetUserIDFromContext(r.Context())
+	watermark, err := h.applyPeriodsApprovalWatermark(f, userID, report.Periods)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load approval", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to encode excel", err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s分摊（%s）.xlsx", span, groupLabel, watermark)
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	http.ServeContent(w, r, filename, time.Now(), bytes.NewReader(buf.Bytes()))
+}
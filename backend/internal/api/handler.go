@@ -15,28 +15,23 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
 	"github.com/xuri/excelize/v2"
 	"gorm.io/gorm"
 
 	"siapp/internal/auth"
 	"siapp/internal/models"
 	"siapp/internal/service"
+	"siapp/internal/storage"
 )
 
 type Handler struct {
 	db      *gorm.DB
 	process *service.Processor
+	jobs    *service.JobRunner
+	store   storage.Storage
 }
 
-type batchUploadItem struct {
-	FileName     string        `json:"file_name"`
-	OriginalName string        `json:"original_name"`
-	Scheme       models.Scheme `json:"scheme"`
-	Part         models.Part   `json:"part"`
-	Imported     int           `json:"imported"`
-	Error        string        `json:"error,omitempty"`
-}
+type batchUploadItem = service.BatchUploadItem
 
 // fileKey 用于标识文件的唯一性 (文件名 + 大小)
 type fileKey struct {
@@ -92,11 +87,15 @@ func deduplicateFilesWithMetadata(files []*multipart.FileHeader, schemes []strin
 	return uniqueFiles, uniqueSchemes, uniqueParts
 }
 
-func NewHandler(db *gorm.DB) *Handler {
-	return &Handler{
+func NewHandler(db *gorm.DB, jobs *service.JobRunner, store storage.Storage) *Handler {
+	h := &Handler{
 		db:      db,
-		process: service.NewProcessor(db),
+		process: service.NewProcessor(db, store),
+		jobs:    jobs,
+		store:   store,
 	}
+	h.process.RegisterJobs(jobs)
+	return h
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
@@ -105,6 +104,48 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 	r.Get("/roster-template", h.downloadRosterTemplate)
 	r.Get("/employees", h.listEmployees)
 	r.Post("/employees/import", h.importEmployees)
+	r.Get("/employees/contributions/export", h.exportStatementsExcel)
+	r.Get("/employees/contributions/statements", h.exportStatementsHTML)
+	r.Get("/employees/{idNumber}/contributions", h.getEmployeeContributions)
+	r.Get("/employees/{idNumber}/contributions/statement", h.getEmployeeStatement)
+	r.Get("/employees/arrears/export", h.exportArrearsExcel)
+	r.Get("/employees/{idNumber}/arrears", h.getEmployeeArrears)
+
+	r.Get("/approvals/pending", h.listPendingApprovals)
+	r.Get("/users", h.listCompanyUsers)
+	r.Put("/users/{userID}/approver", h.setApprover)
+
+	r.Get("/jobs", h.listJobs)
+	r.Get("/jobs/{jobID}", h.getJob)
+
+	r.Get("/header-profiles", h.listHeaderProfiles)
+	r.Post("/header-profiles", h.createHeaderProfile)
+	r.Get("/header-profiles/defaults", h.getHeaderProfileDefaults)
+	r.Get("/header-profiles/{profileID}", h.getHeaderProfile)
+	r.Put("/header-profiles/{profileID}", h.updateHeaderProfile)
+	r.Delete("/header-profiles/{profileID}", h.deleteHeaderProfile)
+
+	r.Get("/schemes", h.listSchemes)
+	r.Post("/schemes", h.createScheme)
+	r.Put("/schemes/{schemeID}", h.updateScheme)
+	r.Delete("/schemes/{schemeID}", h.deleteScheme)
+
+	r.Get("/contribution-rules", h.listContributionRules)
+	r.Post("/contribution-rules", h.createContributionRule)
+	r.Put("/contribution-rules/{ruleID}", h.updateContributionRule)
+	r.Delete("/contribution-rules/{ruleID}", h.deleteContributionRule)
+
+	r.Get("/cost-centers/mappings", h.listCostCenterMappings)
+	r.Post("/cost-centers/mappings", h.createCostCenterMapping)
+	r.Put("/cost-centers/mappings/{mappingID}", h.updateCostCenterMapping)
+	r.Delete("/cost-centers/mappings/{mappingID}", h.deleteCostCenterMapping)
+	r.Get("/cost-centers/splits", h.listCostCenterSplits)
+	r.Post("/cost-centers/splits", h.createCostCenterSplit)
+	r.Put("/cost-centers/splits/{splitID}", h.updateCostCenterSplit)
+	r.Delete("/cost-centers/splits/{splitID}", h.deleteCostCenterSplit)
+
+	r.Get("/allocation", h.getAllocationReport)
+	r.Get("/allocation/export", h.exportAllocationReport)
 
 	r.Route("/periods/{periodID}", func(pr chi.Router) {
 		pr.Get("/", h.getPeriod)
@@ -113,11 +154,28 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 		pr.Get("/files", h.listFiles)
 		pr.Post("/files", h.uploadFile)
 		pr.Post("/files/batch", h.uploadFilesBatch)
+		pr.Post("/files/preview", h.previewFile)
 		pr.Post("/files/clear", h.clearFiles)
+		pr.Get("/files/versions", h.listFileVersions)
+		pr.Post("/files/{fileID}/activate", h.activateFileVersion)
+		pr.Get("/files/{fileID}/download", h.downloadSourceFile)
+		pr.Post("/files/{fileID}/reparse", h.reparseSourceFile)
 		pr.Get("/roster", h.getRoster)
 		pr.Post("/roster", h.uploadRoster)
 		pr.Post("/roster/import", h.importLatestRoster)
 		pr.Post("/process", h.processPeriod)
+		pr.Post("/review", h.reviewPeriod)
+		pr.Post("/close", h.closePeriod)
+		pr.Post("/reopen", h.reopenPeriod)
+		pr.Get("/approval", h.getApproval)
+		pr.Post("/approval/submit", h.submitApproval)
+		pr.Post("/approval/approve", h.approvePeriod)
+		pr.Post("/approval/reject", h.rejectPeriod)
+		pr.Get("/contribution-check", h.checkContributions)
+		pr.Get("/reconciliation", h.getReconciliation)
+		pr.Get("/reconciliation/export", h.exportReconciliationExcel)
+		pr.Get("/diff", h.getPeriodDiff)
+		pr.Get("/diff/export", h.exportPeriodDiffExcel)
 		pr.Get("/summary", h.getSummary)
 		pr.Get("/charges", h.getCharges)
 		pr.Get("/charges/export", h.exportChargesExcel)
@@ -128,6 +186,11 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 		pr.Post("/adjustments/batch", h.uploadAdjustmentsBatch)
 		pr.Post("/adjustments/process", h.processAdjustments)
 		pr.Post("/adjustments/clear", h.clearAdjustments)
+		pr.Get("/adjustments/by-month", h.getAdjustmentsByMonth)
+
+		// 住房公积金
+		pr.Get("/housing-fund", h.getHousingFund)
+		pr.Post("/housing-fund", h.uploadHousingFundFile)
 	})
 }
 
@@ -181,40 +244,13 @@ func (h *Handler) importEmployees(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	if err := os.MkdirAll("./uploads", 0o755); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to prepare upload directory", err)
-		return
-	}
-
-	targetDir := filepath.Join("./uploads", "employees", fmt.Sprintf("%d", userID))
-	if err := os.MkdirAll(targetDir, 0o755); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to create employee directory", err)
-		return
-	}
-
-	ext := filepath.Ext(header.Filename)
-	if ext == "" {
-		ext = ".xlsx"
-	}
-	filename := fmt.Sprintf("employees-%d-%d%s", userID, time.Now().UnixNano(), ext)
-	storedPath := filepath.Join(targetDir, filename)
-
-	out, err := os.Create(storedPath)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to create file", err)
-		return
-	}
-	if _, err := io.Copy(out, file); err != nil {
-		_ = out.Close()
+	key := uploadKey(storage.Key(h.tenantPrefix(&userID), "employees", fmt.Sprintf("%d", userID)), "employees-", header.Filename)
+	if err := h.saveReader(r.Context(), key, file); err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to save file", err)
 		return
 	}
-	if err := out.Close(); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to finalize file", err)
-		return
-	}
 
-	result, err := h.process.ParseEmployeeFile(userID, storedPath, header.Filename)
+	result, err := h.process.ParseEmployeeFile(userID, key, header.Filename)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "failed to import employees", err)
 		return
@@ -224,8 +260,9 @@ func (h *Handler) importEmployees(w http.ResponseWriter, r *http.Request) {
 }
 
 type createPeriodRequest struct {
-	YearMonth        string `json:"year_month"`
-	AllowAdjustments *bool  `json:"allow_adjustments,omitempty"`
+	YearMonth        string  `json:"year_month"`
+	City             *string `json:"city,omitempty"`
+	AllowAdjustments *bool   `json:"allow_adjustments,omitempty"`
 }
 
 func (h *Handler) createPeriod(w http.ResponseWriter, r *http.Request) {
@@ -250,6 +287,10 @@ func (h *Handler) createPeriod(w http.ResponseWriter, r *http.Request) {
 	if req.AllowAdjustments != nil {
 		allowAdjustments = *req.AllowAdjustments
 	}
+	city := ""
+	if req.City != nil {
+		city = strings.TrimSpace(*req.City)
+	}
 
 	var period models.Period
 	if err := h.db.Where("user_id = ? AND year_month = ?", userID, req.YearMonth).First(&period).Error; err != nil {
@@ -257,7 +298,8 @@ func (h *Handler) createPeriod(w http.ResponseWriter, r *http.Request) {
 			period = models.Period{
 				UserID:           &userID,
 				YearMonth:        req.YearMonth,
-				Status:           "draft",
+				City:             city,
+				Status:           models.PeriodDraft,
 				AllowAdjustments: allowAdjustments,
 			}
 			if err := h.db.Create(&period).Error; err != nil {
@@ -273,12 +315,18 @@ func (h *Handler) createPeriod(w http.ResponseWriter, r *http.Request) {
 		if period.AllowAdjustments != allowAdjustments {
 			updates["allow_adjustments"] = allowAdjustments
 		}
+		if req.City != nil && period.City != city {
+			updates["city"] = city
+		}
 		if len(updates) > 0 {
 			if err := h.db.Model(&period).Updates(updates).Error; err != nil {
 				respondError(w, http.StatusInternalServerError, "failed to update period", err)
 				return
 			}
 			period.AllowAdjustments = allowAdjustments
+			if req.City != nil {
+				period.City = city
+			}
 		}
 	}
 
@@ -309,8 +357,9 @@ func (h *Handler) listFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 历史版本通过 /files/versions 查看
 	var files []models.SourceFile
-	if err := h.db.Where("period_id = ?", period.ID).Order("created_at ASC").Find(&files).Error; err != nil {
+	if err := h.db.Where("period_id = ? AND active = ?", period.ID, true).Order("created_at ASC").Find(&files).Error; err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to fetch files", err)
 		return
 	}
@@ -349,6 +398,11 @@ func (h *Handler) uploadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
 	if err := r.ParseMultipartForm(64 << 20); err != nil {
 		respondError(w, http.StatusBadRequest, "failed to parse multipart form", err)
 		return
@@ -362,10 +416,25 @@ func (h *Handler) uploadFile(w http.ResponseWriter, r *http.Request) {
 	}
 	scheme := models.Scheme(schemeStr)
 	part := models.Part(partStr)
-	if !isValidScheme(scheme) || !isValidPart(part) {
+	schemes, err := h.periodSchemes(period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
+		return
+	}
+	if !schemes.Applies(scheme, part) || !isValidPart(part) {
 		respondError(w, http.StatusBadRequest, "invalid scheme or part", nil)
 		return
 	}
+	if scheme == models.SchemeHousingFund {
+		respondError(w, http.StatusBadRequest, errHousingFundUpload, nil)
+		return
+	}
+
+	opts, err := h.parseOptionsFromForm(r, models.HeaderProfileSource)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid parse options", err)
+		return
+	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
@@ -374,39 +443,128 @@ func (h *Handler) uploadFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	if err := os.MkdirAll("./uploads", 0o755); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to prepare upload directory", err)
+	if !service.IsSupportedSheetFile(header.Filename) {
+		respondError(w, http.StatusBadRequest, "unsupported file type, expected .xlsx, .xls or .csv", nil)
 		return
 	}
 
-	targetDir := filepath.Join("./uploads", fmt.Sprintf("%d", period.ID))
-	if err := os.MkdirAll(targetDir, 0o755); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to create period upload dir", err)
+	key := uploadKey(h.periodPrefix(period), "", header.Filename)
+	if err := h.saveReader(r.Context(), key, file); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to save file", err)
 		return
 	}
 
-	ext := filepath.Ext(header.Filename)
-	filename := fmt.Sprintf("%s%s", uuid.NewString(), ext)
-	storedPath := filepath.Join(targetDir, filename)
+	result, err := h.process.ParseSourceFile(period.ID, period.UserID, key, header.Filename, scheme, part, opts)
+	if err != nil {
+		var thresholdErr *service.RejectionThresholdError
+		if errors.As(err, &thresholdErr) {
+			respondJSON(w, http.StatusUnprocessableEntity, map[string]any{
+				"error":    "too many rejected rows",
+				"details":  thresholdErr.Error(),
+				"rejected": thresholdErr.Rejected,
+				"issues":   thresholdErr.Issues,
+			})
+			return
+		}
+		var duplicateErr *service.DuplicateFileError
+		if errors.As(err, &duplicateErr) {
+			respondJSON(w, http.StatusConflict, map[string]any{
+				"error":      "duplicate file content",
+				"details":    duplicateErr.Error(),
+				"duplicates": duplicateErr.Matches,
+			})
+			return
+		}
+		respondError(w, http.StatusBadRequest, "failed to parse file", err)
+		return
+	}
 
-	out, err := os.Create(storedPath)
+	respondJSON(w, http.StatusCreated, result)
+}
+
+// previewFile 解析上传文件并与已导入记录比对，不保存文件也不写入数据库
+func (h *Handler) previewFile(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to create file", err)
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	if err := r.ParseMultipartForm(64 << 20); err != nil {
+		respondError(w, http.StatusBadRequest, "failed to parse multipart form", err)
+		return
+	}
+
+	scheme := models.Scheme(strings.TrimSpace(r.FormValue("scheme")))
+	part := models.Part(strings.TrimSpace(r.FormValue("part")))
+	schemes, err := h.periodSchemes(period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
+		return
+	}
+	if !schemes.Applies(scheme, part) || !isValidPart(part) {
+		respondError(w, http.StatusBadRequest, "invalid scheme or part", nil)
+		return
+	}
+	if scheme == models.SchemeHousingFund {
+		respondError(w, http.StatusBadRequest, errHousingFundUpload, nil)
+		return
+	}
+
+	limit := service.DefaultPreviewRows
+	if raw := strings.TrimSpace(r.FormValue("limit")); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid limit", err)
+			return
+		}
+	}
+
+	opts, err := h.parseOptionsFromForm(r, models.HeaderProfileSource)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid parse options", err)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "file is required", err)
+		return
+	}
+	defer file.Close()
+
+	if !service.IsSupportedSheetFile(header.Filename) {
+		respondError(w, http.StatusBadRequest, "unsupported file type, expected .xlsx, .xls or .csv", nil)
 		return
 	}
-	defer out.Close()
-	if _, err := io.Copy(out, file); err != nil {
+
+	tmp, err := os.CreateTemp("", "preview-*"+filepath.Ext(header.Filename))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to create temp file", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, file); err != nil {
+		_ = tmp.Close()
 		respondError(w, http.StatusInternalServerError, "failed to save file", err)
 		return
 	}
+	if err := tmp.Close(); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to finalize file", err)
+		return
+	}
 
-	result, err := h.process.ParseSourceFile(period.ID, period.UserID, storedPath, header.Filename, scheme, part)
+	result, err := h.process.PreviewSourceFile(period.ID, tmp.Name(), scheme, part, opts, limit)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "failed to parse file", err)
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, result)
+	respondJSON(w, http.StatusOK, result)
 }
 
 func (h *Handler) uploadFilesBatch(w http.ResponseWriter, r *http.Request) {
@@ -420,6 +578,11 @@ func (h *Handler) uploadFilesBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
 	if err := r.ParseMultipartForm(128 << 20); err != nil {
 		respondError(w, http.StatusBadRequest, "failed to parse multipart form", err)
 		return
@@ -434,96 +597,77 @@ func (h *Handler) uploadFilesBatch(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "files field is required", nil)
 		return
 	}
-	if len(originalSchemes) != len(originalFiles) || len(originalParts) != len(originalFiles) {
+	// scheme/part 可省略，由后台任务按文件名与内容识别；提供时须与文件一一对应（单项可为空）
+	if (len(originalSchemes) > 0 && len(originalSchemes) != len(originalFiles)) || (len(originalParts) > 0 && len(originalParts) != len(originalFiles)) {
 		respondError(w, http.StatusBadRequest, "scheme and part count must match files count", nil)
 		return
 	}
 
-	// 去除重复文件 (相同文件名和大小)
-	files, schemes, parts := deduplicateFilesWithMetadata(originalFiles, originalSchemes, originalParts)
-
-	if err := os.MkdirAll("./uploads", 0o755); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to prepare upload directory", err)
+	opts, err := h.parseOptionsFromForm(r, models.HeaderProfileSource)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid parse options", err)
 		return
 	}
-	targetDir := filepath.Join("./uploads", fmt.Sprintf("%d", period.ID))
-	if err := os.MkdirAll(targetDir, 0o755); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to create period upload dir", err)
+
+	registry, err := h.periodSchemes(period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
 		return
 	}
 
-	items := make([]batchUploadItem, 0, len(files))
+	// 去除重复文件 (相同文件名和大小)
+	files, schemes, parts := deduplicateFilesWithMetadata(originalFiles, originalSchemes, originalParts)
+
+	prefix := h.periodPrefix(period)
+	uploads := make([]service.UploadBatchFile, 0, len(files))
 	for idx, header := range files {
-		item := batchUploadItem{
-			OriginalName: header.Filename,
+		upload := service.UploadBatchFile{OriginalName: header.Filename}
+		if idx < len(schemes) {
+			upload.Scheme = models.Scheme(strings.TrimSpace(schemes[idx]))
 		}
-
-		scheme := models.Scheme(strings.TrimSpace(schemes[idx]))
-		part := models.Part(strings.TrimSpace(parts[idx]))
-		item.Scheme = scheme
-		item.Part = part
-
-		if !isValidScheme(scheme) || !isValidPart(part) {
-			item.Error = "invalid scheme or part"
-			items = append(items, item)
-			continue
+		if idx < len(parts) {
+			upload.Part = models.Part(strings.TrimSpace(parts[idx]))
 		}
-
-		src, err := header.Open()
-		if err != nil {
-			item.Error = fmt.Sprintf("open file: %v", err)
-			items = append(items, item)
+		if (upload.Scheme != "" && !registry.Valid(upload.Scheme)) || (upload.Part != "" && !isValidPart(upload.Part)) {
+			upload.Error = "invalid scheme or part"
+			uploads = append(uploads, upload)
 			continue
 		}
-
-		ext := filepath.Ext(header.Filename)
-		if ext == "" {
-			ext = ".xlsx"
-		}
-		filename := fmt.Sprintf("%s%s", uuid.NewString(), ext)
-		storedPath := filepath.Join(targetDir, filename)
-
-		out, err := os.Create(storedPath)
-		if err != nil {
-			item.Error = fmt.Sprintf("create file: %v", err)
-			_ = src.Close()
-			items = append(items, item)
+		if upload.Scheme == models.SchemeHousingFund {
+			upload.Error = errHousingFundUpload
+			uploads = append(uploads, upload)
 			continue
 		}
-
-		if _, err := io.Copy(out, src); err != nil {
-			item.Error = fmt.Sprintf("save file: %v", err)
-			_ = src.Close()
-			_ = out.Close()
-			items = append(items, item)
+		if !service.IsSupportedSheetFile(header.Filename) {
+			upload.Error = "unsupported file type, expected .xlsx, .xls or .csv"
+			uploads = append(uploads, upload)
 			continue
 		}
-		_ = src.Close()
-		_ = out.Close()
 
-		result, err := h.process.ParseSourceFile(period.ID, period.UserID, storedPath, header.Filename, scheme, part)
-		if err != nil {
-			item.Error = err.Error()
-			items = append(items, item)
+		key := uploadKey(prefix, "", header.Filename)
+		if err := h.saveUpload(r.Context(), key, header); err != nil {
+			upload.Error = err.Error()
+			uploads = append(uploads, upload)
 			continue
 		}
 
-		item.FileName = filepath.Base(result.File.StoredPath)
-		item.Imported = result.Imported
-		items = append(items, item)
+		upload.StoredPath = key
+		uploads = append(uploads, upload)
 	}
 
-	status := http.StatusOK
-	for _, item := range items {
-		if item.Error != "" {
-			status = http.StatusMultiStatus
-			break
-		}
+	// 文件已落盘，解析交给后台任务，客户端通过 GET /jobs/{id} 查询进度与结果
+	job, err := h.jobs.Enqueue(period.UserID, &period.ID, models.JobUploadBatch, service.UploadBatchPayload{
+		PeriodID: period.ID,
+		UserID:   period.UserID,
+		Files:    uploads,
+		Options:  opts,
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to enqueue upload job", err)
+		return
 	}
 
-	respondJSON(w, status, map[string]any{
-		"items": items,
-	})
+	respondJSON(w, http.StatusAccepted, job)
 }
 
 func (h *Handler) uploadRoster(w http.ResponseWriter, r *http.Request) {
@@ -537,6 +681,11 @@ func (h *Handler) uploadRoster(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
 		respondError(w, http.StatusBadRequest, "failed to parse multipart form", err)
 		return
@@ -549,36 +698,24 @@ func (h *Handler) uploadRoster(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	if err := os.MkdirAll("./uploads", 0o755); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to prepare upload directory", err)
+	opts, err := h.parseOptionsFromForm(r, models.HeaderProfileRoster)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid parse options", err)
 		return
 	}
 
-	targetDir := filepath.Join("./uploads", fmt.Sprintf("%d", period.ID), "roster")
-	if err := os.MkdirAll(targetDir, 0o755); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to create roster directory", err)
+	if !service.IsSupportedSheetFile(header.Filename) {
+		respondError(w, http.StatusBadRequest, "unsupported file type, expected .xlsx, .xls or .csv", nil)
 		return
 	}
 
-	ext := filepath.Ext(header.Filename)
-	if ext == "" {
-		ext = ".xlsx"
-	}
-	filename := fmt.Sprintf("roster-%s%s", uuid.NewString(), ext)
-	storedPath := filepath.Join(targetDir, filename)
-
-	out, err := os.Create(storedPath)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to create file", err)
-		return
-	}
-	defer out.Close()
-	if _, err := io.Copy(out, file); err != nil {
+	key := uploadKey(h.periodPrefix(period, "roster"), "roster-", header.Filename)
+	if err := h.saveReader(r.Context(), key, file); err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to save file", err)
 		return
 	}
 
-	result, err := h.process.ParseRosterFile(period.ID, period.UserID, storedPath, header.Filename)
+	result, err := h.process.ParseRosterFile(period.ID, period.UserID, key, header.Filename, opts)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "failed to import roster", err)
 		return
@@ -598,6 +735,11 @@ func (h *Handler) importLatestRoster(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
 	// 获取最新的花名册数据（从其他账期中找到最新的非空花名册）
 	var latestRoster []models.RosterEntry
 	err = h.db.Raw(`
@@ -676,13 +818,25 @@ func (h *Handler) processPeriod(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	output, err := h.process.ProcessPeriod(period.ID)
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
+	// mode=provisional 时缺少必需险种也按已上传的文件预估处理
+	mode, err := service.ParseProcessMode(r.URL.Query().Get("mode"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	job, err := h.jobs.Enqueue(period.UserID, &period.ID, models.JobProcessPeriod, service.PeriodJobPayload{PeriodID: period.ID, Mode: mode})
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "failed to process period", err)
+		respondError(w, http.StatusInternalServerError, "failed to enqueue process period job", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, output)
+	respondJSON(w, http.StatusAccepted, job)
 }
 
 func (h *Handler) getSummary(w http.ResponseWriter, r *http.Request) {
@@ -701,6 +855,12 @@ func (h *Handler) getSummary(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusInternalServerError, "failed to fetch summary", err)
 		return
 	}
+	schemes, err := h.periodSchemes(period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
+		return
+	}
+	schemes.SortSummaries(summaries)
 	respondJSON(w, http.StatusOK, summaries)
 }
 
@@ -744,6 +904,24 @@ func (h *Handler) getCharges(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, charges)
 }
 
+// chargeRow 扣款明细导出的一行，个人与单位明细共用
+type chargeRow struct {
+	Name       string
+	IDNumber   string
+	Department string
+	Base       models.Money
+	Amounts    models.SchemeAmounts
+	Subtotal   models.Money
+}
+
+// cellValue 将金额转换为数值写入单元格，其余值原样写入
+func cellValue(value any) any {
+	if amount, ok := value.(models.Money); ok {
+		return amount.Float()
+	}
+	return value
+}
+
 func (h *Handler) exportChargesExcel(w http.ResponseWriter, r *http.Request) {
 	period, err := h.getPeriodByParam(r)
 	if err != nil {
@@ -766,31 +944,16 @@ func (h *Handler) exportChargesExcel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	f := excelize.NewFile()
-	defer func() { _ = f.Close() }()
-	sheetName := f.GetSheetName(0)
+	schemes, err := h.periodSchemes(period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
+		return
+	}
 
 	var (
-		headers []string
-		label   string
+		rows  []chargeRow
+		label string
 	)
-
-	if part == models.PartPersonal {
-		headers = []string{"序号", "姓名", "证件号码", "部门", "基数", "养老保险", "医疗+生育保险", "大额医疗", "失业保险", "小计"}
-		label = "个人"
-	} else {
-		headers = []string{"序号", "姓名", "证件号码", "部门", "基数", "养老保险", "医疗+生育保险", "工伤保险", "失业保险", "小计"}
-		label = "单位"
-	}
-
-	for idx, header := range headers {
-		cell, _ := excelize.CoordinatesToCellName(idx+1, 1)
-		if err := f.SetCellValue(sheetName, cell, header); err != nil {
-			respondError(w, http.StatusInternalServerError, "failed to write header", err)
-			return
-		}
-	}
-
 	if part == models.PartPersonal {
 		var charges []models.PersonalCharge
 		if err := h.db.Where("period_id = ?", period.ID).
@@ -803,65 +966,10 @@ func (h *Handler) exportChargesExcel(w http.ResponseWriter, r *http.Request) {
 			respondError(w, http.StatusBadRequest, "no personal charges available", nil)
 			return
 		}
-
-		var (
-			baseTotal         float64
-			pensionTotal      float64
-			medicalTotal      float64
-			seriousTotal      float64
-			unemploymentTotal float64
-			subtotalTotal     float64
-		)
-
-		for idx, row := range charges {
-			baseTotal += row.Base
-			pensionTotal += row.Pension
-			medicalTotal += row.MedicalMaternity
-			seriousTotal += row.SeriousIllness
-			unemploymentTotal += row.Unemployment
-			subtotalTotal += row.Subtotal
-
-			values := []any{
-				idx + 1,
-				row.Name,
-				row.IDNumber,
-				row.Department,
-				row.Base,
-				row.Pension,
-				row.MedicalMaternity,
-				row.SeriousIllness,
-				row.Unemployment,
-				row.Subtotal,
-			}
-			for colIdx, value := range values {
-				cell, _ := excelize.CoordinatesToCellName(colIdx+1, idx+2)
-				if err := f.SetCellValue(sheetName, cell, value); err != nil {
-					respondError(w, http.StatusInternalServerError, "failed to write data", err)
-					return
-				}
-			}
-		}
-
-		totalRow := len(charges) + 2
-		totalValues := []any{
-			"合计",
-			"",
-			"",
-			"",
-			baseTotal,
-			pensionTotal,
-			medicalTotal,
-			seriousTotal,
-			unemploymentTotal,
-			subtotalTotal,
-		}
-		for colIdx, value := range totalValues {
-			cell, _ := excelize.CoordinatesToCellName(colIdx+1, totalRow)
-			if err := f.SetCellValue(sheetName, cell, value); err != nil {
-				respondError(w, http.StatusInternalServerError, "failed to write total row", err)
-				return
-			}
+		for _, row := range charges {
+			rows = append(rows, chargeRow{row.Name, row.IDNumber, row.Department, row.Base, row.AmountsByScheme(), row.Subtotal})
 		}
+		label = "个人"
 	} else {
 		var charges []models.UnitCharge
 		if err := h.db.Where("period_id = ?", period.ID).
@@ -874,74 +982,89 @@ func (h *Handler) exportChargesExcel(w http.ResponseWriter, r *http.Request) {
 			respondError(w, http.StatusBadRequest, "no unit charges available", nil)
 			return
 		}
+		for _, row := range charges {
+			rows = append(rows, chargeRow{row.Name, row.IDNumber, row.Department, row.Base, row.AmountsByScheme(), row.Subtotal})
+		}
+		label = "单位"
+	}
 
-		var (
-			baseTotal         float64
-			pensionTotal      float64
-			medicalTotal      float64
-			injuryTotal       float64
-			unemploymentTotal float64
-			subtotalTotal     float64
-		)
-
-		for idx, row := range charges {
-			baseTotal += row.Base
-			pensionTotal += row.Pension
-			medicalTotal += row.MedicalMaternity
-			injuryTotal += row.Injury
-			unemploymentTotal += row.Unemployment
-			subtotalTotal += row.Subtotal
-
-			values := []any{
-				idx + 1,
-				row.Name,
-				row.IDNumber,
-				row.Department,
-				row.Base,
-				row.Pension,
-				row.MedicalMaternity,
-				row.Injury,
-				row.Unemployment,
-				row.Subtotal,
-			}
-			for colIdx, value := range values {
-				cell, _ := excelize.CoordinatesToCellName(colIdx+1, idx+2)
-				if err := f.SetCellValue(sheetName, cell, value); err != nil {
-					respondError(w, http.StatusInternalServerError, "failed to write data", err)
-					return
-				}
-			}
+	// 险种列由登记表决定，同名的导出列合并（如单位的医疗与大额医疗）
+	amounts := make([]models.SchemeAmounts, len(rows))
+	for i, row := range rows {
+		amounts[i] = row.Amounts
+	}
+	columns := schemes.Columns(part, amounts...)
+
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+	sheetName := f.GetSheetName(0)
+
+	headers := []string{"序号", "姓名", "证件号码", "部门", "基数"}
+	for _, column := range columns {
+		headers = append(headers, column.Label)
+	}
+	headers = append(headers, "小计")
+	for idx, header := range headers {
+		cell, _ := excelize.CoordinatesToCellName(idx+1, 1)
+		if err := f.SetCellValue(sheetName, cell, header); err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to write header", err)
+			return
 		}
+	}
+
+	var baseTotal, subtotalTotal models.Money
+	columnTotals := make([]models.Money, len(columns))
+	for idx, row := range rows {
+		baseTotal += row.Base
+		subtotalTotal += row.Subtotal
 
-		totalRow := len(charges) + 2
-		totalValues := []any{
-			"合计",
-			"",
-			"",
-			"",
-			baseTotal,
-			pensionTotal,
-			medicalTotal,
-			injuryTotal,
-			unemploymentTotal,
-			subtotalTotal,
-		}
-		for colIdx, value := range totalValues {
-			cell, _ := excelize.CoordinatesToCellName(colIdx+1, totalRow)
-			if err := f.SetCellValue(sheetName, cell, value); err != nil {
-				respondError(w, http.StatusInternalServerError, "failed to write total row", err)
+		values := []any{idx + 1, row.Name, row.IDNumber, row.Department, row.Base}
+		for colIdx, column := range columns {
+			amount := column.Sum(row.Amounts)
+			columnTotals[colIdx] += amount
+			values = append(values, amount)
+		}
+		values = append(values, row.Subtotal)
+		for colIdx, value := range values {
+			cell, _ := excelize.CoordinatesToCellName(colIdx+1, idx+2)
+			if err := f.SetCellValue(sheetName, cell, cellValue(value)); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to write data", err)
 				return
 			}
 		}
 	}
 
+	totalRow := len(rows) + 2
+	totalValues := []any{"合计", "", "", "", baseTotal}
+	for _, total := range columnTotals {
+		totalValues = append(totalValues, total)
+	}
+	totalValues = append(totalValues, subtotalTotal)
+	for colIdx, value := range totalValues {
+		cell, _ := excelize.CoordinatesToCellName(colIdx+1, totalRow)
+		if err := f.SetCellValue(sheetName, cell, cellValue(value)); err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to write total row", err)
+			return
+		}
+	}
+
+	watermark, err := h.applyApprovalWatermark(f, period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load approval", err)
+		return
+	}
+
 	var buf bytes.Buffer
 	if err := f.Write(&buf); err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to encode excel", err)
 		return
 	}
 
-	filename := fmt.Sprintf("%s-%s扣款明细.xlsx", period.YearMonth, label)
+	suffix := "（" + watermark + "）"
+	if period.Provisional {
+		suffix = "（预估）" + suffix
+	}
+	filename := fmt.Sprintf("%s-%s扣款明细%s.xlsx", period.YearMonth, label, suffix)
 	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 	http.ServeContent(w, r, filename, time.Now(), bytes.NewReader(buf.Bytes()))
@@ -967,6 +1090,31 @@ func (h *Handler) getPeriodByParam(r *http.Request) (*models.Period, error) {
 	return &period, nil
 }
 
+// parseOptionsFromForm 读取上传表单中的解析选项：header_profile_id、max_rejected_rows 与 duplicate_policy
+func (h *Handler) parseOptionsFromForm(r *http.Request, kind models.HeaderProfileKind) (service.ParseOptions, error) {
+	var opts service.ParseOptions
+	spec, err := h.loadHeaderSpec(r, kind)
+	if err != nil {
+		return opts, err
+	}
+	opts.Header = spec
+
+	if raw := strings.TrimSpace(r.FormValue("max_rejected_rows")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return opts, fmt.Errorf("invalid max_rejected_rows: %s", raw)
+		}
+		opts.MaxRejectedRows = limit
+	}
+
+	policy, err := service.ParseDuplicatePolicy(r.FormValue("duplicate_policy"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Duplicates = policy
+	return opts, nil
+}
+
 func respondJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -986,19 +1134,6 @@ func respondError(w http.ResponseWriter, status int, message string, err error)
 	respondJSON(w, status, resp)
 }
 
-func isValidScheme(scheme models.Scheme) bool {
-	switch scheme {
-	case models.SchemePension,
-		models.SchemeMedical,
-		models.SchemeSeriousIllness,
-		models.SchemeUnemployment,
-		models.SchemeInjury:
-		return true
-	default:
-		return false
-	}
-}
-
 func isValidPart(part models.Part) bool {
 	switch part {
 	case models.PartPersonal, models.PartUnit:
@@ -1039,11 +1174,11 @@ func (h *Handler) downloadRosterTemplate(w http.ResponseWriter, r *http.Request)
 }
 
 type SchemeChargeDetail struct {
-	Name       string  `json:"name"`
-	IDNumber   string  `json:"id_number"`
-	Department string  `json:"department"`
-	Base       float64 `json:"base"`
-	Amount     float64 `json:"amount"`
+	Name       string       `json:"name"`
+	IDNumber   string       `json:"id_number"`
+	Department string       `json:"department"`
+	Base       models.Money `json:"base"`
+	Amount     models.Money `json:"amount"`
 }
 
 func (h *Handler) getSchemeCharges(w http.ResponseWriter, r *http.Request) {
@@ -1083,7 +1218,12 @@ func (h *Handler) getSchemeCharges(w http.ResponseWriter, r *http.Request) {
 	scheme := models.Scheme(schemeStr)
 	part := models.Part(partStr)
 
-	if !isValidScheme(scheme) || !isValidPart(part) {
+	schemes, err := h.periodSchemes(period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
+		return
+	}
+	if !schemes.Applies(scheme, part) || !isValidPart(part) {
 		respondError(w, http.StatusBadRequest, "invalid scheme or part value", nil)
 		return
 	}
@@ -1102,19 +1242,7 @@ func (h *Handler) getSchemeCharges(w http.ResponseWriter, r *http.Request) {
 		}
 
 		for _, charge := range charges {
-			var amount float64
-			switch scheme {
-			case models.SchemePension:
-				amount = charge.Pension
-			case models.SchemeMedical:
-				amount = charge.MedicalMaternity
-			case models.SchemeSeriousIllness:
-				amount = charge.SeriousIllness
-			case models.SchemeUnemployment:
-				amount = charge.Unemployment
-			default:
-				continue
-			}
+			amount := charge.AmountsByScheme()[scheme]
 
 			details = append(details, SchemeChargeDetail{
 				Name:       charge.Name,
@@ -1136,21 +1264,7 @@ func (h *Handler) getSchemeCharges(w http.ResponseWriter, r *http.Request) {
 		}
 
 		for _, charge := range charges {
-			var amount float64
-			switch scheme {
-			case models.SchemePension:
-				amount = charge.Pension
-			case models.SchemeMedical:
-				amount = charge.MedicalMaternity
-			case models.SchemeSeriousIllness:
-				amount = charge.SeriousIllness
-			case models.SchemeUnemployment:
-				amount = charge.Unemployment
-			case models.SchemeInjury:
-				amount = charge.Injury
-			default:
-				continue
-			}
+			amount := charge.AmountsByScheme()[scheme]
 
 			details = append(details, SchemeChargeDetail{
 				Name:       charge.Name,
@@ -1185,7 +1299,12 @@ func (h *Handler) exportSchemeChargesExcel(w http.ResponseWriter, r *http.Reques
 
 	scheme := models.Scheme(schemeStr)
 	part := models.Part(partStr)
-	if !isValidScheme(scheme) || !isValidPart(part) {
+	schemes, err := h.periodSchemes(period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
+		return
+	}
+	if !schemes.Applies(scheme, part) || !isValidPart(part) {
 		respondError(w, http.StatusBadRequest, "invalid scheme or part value", nil)
 		return
 	}
@@ -1214,19 +1333,7 @@ func (h *Handler) exportSchemeChargesExcel(w http.ResponseWriter, r *http.Reques
 		}
 
 		for _, charge := range charges {
-			var amount float64
-			switch scheme {
-			case models.SchemePension:
-				amount = charge.Pension
-			case models.SchemeMedical:
-				amount = charge.MedicalMaternity
-			case models.SchemeSeriousIllness:
-				amount = charge.SeriousIllness
-			case models.SchemeUnemployment:
-				amount = charge.Unemployment
-			default:
-				continue
-			}
+			amount := charge.AmountsByScheme()[scheme]
 
 			if amount > 0 {
 				details = append(details, SchemeChargeDetail{
@@ -1246,21 +1353,7 @@ func (h *Handler) exportSchemeChargesExcel(w http.ResponseWriter, r *http.Reques
 		}
 
 		for _, charge := range charges {
-			var amount float64
-			switch scheme {
-			case models.SchemePension:
-				amount = charge.Pension
-			case models.SchemeMedical:
-				amount = charge.MedicalMaternity
-			case models.SchemeSeriousIllness:
-				amount = charge.SeriousIllness
-			case models.SchemeUnemployment:
-				amount = charge.Unemployment
-			case models.SchemeInjury:
-				amount = charge.Injury
-			default:
-				continue
-			}
+			amount := charge.AmountsByScheme()[scheme]
 
 			if amount > 0 {
 				details = append(details, SchemeChargeDetail{
@@ -1280,8 +1373,8 @@ func (h *Handler) exportSchemeChargesExcel(w http.ResponseWriter, r *http.Reques
 	}
 
 	var (
-		baseTotal   float64
-		amountTotal float64
+		baseTotal   models.Money
+		amountTotal models.Money
 	)
 
 	for idx, detail := range details {
@@ -1298,7 +1391,7 @@ func (h *Handler) exportSchemeChargesExcel(w http.ResponseWriter, r *http.Reques
 		}
 		for colIdx, value := range values {
 			cell, _ := excelize.CoordinatesToCellName(colIdx+1, idx+2)
-			if err := f.SetCellValue(sheetName, cell, value); err != nil {
+			if err := f.SetCellValue(sheetName, cell, cellValue(value)); err != nil {
 				respondError(w, http.StatusInternalServerError, "failed to write data", err)
 				return
 			}
@@ -1316,31 +1409,30 @@ func (h *Handler) exportSchemeChargesExcel(w http.ResponseWriter, r *http.Reques
 	}
 	for colIdx, value := range totalValues {
 		cell, _ := excelize.CoordinatesToCellName(colIdx+1, totalRow)
-		if err := f.SetCellValue(sheetName, cell, value); err != nil {
+		if err := f.SetCellValue(sheetName, cell, cellValue(value)); err != nil {
 			respondError(w, http.StatusInternalServerError, "failed to write total row", err)
 			return
 		}
 	}
 
+	watermark, err := h.applyApprovalWatermark(f, period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load approval", err)
+		return
+	}
+
 	var buf bytes.Buffer
 	if err := f.Write(&buf); err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to encode excel", err)
 		return
 	}
 
-	schemeLabels := map[models.Scheme]string{
-		models.SchemePension:        "养老保险",
-		models.SchemeMedical:        "医疗保险",
-		models.SchemeSeriousIllness: "大额医疗",
-		models.SchemeUnemployment:   "失业保险",
-		models.SchemeInjury:         "工伤保险",
-	}
 	partLabels := map[models.Part]string{
 		models.PartPersonal: "个人",
 		models.PartUnit:     "单位",
 	}
 
-	filename := fmt.Sprintf("%s-%s-%s明细.xlsx", period.YearMonth, schemeLabels[scheme], partLabels[part])
+	filename := fmt.Sprintf("%s-%s-%s明细（%s）.xlsx", period.YearMonth, schemes.Name(scheme), partLabels[part], watermark)
 	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 	http.ServeContent(w, r, filename, time.Now(), bytes.NewReader(buf.Bytes()))
@@ -1357,6 +1449,11 @@ func (h *Handler) resetPeriod(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
 	// 在事务中删除所有相关数据
 	err = h.db.Transaction(func(tx *gorm.DB) error {
 		// 删除花名册数据
@@ -1384,15 +1481,23 @@ func (h *Handler) resetPeriod(w http.ResponseWriter, r *http.Request) {
 			return fmt.Errorf("delete unit charges: %w", err)
 		}
 
+		// 删除公积金缴存明细
+		if err := tx.Where("period_id = ?", period.ID).Delete(&models.HousingFundCharge{}).Error; err != nil {
+			return fmt.Errorf("delete housing fund charges: %w", err)
+		}
+
 		// 删除源文件记录
 		if err := tx.Where("period_id = ?", period.ID).Delete(&models.SourceFile{}).Error; err != nil {
 			return fmt.Errorf("delete source files: %w", err)
 		}
 
 		// 重置账期状态
-		if err := tx.Model(period).Update("status", "draft").Error; err != nil {
+		if err := tx.Model(period).Updates(map[string]any{"status": models.PeriodDraft, "provisional": false, "missing_uploads": nil}).Error; err != nil {
 			return fmt.Errorf("reset period status: %w", err)
 		}
+		if err := service.InvalidateApprovals(tx, period.ID); err != nil {
+			return err
+		}
 
 		return nil
 	})
@@ -1402,14 +1507,8 @@ func (h *Handler) resetPeriod(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 删除实际的文件存储目录
-	uploadDir := filepath.Join("./uploads", fmt.Sprintf("%d", period.ID))
-	if _, err := os.Stat(uploadDir); err == nil {
-		if err := os.RemoveAll(uploadDir); err != nil {
-			// 日志记录错误，但不影响API响应
-			fmt.Printf("Warning: failed to remove upload directory %s: %v\n", uploadDir, err)
-		}
-	}
+	// 删除文件存储中的账期文件
+	h.removePeriodFiles(r.Context(), period)
 
 	result := map[string]interface{}{
 		"message":   fmt.Sprintf("账期 %s 已重置，所有数据已清除", period.YearMonth),
@@ -1430,6 +1529,11 @@ func (h *Handler) deletePeriod(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
 	// 在事务中删除账期及其所有相关数据
 	err = h.db.Transaction(func(tx *gorm.DB) error {
 		// 删除花名册数据
@@ -1457,6 +1561,11 @@ func (h *Handler) deletePeriod(w http.ResponseWriter, r *http.Request) {
 			return fmt.Errorf("delete unit charges: %w", err)
 		}
 
+		// 删除公积金缴存明细
+		if err := tx.Where("period_id = ?", period.ID).Delete(&models.HousingFundCharge{}).Error; err != nil {
+			return fmt.Errorf("delete housing fund charges: %w", err)
+		}
+
 		// 删除源文件记录
 		if err := tx.Where("period_id = ?", period.ID).Delete(&models.SourceFile{}).Error; err != nil {
 			return fmt.Errorf("delete source files: %w", err)
@@ -1475,14 +1584,8 @@ func (h *Handler) deletePeriod(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 删除实际的文件存储目录
-	uploadDir := filepath.Join("./uploads", fmt.Sprintf("%d", period.ID))
-	if _, err := os.Stat(uploadDir); err == nil {
-		if err := os.RemoveAll(uploadDir); err != nil {
-			// 日志记录错误，但不影响API响应
-			fmt.Printf("Warning: failed to remove upload directory %s: %v\n", uploadDir, err)
-		}
-	}
+	// 删除文件存储中的账期文件
+	h.removePeriodFiles(r.Context(), period)
 
 	result := map[string]interface{}{
 		"message":   fmt.Sprintf("账期 %s 已删除", period.YearMonth),
@@ -1503,6 +1606,11 @@ func (h *Handler) uploadAdjustmentsBatch(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := service.EnsureAdjustmentsAllowed(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
 	if err := r.ParseMultipartForm(128 << 20); err != nil {
 		respondError(w, http.StatusBadRequest, "failed to parse multipart form", err)
 		return
@@ -1516,77 +1624,43 @@ func (h *Handler) uploadAdjustmentsBatch(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 去除重复文件 (相同文件名和大小)
-	files := deduplicateFiles(originalFiles)
-
-	if err := os.MkdirAll("./uploads", 0o755); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to prepare upload directory", err)
+	opts, err := h.parseOptionsFromForm(r, models.HeaderProfileSource)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid parse options", err)
 		return
 	}
-	targetDir := filepath.Join("./uploads", fmt.Sprintf("%d", period.ID), "adjustments")
-	if err := os.MkdirAll(targetDir, 0o755); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to create adjustment upload dir", err)
+
+	if opts.Schemes, err = h.periodSchemes(period); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
 		return
 	}
 
+	// 去除重复文件 (相同文件名和大小)
+	files := deduplicateFiles(originalFiles)
+
+	prefix := h.periodPrefix(period, "adjustments")
+
 	items := make([]batchUploadItem, 0, len(files))
 	for _, header := range files {
 		item := batchUploadItem{
 			OriginalName: header.Filename,
 		}
 
-		// 从文件名解析险种和缴费部分
-		scheme, part, err := parseAdjustmentFileName(header.Filename)
-		if err != nil {
-			item.Error = fmt.Sprintf("解析文件名失败: %v", err)
-			items = append(items, item)
-			continue
-		}
-
-		item.Scheme = scheme
-		item.Part = part
-
-		src, err := header.Open()
-		if err != nil {
-			item.Error = fmt.Sprintf("open file: %v", err)
-			items = append(items, item)
-			continue
-		}
-
-		ext := filepath.Ext(header.Filename)
-		if ext == "" {
-			ext = ".xlsx"
-		}
-		filename := fmt.Sprintf("%s%s", uuid.NewString(), ext)
-		storedPath := filepath.Join(targetDir, filename)
-
-		out, err := os.Create(storedPath)
-		if err != nil {
-			item.Error = fmt.Sprintf("create file: %v", err)
-			_ = src.Close()
-			items = append(items, item)
-			continue
-		}
-
-		if _, err := io.Copy(out, src); err != nil {
-			item.Error = fmt.Sprintf("save file: %v", err)
-			_ = src.Close()
-			_ = out.Close()
-			items = append(items, item)
-			continue
-		}
-		_ = src.Close()
-		_ = out.Close()
-
-		result, err := h.process.ParseAdjustmentFile(period.ID, period.UserID, storedPath, header.Filename, scheme, part)
-		if err != nil {
+		key := uploadKey(prefix, "", header.Filename)
+		if err := h.saveUpload(r.Context(), key, header); err != nil {
 			item.Error = err.Error()
 			items = append(items, item)
 			continue
 		}
 
-		item.FileName = filepath.Base(result.File.StoredPath)
-		item.Imported = result.Imported
+		// 按文件名（如“职工基本养老保险(个人缴纳)_2025-01至2025-01_未申报信息明细”）与内容识别险种和缴费部分
+		classification, result, err := h.process.ParseClassifiedFile(period.ID, period.UserID, key, header.Filename, models.FileTypeAdjustment, "", "", opts)
+		item.ApplyClassifiedResult(classification, result, err)
+		// 无法识别险种的文件不会导入，不保留
+		var ambiguousErr *service.AmbiguousFileError
+		if errors.As(err, &ambiguousErr) {
+			_ = h.store.Delete(r.Context(), key)
+		}
 		items = append(items, item)
 	}
 
@@ -1614,52 +1688,18 @@ func (h *Handler) processAdjustments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	output, err := h.process.ProcessAdjustments(period.ID)
-	if err != nil {
-		respondError(w, http.StatusBadRequest, "failed to process adjustments", err)
+	if err := service.EnsureAdjustmentsAllowed(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, output)
-}
-
-// parseAdjustmentFileName 从补退文件名中解析险种和缴费部分
-// 文件名格式: 张英俊职工基本养老保险(个人缴纳)_2025-01至2025-01_未申报信息明细.xlsx
-func parseAdjustmentFileName(filename string) (models.Scheme, models.Part, error) {
-	// 移除扩展名
-	name := strings.TrimSuffix(filename, filepath.Ext(filename))
-
-	// 提取险种信息
-	var scheme models.Scheme
-	var part models.Part
-
-	if strings.Contains(name, "职工基本养老保险") || strings.Contains(name, "养老保险") {
-		scheme = models.SchemePension
-	} else if strings.Contains(name, "失业保险") {
-		scheme = models.SchemeUnemployment
-	} else if strings.Contains(name, "工伤保险") {
-		scheme = models.SchemeInjury
-	} else if strings.Contains(name, "医疗保险") {
-		scheme = models.SchemeMedical
-	} else if strings.Contains(name, "大额医疗") {
-		scheme = models.SchemeSeriousIllness
-	} else {
-		return "", "", fmt.Errorf("无法识别险种类型")
-	}
-
-	// 提取缴费部分
-	if strings.Contains(name, "(个人缴纳)") || strings.Contains(name, "个人缴纳") {
-		part = models.PartPersonal
-	} else if strings.Contains(name, "(单位缴纳)") || strings.Contains(name, "单位缴纳") {
-		part = models.PartUnit
-	} else if scheme == models.SchemeInjury {
-		// 工伤保险只有单位缴纳
-		part = models.PartUnit
-	} else {
-		return "", "", fmt.Errorf("无法识别缴费部分")
+	job, err := h.jobs.Enqueue(period.UserID, &period.ID, models.JobProcessAdjustments, service.PeriodJobPayload{PeriodID: period.ID})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to enqueue process adjustments job", err)
+		return
 	}
 
-	return scheme, part, nil
+	respondJSON(w, http.StatusAccepted, job)
 }
 
 func (h *Handler) clearFiles(w http.ResponseWriter, r *http.Request) {
@@ -1673,6 +1713,11 @@ func (h *Handler) clearFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
 	// 在事务中清除正常社保文件相关数据
 	err = h.db.Transaction(func(tx *gorm.DB) error {
 		// 删除正常社保文件的原始记录
@@ -1695,11 +1740,24 @@ func (h *Handler) clearFiles(w http.ResponseWriter, r *http.Request) {
 			return fmt.Errorf("delete normal unit charges: %w", err)
 		}
 
+		// 删除公积金缴存明细（公积金文件随正常社保文件一起清除）
+		if err := tx.Where("period_id = ?", period.ID).Delete(&models.HousingFundCharge{}).Error; err != nil {
+			return fmt.Errorf("delete housing fund charges: %w", err)
+		}
+
 		// 删除正常社保文件记录
 		if err := tx.Where("period_id = ? AND file_type = ?", period.ID, models.FileTypeNormal).Delete(&models.SourceFile{}).Error; err != nil {
 			return fmt.Errorf("delete normal source files: %w", err)
 		}
 
+		// 缴费文件已清空，账期回到草稿
+		if err := tx.Model(period).Updates(map[string]any{"status": models.PeriodDraft, "provisional": false, "missing_uploads": nil}).Error; err != nil {
+			return fmt.Errorf("reset period status: %w", err)
+		}
+		if err := service.InvalidateApprovals(tx, period.ID); err != nil {
+			return err
+		}
+
 		return nil
 	})
 
@@ -1727,6 +1785,11 @@ func (h *Handler) clearAdjustments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
 	// 在事务中清除补退文件相关数据
 	err = h.db.Transaction(func(tx *gorm.DB) error {
 		// 删除补退文件的原始记录
@@ -1754,6 +1817,11 @@ func (h *Handler) clearAdjustments(w http.ResponseWriter, r *http.Request) {
 			return fmt.Errorf("delete adjustment source files: %w", err)
 		}
 
+		// 补退汇总已清除，已审核的账期须重新审核
+		if err := tx.Model(period).Where("status = ?", models.PeriodReviewed).Update("status", models.PeriodProcessed).Error; err != nil {
+			return fmt.Errorf("update period status: %w", err)
+		}
+
 		return nil
 	})
 
@@ -1762,13 +1830,8 @@ func (h *Handler) clearAdjustments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 删除补退文件存储目录
-	adjustmentDir := filepath.Join("./uploads", fmt.Sprintf("%d", period.ID), "adjustments")
-	if _, err := os.Stat(adjustmentDir); err == nil {
-		if err := os.RemoveAll(adjustmentDir); err != nil {
-			fmt.Printf("Warning: failed to remove adjustment directory %s: %v\n", adjustmentDir, err)
-		}
-	}
+	// 删除文件存储中的补退文件
+	h.removePeriodFiles(r.Context(), period, "adjustments")
 
 	result := map[string]interface{}{
 		"message": "补退文件已清空",
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"siapp/internal/auth"
+	"siapp/internal/models"
+	"siapp/internal/service"
+)
+
+type headerProfileRequest struct {
+	Name           string                   `json:"name"`
+	Kind           models.HeaderProfileKind `json:"kind"`
+	Description    string                   `json:"description"`
+	RequiredFields []string                 `json:"required_fields"`
+	Mappings       []headerMappingRequest   `json:"mappings"`
+}
+
+type headerMappingRequest struct {
+	SourceHeader string `json:"source_header"`
+	Field        string `json:"field"`
+}
+
+// toProfile 将请求转换为映射方案模型（不含归属信息）
+func (req headerProfileRequest) toProfile() models.HeaderProfile {
+	kind := req.Kind
+	if kind == "" {
+		kind = models.HeaderProfileSource
+	}
+	profile := models.HeaderProfile{
+		Name:           strings.TrimSpace(req.Name),
+		Kind:           kind,
+		Description:    strings.TrimSpace(req.Description),
+		RequiredFields: req.RequiredFields,
+	}
+	for _, m := range req.Mappings {
+		profile.Mappings = append(profile.Mappings, models.HeaderMapping{
+			SourceHeader: strings.TrimSpace(m.SourceHeader),
+			Field:        strings.TrimSpace(m.Field),
+		})
+	}
+	return profile
+}
+
+// headerProfileScope 返回当前用户可见的映射方案查询：同公司共享，未设置公司时仅限本人
+func (h *Handler) headerProfileScope(r *http.Request) (*gorm.DB, *models.User, error) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return nil, nil, err
+	}
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		return nil, nil, err
+	}
+	query := h.db.Model(&models.HeaderProfile{})
+	if user.CompanyID != "" {
+		query = query.Where("company_id = ?", user.CompanyID)
+	} else {
+		query = query.Where("user_id = ?", user.ID)
+	}
+	return query, &user, nil
+}
+
+func (h *Handler) getHeaderProfileByParam(r *http.Request) (*models.HeaderProfile, error) {
+	query, _, err := h.headerProfileScope(r)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized: %w", err)
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "profileID"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid profileID: %w", err)
+	}
+	var profile models.HeaderProfile
+	if err := query.Preload("Mappings").Where("id = ?", id).First(&profile).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// loadHeaderSpec 根据表单中的 header_profile_id 加载表头映射，未指定时返回 nil（使用内置表头）
+func (h *Handler) loadHeaderSpec(r *http.Request, kind models.HeaderProfileKind) (*service.HeaderSpec, error) {
+	raw := strings.TrimSpace(r.FormValue("header_profile_id"))
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header_profile_id: %w", err)
+	}
+	query, _, err := h.headerProfileScope(r)
+	if err != nil {
+		return nil, err
+	}
+	var profile models.HeaderProfile
+	if err := query.Preload("Mappings").Where("id = ?", id).First(&profile).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("表头映射方案不存在: %d", id)
+		}
+		return nil, err
+	}
+	if profile.Kind != kind {
+		return nil, fmt.Errorf("表头映射方案类型不匹配，需要 %s", kind)
+	}
+	spec := service.HeaderSpecFromProfile(&profile)
+	return &spec, nil
+}
+
+func (h *Handler) listHeaderProfiles(w http.ResponseWriter, r *http.Request) {
+	query, _, err := h.headerProfileScope(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	if kind := strings.TrimSpace(r.URL.Query().Get("kind")); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var profiles []models.HeaderProfile
+	if err := query.Preload("Mappings").Order("name ASC").Find(&profiles).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list header profiles", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, profiles)
+}
+
+// getHeaderProfileDefaults 返回内置表头映射及可用的标准字段，供前端编辑方案时参考
+func (h *Handler) getHeaderProfileDefaults(w http.ResponseWriter, r *http.Request) {
+	kind := models.HeaderProfileKind(strings.TrimSpace(r.URL.Query().Get("kind")))
+	if kind == "" {
+		kind = models.HeaderProfileSource
+	}
+	fields := service.HeaderFields(kind)
+	if fields == nil {
+		respondError(w, http.StatusBadRequest, "invalid kind", nil)
+		return
+	}
+	spec := service.DefaultHeaderSpec(kind)
+	respondJSON(w, http.StatusOK, map[string]any{
+		"kind":     kind,
+		"fields":   fields,
+		"required": spec.Required,
+		"aliases":  spec.Aliases,
+	})
+}
+
+func (h *Handler) getHeaderProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := h.getHeaderProfileByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+	respondJSON(w, http.StatusOK, profile)
+}
+
+func (h *Handler) createHeaderProfile(w http.ResponseWriter, r *http.Request) {
+	_, user, err := h.headerProfileScope(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+
+	var req headerProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	profile := req.toProfile()
+	if err := service.ValidateHeaderProfile(&profile); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	profile.UserID = &user.ID
+	profile.CompanyID = user.CompanyID
+
+	if err := h.db.Create(&profile).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to create header profile", err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, profile)
+}
+
+func (h *Handler) updateHeaderProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := h.getHeaderProfileByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	var req headerProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	updated := req.toProfile()
+	if err := service.ValidateHeaderProfile(&updated); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	profile.Name = updated.Name
+	profile.Kind = updated.Kind
+	profile.Description = updated.Description
+	profile.RequiredFields = updated.RequiredFields
+	profile.Mappings = updated.Mappings
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		// 映射整体替换，避免残留已删除的列名
+		if err := tx.Where("profile_id = ?", profile.ID).Delete(&models.HeaderMapping{}).Error; err != nil {
+			return fmt.Errorf("cleanup mappings: %w", err)
+		}
+		if err := tx.Omit("Mappings").Save(profile).Error; err != nil {
+			return fmt.Errorf("save profile: %w", err)
+		}
+		for i := range profile.Mappings {
+			profile.Mappings[i].ProfileID = profile.ID
+		}
+		if len(profile.Mappings) > 0 {
+			if err := tx.Create(&profile.Mappings).Error; err != nil {
+				return fmt.Errorf("insert mappings: %w", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to update header profile", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, profile)
+}
+
+func (h *Handler) deleteHeaderProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := h.getHeaderProfileByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("profile_id = ?", profile.ID).Delete(&models.HeaderMapping{}).Error; err != nil {
+			return fmt.Errorf("delete mappings: %w", err)
+		}
+		if err := tx.Delete(&models.HeaderProfile{}, profile.ID).Error; err != nil {
+			return fmt.Errorf("delete profile: %w", err)
+		}
+		return nil
+	}); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to delete header profile", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"message": "表头映射方案已删除",
+	})
+}
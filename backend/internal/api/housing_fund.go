@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+	"siapp/internal/service"
+)
+
+// errHousingFundUpload 公积金文件一行同时包含个人与单位缴存额，不能按险种、缴费部分上传
+const errHousingFundUpload = "住房公积金文件请通过 POST /periods/{periodID}/housing-fund 上传"
+
+// uploadHousingFundFile 上传公积金中心的缴存明细，支持 header_profile_id（kind=housing_fund）、
+// max_rejected_rows 与 duplicate_policy 参数；与社保文件一样按版本保存，处理账期时生成公积金缴存明细
+func (h *Handler) uploadHousingFundFile(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
+	if err := r.ParseMultipartForm(64 << 20); err != nil {
+		respondError(w, http.StatusBadRequest, "failed to parse multipart form", err)
+		return
+	}
+
+	opts, err := h.parseOptionsFromForm(r, models.HeaderProfileHousingFund)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid parse options", err)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "file is required", err)
+		return
+	}
+	defer file.Close()
+
+	if !service.IsSupportedSheetFile(header.Filename) {
+		respondError(w, http.StatusBadRequest, "unsupported file type, expected .xlsx, .xls or .csv", nil)
+		return
+	}
+
+	key := uploadKey(h.periodPrefix(period, "housing-fund"), "", header.Filename)
+	if err := h.saveReader(r.Context(), key, file); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to save file", err)
+		return
+	}
+
+	result, err := h.process.ParseHousingFundFile(period.ID, period.UserID, key, header.Filename, opts)
+	if err != nil {
+		var thresholdErr *service.RejectionThresholdError
+		if errors.As(err, &thresholdErr) {
+			respondJSON(w, http.StatusUnprocessableEntity, map[string]any{
+				"error":    "too many rejected rows",
+				"details":  thresholdErr.Error(),
+				"rejected": thresholdErr.Rejected,
+				"issues":   thresholdErr.Issues,
+			})
+			return
+		}
+		var duplicateErr *service.DuplicateFileError
+		if errors.As(err, &duplicateErr) {
+			respondJSON(w, http.StatusConflict, map[string]any{
+				"error":      "duplicate file content",
+				"details":    duplicateErr.Error(),
+				"duplicates": duplicateErr.Matches,
+			})
+			return
+		}
+		respondError(w, http.StatusBadRequest, "failed to parse file", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, result)
+}
+
+// getHousingFund 返回账期的公积金汇总（个人、单位各一行）与每人的缴存明细
+func (h *Handler) getHousingFund(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	var summaries []models.PeriodSummary
+	if err := h.db.Where("period_id = ? AND scheme = ?", period.ID, models.SchemeHousingFund).Order("part").Find(&summaries).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to fetch housing fund summary", err)
+		return
+	}
+	var charges []models.HousingFundCharge
+	if err := h.db.Where("period_id = ?", period.ID).Order("id_number ASC").Find(&charges).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to fetch housing fund charges", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"summary": summaries,
+		"charges": charges,
+	})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"siapp/internal/auth"
+	"siapp/internal/models"
+)
+
+const (
+	defaultJobListLimit = 50
+	maxJobListLimit     = 200
+)
+
+// listJobs 查询当前用户的后台任务，支持 status、type、period_id、limit 过滤
+func (h *Handler) listJobs(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+
+	query := h.db.Where("user_id = ?", userID)
+	q := r.URL.Query()
+	if status := strings.TrimSpace(q.Get("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType := strings.TrimSpace(q.Get("type")); jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+	if raw := strings.TrimSpace(q.Get("period_id")); raw != "" {
+		periodID, err := strconv.Atoi(raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid period_id", err)
+			return
+		}
+		query = query.Where("period_id = ?", periodID)
+	}
+	limit := defaultJobListLimit
+	if raw := strings.TrimSpace(q.Get("limit")); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid limit", err)
+			return
+		}
+		if limit > maxJobListLimit {
+			limit = maxJobListLimit
+		}
+	}
+
+	// 列表不返回结果内容，避免大批量上传结果拖慢轮询
+	var jobs []models.Job
+	if err := query.Omit("result", "payload").Order("id DESC").Limit(limit).Find(&jobs).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list jobs", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, jobs)
+}
+
+func (h *Handler) getJob(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "jobID"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid jobID", err)
+		return
+	}
+
+	var job models.Job
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&job).Error; err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, "failed to fetch job", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, job)
+}
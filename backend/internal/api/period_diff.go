@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+	"siapp/internal/service"
+)
+
+// loadPeriodDiff 读取账期与比较基准账期（against 参数，缺省为上一个账期）并计算变化，出错时直接写入响应
+func (h *Handler) loadPeriodDiff(w http.ResponseWriter, r *http.Request) (*models.Period, *service.PeriodDiff, bool) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return nil, nil, false
+	}
+
+	var against *models.Period
+	if param := r.URL.Query().Get("against"); param != "" {
+		id, err := strconv.Atoi(param)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid against", err)
+			return nil, nil, false
+		}
+		if uint(id) == period.ID {
+			respondError(w, http.StatusBadRequest, "不能与账期自身比较", nil)
+			return nil, nil, false
+		}
+		var other models.Period
+		if err := h.db.Where("id = ? AND user_id = ?", id, period.UserID).First(&other).Error; err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				status = http.StatusNotFound
+			}
+			respondError(w, status, "比较的账期不存在", err)
+			return nil, nil, false
+		}
+		against = &other
+	} else {
+		against, err = h.process.PreviousPeriod(period)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrNoPreviousPeriod) {
+				status = http.StatusNotFound
+			}
+			respondError(w, status, err.Error(), err)
+			return nil, nil, false
+		}
+	}
+
+	diff, err := h.process.DiffPeriods(period, against)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), err)
+		return nil, nil, false
+	}
+	return period, diff, true
+}
+
+// getPeriodDiff 账期环比变化：增员、减员、基数变化、各险种金额变化与部门调动
+func (h *Handler) getPeriodDiff(w http.ResponseWriter, r *http.Request) {
+	_, diff, ok := h.loadPeriodDiff(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, diff)
+}
+
+// diffSheet 导出中的一个工作表，最后一行为合计
+type diffSheet struct {
+	name    string
+	headers []string
+	rows    [][]any
+}
+
+// exportPeriodDiffExcel 导出账期环比变化，每部分一个工作表
+func (h *Handler) exportPeriodDiffExcel(w http.ResponseWriter, r *http.Request) {
+	period, diff, ok := h.loadPeriodDiff(w, r)
+	if !ok {
+		return
+	}
+
+	overview := diffSheet{name: "险种汇总", headers: []string{"险种", "缴费部分", diff.AgainstYearMonth, diff.YearMonth, "变化", "其中增员", "其中减员", "其中在册变化"}}
+	for _, t := range diff.AmountChanges.Totals {
+		overview.rows = append(overview.rows, []any{t.SchemeName, partName(t.Part), t.Before, t.After, t.Delta, t.Additions, t.Removals, t.Changes})
+	}
+	for _, t := range diff.Totals {
+		overview.rows = append(overview.rows, []any{"合计", partName(t.Part), t.Before, t.After, t.Delta})
+	}
+	for _, t := range diff.Totals {
+		overview.rows = append(overview.rows, []any{"补退", partName(t.Part), t.AdjustmentBefore, t.AdjustmentAfter, t.AdjustmentAfter - t.AdjustmentBefore})
+	}
+
+	peopleSheet := func(name string, section service.DiffPeopleSection) diffSheet {
+		sheet := diffSheet{name: name, headers: []string{"证件号码", "姓名", "部门", "个人缴费基数", "单位缴费基数", "个人扣款", "单位扣款"}}
+		for _, p := range section.People {
+			sheet.rows = append(sheet.rows, []any{p.IDNumber, p.Name, p.Department, p.PersonalBase, p.UnitBase, p.Personal, p.Unit})
+		}
+		sheet.rows = append(sheet.rows, []any{fmt.Sprintf("合计 %d 人", section.Count), "", "", "", "", section.PersonalTotal, section.UnitTotal})
+		return sheet
+	}
+
+	bases := diffSheet{name: "基数变化", headers: []string{"证件号码", "姓名", "部门", "缴费部分", diff.AgainstYearMonth, diff.YearMonth, "变化"}}
+	for _, c := range diff.BaseChanges.Changes {
+		bases.rows = append(bases.rows, []any{c.IDNumber, c.Name, c.Department, partName(c.Part), c.Before, c.After, c.Delta})
+	}
+	bases.rows = append(bases.rows,
+		[]any{fmt.Sprintf("合计 %d 项", diff.BaseChanges.Count), "", "", partName(models.PartPersonal), "", "", diff.BaseChanges.PersonalDelta},
+		[]any{"", "", "", partName(models.PartUnit), "", "", diff.BaseChanges.UnitDelta})
+
+	amounts := diffSheet{name: "金额变化", headers: []string{"证件号码", "姓名", "部门", "险种", "缴费部分", diff.AgainstYearMonth, diff.YearMonth, "变化"}}
+	var amountDelta models.Money
+	for _, c := range diff.AmountChanges.Changes {
+		amounts.rows = append(amounts.rows, []any{c.IDNumber, c.Name, c.Department, c.SchemeName, partName(c.Part), c.Before, c.After, c.Delta})
+		amountDelta += c.Delta
+	}
+	amounts.rows = append(amounts.rows, []any{fmt.Sprintf("合计 %d 项", diff.AmountChanges.Count), "", "", "", "", "", "", amountDelta})
+
+	moves := diffSheet{name: "部门调动", headers: []string{"证件号码", "姓名", "原部门", "现部门"}}
+	for _, m := range diff.DepartmentMoves.Moves {
+		moves.rows = append(moves.rows, []any{m.IDNumber, m.Name, m.From, m.To})
+	}
+	moves.rows = append(moves.rows, []any{fmt.Sprintf("合计 %d 人", diff.DepartmentMoves.Count)})
+
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+	sheets := []diffSheet{overview, peopleSheet("增员", diff.Additions), peopleSheet("减员", diff.Removals), bases, amounts, moves}
+	for idx, sheet := range sheets {
+		if idx == 0 {
+			if err := f.SetSheetName(f.GetSheetName(0), sheet.name); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to create sheet", err)
+				return
+			}
+		} else if _, err := f.NewSheet(sheet.name); err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to create sheet", err)
+			return
+		}
+		for colIdx, header := range sheet.headers {
+			cell, _ := excelize.CoordinatesToCellName(colIdx+1, 1)
+			if err := f.SetCellValue(sheet.name, cell, header); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to write header", err)
+				return
+			}
+		}
+		for rowIdx, row := range sheet.rows {
+			for colIdx, value := range row {
+				cell, _ := excelize.CoordinatesToCellName(colIdx+1, rowIdx+2)
+				if err := f.SetCellValue(sheet.name, cell, cellValue(value)); err != nil {
+					respondError(w, http.StatusInternalServerError, "failed to write data", err)
+					return
+				}
+			}
+		}
+	}
+
+	watermark, err := h.applyApprovalWatermark(f, period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load approval", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to encode excel", err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-环比%s变化（%s）.xlsx", period.YearMonth, diff.AgainstYearMonth, watermark)
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	http.ServeContent(w, r, filename, time.Now(), bytes.NewReader(buf.Bytes()))
+}
+
+// partName 缴费部分的中文名称
+func partName(part models.Part) string {
+	if part == models.PartPersonal {
+		return "个人"
+	}
+	return "单位"
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/auth"
+	"siapp/internal/service"
+)
+
+// periodStateStatus 账期状态不允许操作时的响应码：未开启补退为 403，其余（已关账、状态不符）为 409
+func periodStateStatus(err error) int {
+	if errors.Is(err, service.ErrAdjustmentsNotAllowed) {
+		return http.StatusForbidden
+	}
+	return http.StatusConflict
+}
+
+type reopenPeriodRequest struct {
+	Reason string `json:"reason"`
+}
+
+// reviewPeriod 审核账期：processed → reviewed，预估处理的结果不能审核
+func (h *Handler) reviewPeriod(w http.ResponseWriter, r *http.Request) {
+	h.transitionPeriod(w, r, service.TransitionReview, "")
+}
+
+// closePeriod 关账：reviewed → closed，关账后拒绝上传、处理、清空与重置
+func (h *Handler) closePeriod(w http.ResponseWriter, r *http.Request) {
+	h.transitionPeriod(w, r, service.TransitionClose, "")
+}
+
+// reopenPeriod 重新打开已关账的账期：closed → reviewed，必须填写原因，原因写入审计日志
+func (h *Handler) reopenPeriod(w http.ResponseWriter, r *http.Request) {
+	var req reopenPeriodRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	h.transitionPeriod(w, r, service.TransitionReopen, req.Reason)
+}
+
+func (h *Handler) transitionPeriod(w http.ResponseWriter, r *http.Request, transition service.PeriodTransition, reason string) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+
+	if err := h.process.TransitionPeriod(period, transition, &userID, reason); err != nil {
+		var transitionErr *service.PeriodTransitionError
+		switch {
+		case errors.As(err, &transitionErr), errors.Is(err, service.ErrProvisionalPeriod), errors.Is(err, service.ErrApprovalRequired):
+			respondError(w, http.StatusConflict, err.Error(), nil)
+		case errors.Is(err, service.ErrReopenReasonRequired):
+			respondError(w, http.StatusBadRequest, err.Error(), nil)
+		default:
+			respondError(w, http.StatusInternalServerError, "failed to update period status", err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, period)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// getReconciliation 核对账期花名册与社保局文件：险种文件缺失、不在花名册、姓名或部门不一致、单位与个人缴费不一致
+func (h *Handler) getReconciliation(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	report, err := h.process.ReconcilePeriod(period.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to reconcile period", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// exportReconciliationExcel 导出核对结果，每项问题一行，可在 Excel 中按类型筛选
+func (h *Handler) exportReconciliationExcel(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	report, err := h.process.ReconcilePeriod(period.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to reconcile period", err)
+		return
+	}
+
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+	sheetName := f.GetSheetName(0)
+
+	headers := []string{"序号", "问题类型", "证件号码", "姓名（花名册）", "姓名（社保局）", "部门（花名册）", "部门（社保局）", "说明"}
+	for idx, header := range headers {
+		cell, _ := excelize.CoordinatesToCellName(idx+1, 1)
+		if err := f.SetCellValue(sheetName, cell, header); err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to write header", err)
+			return
+		}
+	}
+	for idx, item := range report.Items {
+		values := []any{idx + 1, item.Kind.Label(), item.IDNumber, item.RosterName, item.BureauName, item.RosterDepartment, item.BureauDepartment, item.Detail}
+		for colIdx, value := range values {
+			cell, _ := excelize.CoordinatesToCellName(colIdx+1, idx+2)
+			if err := f.SetCellValue(sheetName, cell, value); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to write data", err)
+				return
+			}
+		}
+	}
+	if err := f.AutoFilter(sheetName, fmt.Sprintf("A1:H%d", len(report.Items)+1), nil); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to set filter", err)
+		return
+	}
+
+	watermark, err := h.applyApprovalWatermark(f, period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load approval", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to encode excel", err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-花名册核对（%s）.xlsx", period.YearMonth, watermark)
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	http.ServeContent(w, r, filename, time.Now(), bytes.NewReader(buf.Bytes()))
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"siapp/internal/auth"
+	"siapp/internal/models"
+	"siapp/internal/service"
+)
+
+type schemeDefinitionRequest struct {
+	Code           models.Scheme `json:"code"`
+	Name           string        `json:"name"`
+	Parts          []models.Part `json:"parts"`
+	Required       bool          `json:"required"`
+	PersonalColumn string        `json:"personal_column"`
+	UnitColumn     string        `json:"unit_column"`
+	Keywords       []string      `json:"keywords"`
+	SortOrder      int           `json:"sort_order"`
+	Enabled        *bool         `json:"enabled"`
+}
+
+// toDefinition 将请求转换为险种模型（不含归属信息），未指定 enabled 时默认启用
+func (req schemeDefinitionRequest) toDefinition() models.SchemeDefinition {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return models.SchemeDefinition{
+		Code:           req.Code,
+		Name:           req.Name,
+		Parts:          req.Parts,
+		Required:       req.Required,
+		PersonalColumn: req.PersonalColumn,
+		UnitColumn:     req.UnitColumn,
+		Keywords:       req.Keywords,
+		SortOrder:      req.SortOrder,
+		Enabled:        enabled,
+	}
+}
+
+// currentUser 读取当前登录用户
+func (h *Handler) currentUser(r *http.Request) (*models.User, error) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// periodSchemes 加载账期所属用户的险种登记表
+func (h *Handler) periodSchemes(period *models.Period) (*service.SchemeRegistry, error) {
+	return service.LoadSchemeRegistry(h.db, period.UserID)
+}
+
+func (h *Handler) getSchemeDefinitionByParam(r *http.Request) (*models.SchemeDefinition, error) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized: %w", err)
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "schemeID"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schemeID: %w", err)
+	}
+	var def models.SchemeDefinition
+	if err := service.SchemeDefinitionScope(h.db, user).Where("id = ?", id).First(&def).Error; err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// schemeCodeTaken 判断同一公司（或个人）是否已有相同代码的自定义险种
+func (h *Handler) schemeCodeTaken(user *models.User, code models.Scheme, excludeID uint) (bool, error) {
+	var count int64
+	err := service.SchemeDefinitionScope(h.db, user).
+		Where("code = ? AND id <> ?", code, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// listSchemes 返回当前公司的险种登记表：内置险种与自定义险种合并后的结果，含已停用的险种
+func (h *Handler) listSchemes(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	registry, err := service.LoadSchemeRegistry(h.db, &user.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, registry.All())
+}
+
+// createScheme 新增险种；代码与内置险种相同时覆盖内置设置（如停用大额医疗、调整导出列名）
+func (h *Handler) createScheme(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+
+	var req schemeDefinitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	def := req.toDefinition()
+	if err := service.ValidateSchemeDefinition(&def); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	taken, err := h.schemeCodeTaken(user, def.Code, 0)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to check scheme code", err)
+		return
+	}
+	if taken {
+		respondError(w, http.StatusConflict, fmt.Sprintf("险种代码已存在: %s", def.Code), nil)
+		return
+	}
+	def.UserID = &user.ID
+	def.CompanyID = user.CompanyID
+
+	if err := h.db.Create(&def).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to create scheme", err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, def)
+}
+
+// updateScheme 修改自定义险种，险种代码不可修改（已导入的记录与扣款明细按代码关联）
+func (h *Handler) updateScheme(w http.ResponseWriter, r *http.Request) {
+	def, err := h.getSchemeDefinitionByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	var req schemeDefinitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body", err)
+		return
+	}
+	if req.Code == "" {
+		req.Code = def.Code
+	}
+	updated := req.toDefinition()
+	if err := service.ValidateSchemeDefinition(&updated); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if updated.Code != def.Code {
+		respondError(w, http.StatusBadRequest, "险种代码不可修改", nil)
+		return
+	}
+
+	def.Name = updated.Name
+	def.Parts = updated.Parts
+	def.Required = updated.Required
+	def.PersonalColumn = updated.PersonalColumn
+	def.UnitColumn = updated.UnitColumn
+	def.Keywords = updated.Keywords
+	def.SortOrder = updated.SortOrder
+	def.Enabled = updated.Enabled
+	if err := h.db.Save(def).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to update scheme", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, def)
+}
+
+// deleteScheme 删除自定义险种；覆盖内置险种的记录删除后恢复内置设置
+func (h *Handler) deleteScheme(w http.ResponseWriter, r *http.Request) {
+	def, err := h.getSchemeDefinitionByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	if err := h.db.Delete(&models.SchemeDefinition{}, def.ID).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to delete scheme", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"message": "险种已删除",
+	})
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+	"siapp/internal/service"
+	"siapp/internal/storage"
+)
+
+// sheetContentTypes 原始文件按扩展名返回的 Content-Type
+var sheetContentTypes = map[string]string{
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xls":  "application/vnd.ms-excel",
+	".csv":  "text/csv",
+}
+
+// getSourceFileByParam 读取路由中 fileID 对应的源文件，只在所属账期内查找
+func (h *Handler) getSourceFileByParam(r *http.Request, period *models.Period) (*models.SourceFile, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "fileID"))
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid fileID: %s", chi.URLParam(r, "fileID"))
+	}
+	return h.process.GetSourceFile(period.ID, uint(id))
+}
+
+// attachmentDisposition 生成附件下载头，中文文件名按 RFC 2231 编码为 filename*
+func attachmentDisposition(name string) string {
+	if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": name}); disposition != "" {
+		return disposition
+	}
+	return "attachment"
+}
+
+// downloadSourceFile 以原文件名返回导入时保存的原始文件，供审计追溯
+func (h *Handler) downloadSourceFile(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	file, err := h.getSourceFileByParam(r, period)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, "failed to fetch file", err)
+		return
+	}
+	if file.PurgedAt != nil {
+		respondError(w, http.StatusGone, service.ErrStoredFileMissing.Error(), nil)
+		return
+	}
+
+	rc, err := h.store.Open(r.Context(), file.StoredPath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			respondError(w, http.StatusGone, service.ErrStoredFileMissing.Error(), nil)
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "failed to open stored file", err)
+		return
+	}
+	defer rc.Close()
+
+	name := file.OriginalName
+	if name == "" {
+		name = file.FileName
+	}
+	contentType, ok := sheetContentTypes[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", attachmentDisposition(name))
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, rc)
+}
+
+// reparseSourceFile 使用当前的表头映射重新解析已保存的原始文件（解析器修复后补救历史导入）。
+// 支持与上传相同的 header_profile_id、max_rejected_rows 与 duplicate_policy 参数
+func (h *Handler) reparseSourceFile(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
+	file, err := h.getSourceFileByParam(r, period)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, "failed to fetch file", err)
+		return
+	}
+
+	opts, err := h.parseOptionsFromForm(r, models.HeaderProfileSource)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid parse options", err)
+		return
+	}
+
+	result, err := h.process.ReparseSourceFile(period.ID, file.ID, opts)
+	if err != nil {
+		if errors.Is(err, service.ErrStoredFileMissing) {
+			respondError(w, http.StatusGone, err.Error(), nil)
+			return
+		}
+		if errors.Is(err, service.ErrPeriodClosed) || errors.Is(err, service.ErrAdjustmentsNotAllowed) {
+			respondError(w, periodStateStatus(err), err.Error(), nil)
+			return
+		}
+		var thresholdErr *service.RejectionThresholdError
+		if errors.As(err, &thresholdErr) {
+			respondJSON(w, http.StatusUnprocessableEntity, map[string]any{
+				"error":    "too many rejected rows",
+				"details":  thresholdErr.Error(),
+				"rejected": thresholdErr.Rejected,
+				"issues":   thresholdErr.Issues,
+			})
+			return
+		}
+		var duplicateErr *service.DuplicateFileError
+		if errors.As(err, &duplicateErr) {
+			respondJSON(w, http.StatusConflict, map[string]any{
+				"error":      "duplicate file content",
+				"details":    duplicateErr.Error(),
+				"duplicates": duplicateErr.Matches,
+			})
+			return
+		}
+		respondError(w, http.StatusBadRequest, "failed to parse file", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// listFileVersions 列出正常文件的历史版本，可按 scheme、part 过滤
+func (h *Handler) listFileVersions(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	scheme := models.Scheme(strings.TrimSpace(r.URL.Query().Get("scheme")))
+	part := models.Part(strings.TrimSpace(r.URL.Query().Get("part")))
+	schemes, err := h.periodSchemes(period)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
+		return
+	}
+	if (scheme != "" && !schemes.Valid(scheme)) || (part != "" && !isValidPart(part)) {
+		respondError(w, http.StatusBadRequest, "invalid scheme or part", nil)
+		return
+	}
+
+	files, err := h.process.ListSourceFileVersions(period.ID, scheme, part)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to fetch file versions", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, files)
+}
+
+// activateFileVersion 将指定版本设为生效（例如撤销一次错误的重新上传），之后需重新处理账期
+func (h *Handler) activateFileVersion(w http.ResponseWriter, r *http.Request) {
+	period, err := h.getPeriodByParam(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error(), nil)
+		return
+	}
+
+	if err := service.EnsurePeriodOpen(period); err != nil {
+		respondError(w, periodStateStatus(err), err.Error(), nil)
+		return
+	}
+
+	file, err := h.getSourceFileByParam(r, period)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, "failed to fetch file", err)
+		return
+	}
+
+	activated, err := h.process.ActivateSourceFileVersion(period.ID, file.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotVersioned) {
+			respondError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "failed to activate file version", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, activated)
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xuri/excelize/v2"
+
+	"siapp/internal/auth"
+	"siapp/internal/models"
+	"siapp/internal/service"
+)
+
+// loadStatements 读取 year 参数（默认今年）并生成年度缴费明细，出错时直接写入响应
+func (h *Handler) loadStatements(w http.ResponseWriter, r *http.Request, idNumbers []string) (int, []*service.ContributionStatement, bool) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized", err)
+		return 0, nil, false
+	}
+	year := time.Now().Year()
+	if param := r.URL.Query().Get("year"); param != "" {
+		year, err = strconv.Atoi(param)
+		if err != nil || year < 1900 || year > 9999 {
+			respondError(w, http.StatusBadRequest, "invalid year", err)
+			return 0, nil, false
+		}
+	}
+
+	statements, err := h.process.BuildContributionStatements(userID, year, idNumbers)
+	if err != nil {
+		if errors.Is(err, service.ErrNoStatementData) {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("%d 年%s", year, err.Error()), nil)
+		} else {
+			respondError(w, http.StatusInternalServerError, "failed to build contribution statements", err)
+		}
+		return 0, nil, false
+	}
+	return year, statements, true
+}
+
+// idNumbersParam 读取逗号分隔的 id_number 参数，为空时表示全部员工
+func idNumbersParam(r *http.Request) []string {
+	var ids []string
+	for _, id := range strings.Split(r.URL.Query().Get("id_number"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// getEmployeeContributions 员工某年度各月的个人、单位缴费明细（含补退）
+func (h *Handler) getEmployeeContributions(w http.ResponseWriter, r *http.Request) {
+	_, statements, ok := h.loadStatements(w, r, []string{chi.URLParam(r, "idNumber")})
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, statements[0])
+}
+
+// getEmployeeStatement 员工年度缴费证明（可打印的 HTML，每人一页）
+func (h *Handler) getEmployeeStatement(w http.ResponseWriter, r *http.Request) {
+	year, statements, ok := h.loadStatements(w, r, []string{chi.URLParam(r, "idNumber")})
+	if !ok {
+		return
+	}
+	h.writeStatementsHTML(w, year, statements)
+}
+
+// exportStatementsHTML 批量输出年度缴费证明，id_number 为空时包含该年度全部员工
+func (h *Handler) exportStatementsHTML(w http.ResponseWriter, r *http.Request) {
+	year, statements, ok := h.loadStatements(w, r, idNumbersParam(r))
+	if !ok {
+		return
+	}
+	h.writeStatementsHTML(w, year, statements)
+}
+
+func (h *Handler) writeStatementsHTML(w http.ResponseWriter, year int, statements []*service.ContributionStatement) {
+	var buf bytes.Buffer
+	if err := service.RenderStatementsHTML(&buf, year, statements); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to render statement", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// exportStatementsExcel 批量导出年度缴费明细：“汇总”每人一行，“明细”每人每月一行，金额含补退
+func (h *Handler) exportStatementsExcel(w http.ResponseWriter, r *http.Request) {
+	year, statements, ok := h.loadStatements(w, r, idNumbersParam(r))
+	if !ok {
+		return
+	}
+	userID, _ := auth.GetUserIDFromContext(r.Context())
+	schemes, err := service.LoadSchemeRegistry(h.db, &userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load schemes", err)
+		return
+	}
+	var personalAmounts, unitAmounts []models.SchemeAmounts
+	for _, st := range statements {
+		personalAmounts = append(personalAmounts, st.Totals.Personal)
+		unitAmounts = append(unitAmounts, st.Totals.Unit)
+	}
+	personalColumns := schemes.Columns(models.PartPersonal, personalAmounts...)
+	unitColumns := schemes.Columns(models.PartUnit, unitAmounts...)
+
+	amountHeaders := func() []string {
+		var headers []string
+		for _, col := range personalColumns {
+			headers = append(headers, "个人"+col.Label)
+		}
+		headers = append(headers, "个人合计")
+		for _, col := range unitColumns {
+			headers = append(headers, "单位"+col.Label)
+		}
+		return append(headers, "单位合计")
+	}
+	amountValues := func(personal, unit models.SchemeAmounts, personalTotal, unitTotal models.Money) []any {
+		var values []any
+		for _, col := range personalColumns {
+			values = append(values, col.Sum(personal))
+		}
+		values = append(values, personalTotal)
+		for _, col := range unitColumns {
+			values = append(values, col.Sum(unit))
+		}
+		return append(values, unitTotal)
+	}
+
+	summary := [][]any{}
+	detail := [][]any{}
+	for _, st := range statements {
+		row := []any{st.IDNumber, st.Name, st.Department, len(st.Months)}
+		row = append(row, amountValues(st.Totals.Personal, st.Totals.Unit, st.Totals.PersonalTotal, st.Totals.UnitTotal)...)
+		summary = append(summary, append(row, st.Totals.Total))
+		for _, month := range st.Months {
+			row := []any{st.IDNumber, st.Name, month.YearMonth, month.Department, month.PersonalBase, month.UnitBase}
+			row = append(row, amountValues(month.PersonalAmounts(), month.UnitAmounts(), month.PersonalTotal, month.UnitTotal)...)
+			detail = append(detail, append(row, month.PersonalAdjustmentTotal, month.UnitAdjustmentTotal))
+		}
+	}
+
+	sheets := []struct {
+		name    string
+		headers []string
+		rows    [][]any
+	}{
+		{"汇总", append(append([]string{"证件号码", "姓名", "部门", "缴费月数"}, amountHeaders()...), "合计"), summary},
+		{"明细", append(append([]string{"证件号码", "姓名", "月份", "部门", "个人缴费基数", "单位缴费基数"}, amountHeaders()...), "其中个人补退", "其中单位补退"), detail},
+	}
+
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+	for idx, sheet := range sheets {
+		if idx == 0 {
+			if err := f.SetSheetName(f.GetSheetName(0), sheet.name); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to create sheet", err)
+				return
+			}
+		} else if _, err := f.NewSheet(sheet.name); err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to create sheet", err)
+			return
+		}
+		for colIdx, header := range sheet.headers {
+			cell, _ := excelize.CoordinatesToCellName(colIdx+1, 1)
+			if err := f.SetCellValue(sheet.name, cell, header); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to write header", err)
+				return
+			}
+		}
+		for rowIdx, row := range sheet.rows {
+			for colIdx, value := range row {
+				cell, _ := excelize.CoordinatesToCellName(colIdx+1, rowIdx+2)
+				if err := f.SetCellValue(sheet.name, cell, cellValue(value)); err != nil {
+					respondError(w, http.StatusInternalServerError, "failed to write data", err)
+					return
+				}
+			}
+		}
+		lastCell, _ := excelize.CoordinatesToCellName(len(sheet.headers), len(sheet.rows)+1)
+		if err := f.AutoFilter(sheet.name, "A1:"+lastCell, nil); err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to set filter", err)
+			return
+		}
+	}
+
+	// 涉及的账期：各月扣款所在账期与支付补退的账期（补退可能在以后年度支付）
+	seen := map[string]bool{}
+	var yearMonths []string
+	for _, st := range statements {
+		for _, month := range st.Months {
+			paid := month.AdjustmentPaidIn
+			if month.PeriodID != 0 {
+				paid = append([]string{month.YearMonth}, paid...)
+			}
+			for _, ym := range paid {
+				if !seen[ym] {
+					seen[ym] = true
+					yearMonths = append(yearMonths, ym)
+				}
+			}
+		}
+	}
+	sort.Strings(yearMonths)
+	watermark, err := h.applyPeriodsApprovalWatermark(f, userID, yearMonths)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load approval", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to encode excel", err)
+		return
+	}
+
+	filename := fmt.Sprintf("%d-年度缴费明细（%s）.xlsx", year, watermark)
+	if len(statements) == 1 {
+		filename = fmt.Sprintf("%d-%s-年度缴费明细（%s）.xlsx", year, statements[0].Name, watermark)
+	}
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	http.ServeContent(w, r, filename, time.Now(), bytes.NewReader(buf.Bytes()))
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"path/filepath"
+
+	"github.com/google/uuid"
+
+	"siapp/internal/models"
+	"siapp/internal/storage"
+)
+
+// tenantPrefix 返回用户所属租户的存储前缀：有公司时按公司隔离，否则按用户隔离
+func (h *Handler) tenantPrefix(userID *uint) string {
+	companyID := ""
+	if userID != nil {
+		var user models.User
+		if err := h.db.Select("id", "company_id").First(&user, *userID).Error; err == nil {
+			companyID = user.CompanyID
+		}
+	}
+	return storage.TenantPrefix(companyID, userID)
+}
+
+// periodPrefix 返回账期文件在存储中的目录，sub 为子目录（如 adjustments、roster）
+func (h *Handler) periodPrefix(period *models.Period, sub ...string) string {
+	parts := append([]string{h.tenantPrefix(period.UserID), "periods", fmt.Sprintf("%d", period.ID)}, sub...)
+	return storage.Key(parts...)
+}
+
+// uploadKey 为上传文件生成唯一的存储 key，保留原扩展名（没有时按 .xlsx）
+func uploadKey(prefix, namePrefix, originalName string) string {
+	ext := filepath.Ext(originalName)
+	if ext == "" {
+		ext = ".xlsx"
+	}
+	return storage.Key(prefix, namePrefix+uuid.NewString()+ext)
+}
+
+// saveUpload 将上传的文件写入存储
+func (h *Handler) saveUpload(ctx context.Context, key string, header *multipart.FileHeader) error {
+	src, err := header.Open()
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer src.Close()
+	return h.saveReader(ctx, key, src)
+}
+
+func (h *Handler) saveReader(ctx context.Context, key string, src io.Reader) error {
+	if err := h.store.Put(ctx, key, src); err != nil {
+		return fmt.Errorf("save file: %w", err)
+	}
+	return nil
+}
+
+// removePeriodFiles 删除账期目录下的文件，同时清理引入文件存储之前按 {periodID}/ 保存的旧文件。
+// 删除失败只记录日志，不影响接口响应
+func (h *Handler) removePeriodFiles(ctx context.Context, period *models.Period, sub ...string) {
+	legacy := storage.Key(append([]string{fmt.Sprintf("%d", period.ID)}, sub...)...)
+	for _, prefix := range []string{h.periodPrefix(period, sub...), legacy} {
+		if err := h.store.DeletePrefix(ctx, prefix); err != nil {
+			log.Printf("Warning: failed to remove stored files under %s: %v", prefix, err)
+		}
+	}
+}
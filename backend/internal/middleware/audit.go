@@ -168,6 +168,18 @@ func determineActionFromPath(method, path string) (models.ActionType, string, *s
 				action = models.ActionResetPeriod
 				id := pathParts[1]
 				resourceID = &id
+			} else if len(pathParts) > 2 && pathParts[2] == "review" {
+				action = models.ActionReviewPeriod
+				id := pathParts[1]
+				resourceID = &id
+			} else if len(pathParts) > 2 && pathParts[2] == "close" {
+				action = models.ActionClosePeriod
+				id := pathParts[1]
+				resourceID = &id
+			} else if len(pathParts) > 2 && pathParts[2] == "reopen" {
+				action = models.ActionReopenPeriod
+				id := pathParts[1]
+				resourceID = &id
 			} else {
 				action = models.ActionCreatePeriod
 			}
@@ -192,9 +204,17 @@ func determineActionFromPath(method, path string) (models.ActionType, string, *s
 						action = models.ActionUploadBatch
 					} else if len(pathParts) > 3 && pathParts[3] == "clear" {
 						action = models.ActionClearFiles
+					} else if len(pathParts) > 3 && pathParts[3] == "preview" {
+						action = models.ActionPreviewFile
+					} else if len(pathParts) > 4 && pathParts[4] == "reparse" {
+						action = models.ActionReparseFile
+					} else if len(pathParts) > 4 && pathParts[4] == "activate" {
+						action = models.ActionActivateFileVersion
 					} else {
 						action = models.ActionUploadFile
 					}
+				} else if method == "GET" && len(pathParts) > 4 && pathParts[4] == "download" {
+					action = models.ActionDownloadSourceFile
 				}
 				resource = "files"
 
@@ -204,6 +224,19 @@ func determineActionFromPath(method, path string) (models.ActionType, string, *s
 				}
 				resource = "roster"
 
+			case "approval":
+				if method == "POST" && len(pathParts) > 3 {
+					switch pathParts[3] {
+					case "submit":
+						action = models.ActionSubmitApproval
+					case "approve":
+						action = models.ActionApprovePeriod
+					case "reject":
+						action = models.ActionRejectPeriod
+					}
+				}
+				resource = "approvals"
+
 			case "charges":
 				if len(pathParts) > 3 && pathParts[3] == "export" {
 					action = models.ActionExportCharges
@@ -223,6 +256,51 @@ func determineActionFromPath(method, path string) (models.ActionType, string, *s
 					}
 				}
 				resource = "adjustments"
+
+			case "reconciliation":
+				if len(pathParts) > 3 && pathParts[3] == "export" {
+					action = models.ActionExportReconciliation
+				}
+				resource = "exports"
+
+			case "diff":
+				if len(pathParts) > 3 && pathParts[3] == "export" {
+					action = models.ActionExportPeriodDiff
+				}
+				resource = "exports"
+
+			case "housing-fund":
+				if method == "POST" {
+					action = models.ActionUploadHousingFund
+				}
+				resource = "housing_fund"
+			}
+		}
+
+	case "users":
+		action = models.ActionSystemStart
+		if method == "PUT" && len(pathParts) > 2 && pathParts[2] == "approver" {
+			action = models.ActionSetApprover
+			id := pathParts[1]
+			resourceID = &id
+		}
+		resource = "users"
+
+	case "allocation":
+		action = models.ActionSystemStart
+		if len(pathParts) > 1 && pathParts[1] == "export" {
+			action = models.ActionExportAllocation
+		}
+		resource = "exports"
+
+	case "employees":
+		action = models.ActionSystemStart
+		resource = "employees"
+		if len(pathParts) > 2 {
+			switch pathParts[len(pathParts)-1] {
+			case "export", "statements", "statement":
+				action = models.ActionExportStatements
+				resource = "exports"
 			}
 		}
 
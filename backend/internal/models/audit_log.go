@@ -47,14 +47,30 @@ const (
 	ActionDeletePeriod ActionType = "DELETE_PERIOD"
 	ActionResetPeriod  ActionType = "RESET_PERIOD"
 	ActionProcessPeriod ActionType = "PROCESS_PERIOD"
+	ActionReviewPeriod ActionType = "REVIEW_PERIOD"
+	ActionClosePeriod  ActionType = "CLOSE_PERIOD"
+	ActionReopenPeriod ActionType = "REOPEN_PERIOD"
+	ActionSubmitApproval ActionType = "SUBMIT_APPROVAL"
+	ActionApprovePeriod  ActionType = "APPROVE_PERIOD"
+	ActionRejectPeriod   ActionType = "REJECT_PERIOD"
+	ActionSetApprover    ActionType = "SET_APPROVER"
 
 	// File operations
 	ActionUploadFile       ActionType = "UPLOAD_FILE"
+	ActionPreviewFile      ActionType = "PREVIEW_FILE"
 	ActionUploadBatch      ActionType = "UPLOAD_BATCH"
 	ActionUploadRoster     ActionType = "UPLOAD_ROSTER"
 	ActionUploadAdjustment ActionType = "UPLOAD_ADJUSTMENT"
 	ActionClearFiles       ActionType = "CLEAR_FILES"
 	ActionClearAdjustments ActionType = "CLEAR_ADJUSTMENTS"
+	ActionReparseFile      ActionType = "REPARSE_FILE"
+	ActionDownloadSourceFile ActionType = "DOWNLOAD_SOURCE_FILE"
+	ActionActivateFileVersion ActionType = "ACTIVATE_FILE_VERSION"
+	ActionUploadHousingFund ActionType = "UPLOAD_HOUSING_FUND"
+	ActionExportReconciliation ActionType = "EXPORT_RECONCILIATION"
+	ActionExportPeriodDiff ActionType = "EXPORT_PERIOD_DIFF"
+	ActionExportAllocation ActionType = "EXPORT_ALLOCATION"
+	ActionExportStatements ActionType = "EXPORT_STATEMENTS"
 
 	// Data export actions
 	ActionExportCharges ActionType = "EXPORT_CHARGES"
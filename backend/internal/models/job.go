@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JobType identifies the kind of background work a job performs
+type JobType string
+
+const (
+	JobUploadBatch        JobType = "upload_batch"
+	JobProcessPeriod      JobType = "process_period"
+	JobProcessAdjustments JobType = "process_adjustments"
+)
+
+// JobStatus is the lifecycle state of a background job
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is a persisted unit of background work (file parsing, period processing).
+// Payload holds everything needed to run or resume the job; Result holds the JSON
+// output once it succeeds (or the partial output while running).
+type Job struct {
+	ID         uint            `json:"id" gorm:"primaryKey"`
+	UserID     *uint           `json:"user_id,omitempty" gorm:"index"`
+	User       *User           `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	PeriodID   *uint           `json:"period_id,omitempty" gorm:"index"`
+	Type       JobType         `json:"type" gorm:"size:50;not null;index"`
+	Status     JobStatus       `json:"status" gorm:"size:20;not null;index"`
+	Progress   int             `json:"progress"` // 0-100
+	Message    string          `json:"message" gorm:"size:255"`
+	Payload    json.RawMessage `json:"-" gorm:"type:text;serializer:json"`
+	Result     json.RawMessage `json:"result,omitempty" gorm:"type:text;serializer:json"`
+	Error      string          `json:"error,omitempty" gorm:"type:text"`
+	Attempts   int             `json:"attempts"`
+	Resumable  bool            `json:"resumable"` // whether an interrupted run may be restarted
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	CreatedAt  time.Time       `json:"created_at" gorm:"index"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+
+	// Owner identifies the runner instance executing the job; HeartbeatAt is refreshed while it runs
+	Owner       string     `json:"-" gorm:"size:128;index"`
+	HeartbeatAt *time.Time `json:"heartbeat_at,omitempty" gorm:"index"`
+}
+
+// Done reports whether the job has reached a terminal state
+func (j *Job) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
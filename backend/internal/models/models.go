@@ -30,8 +30,163 @@ const (
 	SchemeSeriousIllness Scheme = "serious_illness"
 	SchemeUnemployment   Scheme = "unemployment"
 	SchemeInjury         Scheme = "injury"
+	SchemeHousingFund    Scheme = "housing_fund" // 住房公积金，公积金文件一行同时包含个人与单位缴存额
 )
 
+// SchemeAmounts 按险种代码记录的金额
+type SchemeAmounts map[Scheme]Money
+
+// Total 返回各险种金额之和
+func (a SchemeAmounts) Total() Money {
+	var total Money
+	for _, amount := range a {
+		total += amount
+	}
+	return total
+}
+
+// SchemeDefinition 险种登记表中的一项，按公司保存并覆盖内置险种（代码相同时）。
+// 新增险种（如单独的生育保险、长护险、企业年金）只需增加一条记录
+type SchemeDefinition struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         *uint     `json:"user_id,omitempty" gorm:"index"`
+	User           *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	CompanyID      string    `json:"company_id" gorm:"size:100;index"`
+	Code           Scheme    `json:"code" gorm:"size:50;index;not null"`
+	Name           string    `json:"name" gorm:"size:100;not null"`
+	Parts          []Part    `json:"parts" gorm:"type:text;serializer:json"`    // 适用的缴费部分
+	Required       bool      `json:"required"`                                  // 处理账期前每个适用部分都必须上传
+	PersonalColumn string    `json:"personal_column" gorm:"size:100"`           // 个人扣款明细导出的列名，多个险种同名时合并为一列；为空时使用 Name
+	UnitColumn     string    `json:"unit_column" gorm:"size:100"`               // 单位扣款明细导出的列名，规则同上
+	Keywords       []string  `json:"keywords" gorm:"type:text;serializer:json"` // 根据文件名、标题识别险种的关键字
+	SortOrder      int       `json:"sort_order"`
+	Enabled        bool      `json:"enabled"`
+	Builtin        bool      `json:"builtin" gorm:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// AppliesTo 判断险种是否适用于指定的缴费部分
+func (d SchemeDefinition) AppliesTo(part Part) bool {
+	for _, p := range d.Parts {
+		if p == part {
+			return true
+		}
+	}
+	return false
+}
+
+// ColumnFor 返回险种在指定缴费部分扣款明细中的导出列名
+func (d SchemeDefinition) ColumnFor(part Part) string {
+	column := d.UnitColumn
+	if part == PartPersonal {
+		column = d.PersonalColumn
+	}
+	if column == "" {
+		return d.Name
+	}
+	return column
+}
+
+// RoundingMode 缴费金额的舍入方式
+type RoundingMode string
+
+const (
+	RoundingHalfUp   RoundingMode = "round"     // 四舍五入
+	RoundingHalfEven RoundingMode = "half_even" // 四舍六入五成双（银行家舍入）
+	RoundingUp       RoundingMode = "ceil"      // 见零进整（如见角进元）
+	RoundingDown     RoundingMode = "floor"     // 舍去尾数
+)
+
+// RoundingUnit 缴费金额舍入到的单位
+type RoundingUnit string
+
+const (
+	RoundingFen  RoundingUnit = "fen"  // 分
+	RoundingJiao RoundingUnit = "jiao" // 角
+	RoundingYuan RoundingUnit = "yuan" // 元
+)
+
+// RoundingScope 社保局舍入金额的环节
+type RoundingScope string
+
+const (
+	RoundingPerLine   RoundingScope = "line"   // 每条明细分别舍入
+	RoundingPerPerson RoundingScope = "person" // 每人该险种的合计舍入
+	RoundingPerTotal  RoundingScope = "total"  // 只对该险种的汇总合计舍入
+)
+
+// RoundingPolicy 社保局计算某险种某缴费部分金额时的舍入规则，处理账期时按此生成汇总与扣款明细
+type RoundingPolicy struct {
+	Scheme Scheme        `json:"scheme"`
+	Part   Part          `json:"part,omitempty"` // 为空时个人与单位都适用
+	Mode   RoundingMode  `json:"mode"`           // 为空时四舍五入
+	Unit   RoundingUnit  `json:"unit"`           // 为空时舍入到分
+	Scope  RoundingScope `json:"scope"`          // 为空时每条明细分别舍入
+}
+
+// ContributionRate 某险种某缴费部分的费率
+type ContributionRate struct {
+	Scheme      Scheme  `json:"scheme"`
+	Part        Part    `json:"part"`
+	Rate        float64 `json:"rate"`                   // 百分比，如养老个人 8 表示 8%
+	FixedAmount Money   `json:"fixed_amount,omitempty"` // 按人定额缴纳时的金额（如部分城市的大额医疗），不为 0 时不按基数计算
+}
+
+// ContributionRuleSet 城市缴费规则，按城市与生效月份保存缴费基数上下限、各险种费率与舍入方式。
+// 账期使用同城市中生效月份不晚于账期月份的最新一套规则
+type ContributionRuleSet struct {
+	ID               uint               `json:"id" gorm:"primaryKey"`
+	UserID           *uint              `json:"user_id,omitempty" gorm:"index"`
+	User             *User              `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	CompanyID        string             `json:"company_id" gorm:"size:100;index"`
+	City             string             `json:"city" gorm:"size:50;index;not null"`
+	EffectiveFrom    string             `json:"effective_from" gorm:"size:7;index;not null"` // 生效月份，格式 YYYY-MM
+	AverageWage      Money              `json:"average_wage"`                                // 上年度社会平均工资（月）
+	FloorPercent     float64            `json:"floor_percent"`                               // 基数下限占社平工资的百分比，为 0 时按 60
+	CeilingPercent   float64            `json:"ceiling_percent"`                             // 基数上限占社平工资的百分比，为 0 时按 300
+	BaseFloor        Money              `json:"base_floor"`                                  // 直接公布的基数下限，不为 0 时优先于百分比
+	BaseCeiling      Money              `json:"base_ceiling"`                                // 直接公布的基数上限，不为 0 时优先于百分比
+	Rates            []ContributionRate `json:"rates" gorm:"type:text;serializer:json"`
+	Tolerance        Money              `json:"tolerance"`                                          // 允许的金额差异，不超过该值不视为差异
+	RoundingPolicies []RoundingPolicy   `json:"rounding_policies" gorm:"type:text;serializer:json"` // 各险种汇总金额的舍入规则，未配置的险种不舍入
+	Notes            string             `json:"notes" gorm:"size:255"`
+	CreatedAt        time.Time          `json:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at"`
+}
+
+// CostCenterMapping 部门对应的成本中心，同公司共享；同一部门只能对应一个成本中心
+type CostCenterMapping struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         *uint     `json:"user_id,omitempty" gorm:"index"`
+	User           *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	CompanyID      string    `json:"company_id" gorm:"size:100;index"`
+	Department     string    `json:"department" gorm:"size:100;index;not null"`
+	CostCenter     string    `json:"cost_center" gorm:"size:50;not null"` // 成本中心编码
+	CostCenterName string    `json:"cost_center_name" gorm:"size:100"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CostCenterShare 员工分摊到某成本中心的比例
+type CostCenterShare struct {
+	CostCenter string  `json:"cost_center"`
+	Percent    float64 `json:"percent"` // 百分比，同一员工各项合计为 100
+}
+
+// CostCenterSplit 员工按比例分摊到多个成本中心，优先于所在部门的成本中心
+type CostCenterSplit struct {
+	ID        uint              `json:"id" gorm:"primaryKey"`
+	UserID    *uint             `json:"user_id,omitempty" gorm:"index"`
+	User      *User             `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	CompanyID string            `json:"company_id" gorm:"size:100;index"`
+	IDNumber  string            `json:"id_number" gorm:"size:50;index;not null"`
+	Name      string            `json:"name" gorm:"size:100"`
+	Shares    []CostCenterShare `json:"shares" gorm:"type:text;serializer:json"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
 // User represents a system user
 type User struct {
 	ID              uint       `json:"id" gorm:"primaryKey"`
@@ -41,6 +196,7 @@ type User struct {
 	FullName        string     `json:"full_name"`
 	CompanyID       string     `json:"company_id" gorm:"index"`
 	Active          bool       `json:"active" gorm:"default:true"`
+	Approver        bool       `json:"approver" gorm:"default:false"` // 可审批同公司其他用户提交的账期
 	EmailVerified   bool       `json:"email_verified" gorm:"default:false;index"`
 	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
 	CreatedAt       time.Time  `json:"created_at"`
@@ -194,108 +350,217 @@ type Period struct {
 	UserID           *uint     `json:"user_id,omitempty" gorm:"index"`
 	User             *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
 	YearMonth        string    `json:"year_month" gorm:"index"`
+	City             string    `json:"city" gorm:"size:50"` // 参保城市，用于匹配城市缴费规则
 	Status           string    `json:"status"`
 	AllowAdjustments bool      `json:"allow_adjustments" gorm:"default:true"`
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
+
+	// Provisional 最近一次处理为预估处理（缺少必需险种的文件），定稿前须完整处理一次
+	Provisional bool `json:"provisional" gorm:"default:false"`
+	// MissingUploads 预估处理时缺少的险种与缴费部分
+	MissingUploads []MissingUpload `json:"missing_uploads,omitempty" gorm:"type:text;serializer:json"`
+}
+
+// 账期状态，依次流转：draft → uploaded → processed → reviewed → closed
+const (
+	PeriodDraft     = "draft"     // 新建或重置后尚未上传缴费文件
+	PeriodUploaded  = "uploaded"  // 已上传缴费文件，待处理（处理后再上传也会回到此状态）
+	PeriodProcessed = "processed" // 已生成汇总与扣款明细
+	PeriodReviewed  = "reviewed"  // 处理结果已审核
+	PeriodClosed    = "closed"    // 已关账，数据只读，须重新打开才能修改
+)
+
+// ApprovalStatus 账期审批状态
+type ApprovalStatus string
+
+const (
+	ApprovalPending     ApprovalStatus = "pending"     // 已提交，等待审批
+	ApprovalApproved    ApprovalStatus = "approved"    // 已批准
+	ApprovalRejected    ApprovalStatus = "rejected"    // 已驳回
+	ApprovalInvalidated ApprovalStatus = "invalidated" // 提交或批准后处理结果发生变化，审批失效
+)
+
+// PeriodApproval 账期审批记录：提交人提交处理完成的账期，另一位有审批权限的用户批准或驳回。
+// 每次提交新增一条，最新一条为账期当前的审批状态
+type PeriodApproval struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	PeriodID      uint           `json:"period_id" gorm:"index"`
+	Status        ApprovalStatus `json:"status" gorm:"size:20;index"`
+	SummaryHash   string         `json:"summary_hash" gorm:"size:64"` // 提交时汇总与扣款明细的 SHA-256，审批时须一致
+	SubmittedBy   uint           `json:"submitted_by"`
+	SubmittedAt   time.Time      `json:"submitted_at"`
+	DecidedBy     *uint          `json:"decided_by,omitempty"`
+	DecidedAt     *time.Time     `json:"decided_at,omitempty"`
+	Comment       string         `json:"comment"`
+	InvalidatedAt *time.Time     `json:"invalidated_at,omitempty"` // 发现处理结果变化的时间
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// MissingUpload 处理账期时缺少文件的必需险种与缴费部分
+type MissingUpload struct {
+	Scheme Scheme `json:"scheme"`
+	Part   Part   `json:"part"`
 }
 
 type SourceFile struct {
-	ID           uint      `json:"id" gorm:"primaryKey"`
-	UserID       *uint     `json:"user_id,omitempty" gorm:"index"`
-	User         *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
-	PeriodID     uint      `json:"period_id" gorm:"index"`
-	Period       Period    `json:"-"`
-	FileName     string    `json:"file_name"`
-	StoredPath   string    `json:"stored_path"`
-	Scheme       Scheme    `json:"scheme" gorm:"index"`
-	Part         Part      `json:"part" gorm:"index"`
-	FileType     FileType  `json:"file_type" gorm:"index;default:normal"`
-	Rows         int       `json:"rows"`
-	Status       string    `json:"status"`
-	UploadedAt   time.Time `json:"uploaded_at"`
-	OriginalName string    `json:"original_name"`
-	Notes        string    `json:"notes"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       *uint      `json:"user_id,omitempty" gorm:"index"`
+	User         *User      `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	PeriodID     uint       `json:"period_id" gorm:"index"`
+	Period       Period     `json:"-"`
+	FileName     string     `json:"file_name"`
+	StoredPath   string     `json:"stored_path"` // 文件存储中的 key（如 companies/acme/periods/3/xxx.xlsx）
+	Scheme       Scheme     `json:"scheme" gorm:"index"`
+	Part         Part       `json:"part" gorm:"index"`
+	FileType     FileType   `json:"file_type" gorm:"index;default:normal"`
+	Version      int        `json:"version" gorm:"default:1"`         // 同一账期、险种、缴费部分的第几次上传，补退文件恒为1
+	Active       bool       `json:"active" gorm:"index;default:true"` // 是否为当前生效的版本，处理时只读取生效版本的记录
+	Rows         int        `json:"rows"`
+	RejectedRows int        `json:"rejected_rows"`
+	Status       string     `json:"status"`
+	UploadedAt   time.Time  `json:"uploaded_at"`
+	OriginalName string     `json:"original_name"`
+	ContentHash  string     `json:"content_hash" gorm:"size:64;index"` // 文件内容 SHA-256
+	PurgedAt     *time.Time `json:"purged_at,omitempty"`               // 原始文件超过保留期限被清理的时间
+	Notes        string     `json:"notes"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 type RawRecord struct {
-	ID           uint      `json:"id" gorm:"primaryKey"`
-	UserID       *uint     `json:"user_id,omitempty" gorm:"index"`
-	User         *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
-	PeriodID     uint      `json:"period_id" gorm:"index"`
-	SourceFileID uint      `json:"source_file_id" gorm:"index"`
-	Sequence     int       `json:"sequence"`
-	Name         string    `json:"name"`
-	IDType       string    `json:"id_type"`
-	IDNumber     string    `json:"id_number" gorm:"index"`
-	Department   string    `json:"department"`
-	PaySalary    float64   `json:"pay_salary"`
-	PayBase      float64   `json:"pay_base"`
-	RateText     string    `json:"rate_text"`
-	AmountDue    float64   `json:"amount_due"`
-	AmountAdjust float64   `json:"amount_adjust"`
-	PersonCode   string    `json:"person_code"`
-	Scheme       Scheme    `json:"scheme" gorm:"index"`
-	Part         Part      `json:"part" gorm:"index"`
-	FileType     FileType  `json:"file_type" gorm:"index;default:normal"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserID        *uint     `json:"user_id,omitempty" gorm:"index"`
+	User          *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	PeriodID      uint      `json:"period_id" gorm:"index"`
+	SourceFileID  uint      `json:"source_file_id" gorm:"index"`
+	Sequence      int       `json:"sequence"`
+	Name          string    `json:"name"`
+	IDType        string    `json:"id_type"`
+	IDNumber      string    `json:"id_number" gorm:"index"`
+	Department    string    `json:"department"`
+	PaySalary     Money     `json:"pay_salary"`
+	PayBase       Money     `json:"pay_base"`
+	RateText      string    `json:"rate_text"`
+	Rate          float64   `json:"rate"`       // 由费率文字解析的百分比，如“8%”为 8
+	RateFixed     Money     `json:"rate_fixed"` // 费率中按人定额的部分（元），如“2%+3”中的 3
+	AmountDue     Money     `json:"amount_due"`
+	AmountAdjust  Money     `json:"amount_adjust"`
+	PersonCode    string    `json:"person_code"`
+	AccountNumber string    `json:"account_number,omitempty"` // 住房公积金个人账号
+	Scheme        Scheme    `json:"scheme" gorm:"index"`
+	Part          Part      `json:"part" gorm:"index"`
+	FileType      FileType  `json:"file_type" gorm:"index;default:normal"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// ContributionMonth 费款所属期（YYYY-MM），补退记录据此归属到原缴费月份；文件未提供时为空
+	ContributionMonth string `json:"contribution_month,omitempty" gorm:"index"`
 }
 
 type PeriodSummary struct {
-	ID           uint      `json:"id" gorm:"primaryKey"`
-	UserID       *uint     `json:"user_id,omitempty" gorm:"index"`
-	User         *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
-	PeriodID     uint      `json:"period_id" gorm:"index"`
-	Scheme       Scheme    `json:"scheme"`
-	Part         Part      `json:"part"`
-	Headcount    int       `json:"headcount"`
-	BaseTotal    float64   `json:"base_total"`
-	AmountTotal  float64   `json:"amount_total"`
-	IsAdjustment bool      `json:"is_adjustment" gorm:"index;default:false"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserID        *uint     `json:"user_id,omitempty" gorm:"index"`
+	User          *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	PeriodID      uint      `json:"period_id" gorm:"index"`
+	Scheme        Scheme    `json:"scheme"`
+	SchemeName    string    `json:"scheme_name,omitempty" gorm:"-"`
+	EffectiveRate float64   `json:"effective_rate" gorm:"-"` // 实际费率（百分比）：应缴金额合计 / 基数合计
+	Part          Part      `json:"part"`
+	Headcount     int       `json:"headcount"`
+	BaseTotal     Money     `json:"base_total"`
+	AmountTotal   Money     `json:"amount_total"`
+	IsAdjustment  bool      `json:"is_adjustment" gorm:"index;default:false"`
+	Provisional   bool      `json:"provisional" gorm:"default:false"` // 由预估处理生成
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type PersonalCharge struct {
-	ID               uint      `json:"id" gorm:"primaryKey"`
-	UserID           *uint     `json:"user_id,omitempty" gorm:"index"`
-	User             *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
-	PeriodID         uint      `json:"period_id" gorm:"index"`
-	Name             string    `json:"name"`
-	IDNumber         string    `json:"id_number" gorm:"index"`
-	Department       string    `json:"department"`
-	Base             float64   `json:"base"`
-	Pension          float64   `json:"pension"`
-	MedicalMaternity float64   `json:"medical_maternity"`
-	SeriousIllness   float64   `json:"serious_illness"`
-	Unemployment     float64   `json:"unemployment"`
-	Subtotal         float64   `json:"subtotal"`
-	IsAdjustment     bool      `json:"is_adjustment" gorm:"index;default:false"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID               uint          `json:"id" gorm:"primaryKey"`
+	UserID           *uint         `json:"user_id,omitempty" gorm:"index"`
+	User             *User         `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	PeriodID         uint          `json:"period_id" gorm:"index"`
+	Name             string        `json:"name"`
+	IDNumber         string        `json:"id_number" gorm:"index"`
+	Department       string        `json:"department"`
+	Base             Money         `json:"base"`
+	Pension          Money         `json:"pension"`
+	MedicalMaternity Money         `json:"medical_maternity"`
+	SeriousIllness   Money         `json:"serious_illness"`
+	Unemployment     Money         `json:"unemployment"`
+	Amounts          SchemeAmounts `json:"amounts" gorm:"type:text;serializer:json"`
+	Subtotal         Money         `json:"subtotal"`
+	IsAdjustment     bool          `json:"is_adjustment" gorm:"index;default:false"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+}
+
+// AmountsByScheme 返回按险种的金额；险种登记表引入之前保存的记录没有 Amounts，按固定列还原
+func (c PersonalCharge) AmountsByScheme() SchemeAmounts {
+	if len(c.Amounts) > 0 {
+		return c.Amounts
+	}
+	return SchemeAmounts{
+		SchemePension:        c.Pension,
+		SchemeMedical:        c.MedicalMaternity,
+		SchemeSeriousIllness: c.SeriousIllness,
+		SchemeUnemployment:   c.Unemployment,
+	}
 }
 
 type UnitCharge struct {
-	ID               uint      `json:"id" gorm:"primaryKey"`
-	UserID           *uint     `json:"user_id,omitempty" gorm:"index"`
-	User             *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
-	PeriodID         uint      `json:"period_id" gorm:"index"`
-	Name             string    `json:"name"`
-	IDNumber         string    `json:"id_number" gorm:"index"`
-	Department       string    `json:"department"`
-	Base             float64   `json:"base"`
-	Pension          float64   `json:"pension"`
-	MedicalMaternity float64   `json:"medical_maternity"`
-	SeriousIllness   float64   `json:"serious_illness"`
-	Injury           float64   `json:"injury"`
-	Unemployment     float64   `json:"unemployment"`
-	Subtotal         float64   `json:"subtotal"`
-	IsAdjustment     bool      `json:"is_adjustment" gorm:"index;default:false"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID               uint          `json:"id" gorm:"primaryKey"`
+	UserID           *uint         `json:"user_id,omitempty" gorm:"index"`
+	User             *User         `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	PeriodID         uint          `json:"period_id" gorm:"index"`
+	Name             string        `json:"name"`
+	IDNumber         string        `json:"id_number" gorm:"index"`
+	Department       string        `json:"department"`
+	Base             Money         `json:"base"`
+	Pension          Money         `json:"pension"`
+	MedicalMaternity Money         `json:"medical_maternity"`
+	SeriousIllness   Money         `json:"serious_illness"`
+	Injury           Money         `json:"injury"`
+	Unemployment     Money         `json:"unemployment"`
+	Amounts          SchemeAmounts `json:"amounts" gorm:"type:text;serializer:json"`
+	Subtotal         Money         `json:"subtotal"`
+	IsAdjustment     bool          `json:"is_adjustment" gorm:"index;default:false"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+}
+
+// AmountsByScheme 返回按险种的金额；旧记录的单位医疗列含大额医疗，还原时拆分
+func (c UnitCharge) AmountsByScheme() SchemeAmounts {
+	if len(c.Amounts) > 0 {
+		return c.Amounts
+	}
+	return SchemeAmounts{
+		SchemePension:        c.Pension,
+		SchemeMedical:        c.MedicalMaternity - c.SeriousIllness,
+		SchemeSeriousIllness: c.SeriousIllness,
+		SchemeInjury:         c.Injury,
+		SchemeUnemployment:   c.Unemployment,
+	}
+}
+
+// HousingFundCharge 住房公积金缴存明细，处理账期时由公积金文件的导入记录生成
+type HousingFundCharge struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserID        *uint     `json:"user_id,omitempty" gorm:"index"`
+	User          *User     `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	PeriodID      uint      `json:"period_id" gorm:"index"`
+	Name          string    `json:"name"`
+	IDNumber      string    `json:"id_number" gorm:"index"`
+	AccountNumber string    `json:"account_number"`
+	Department    string    `json:"department"`
+	Base          Money     `json:"base"`
+	Personal      Money     `json:"personal"`
+	Unit          Money     `json:"unit"`
+	Total         Money     `json:"total"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type RosterEntry struct {
@@ -350,3 +615,36 @@ type Employee struct {
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
 }
+
+type HeaderProfileKind string
+
+const (
+	HeaderProfileSource      HeaderProfileKind = "source"
+	HeaderProfileRoster      HeaderProfileKind = "roster"
+	HeaderProfileHousingFund HeaderProfileKind = "housing_fund" // 住房公积金缴存明细
+)
+
+// HeaderProfile 表头映射方案，按公司保存，用于适配不同区县社保局导出文件的列名
+type HeaderProfile struct {
+	ID             uint              `json:"id" gorm:"primaryKey"`
+	UserID         *uint             `json:"user_id,omitempty" gorm:"index"`
+	User           *User             `json:"-,omitempty" gorm:"foreignKey:UserID"`
+	CompanyID      string            `json:"company_id" gorm:"size:100;index"`
+	Name           string            `json:"name" gorm:"size:100;not null"`
+	Kind           HeaderProfileKind `json:"kind" gorm:"size:20;index;default:source"`
+	Description    string            `json:"description" gorm:"size:255"`
+	RequiredFields []string          `json:"required_fields" gorm:"type:text;serializer:json"` // 不为空时取代内置必需字段，证件号码始终必需
+	Mappings       []HeaderMapping   `json:"mappings" gorm:"foreignKey:ProfileID;constraint:OnDelete:CASCADE"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// HeaderMapping 单条表头映射：源文件列名 → 标准字段
+type HeaderMapping struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ProfileID    uint      `json:"profile_id" gorm:"index"`
+	SourceHeader string    `json:"source_header" gorm:"size:100;not null"`
+	Field        string    `json:"field" gorm:"size:50;not null"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
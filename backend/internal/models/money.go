@@ -0,0 +1,178 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Money 金额，以分为单位的整数保存，累加、合并时不产生浮点误差。
+// 数据库中为 numeric(15,2)，JSON 中为保留两位小数的数字
+type Money int64
+
+const moneyScale = 100
+
+// MoneyFromFloat 将浮点数四舍五入到分。仅用于基数×费率、Excel 数值单元格等本身是浮点的场合；
+// 先按 1e-6 分消除二进制表示误差（如 1.005 实为 1.00499…），再四舍五入
+func MoneyFromFloat(v float64) Money {
+	return Money(math.Round(math.Round(v*moneyScale*1e4) / 1e4))
+}
+
+// ParseMoney 按十进制精确解析金额，兼容千分位、正负号、会计格式的括号负数与科学计数法；
+// 超过两位的小数四舍五入到分
+func ParseMoney(value string) (Money, error) {
+	s := strings.TrimSpace(value)
+	s = strings.NewReplacer(",", "", "，", "", " ", "", "¥", "", "￥", "").Replace(s)
+	if s == "" {
+		return 0, nil
+	}
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative, s = true, s[1:len(s)-1]
+	}
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative, s = !negative, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, fmt.Errorf("invalid amount %q", value)
+		}
+		m := MoneyFromFloat(f)
+		if negative {
+			m = -m
+		}
+		return m, nil
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if len(strings.TrimLeft(intPart, "0")) > 13 {
+		return 0, fmt.Errorf("amount %q out of range", value)
+	}
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+	var fen int64
+	for _, c := range intPart {
+		fen = fen*10 + int64(c-'0')
+	}
+	for i := 0; i < 2; i++ {
+		fen *= 10
+		if i < len(fracPart) {
+			fen += int64(fracPart[i] - '0')
+		}
+	}
+	if len(fracPart) > 2 && fracPart[2] >= '5' {
+		fen++
+	}
+	if negative {
+		fen = -fen
+	}
+	return Money(fen), nil
+}
+
+// Float 返回以元为单位的浮点数，用于写入 Excel 数值单元格及与费率相乘
+func (m Money) Float() float64 {
+	return float64(m) / moneyScale
+}
+
+// String 返回保留两位小数的金额，如 -12.30
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/moneyScale, v%moneyScale)
+}
+
+// Abs 返回金额的绝对值
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// MulPercent 计算金额乘以百分比（如 8 表示 8%）并四舍五入到分
+func (m Money) MulPercent(percent float64) Money {
+	return MoneyFromFloat(m.Float() * percent / 100)
+}
+
+// MarshalJSON 输出为保留两位小数的数字
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON 接受数字或数字字符串
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(strings.TrimSpace(string(data)), `"`)
+	if s == "null" {
+		*m = 0
+		return nil
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Value 以十进制字符串写入数据库，numeric 列按原值精确保存
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan 读取 numeric、整数或旧版本 double 列中的金额，浮点值四舍五入到分
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v * moneyScale)
+	case float64:
+		*m = MoneyFromFloat(v)
+	case float32:
+		*m = MoneyFromFloat(float64(v))
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	default:
+		return fmt.Errorf("unsupported amount type %T", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// GormDataType 金额列的通用类型
+func (Money) GormDataType() string {
+	return "numeric"
+}
+
+// GormDBDataType 金额列在 SQLite 与 PostgreSQL 中均为 numeric(15,2)
+func (Money) GormDBDataType(*gorm.DB, *schema.Field) string {
+	return "numeric(15,2)"
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		raw   string
+		want  Money
+		valid bool
+	}{
+		{"1,234.50", 123450, true},
+		{"0.1", 10, true},
+		{"400.125", 40013, true},
+		{"400.124", 40012, true},
+		{"-12.3", -1230, true},
+		{"(12.30)", -1230, true},
+		{"￥ 8，000", 800000, true},
+		{"1.5e3", 150000, true},
+		{".5", 50, true},
+		{"", 0, true},
+		{"－", 0, false},
+		{"12元", 0, false},
+		{"12345678901234", 0, false},
+	}
+	for _, c := range cases {
+		got, err := ParseMoney(c.raw)
+		if (err == nil) != c.valid || got != c.want {
+			t.Errorf("ParseMoney(%q) = %s, %v，期望 %s, 有效 %v", c.raw, got, err, c.want, c.valid)
+		}
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	// 1.005 的二进制表示略小于 1.005，仍应进位到 1.01
+	if got := MoneyFromFloat(1.005); got != 101 {
+		t.Errorf("MoneyFromFloat(1.005) = %s，期望 1.01", got)
+	}
+	var sum Money
+	for i := 0; i < 10; i++ {
+		sum += MoneyFromFloat(0.1)
+	}
+	if sum != 100 || sum.String() != "1.00" {
+		t.Errorf("十个 0.1 相加 = %s，期望 1.00", sum)
+	}
+	if got := Money(500010).MulPercent(8); got != 40001 {
+		t.Errorf("5000.10 × 8%% = %s，期望 400.01", got)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(map[string]Money{"amount": -1230, "zero": 0})
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	if string(data) != `{"amount":-12.30,"zero":0.00}` {
+		t.Errorf("序列化结果 = %s", data)
+	}
+
+	var decoded struct {
+		Number Money `json:"number"`
+		Text   Money `json:"text"`
+		Null   Money `json:"null"`
+	}
+	if err := json.Unmarshal([]byte(`{"number":400.01,"text":"1,000.5","null":null}`), &decoded); err != nil {
+		t.Fatalf("反序列化失败: %v", err)
+	}
+	if decoded.Number != 40001 || decoded.Text != 100050 || decoded.Null != 0 {
+		t.Errorf("反序列化结果 = %+v", decoded)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	cases := []struct {
+		src  any
+		want Money
+	}{
+		{int64(400), 40000}, // SQLite numeric 列中的整数
+		{400.01, 40001},     // 旧版本 double 列或 SQLite 中的小数
+		{12333.630000000001, 1233363},
+		{[]byte("986.70"), 98670}, // PostgreSQL numeric
+		{"-0.05", -5},
+		{nil, 0},
+	}
+	for _, c := range cases {
+		var m Money
+		if err := m.Scan(c.src); err != nil || m != c.want {
+			t.Errorf("Scan(%v) = %s, %v，期望 %s", c.src, m, err, c.want)
+		}
+	}
+	if v, err := Money(-1230).Value(); err != nil || v != "-12.30" {
+		t.Errorf("Value() = %v, %v，期望 -12.30", v, err)
+	}
+}
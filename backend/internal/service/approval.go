@@ -0,0 +1,372 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+)
+
+var (
+	// ErrNotSubmittable 只有完整处理后的账期才能提交审批
+	ErrNotSubmittable = errors.New("账期须完整处理后才能提交审批")
+	// ErrApprovalExists 账期已提交或已批准，处理结果未变化时不能重复提交
+	ErrApprovalExists = errors.New("账期已提交审批或已批准")
+	// ErrApprovalNotPending 账期没有待审批的提交
+	ErrApprovalNotPending = errors.New("账期没有待审批的提交")
+	// ErrNotApprover 当前用户没有审批权限
+	ErrNotApprover = errors.New("当前用户没有审批权限")
+	// ErrSelfApproval 提交人不能审批自己的提交
+	ErrSelfApproval = errors.New("审批人不能是提交人")
+	// ErrRejectCommentRequired 驳回必须填写意见
+	ErrRejectCommentRequired = errors.New("驳回须填写审批意见")
+	// ErrApprovalRequired 审核与关账前账期须已批准
+	ErrApprovalRequired = errors.New("账期须审批通过后才能审核或关账")
+	// ErrSelfRevoke 审批人不能撤销自己的审批权限，避免公司内没有审批人
+	ErrSelfRevoke = errors.New("不能撤销自己的审批权限")
+	// ErrSummaryChanged 提交后处理结果发生变化，审批已失效
+	ErrSummaryChanged = errors.New("提交后处理结果已变化，审批已失效，请重新提交")
+)
+
+// PendingApproval 审批人待处理的一项提交
+type PendingApproval struct {
+	Period   models.Period         `json:"period"`
+	Approval models.PeriodApproval `json:"approval"`
+}
+
+// 导出文件上标注的审批状态
+const (
+	WatermarkApproved   = "已审批"
+	WatermarkUnapproved = "未审批"
+)
+
+// ApprovalWatermark 导出文件上标注的审批状态：只有当前有效的批准标为“已审批”
+func ApprovalWatermark(approval *models.PeriodApproval) string {
+	if approval != nil && approval.Status == models.ApprovalApproved {
+		return WatermarkApproved
+	}
+	return WatermarkUnapproved
+}
+
+// PeriodSummaryHash 计算账期处理结果（汇总、个人与单位扣款明细、公积金缴存明细）的 SHA-256。
+// 只包含金额、人数等业务字段，重新处理得到相同结果时摘要不变
+func PeriodSummaryHash(db *gorm.DB, periodID uint) (string, error) {
+	var summaries []models.PeriodSummary
+	if err := db.Where("period_id = ?", periodID).Order("is_adjustment, scheme, part").Find(&summaries).Error; err != nil {
+		return "", fmt.Errorf("load summaries: %w", err)
+	}
+	var personal []models.PersonalCharge
+	if err := db.Where("period_id = ?", periodID).Order("is_adjustment, id_number, id").Find(&personal).Error; err != nil {
+		return "", fmt.Errorf("load personal charges: %w", err)
+	}
+	var unit []models.UnitCharge
+	if err := db.Where("period_id = ?", periodID).Order("is_adjustment, id_number, id").Find(&unit).Error; err != nil {
+		return "", fmt.Errorf("load unit charges: %w", err)
+	}
+	var housingFund []models.HousingFundCharge
+	if err := db.Where("period_id = ?", periodID).Order("id_number, id").Find(&housingFund).Error; err != nil {
+		return "", fmt.Errorf("load housing fund charges: %w", err)
+	}
+
+	h := sha256.New()
+	for _, s := range summaries {
+		fmt.Fprintf(h, "summary|%s|%s|%t|%d|%d|%d|%t\n", s.Scheme, s.Part, s.IsAdjustment, s.Headcount, s.BaseTotal, s.AmountTotal, s.Provisional)
+	}
+	for _, c := range personal {
+		fmt.Fprintf(h, "personal|%s|%s|%s|%t|%d|%d|", c.IDNumber, c.Name, c.Department, c.IsAdjustment, c.Base, c.Subtotal)
+		writeAmounts(h, c.AmountsByScheme())
+	}
+	for _, c := range unit {
+		fmt.Fprintf(h, "unit|%s|%s|%s|%t|%d|%d|", c.IDNumber, c.Name, c.Department, c.IsAdjustment, c.Base, c.Subtotal)
+		writeAmounts(h, c.AmountsByScheme())
+	}
+	for _, c := range housingFund {
+		fmt.Fprintf(h, "housing_fund|%s|%s|%s|%d|%d|%d\n", c.IDNumber, c.AccountNumber, c.Department, c.Base, c.Personal, c.Unit)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeAmounts 按险种代码顺序写入金额，保证摘要与 map 的遍历顺序无关
+func writeAmounts(h hash.Hash, amounts models.SchemeAmounts) {
+	schemes := make([]string, 0, len(amounts))
+	for scheme := range amounts {
+		schemes = append(schemes, string(scheme))
+	}
+	sort.Strings(schemes)
+	for _, scheme := range schemes {
+		fmt.Fprintf(h, "%s=%d;", scheme, amounts[models.Scheme(scheme)])
+	}
+	fmt.Fprintln(h)
+}
+
+// latestApproval 读取账期最新一次提交，从未提交时返回 nil
+func (p *Processor) latestApproval(periodID uint) (*models.PeriodApproval, error) {
+	var approval models.PeriodApproval
+	if err := p.db.Where("period_id = ?", periodID).Order("id DESC").Limit(1).Find(&approval).Error; err != nil {
+		return nil, fmt.Errorf("load approval: %w", err)
+	}
+	if approval.ID == 0 {
+		return nil, nil
+	}
+	return &approval, nil
+}
+
+// verifyApproval 待审批或已批准的提交与当前处理结果比对，摘要不一致时标记为失效
+func (p *Processor) verifyApproval(approval *models.PeriodApproval) error {
+	if approval == nil || (approval.Status != models.ApprovalPending && approval.Status != models.ApprovalApproved) {
+		return nil
+	}
+	current, err := PeriodSummaryHash(p.db, approval.PeriodID)
+	if err != nil {
+		return err
+	}
+	if current == approval.SummaryHash {
+		return nil
+	}
+	now := time.Now()
+	if err := p.db.Model(&models.PeriodApproval{}).Where("id = ? AND status = ?", approval.ID, approval.Status).
+		Updates(map[string]any{"status": models.ApprovalInvalidated, "invalidated_at": now}).Error; err != nil {
+		return fmt.Errorf("invalidate approval: %w", err)
+	}
+	approval.Status = models.ApprovalInvalidated
+	approval.InvalidatedAt = &now
+	return nil
+}
+
+// InvalidateApprovals 账期离开已处理/已审核状态（重新上传、切换版本、清空文件或重置）时，
+// 在同一事务中将待审批与已批准的提交标记为失效，须重新处理后再次提交
+func InvalidateApprovals(tx *gorm.DB, periodID uint) error {
+	if err := tx.Model(&models.PeriodApproval{}).
+		Where("period_id = ? AND status IN ?", periodID, []models.ApprovalStatus{models.ApprovalPending, models.ApprovalApproved}).
+		Updates(map[string]any{"status": models.ApprovalInvalidated, "invalidated_at": time.Now()}).Error; err != nil {
+		return fmt.Errorf("invalidate approvals: %w", err)
+	}
+	return nil
+}
+
+// CurrentApproval 返回账期当前的审批状态（最新一次提交）；提交或批准后处理结果发生变化的，状态为 invalidated。
+// 从未提交时返回 nil
+func (p *Processor) CurrentApproval(period *models.Period) (*models.PeriodApproval, error) {
+	approval, err := p.latestApproval(period.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.verifyApproval(approval); err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// ApprovalHistory 账期全部审批记录，最新的在前
+func (p *Processor) ApprovalHistory(period *models.Period) ([]models.PeriodApproval, error) {
+	if _, err := p.CurrentApproval(period); err != nil {
+		return nil, err
+	}
+	var approvals []models.PeriodApproval
+	if err := p.db.Where("period_id = ?", period.ID).Order("id DESC").Find(&approvals).Error; err != nil {
+		return nil, fmt.Errorf("load approvals: %w", err)
+	}
+	return approvals, nil
+}
+
+// SubmitForApproval 提交人提交处理完成的账期，记录当前处理结果的摘要。
+// 预估处理或尚未处理的账期不能提交；已有有效的待审批或已批准记录时不能重复提交
+func (p *Processor) SubmitForApproval(period *models.Period, userID uint) (*models.PeriodApproval, error) {
+	switch PeriodStatus(period) {
+	case models.PeriodProcessed, models.PeriodReviewed, models.PeriodClosed:
+	default:
+		return nil, ErrNotSubmittable
+	}
+	if period.Provisional {
+		return nil, ErrNotSubmittable
+	}
+	current, err := p.CurrentApproval(period)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && (current.Status == models.ApprovalPending || current.Status == models.ApprovalApproved) {
+		return nil, ErrApprovalExists
+	}
+	summaryHash, err := PeriodSummaryHash(p.db, period.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	approval := models.PeriodApproval{
+		PeriodID:    period.ID,
+		Status:      models.ApprovalPending,
+		SummaryHash: summaryHash,
+		SubmittedBy: userID,
+		SubmittedAt: time.Now(),
+	}
+	err = p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&approval).Error; err != nil {
+			return fmt.Errorf("save approval: %w", err)
+		}
+		return savePeriodAuditLog(tx, period, models.ActionSubmitApproval, &userID,
+			map[string]interface{}{"approval_id": approval.ID, "summary_hash": summaryHash})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// DecideApproval 审批人批准或驳回待审批的提交。审批人须有审批权限且不是提交人，驳回须填写意见；
+// 提交后处理结果发生变化的，提交失效并返回 ErrSummaryChanged
+func (p *Processor) DecideApproval(period *models.Period, approver *models.User, approve bool, comment string) (*models.PeriodApproval, error) {
+	if !approver.Approver {
+		return nil, ErrNotApprover
+	}
+	comment = strings.TrimSpace(comment)
+	if !approve && comment == "" {
+		return nil, ErrRejectCommentRequired
+	}
+	approval, err := p.latestApproval(period.ID)
+	if err != nil {
+		return nil, err
+	}
+	if approval == nil || approval.Status != models.ApprovalPending {
+		return nil, ErrApprovalNotPending
+	}
+	if approval.SubmittedBy == approver.ID {
+		return nil, ErrSelfApproval
+	}
+	if err := p.verifyApproval(approval); err != nil {
+		return nil, err
+	}
+	if approval.Status == models.ApprovalInvalidated {
+		return nil, ErrSummaryChanged
+	}
+
+	status, action := models.ApprovalRejected, models.ActionRejectPeriod
+	if approve {
+		status, action = models.ApprovalApproved, models.ActionApprovePeriod
+	}
+	now := time.Now()
+	err = p.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.PeriodApproval{}).Where("id = ? AND status = ?", approval.ID, models.ApprovalPending).
+			Updates(map[string]any{"status": status, "decided_by": approver.ID, "decided_at": now, "comment": comment})
+		if result.Error != nil {
+			return fmt.Errorf("update approval: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrApprovalNotPending
+		}
+		custom := map[string]interface{}{"approval_id": approval.ID, "summary_hash": approval.SummaryHash}
+		if comment != "" {
+			custom["comment"] = comment
+		}
+		return savePeriodAuditLog(tx, period, action, &approver.ID, custom)
+	})
+	if err != nil {
+		return nil, err
+	}
+	approval.Status = status
+	approval.DecidedBy = &approver.ID
+	approval.DecidedAt = &now
+	approval.Comment = comment
+	return approval, nil
+}
+
+// PendingApprovals 审批人待处理的提交：同公司用户提交、不是本人提交、处理结果未变化的账期
+func (p *Processor) PendingApprovals(approver *models.User) ([]PendingApproval, error) {
+	if !approver.Approver {
+		return nil, ErrNotApprover
+	}
+	if approver.CompanyID == "" {
+		return []PendingApproval{}, nil
+	}
+	var approvals []models.PeriodApproval
+	if err := p.db.Where("status = ? AND submitted_by <> ?", models.ApprovalPending, approver.ID).
+		Where("period_id IN (?)", p.db.Model(&models.Period{}).Select("id").
+			Where("user_id IN (?)", p.db.Model(&models.User{}).Select("id").Where("company_id = ?", approver.CompanyID))).
+		Order("submitted_at").Find(&approvals).Error; err != nil {
+		return nil, fmt.Errorf("load pending approvals: %w", err)
+	}
+
+	pending := make([]PendingApproval, 0, len(approvals))
+	for i := range approvals {
+		if err := p.verifyApproval(&approvals[i]); err != nil {
+			return nil, err
+		}
+		if approvals[i].Status != models.ApprovalPending {
+			continue
+		}
+		var period models.Period
+		if err := p.db.First(&period, approvals[i].PeriodID).Error; err != nil {
+			return nil, fmt.Errorf("load period: %w", err)
+		}
+		pending = append(pending, PendingApproval{Period: period, Approval: approvals[i]})
+	}
+	return pending, nil
+}
+
+// CompanyUsers 审批人所在公司的全部用户，供授予或撤销审批权限
+func (p *Processor) CompanyUsers(admin *models.User) ([]models.User, error) {
+	if !admin.Approver {
+		return nil, ErrNotApprover
+	}
+	if admin.CompanyID == "" {
+		return []models.User{}, nil
+	}
+	var users []models.User
+	if err := p.db.Where("company_id = ?", admin.CompanyID).Order("username").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("load users: %w", err)
+	}
+	return users, nil
+}
+
+// SetApprover 审批人授予或撤销同公司用户的审批权限，并写入审计日志。
+// 目标用户不属于同一公司时返回 gorm.ErrRecordNotFound；审批人不能撤销自己的权限
+func (p *Processor) SetApprover(admin *models.User, targetID uint, approver bool) (*models.User, error) {
+	if !admin.Approver {
+		return nil, ErrNotApprover
+	}
+	if admin.CompanyID == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if targetID == admin.ID && !approver {
+		return nil, ErrSelfRevoke
+	}
+	var target models.User
+	if err := p.db.Where("id = ? AND company_id = ?", targetID, admin.CompanyID).First(&target).Error; err != nil {
+		return nil, err
+	}
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&target).Update("approver", approver).Error; err != nil {
+			return fmt.Errorf("update approver: %w", err)
+		}
+		resourceID := strconv.FormatUint(uint64(target.ID), 10)
+		entry := models.CreateAuditLog(models.CreateAuditLogParams{
+			UserID:     &admin.ID,
+			Action:     models.ActionSetApprover,
+			Resource:   "users",
+			ResourceID: &resourceID,
+			Status:     models.StatusSuccess,
+			StatusCode: 200,
+			Details: &models.LogDetails{Custom: map[string]interface{}{
+				"username": target.Username, "company_id": target.CompanyID, "approver": approver,
+			}},
+		})
+		if err := tx.Create(entry).Error; err != nil {
+			return fmt.Errorf("save audit log: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	target.Approver = approver
+	return &target, nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+)
+
+func TestProcessor_ApprovalWorkflow(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	db := processor.db
+	if err := db.AutoMigrate(&models.User{}, &models.PeriodSummary{}, &models.PersonalCharge{}, &models.UnitCharge{},
+		&models.HousingFundCharge{}, &models.PeriodApproval{}, &models.AuditLog{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	preparer := models.User{Username: "maker", Email: "maker@example.com", CompanyID: "acme"}
+	checker := models.User{Username: "checker", Email: "checker@example.com", CompanyID: "acme", Approver: true}
+	outsider := models.User{Username: "other", Email: "other@example.com", CompanyID: "other", Approver: true}
+	for _, user := range []*models.User{&preparer, &checker, &outsider} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+	}
+	period := models.Period{UserID: &preparer.ID, YearMonth: "2026-05", Status: models.PeriodUploaded}
+	if err := db.Create(&period).Error; err != nil {
+		t.Fatalf("创建账期失败: %v", err)
+	}
+
+	if _, err := processor.SubmitForApproval(&period, preparer.ID); !errors.Is(err, ErrNotSubmittable) {
+		t.Fatalf("未处理的账期不能提交，实际 %v", err)
+	}
+	charge := models.PersonalCharge{PeriodID: period.ID, Name: "张三", IDNumber: "110101199001011234", Base: yuan(5000),
+		Amounts: models.SchemeAmounts{models.SchemePension: yuan(400), models.SchemeMedical: yuan(100)}, Subtotal: yuan(500)}
+	if err := db.Create(&charge).Error; err != nil {
+		t.Fatalf("插入扣款明细失败: %v", err)
+	}
+	if err := db.Create(&models.PeriodSummary{PeriodID: period.ID, Scheme: models.SchemePension, Part: models.PartPersonal,
+		Headcount: 1, BaseTotal: yuan(5000), AmountTotal: yuan(400)}).Error; err != nil {
+		t.Fatalf("插入汇总失败: %v", err)
+	}
+	period.Status = models.PeriodProcessed
+
+	submitted, err := processor.SubmitForApproval(&period, preparer.ID)
+	if err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	if len(submitted.SummaryHash) != 64 {
+		t.Errorf("提交应记录处理结果摘要: %q", submitted.SummaryHash)
+	}
+	if _, err := processor.SubmitForApproval(&period, preparer.ID); !errors.Is(err, ErrApprovalExists) {
+		t.Errorf("待审批时不能重复提交，实际 %v", err)
+	}
+	if _, err := processor.DecideApproval(&period, &preparer, true, ""); !errors.Is(err, ErrNotApprover) {
+		t.Errorf("没有审批权限的用户不能审批，实际 %v", err)
+	}
+	preparer.Approver = true
+	if _, err := processor.DecideApproval(&period, &preparer, true, ""); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("提交人不能审批自己的提交，实际 %v", err)
+	}
+
+	pending, err := processor.PendingApprovals(&checker)
+	if err != nil || len(pending) != 1 || pending[0].Period.ID != period.ID {
+		t.Fatalf("审批人待办不符: %+v, %v", pending, err)
+	}
+	if pending, _ := processor.PendingApprovals(&outsider); len(pending) != 0 {
+		t.Errorf("其他公司的审批人不应看到该提交: %+v", pending)
+	}
+
+	if _, err := processor.DecideApproval(&period, &checker, false, " "); !errors.Is(err, ErrRejectCommentRequired) {
+		t.Errorf("驳回须填写意见，实际 %v", err)
+	}
+	approved, err := processor.DecideApproval(&period, &checker, true, "核对无误")
+	if err != nil {
+		t.Fatalf("批准失败: %v", err)
+	}
+	if approved.Status != models.ApprovalApproved || approved.DecidedBy == nil || *approved.DecidedBy != checker.ID || approved.DecidedAt == nil {
+		t.Errorf("批准记录不符: %+v", approved)
+	}
+	current, err := processor.CurrentApproval(&period)
+	if err != nil || ApprovalWatermark(current) != "已审批" {
+		t.Fatalf("批准后应标注已审批: %+v, %v", current, err)
+	}
+
+	// 批准后处理结果变化，审批失效
+	if err := db.Model(&charge).Update("department", "财务部").Error; err != nil {
+		t.Fatalf("更新扣款明细失败: %v", err)
+	}
+	current, err = processor.CurrentApproval(&period)
+	if err != nil || current.Status != models.ApprovalInvalidated || current.InvalidatedAt == nil {
+		t.Fatalf("处理结果变化后审批应失效: %+v, %v", current, err)
+	}
+	if ApprovalWatermark(current) != "未审批" {
+		t.Errorf("失效的审批应标注未审批")
+	}
+
+	// 重新提交后驳回
+	if _, err := processor.SubmitForApproval(&period, preparer.ID); err != nil {
+		t.Fatalf("失效后重新提交失败: %v", err)
+	}
+	rejected, err := processor.DecideApproval(&period, &checker, false, "部门有误")
+	if err != nil || rejected.Status != models.ApprovalRejected || rejected.Comment != "部门有误" {
+		t.Fatalf("驳回记录不符: %+v, %v", rejected, err)
+	}
+	history, err := processor.ApprovalHistory(&period)
+	if err != nil || len(history) != 2 || history[0].Status != models.ApprovalRejected || history[1].Status != models.ApprovalInvalidated {
+		t.Errorf("审批历史不符: %+v, %v", history, err)
+	}
+
+	var actions []string
+	db.Model(&models.AuditLog{}).Order("id").Pluck("action", &actions)
+	want := []string{"SUBMIT_APPROVAL", "APPROVE_PERIOD", "SUBMIT_APPROVAL", "REJECT_PERIOD"}
+	if len(actions) != len(want) {
+		t.Fatalf("审计日志 = %v，期望 %v", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Errorf("审计日志 = %v，期望 %v", actions, want)
+			break
+		}
+	}
+}
+
+func TestPeriodSummaryHash_IgnoresRowOrderAndIDs(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	db := processor.db
+	if err := db.AutoMigrate(&models.PeriodSummary{}, &models.PersonalCharge{}, &models.UnitCharge{}, &models.HousingFundCharge{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	a := models.UnitCharge{PeriodID: 1, IDNumber: "A", Subtotal: yuan(100), Amounts: models.SchemeAmounts{models.SchemePension: yuan(80), models.SchemeInjury: yuan(20)}}
+	b := models.UnitCharge{PeriodID: 1, IDNumber: "B", Subtotal: yuan(50), Amounts: models.SchemeAmounts{models.SchemePension: yuan(50)}}
+	if err := db.Create(&[]models.UnitCharge{a, b}).Error; err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	first, err := PeriodSummaryHash(db, 1)
+	if err != nil {
+		t.Fatalf("计算摘要失败: %v", err)
+	}
+
+	// 重新处理：删除后按相反顺序写入相同的结果
+	db.Where("period_id = ?", 1).Delete(&models.UnitCharge{})
+	b.ID, a.ID = 0, 0
+	if err := db.Create(&[]models.UnitCharge{b, a}).Error; err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	second, _ := PeriodSummaryHash(db, 1)
+	if first != second {
+		t.Errorf("相同的处理结果摘要应一致: %s != %s", first, second)
+	}
+
+	db.Model(&models.UnitCharge{}).Where("id_number = ?", "B").Update("subtotal", yuan(51))
+	if third, _ := PeriodSummaryHash(db, 1); third == first {
+		t.Error("金额变化后摘要应改变")
+	}
+}
+
+func TestProcessor_SetApprover(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	db := processor.db
+	if err := db.AutoMigrate(&models.User{}, &models.AuditLog{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	admin := models.User{Username: "checker", Email: "checker@example.com", CompanyID: "acme", Approver: true}
+	colleague := models.User{Username: "maker", Email: "maker@example.com", CompanyID: "acme"}
+	outsider := models.User{Username: "other", Email: "other@example.com", CompanyID: "other"}
+	for _, user := range []*models.User{&admin, &colleague, &outsider} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+	}
+
+	if _, err := processor.SetApprover(&colleague, admin.ID, false); !errors.Is(err, ErrNotApprover) {
+		t.Errorf("没有审批权限的用户不能管理审批权限，实际 %v", err)
+	}
+	if _, err := processor.SetApprover(&admin, outsider.ID, true); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("不能授予其他公司的用户，实际 %v", err)
+	}
+	if _, err := processor.SetApprover(&admin, admin.ID, false); !errors.Is(err, ErrSelfRevoke) {
+		t.Errorf("不能撤销自己的审批权限，实际 %v", err)
+	}
+
+	granted, err := processor.SetApprover(&admin, colleague.ID, true)
+	if err != nil || !granted.Approver {
+		t.Fatalf("授予审批权限失败: %+v, %v", granted, err)
+	}
+	users, err := processor.CompanyUsers(&admin)
+	if err != nil || len(users) != 2 {
+		t.Fatalf("只应列出同公司的用户: %+v, %v", users, err)
+	}
+	if _, err := processor.SetApprover(&admin, colleague.ID, false); err != nil {
+		t.Fatalf("撤销审批权限失败: %v", err)
+	}
+	var saved models.User
+	db.First(&saved, colleague.ID)
+	if saved.Approver {
+		t.Error("撤销后不应再有审批权限")
+	}
+	var logs int64
+	db.Model(&models.AuditLog{}).Where("action = ?", models.ActionSetApprover).Count(&logs)
+	if logs != 2 {
+		t.Errorf("授予与撤销应各写一条审计日志，实际 %d 条", logs)
+	}
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"siapp/internal/models"
+)
+
+var (
+	// ErrNoAdjustments 账期没有补退数据
+	ErrNoAdjustments = errors.New("账期没有补退数据")
+	// ErrNoArrearsData 所选范围内没有补退记录
+	ErrNoArrearsData = errors.New("没有补退记录")
+)
+
+// AdjustmentMonth 账期补退中归属于同一费款所属期的金额
+type AdjustmentMonth struct {
+	ContributionMonth string               `json:"contribution_month"` // 为空表示补退文件未注明费款所属期
+	Headcount         int                  `json:"headcount"`
+	Personal          models.SchemeAmounts `json:"personal"`
+	Unit              models.SchemeAmounts `json:"unit"`
+	PersonalTotal     models.Money         `json:"personal_total"`
+	UnitTotal         models.Money         `json:"unit_total"`
+	Total             models.Money         `json:"total"`
+}
+
+// PeriodAdjustments 账期补退按费款所属期的分布
+type PeriodAdjustments struct {
+	PeriodID        uint              `json:"period_id"`
+	YearMonth       string            `json:"year_month"`
+	Months          []AdjustmentMonth `json:"months"`
+	PersonalColumns []ChargeColumn    `json:"personal_columns"`
+	UnitColumns     []ChargeColumn    `json:"unit_columns"`
+	PersonalTotal   models.Money      `json:"personal_total"`
+	UnitTotal       models.Money      `json:"unit_total"`
+	Total           models.Money      `json:"total"`
+}
+
+// ArrearsEntry 员工某个费款所属期在某个账期中补缴或退还的金额
+type ArrearsEntry struct {
+	ContributionMonth string               `json:"contribution_month"`
+	PeriodID          uint                 `json:"period_id"`
+	PaidYearMonth     string               `json:"paid_year_month"` // 补退所在账期的月份
+	PersonalBase      models.Money         `json:"personal_base"`
+	UnitBase          models.Money         `json:"unit_base"`
+	Personal          models.SchemeAmounts `json:"personal"`
+	Unit              models.SchemeAmounts `json:"unit"`
+	PersonalTotal     models.Money         `json:"personal_total"`
+	UnitTotal         models.Money         `json:"unit_total"`
+}
+
+// ArrearsLedger 员工补退台账：各历史月份在哪个账期被更正、更正了多少
+type ArrearsLedger struct {
+	IDNumber        string         `json:"id_number"`
+	Name            string         `json:"name"`
+	Department      string         `json:"department"` // 最近一次补退时的部门
+	Entries         []ArrearsEntry `json:"entries"`
+	Months          []string       `json:"months"` // 被更正过的费款所属期，不含未注明的
+	PersonalColumns []ChargeColumn `json:"personal_columns"`
+	UnitColumns     []ChargeColumn `json:"unit_columns"`
+	PersonalTotal   models.Money   `json:"personal_total"`
+	UnitTotal       models.Money   `json:"unit_total"`
+	Total           models.Money   `json:"total"`
+}
+
+// adjustmentLine 一条补退明细及其所在账期，amount 已按每条明细的舍入规则舍入
+type adjustmentLine struct {
+	periodID  uint
+	yearMonth string
+	record    models.RawRecord
+	amount    models.Money
+}
+
+// newAdjustmentLines 过滤不适用的险种并按每条明细的舍入规则舍入；
+// 按人、按合计舍入的规则作用于整个账期，不能拆到费款所属期，这里不再应用
+func newAdjustmentLines(period models.Period, records []models.RawRecord, schemes *SchemeRegistry, rounding roundingPolicies) []adjustmentLine {
+	lines := make([]adjustmentLine, 0, len(records))
+	for _, rec := range records {
+		if !schemes.Applies(rec.Scheme, rec.Part) {
+			continue
+		}
+		lines = append(lines, adjustmentLine{period.ID, period.YearMonth, rec, rounding.line(rec)})
+	}
+	return lines
+}
+
+// contributionMonthLess 按费款所属期排序，未注明的排在最后
+func contributionMonthLess(a, b string) bool {
+	if a == "" || b == "" {
+		return a != "" && b == ""
+	}
+	return a < b
+}
+
+// buildPeriodAdjustments 按费款所属期汇总账期的补退明细
+func buildPeriodAdjustments(period models.Period, lines []adjustmentLine, schemes *SchemeRegistry) *PeriodAdjustments {
+	months := map[string]*AdjustmentMonth{}
+	people := map[string]map[string]bool{}
+	for _, line := range lines {
+		key := line.record.ContributionMonth
+		month, ok := months[key]
+		if !ok {
+			month = &AdjustmentMonth{ContributionMonth: key, Personal: models.SchemeAmounts{}, Unit: models.SchemeAmounts{}}
+			months[key] = month
+			people[key] = map[string]bool{}
+		}
+		people[key][line.record.IDNumber] = true
+		if line.record.Part == models.PartPersonal {
+			month.Personal[line.record.Scheme] += line.amount
+		} else {
+			month.Unit[line.record.Scheme] += line.amount
+		}
+	}
+
+	result := &PeriodAdjustments{PeriodID: period.ID, YearMonth: period.YearMonth, Months: []AdjustmentMonth{}}
+	var personalAmounts, unitAmounts []models.SchemeAmounts
+	for key, month := range months {
+		month.Headcount = len(people[key])
+		month.Personal = compactAmounts(month.Personal)
+		month.Unit = compactAmounts(month.Unit)
+		month.PersonalTotal = month.Personal.Total()
+		month.UnitTotal = month.Unit.Total()
+		month.Total = month.PersonalTotal + month.UnitTotal
+		result.PersonalTotal += month.PersonalTotal
+		result.UnitTotal += month.UnitTotal
+		personalAmounts = append(personalAmounts, month.Personal)
+		unitAmounts = append(unitAmounts, month.Unit)
+		result.Months = append(result.Months, *month)
+	}
+	sort.Slice(result.Months, func(i, j int) bool {
+		return contributionMonthLess(result.Months[i].ContributionMonth, result.Months[j].ContributionMonth)
+	})
+	result.Total = result.PersonalTotal + result.UnitTotal
+	result.PersonalColumns = schemes.Columns(models.PartPersonal, personalAmounts...)
+	result.UnitColumns = schemes.Columns(models.PartUnit, unitAmounts...)
+	return result
+}
+
+// buildArrearsLedgers 按员工、费款所属期与补退账期汇总补退明细，员工按证件号码排列
+func buildArrearsLedgers(lines []adjustmentLine, schemes *SchemeRegistry) []*ArrearsLedger {
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].yearMonth < lines[j].yearMonth })
+
+	type entryKey struct {
+		month    string
+		periodID uint
+	}
+	ledgers := map[string]*ArrearsLedger{}
+	entries := map[string]map[entryKey]*ArrearsEntry{}
+	for _, line := range lines {
+		rec := line.record
+		id := strings.TrimSpace(rec.IDNumber)
+		if id == "" {
+			continue
+		}
+		ledger, ok := ledgers[id]
+		if !ok {
+			ledger = &ArrearsLedger{IDNumber: id, Months: []string{}}
+			ledgers[id] = ledger
+			entries[id] = map[entryKey]*ArrearsEntry{}
+		}
+		if rec.Name != "" {
+			ledger.Name = rec.Name
+		}
+		if rec.Department != "" {
+			ledger.Department = rec.Department
+		}
+		key := entryKey{rec.ContributionMonth, line.periodID}
+		entry, ok := entries[id][key]
+		if !ok {
+			entry = &ArrearsEntry{
+				ContributionMonth: rec.ContributionMonth, PeriodID: line.periodID, PaidYearMonth: line.yearMonth,
+				Personal: models.SchemeAmounts{}, Unit: models.SchemeAmounts{},
+			}
+			entries[id][key] = entry
+		}
+		// 缴费基数取社保险种的基数，与扣款明细一致
+		socialBase := rec.Scheme != models.SchemeHousingFund
+		if rec.Part == models.PartPersonal {
+			if entry.PersonalBase == 0 && socialBase {
+				entry.PersonalBase = rec.PayBase
+			}
+			entry.Personal[rec.Scheme] += line.amount
+		} else {
+			if entry.UnitBase == 0 && socialBase {
+				entry.UnitBase = rec.PayBase
+			}
+			entry.Unit[rec.Scheme] += line.amount
+		}
+	}
+
+	result := make([]*ArrearsLedger, 0, len(ledgers))
+	for id, ledger := range ledgers {
+		var personalAmounts, unitAmounts []models.SchemeAmounts
+		months := map[string]bool{}
+		for _, entry := range entries[id] {
+			entry.Personal = compactAmounts(entry.Personal)
+			entry.Unit = compactAmounts(entry.Unit)
+			entry.PersonalTotal = entry.Personal.Total()
+			entry.UnitTotal = entry.Unit.Total()
+			ledger.PersonalTotal += entry.PersonalTotal
+			ledger.UnitTotal += entry.UnitTotal
+			personalAmounts = append(personalAmounts, entry.Personal)
+			unitAmounts = append(unitAmounts, entry.Unit)
+			if entry.ContributionMonth != "" && !months[entry.ContributionMonth] {
+				months[entry.ContributionMonth] = true
+				ledger.Months = append(ledger.Months, entry.ContributionMonth)
+			}
+			ledger.Entries = append(ledger.Entries, *entry)
+		}
+		sort.Slice(ledger.Entries, func(i, j int) bool {
+			a, b := ledger.Entries[i], ledger.Entries[j]
+			if a.ContributionMonth != b.ContributionMonth {
+				return contributionMonthLess(a.ContributionMonth, b.ContributionMonth)
+			}
+			return a.PaidYearMonth < b.PaidYearMonth
+		})
+		sort.Strings(ledger.Months)
+		ledger.Total = ledger.PersonalTotal + ledger.UnitTotal
+		ledger.PersonalColumns = schemes.Columns(models.PartPersonal, personalAmounts...)
+		ledger.UnitColumns = schemes.Columns(models.PartUnit, unitAmounts...)
+		result = append(result, ledger)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].IDNumber < result[j].IDNumber })
+	return result
+}
+
+// PeriodAdjustmentsByMonth 账期补退按费款所属期的分布
+func (p *Processor) PeriodAdjustmentsByMonth(period *models.Period) (*PeriodAdjustments, error) {
+	var records []models.RawRecord
+	if err := p.db.Where("period_id = ? AND file_type = ?", period.ID, models.FileTypeAdjustment).
+		Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("load adjustment records: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, ErrNoAdjustments
+	}
+	schemes, err := LoadSchemeRegistry(p.db, period.UserID)
+	if err != nil {
+		return nil, err
+	}
+	rounding, err := p.loadRoundingPolicies(period)
+	if err != nil {
+		return nil, err
+	}
+	return buildPeriodAdjustments(*period, newAdjustmentLines(*period, records, schemes, rounding), schemes), nil
+}
+
+// BuildArrearsLedgers 汇总用户各账期的补退记录，生成员工补退台账；idNumbers 为空时包含全部员工，
+// from / to（YYYY-MM）非空时只统计费款所属期在该范围内的补退
+func (p *Processor) BuildArrearsLedgers(userID uint, idNumbers []string, from, to string) ([]*ArrearsLedger, error) {
+	var periods []models.Period
+	if err := p.db.Where("user_id = ?", userID).Find(&periods).Error; err != nil {
+		return nil, fmt.Errorf("load periods: %w", err)
+	}
+	if len(periods) == 0 {
+		return nil, ErrNoArrearsData
+	}
+	byID := make(map[uint]models.Period, len(periods))
+	ids := make([]uint, 0, len(periods))
+	for _, period := range periods {
+		byID[period.ID] = period
+		ids = append(ids, period.ID)
+	}
+
+	query := p.db.Where("period_id IN ? AND file_type = ?", ids, models.FileTypeAdjustment)
+	if len(idNumbers) > 0 {
+		query = query.Where("id_number IN ?", idNumbers)
+	}
+	if from != "" {
+		query = query.Where("contribution_month >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("contribution_month <> '' AND contribution_month <= ?", to)
+	}
+	var records []models.RawRecord
+	if err := query.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("load adjustment records: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, ErrNoArrearsData
+	}
+
+	schemes, err := LoadSchemeRegistry(p.db, &userID)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := p.adjustmentLines(byID, records, schemes)
+	if err != nil {
+		return nil, err
+	}
+	return buildArrearsLedgers(lines, schemes), nil
+}
+
+// adjustmentLines 按所在账期的舍入规则生成多个账期的补退明细，periods 为账期 ID 到账期的映射
+func (p *Processor) adjustmentLines(periods map[uint]models.Period, records []models.RawRecord, schemes *SchemeRegistry) ([]adjustmentLine, error) {
+	byPeriod := map[uint][]models.RawRecord{}
+	for _, rec := range records {
+		byPeriod[rec.PeriodID] = append(byPeriod[rec.PeriodID], rec)
+	}
+	var lines []adjustmentLine
+	for periodID, recs := range byPeriod {
+		period := periods[periodID]
+		rounding, err := p.loadRoundingPolicies(&period)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, newAdjustmentLines(period, recs, schemes, rounding)...)
+	}
+	return lines, nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestBuildArrearsLedgers(t *testing.T) {
+	line := func(period models.Period, id, month string, scheme models.Scheme, part models.Part, amount float64) adjustmentLine {
+		rec := models.RawRecord{PeriodID: period.ID, IDNumber: id, Name: "员工" + id, PayBase: yuan(6000),
+			Scheme: scheme, Part: part, AmountDue: yuan(amount), FileType: models.FileTypeAdjustment, ContributionMonth: month}
+		return adjustmentLine{period.ID, period.YearMonth, rec, rec.AmountDue}
+	}
+	jun := models.Period{ID: 6, YearMonth: "2026-06"}
+	jul := models.Period{ID: 7, YearMonth: "2026-07"}
+	lines := []adjustmentLine{
+		line(jul, "A", "2026-03", models.SchemePension, models.PartPersonal, -40),
+		line(jun, "A", "2026-03", models.SchemePension, models.PartPersonal, 80),
+		line(jun, "A", "2026-03", models.SchemePension, models.PartUnit, 160),
+		line(jun, "A", "2026-02", models.SchemeMedical, models.PartPersonal, 20),
+		line(jun, "A", "", models.SchemePension, models.PartPersonal, 5),
+		line(jun, "B", "2026-03", models.SchemePension, models.PartPersonal, 80),
+	}
+
+	byMonth := buildPeriodAdjustments(jun, lines[1:], NewSchemeRegistry(nil))
+	if len(byMonth.Months) != 3 || byMonth.Months[0].ContributionMonth != "2026-02" || byMonth.Months[2].ContributionMonth != "" {
+		t.Fatalf("所属期分布不符: %+v", byMonth.Months)
+	}
+	if m := byMonth.Months[1]; m.Headcount != 2 || m.PersonalTotal != yuan(160) || m.UnitTotal != yuan(160) || m.Total != yuan(320) {
+		t.Errorf("2026-03 汇总不符: %+v", m)
+	}
+	if byMonth.Total != yuan(345) {
+		t.Errorf("账期补退合计 = %s，期望 345.00", byMonth.Total)
+	}
+
+	ledgers := buildArrearsLedgers(lines, NewSchemeRegistry(nil))
+	if len(ledgers) != 2 || ledgers[0].IDNumber != "A" || ledgers[1].IDNumber != "B" {
+		t.Fatalf("员工数量或顺序不符: %+v", ledgers)
+	}
+	a := ledgers[0]
+	if strings.Join(a.Months, ",") != "2026-02,2026-03" {
+		t.Errorf("更正月份 = %v", a.Months)
+	}
+	var got []string
+	for _, e := range a.Entries {
+		got = append(got, e.ContributionMonth+"@"+e.PaidYearMonth)
+	}
+	if strings.Join(got, ",") != "2026-02@2026-06,2026-03@2026-06,2026-03@2026-07,@2026-06" {
+		t.Fatalf("台账顺序不符: %v", got)
+	}
+	mar := a.Entries[1]
+	if mar.PersonalTotal != yuan(80) || mar.UnitTotal != yuan(160) || mar.PersonalBase != yuan(6000) {
+		t.Errorf("3 月在 6 月的补缴不符: %+v", mar)
+	}
+	if a.Entries[2].PersonalTotal != yuan(-40) {
+		t.Errorf("3 月在 7 月的退费不符: %+v", a.Entries[2])
+	}
+	if a.PersonalTotal != yuan(65) || a.UnitTotal != yuan(160) || a.Total != yuan(225) {
+		t.Errorf("台账合计不符: %+v", a)
+	}
+
+}
+
+func TestProcessor_ArrearsFromAdjustmentFile(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+	if err := processor.db.AutoMigrate(&models.User{}, &models.SchemeDefinition{}, &models.ContributionRuleSet{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	user := models.User{Username: "hr", Email: "hr@example.com"}
+	if err := processor.db.Create(&user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	period := models.Period{UserID: &user.ID, YearMonth: "2026-06"}
+	if err := processor.db.Create(&period).Error; err != nil {
+		t.Fatalf("创建账期失败: %v", err)
+	}
+
+	content := "序号,姓名,证件号码,缴费工资,缴费基数,费率,应缴费额,费款所属期\n" +
+		"1,张三,110101199001011234,6000,6000,8%,80,202603\n" +
+		"2,张三,110101199001011234,6000,6000,8%,80,202604\n" +
+		"3,李四,110101199001015678,6000,6000,8%,-40,2026年3月\n" +
+		"4,王五,110101199001019999,6000,6000,8%,10,三月\n"
+	key := "periods/1/adjustments/adj.csv"
+	if err := store.Put(t.Context(), key, strings.NewReader(content)); err != nil {
+		t.Fatalf("保存文件失败: %v", err)
+	}
+	result, err := processor.ParseAdjustmentFile(period.ID, &user.ID, key, "养老补退.csv", models.SchemePension, models.PartPersonal, ParseOptions{})
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if result.Imported != 4 || len(result.Issues) != 1 || result.Issues[0].Row != 5 {
+		t.Errorf("无法识别的费款所属期应警告并导入: %+v", result)
+	}
+
+	byMonth, err := processor.PeriodAdjustmentsByMonth(&period)
+	if err != nil {
+		t.Fatalf("汇总失败: %v", err)
+	}
+	var months []string
+	for _, m := range byMonth.Months {
+		months = append(months, m.ContributionMonth)
+	}
+	if strings.Join(months, ",") != "2026-03,2026-04," || byMonth.Months[0].PersonalTotal != yuan(40) {
+		t.Errorf("所属期分布不符: %+v", byMonth.Months)
+	}
+
+	ledgers, err := processor.BuildArrearsLedgers(user.ID, []string{"110101199001011234"}, "2026-04", "2026-12")
+	if err != nil {
+		t.Fatalf("生成台账失败: %v", err)
+	}
+	if len(ledgers) != 1 || len(ledgers[0].Entries) != 1 || ledgers[0].Entries[0].ContributionMonth != "2026-04" ||
+		ledgers[0].Entries[0].PaidYearMonth != "2026-06" {
+		t.Errorf("台账不符: %+v", ledgers)
+	}
+	if _, err := processor.BuildArrearsLedgers(user.ID, nil, "2025-01", "2025-12"); !errors.Is(err, ErrNoArrearsData) {
+		t.Errorf("范围内没有补退时应返回 ErrNoArrearsData，实际 %v", err)
+	}
+}
@@ -102,6 +102,7 @@ func newTestTransaction(t *testing.T, db *gorm.DB) *gorm.DB {
 			full_name TEXT,
 			company_id TEXT,
 			active BOOLEAN,
+			approver BOOLEAN DEFAULT FALSE,
 			email_verified BOOLEAN,
 			email_verified_at TIMESTAMPTZ,
 			created_at TIMESTAMPTZ DEFAULT NOW(),
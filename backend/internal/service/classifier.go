@@ -0,0 +1,377 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"siapp/internal/models"
+)
+
+// ClassifyMinConfidence 自动识别结果被采用的最低置信度
+const ClassifyMinConfidence = 0.5
+
+const (
+	// classifyTitleRows 读取文件开头的行数，用于匹配标题与表头中的险种关键字
+	classifyTitleRows = 3
+	// classifySampleRows 统计费率时最多读取的数据行数
+	classifySampleRows = 200
+)
+
+// 各类线索的权重：文件名最可靠，表格标题次之，费率只能缩小范围
+const (
+	classifyWeightFileName = 0.6
+	classifyWeightTitle    = 0.5
+	classifyWeightRate     = 0.5
+)
+
+// ClassifySignalKind 识别线索的来源
+type ClassifySignalKind string
+
+const (
+	ClassifyByFileName ClassifySignalKind = "file_name"
+	ClassifyByTitle    ClassifySignalKind = "title"
+	ClassifyByRate     ClassifySignalKind = "rate"
+)
+
+// ClassifySource 最终险种/缴费部分的来源
+type ClassifySource string
+
+const (
+	// ClassifiedFromContent 由文件名与内容识别
+	ClassifiedFromContent ClassifySource = "content"
+	// ClassifiedFromForm 识别不确定，采用表单指定的值
+	ClassifiedFromForm ClassifySource = "form"
+	// ClassifiedMixed 险种与缴费部分分别来自识别结果和表单
+	ClassifiedMixed ClassifySource = "mixed"
+)
+
+// ClassifySignal 一条识别线索，Schemes/Parts 为该线索支持的候选值
+type ClassifySignal struct {
+	Kind    ClassifySignalKind `json:"kind"`
+	Text    string             `json:"text"`
+	Schemes []models.Scheme    `json:"schemes,omitempty"`
+	Parts   []models.Part      `json:"parts,omitempty"`
+	Weight  float64            `json:"weight"`
+}
+
+// Classification 险种与缴费部分的识别结果
+type Classification struct {
+	Scheme           models.Scheme    `json:"scheme,omitempty"`
+	Part             models.Part      `json:"part,omitempty"`
+	SchemeConfidence float64          `json:"scheme_confidence"`
+	PartConfidence   float64          `json:"part_confidence"`
+	Confidence       float64          `json:"confidence"`
+	Source           ClassifySource   `json:"source,omitempty"`
+	Signals          []ClassifySignal `json:"signals,omitempty"`
+}
+
+// Confident 判断识别结果是否足以直接采用
+func (c *Classification) Confident() bool {
+	return c.Scheme != "" && c.Part != "" && c.Confidence >= ClassifyMinConfidence
+}
+
+// AmbiguousFileError 无法可靠确定险种或缴费部分时返回，调用方应提示用户指定而不是猜测
+type AmbiguousFileError struct {
+	FileName       string
+	Reason         string
+	Classification *Classification
+}
+
+func (e *AmbiguousFileError) Error() string {
+	return fmt.Sprintf("无法确定文件 %s 的险种和缴费部分：%s", e.FileName, e.Reason)
+}
+
+// schemeKeyword 险种识别关键字，来自险种登记表
+type schemeKeyword struct {
+	scheme   models.Scheme
+	keywords []string
+}
+
+var partKeywords = map[models.Part][]string{
+	models.PartPersonal: {"个人缴纳", "个人部分", "个人缴费", "个人应缴"},
+	models.PartUnit:     {"单位缴纳", "单位部分", "单位缴费", "单位应缴"},
+}
+
+// schemePart 险种与缴费部分的组合
+type schemePart struct {
+	scheme models.Scheme
+	part   models.Part
+}
+
+// rateHints 常见的全国统一或多数地区采用的费率（百分比）。单位医疗、工伤费率因地区
+// 与行业差异较大，只收录常见值；同一费率对应多个组合时只作为缩小范围的线索
+var rateHints = map[string][]schemePart{
+	"8":   {{models.SchemePension, models.PartPersonal}},
+	"16":  {{models.SchemePension, models.PartUnit}},
+	"19":  {{models.SchemePension, models.PartUnit}},
+	"20":  {{models.SchemePension, models.PartUnit}},
+	"2":   {{models.SchemeMedical, models.PartPersonal}},
+	"6":   {{models.SchemeMedical, models.PartUnit}},
+	"7":   {{models.SchemeMedical, models.PartUnit}},
+	"9":   {{models.SchemeMedical, models.PartUnit}},
+	"9.8": {{models.SchemeMedical, models.PartUnit}},
+	"10":  {{models.SchemeMedical, models.PartUnit}},
+	"0.5": {{models.SchemeUnemployment, models.PartPersonal}, {models.SchemeUnemployment, models.PartUnit}},
+	"0.7": {{models.SchemeUnemployment, models.PartUnit}},
+	"0.8": {{models.SchemeUnemployment, models.PartUnit}},
+	"1":   {{models.SchemeSeriousIllness, models.PartUnit}, {models.SchemeUnemployment, models.PartUnit}},
+}
+
+// ClassifySourceFile 根据文件名、表格开头的标题行与费率列识别险种和缴费部分。
+// path 为空时只使用文件名。
+func ClassifySourceFile(path, fileName string, opts ParseOptions) (*Classification, error) {
+	schemes := opts.schemeRegistry()
+	keywords := schemes.keywordList()
+
+	var signals []ClassifySignal
+	name := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	signals = append(signals, keywordSignals(ClassifyByFileName, name, classifyWeightFileName, keywords)...)
+
+	if path != "" {
+		titles, rate, err := sampleSheetForClassify(path, opts.headerSpec(models.HeaderProfileSource))
+		if err != nil {
+			return nil, err
+		}
+		signals = append(signals, keywordSignals(ClassifyByTitle, titles, classifyWeightTitle, keywords)...)
+		if candidates, ok := rateHints[rate]; ok {
+			// 文件名与标题已确定的维度以关键字为准，费率只用于补足其余维度，
+			// 与已确定维度矛盾的费率组合不参与判断
+			known := scoreSignals(signals, schemes)
+			knownScheme := known.Scheme != "" && known.SchemeConfidence >= ClassifyMinConfidence
+			knownPart := known.Part != "" && known.PartConfidence >= ClassifyMinConfidence
+			signal := ClassifySignal{Kind: ClassifyByRate, Text: rate + "%", Weight: classifyWeightRate}
+			for _, c := range candidates {
+				if !schemes.Applies(c.scheme, c.part) ||
+					knownScheme && c.scheme != known.Scheme || knownPart && c.part != known.Part {
+					continue
+				}
+				if !knownScheme {
+					signal.Schemes = appendUnique(signal.Schemes, c.scheme)
+				}
+				if !knownPart {
+					signal.Parts = appendUnique(signal.Parts, c.part)
+				}
+			}
+			if len(signal.Schemes) > 0 || len(signal.Parts) > 0 {
+				signals = append(signals, signal)
+			}
+		}
+	}
+
+	return scoreSignals(signals, schemes), nil
+}
+
+// ResolveSchemePart 确定文件的险种与缴费部分：置信度足够时采用识别结果，否则退回表单指定的值；
+// 两者都不可用，或识别结果与表单不一致时返回 AmbiguousFileError
+func ResolveSchemePart(path, fileName string, opts ParseOptions, formScheme models.Scheme, formPart models.Part) (*Classification, error) {
+	c, err := ClassifySourceFile(path, fileName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var reasons []string
+	fromForm := 0
+	if c.SchemeConfidence < ClassifyMinConfidence || c.Scheme == "" {
+		if formScheme == "" {
+			reasons = append(reasons, "险种无法识别，请指定 scheme")
+		} else {
+			c.Scheme = formScheme
+			fromForm++
+		}
+	} else if formScheme != "" && formScheme != c.Scheme {
+		reasons = append(reasons, fmt.Sprintf("识别为 %s，与指定的险种 %s 不一致", c.Scheme, formScheme))
+	}
+	if c.PartConfidence < ClassifyMinConfidence || c.Part == "" {
+		if formPart == "" {
+			reasons = append(reasons, "缴费部分无法识别，请指定 part")
+		} else {
+			c.Part = formPart
+			fromForm++
+		}
+	} else if formPart != "" && formPart != c.Part {
+		reasons = append(reasons, fmt.Sprintf("识别为 %s，与指定的缴费部分 %s 不一致", c.Part, formPart))
+	}
+	if len(reasons) == 0 && !opts.schemeRegistry().Applies(c.Scheme, c.Part) {
+		reasons = append(reasons, fmt.Sprintf("险种 %s 未启用或不适用于缴费部分 %s", c.Scheme, c.Part))
+	}
+	if len(reasons) > 0 {
+		return nil, &AmbiguousFileError{FileName: fileName, Reason: strings.Join(reasons, "；"), Classification: c}
+	}
+
+	switch fromForm {
+	case 0:
+		c.Source = ClassifiedFromContent
+	case 2:
+		c.Source = ClassifiedFromForm
+	default:
+		c.Source = ClassifiedMixed
+	}
+	return c, nil
+}
+
+// keywordSignals 在文本中匹配险种与缴费部分关键字。命中多个险种时取最长的关键字，
+// 使“大额医疗保险”不会被识别为“医疗保险”；长度相同时按登记表顺序
+func keywordSignals(kind ClassifySignalKind, text string, weight float64, schemes []schemeKeyword) []ClassifySignal {
+	var signals []ClassifySignal
+	var best *ClassifySignal
+	for _, entry := range schemes {
+		for _, keyword := range entry.keywords {
+			if !strings.Contains(text, keyword) {
+				continue
+			}
+			if best == nil || len([]rune(keyword)) > len([]rune(best.Text)) {
+				best = &ClassifySignal{Kind: kind, Text: keyword, Schemes: []models.Scheme{entry.scheme}, Weight: weight}
+			}
+		}
+	}
+	if best != nil {
+		signals = append(signals, *best)
+	}
+
+	// 同一段文字同时出现个人与单位关键字（如合并报表标题）时不作为缴费部分的线索
+	var matched []ClassifySignal
+	for _, part := range []models.Part{models.PartPersonal, models.PartUnit} {
+		if keyword, ok := containsAny(text, partKeywords[part]); ok {
+			matched = append(matched, ClassifySignal{Kind: kind, Text: keyword, Parts: []models.Part{part}, Weight: weight})
+		}
+	}
+	if len(matched) == 1 {
+		signals = append(signals, matched[0])
+	}
+	return signals
+}
+
+// scoreSignals 汇总线索：每条线索的权重平均分配给它支持的候选值，
+// 置信度为得分最高与次高候选之差（上限为1），冲突的线索会相互抵消
+func scoreSignals(signals []ClassifySignal, schemes *SchemeRegistry) *Classification {
+	schemeScores := map[models.Scheme]float64{}
+	partScores := map[models.Part]float64{}
+	for _, s := range signals {
+		for _, scheme := range s.Schemes {
+			schemeScores[scheme] += s.Weight / float64(len(s.Schemes))
+		}
+		for _, part := range s.Parts {
+			partScores[part] += s.Weight / float64(len(s.Parts))
+		}
+	}
+
+	c := &Classification{Signals: signals}
+	c.Scheme, c.SchemeConfidence = topCandidate(schemeScores)
+	c.Part, c.PartConfidence = topCandidate(partScores)
+
+	// 只适用于一个缴费部分的险种（如工伤保险只有单位缴纳）
+	if part, ok := schemes.singlePart(c.Scheme); ok && c.Part == "" {
+		c.Part = part
+		c.PartConfidence = c.SchemeConfidence
+	}
+	c.Confidence = roundConfidence(min(c.SchemeConfidence, c.PartConfidence))
+	c.SchemeConfidence = roundConfidence(c.SchemeConfidence)
+	c.PartConfidence = roundConfidence(c.PartConfidence)
+	return c
+}
+
+func topCandidate[T ~string](scores map[T]float64) (T, float64) {
+	keys := make([]T, 0, len(scores))
+	for k := range scores {
+		keys = append(keys, k)
+	}
+	// 排序保证得分相同时结果稳定
+	sort.Slice(keys, func(i, j int) bool {
+		if scores[keys[i]] != scores[keys[j]] {
+			return scores[keys[i]] > scores[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	var zero T
+	if len(keys) == 0 {
+		return zero, 0
+	}
+	top := scores[keys[0]]
+	second := 0.0
+	if len(keys) > 1 {
+		second = scores[keys[1]]
+	}
+	margin := min(top-second, 1)
+	if margin <= 0 {
+		return zero, 0
+	}
+	return keys[0], margin
+}
+
+func roundConfidence(v float64) float64 {
+	return float64(int(v*100+0.5)) / 100
+}
+
+// sampleSheetForClassify 读取开头的标题行文字，并统计前若干数据行中出现最多的费率
+func sampleSheetForClassify(path string, spec HeaderSpec) (string, string, error) {
+	rows, err := openSheetRows(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var titles []string
+	rateIdx := -1
+	rateCounts := map[string]int{}
+	for rowNum := 0; rows.Next() && rowNum < classifyTitleRows+classifySampleRows; rowNum++ {
+		row := rows.Row()
+		if rowNum < classifyTitleRows {
+			titles = append(titles, strings.Join(row, " "))
+			// 表头可能在标题行之后，取第一个包含费率列的行作为表头
+			if rateIdx < 0 {
+				if idx, ok := spec.indexHeader(row)["rate"]; ok {
+					rateIdx = idx
+					continue
+				}
+			}
+		}
+		if rateIdx < 0 {
+			continue
+		}
+		if rate, ok := normalizeRatePercent(getCell(row, rateIdx)); ok {
+			rateCounts[rate]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", "", err
+	}
+
+	rate, best := "", 0
+	for r, n := range rateCounts {
+		if n > best || (n == best && r < rate) {
+			rate, best = r, n
+		}
+	}
+	return strings.Join(titles, " "), rate, nil
+}
+
+// normalizeRatePercent 将“8%”“0.08”“8”等写法统一为百分比文字（如“8”“0.5”），写法的判断同 ParseRateText；
+// 带定额的费率不能用于识别险种
+func normalizeRatePercent(raw string) (string, bool) {
+	rate, ok := ParseRateText(raw)
+	if !ok || rate.Fixed != 0 || rate.Percent <= 0 {
+		return "", false
+	}
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.4f", rate.Percent), "0"), "."), true
+}
+
+func containsAny(text string, keywords []string) (string, bool) {
+	for _, keyword := range keywords {
+		if strings.Contains(text, keyword) {
+			return keyword, true
+		}
+	}
+	return "", false
+}
+
+func appendUnique[T comparable](values []T, v T) []T {
+	for _, existing := range values {
+		if existing == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"siapp/internal/models"
+)
+
+const classifyCSVHeader = "序号,姓名,证件号码,缴费基数,费率,应缴费额\n"
+
+func TestClassifySourceFile_FileName(t *testing.T) {
+	cases := []struct {
+		name   string
+		scheme models.Scheme
+		part   models.Part
+	}{
+		{"张英俊职工基本养老保险(个人缴纳)_2025-01至2025-01_未申报信息明细.xlsx", models.SchemePension, models.PartPersonal},
+		{"大额医疗保险(单位缴纳)_2025-01.xlsx", models.SchemeSeriousIllness, models.PartUnit},
+		{"工伤保险_2025-01.xlsx", models.SchemeInjury, models.PartUnit},
+	}
+	for _, tc := range cases {
+		c, err := ClassifySourceFile("", tc.name, ParseOptions{})
+		if err != nil {
+			t.Fatalf("识别 %s 失败: %v", tc.name, err)
+		}
+		if c.Scheme != tc.scheme || c.Part != tc.part || !c.Confident() {
+			t.Errorf("%s 识别为 %s/%s（置信度 %.2f），期望 %s/%s", tc.name, c.Scheme, c.Part, c.Confidence, tc.scheme, tc.part)
+		}
+	}
+}
+
+func TestClassifySourceFile_RateAndTitle(t *testing.T) {
+	path := writeTempFile(t, "2025-07.csv", []byte(classifyCSVHeader+
+		"1,张三,110101199001011234,5000,8%,400\n"+
+		"2,李四,110101199001015678,6000,8%,480\n"))
+
+	c, err := ClassifySourceFile(path, "2025-07.csv", ParseOptions{})
+	if err != nil {
+		t.Fatalf("识别失败: %v", err)
+	}
+	if c.Scheme != models.SchemePension || c.Part != models.PartPersonal || !c.Confident() {
+		t.Errorf("8%%费率应识别为养老个人，实际 %+v", c)
+	}
+
+	// 文件名已确定险种时以文件名为准，与之矛盾的费率不用于推断缴费部分
+	c, err = ClassifySourceFile(path, "医疗保险.csv", ParseOptions{})
+	if err != nil {
+		t.Fatalf("识别失败: %v", err)
+	}
+	if c.Scheme != models.SchemeMedical || c.SchemeConfidence < ClassifyMinConfidence || c.PartConfidence >= ClassifyMinConfidence {
+		t.Errorf("险种应按文件名识别为医疗保险且缴费部分不确定，实际 %+v", c)
+	}
+
+	// 文件名同时给出险种与缴费部分时，费率列不能推翻
+	name := "医疗保险(单位缴纳)_2025-01至2025-01_未申报信息明细.csv"
+	path = writeTempFile(t, name, []byte(classifyCSVHeader+
+		"1,张三,110101199001011234,5000,8%,400\n"))
+	c, err = ResolveSchemePart(path, name, ParseOptions{}, "", "")
+	if err != nil {
+		t.Fatalf("文件名已确定险种与缴费部分时应可导入: %v", err)
+	}
+	if c.Scheme != models.SchemeMedical || c.Part != models.PartUnit {
+		t.Errorf("应识别为医疗单位，实际 %+v", c)
+	}
+}
+
+func TestResolveSchemePart(t *testing.T) {
+	// 失业保险个人与单位费率均为0.5%，缴费部分无法从费率判断
+	path := writeTempFile(t, "unemployment.csv", []byte(classifyCSVHeader+
+		"1,张三,110101199001011234,5000,0.5%,25\n"))
+
+	_, err := ResolveSchemePart(path, "失业保险明细.csv", ParseOptions{}, "", "")
+	var ambiguous *AmbiguousFileError
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("缴费部分不确定时应返回 AmbiguousFileError，实际 %v", err)
+	}
+	if ambiguous.Classification.Scheme != models.SchemeUnemployment {
+		t.Errorf("险种应识别为失业保险，实际 %+v", ambiguous.Classification)
+	}
+
+	c, err := ResolveSchemePart(path, "失业保险明细.csv", ParseOptions{}, "", models.PartUnit)
+	if err != nil {
+		t.Fatalf("指定缴费部分后应可导入: %v", err)
+	}
+	if c.Scheme != models.SchemeUnemployment || c.Part != models.PartUnit || c.Source != ClassifiedMixed {
+		t.Errorf("识别结果不符: %+v", c)
+	}
+
+	// 识别结果可靠但与表单不一致时报告而不是任选其一
+	_, err = ResolveSchemePart("", "养老保险(个人缴纳).xlsx", ParseOptions{}, models.SchemeMedical, models.PartPersonal)
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("识别结果与表单不一致时应返回 AmbiguousFileError，实际 %v", err)
+	}
+
+	c, err = ResolveSchemePart("", "明细.xlsx", ParseOptions{}, models.SchemeMedical, models.PartPersonal)
+	if err != nil || c.Source != ClassifiedFromForm || c.Scheme != models.SchemeMedical {
+		t.Errorf("无法识别时应采用表单指定的值: %+v, %v", c, err)
+	}
+}
+
+func TestNormalizeRatePercent(t *testing.T) {
+	cases := map[string]string{"8%": "8", "0.08": "8", "0.005": "0.5", "9.80%": "9.8", "16": "16", "0.5": "0.5", "5‰": "0.5"}
+	for raw, want := range cases {
+		if got, ok := normalizeRatePercent(raw); !ok || got != want {
+			t.Errorf("normalizeRatePercent(%q) = %q，期望 %q", raw, got, want)
+		}
+	}
+	for _, raw := range []string{"按比例", "2%+3", "0"} {
+		if _, ok := normalizeRatePercent(raw); ok {
+			t.Errorf("normalizeRatePercent(%q) 应返回 false", raw)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+)
+
+const (
+	defaultFloorPercent   = 60
+	defaultCeilingPercent = 300
+)
+
+var (
+	// ErrContributionCityRequired 账期未设置参保城市且未指定 city 参数
+	ErrContributionCityRequired = errors.New("请先设置账期的参保城市或指定 city 参数")
+	// ErrContributionRuleNotFound 参保城市没有在账期月份生效的缴费规则
+	ErrContributionRuleNotFound = errors.New("未找到适用于该账期的城市缴费规则")
+)
+
+var yearMonthPattern = regexp.MustCompile(`^\d{4}-(0[1-9]|1[0-2])$`)
+
+// ValidYearMonth 判断是否为 YYYY-MM 格式的月份
+func ValidYearMonth(value string) bool {
+	return yearMonthPattern.MatchString(value)
+}
+
+// ContributionIssue 社保局文件中应缴金额与城市规则计算结果不一致的一行
+type ContributionIssue struct {
+	RecordID       uint          `json:"record_id"`
+	SourceFileID   uint          `json:"source_file_id"`
+	Sequence       int           `json:"sequence"`
+	Name           string        `json:"name"`
+	IDNumber       string        `json:"id_number"`
+	Scheme         models.Scheme `json:"scheme"`
+	Part           models.Part   `json:"part"`
+	PaySalary      models.Money  `json:"pay_salary"`
+	PayBase        models.Money  `json:"pay_base"`
+	ExpectedBase   models.Money  `json:"expected_base"`
+	Rate           float64       `json:"rate"`
+	ExpectedAmount models.Money  `json:"expected_amount"`
+	AmountDue      models.Money  `json:"amount_due"`
+	Difference     models.Money  `json:"difference"` // 社保局应缴金额减去规则计算金额
+	Reasons        []string      `json:"reasons"`
+}
+
+// ContributionCheckResult 按城市缴费规则核对账期应缴金额的结果
+type ContributionCheckResult struct {
+	RuleSet        *models.ContributionRuleSet `json:"rule_set"`
+	BaseFloor      models.Money                `json:"base_floor"`
+	BaseCeiling    models.Money                `json:"base_ceiling"`
+	Checked        int                         `json:"checked"`
+	Mismatched     int                         `json:"mismatched"`
+	Skipped        int                         `json:"skipped"`
+	UnratedSchemes []string                    `json:"unrated_schemes,omitempty"` // 规则中没有费率、未参与核对的险种与缴费部分
+	Issues         []ContributionIssue         `json:"issues"`
+}
+
+// ContributionRuleScope 返回用户可见的城市缴费规则查询
+func ContributionRuleScope(db *gorm.DB, user *models.User) *gorm.DB {
+	return companyScope(db.Model(&models.ContributionRuleSet{}), user)
+}
+
+// companyScope 同公司共享，未设置公司时仅限本人
+func companyScope(query *gorm.DB, user *models.User) *gorm.DB {
+	if user.CompanyID != "" {
+		return query.Where("company_id = ?", user.CompanyID)
+	}
+	return query.Where("user_id = ? AND (company_id = '' OR company_id IS NULL)", user.ID)
+}
+
+// FindContributionRuleSet 查找城市在指定月份生效的缴费规则：生效月份不晚于该月的最新一套
+func FindContributionRuleSet(db *gorm.DB, userID *uint, city, yearMonth string) (*models.ContributionRuleSet, error) {
+	if userID == nil {
+		return nil, ErrContributionRuleNotFound
+	}
+	var user models.User
+	if err := db.Select("id", "company_id").First(&user, *userID).Error; err != nil {
+		return nil, fmt.Errorf("load user: %w", err)
+	}
+	var rs models.ContributionRuleSet
+	err := ContributionRuleScope(db, &user).
+		Where("city = ? AND effective_from <= ?", strings.TrimSpace(city), yearMonth).
+		Order("effective_from DESC").
+		First(&rs).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrContributionRuleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load contribution rule set: %w", err)
+	}
+	return &rs, nil
+}
+
+// ValidateContributionRuleSet 校验城市缴费规则并补齐默认值；schemes 不为空时费率中的险种必须在登记表中
+func ValidateContributionRuleSet(rs *models.ContributionRuleSet, schemes *SchemeRegistry) error {
+	rs.City = strings.TrimSpace(rs.City)
+	rs.EffectiveFrom = strings.TrimSpace(rs.EffectiveFrom)
+	if rs.City == "" {
+		return fmt.Errorf("城市不能为空")
+	}
+	if !yearMonthPattern.MatchString(rs.EffectiveFrom) {
+		return fmt.Errorf("生效月份格式应为 YYYY-MM: %q", rs.EffectiveFrom)
+	}
+	if rs.AverageWage < 0 || rs.FloorPercent < 0 || rs.CeilingPercent < 0 || rs.BaseFloor < 0 || rs.BaseCeiling < 0 || rs.Tolerance < 0 {
+		return fmt.Errorf("社平工资、基数上下限与允许差异不能为负数")
+	}
+	if floor, ceiling := contributionBaseBounds(rs); ceiling > 0 && floor > ceiling {
+		return fmt.Errorf("基数下限 %s 高于上限 %s", floor, ceiling)
+	}
+
+	if len(rs.Rates) == 0 {
+		return fmt.Errorf("至少需要一项费率")
+	}
+	seen := map[string]bool{}
+	for i := range rs.Rates {
+		rate := &rs.Rates[i]
+		rate.Scheme = models.Scheme(strings.TrimSpace(string(rate.Scheme)))
+		if schemes != nil {
+			if _, ok := schemes.Lookup(rate.Scheme); !ok {
+				return fmt.Errorf("无效的险种: %s", rate.Scheme)
+			}
+		} else if rate.Scheme == "" {
+			return fmt.Errorf("费率缺少险种")
+		}
+		if rate.Scheme == models.SchemeHousingFund {
+			return fmt.Errorf("住房公积金不按社保缴费规则核对")
+		}
+		if rate.Part != models.PartPersonal && rate.Part != models.PartUnit {
+			return fmt.Errorf("无效的缴费部分: %s", rate.Part)
+		}
+		if rate.Rate < 0 || rate.Rate > 100 || rate.FixedAmount < 0 {
+			return fmt.Errorf("%s %s 的费率应在 0 到 100 之间，定额不能为负数", rate.Scheme, rate.Part)
+		}
+		key := string(rate.Scheme) + "/" + string(rate.Part)
+		if seen[key] {
+			return fmt.Errorf("费率重复: %s", key)
+		}
+		seen[key] = true
+	}
+	return validateRoundingPolicies(rs.RoundingPolicies, schemes)
+}
+
+// contributionBaseBounds 返回缴费基数下限与上限，上限为 0 表示不限
+func contributionBaseBounds(rs *models.ContributionRuleSet) (models.Money, models.Money) {
+	floor, ceiling := rs.BaseFloor, rs.BaseCeiling
+	if floor == 0 && rs.AverageWage > 0 {
+		percent := rs.FloorPercent
+		if percent == 0 {
+			percent = defaultFloorPercent
+		}
+		floor = rs.AverageWage.MulPercent(percent)
+	}
+	if ceiling == 0 && rs.AverageWage > 0 {
+		percent := rs.CeilingPercent
+		if percent == 0 {
+			percent = defaultCeilingPercent
+		}
+		ceiling = rs.AverageWage.MulPercent(percent)
+	}
+	return floor, ceiling
+}
+
+// clampBase 将申报工资限定在基数上下限之间
+func clampBase(value, floor, ceiling models.Money) models.Money {
+	if value < floor {
+		value = floor
+	}
+	if ceiling > 0 && value > ceiling {
+		value = ceiling
+	}
+	return value
+}
+
+// roundContribution 将以分为单位、可含小数的金额（如基数×费率）按舍入方式与单位取整；
+// 先在万分之一分处消除浮点误差，以免进位或舍去时多出一位。负数（退费）按绝对值舍入
+func roundContribution(fen float64, mode models.RoundingMode, unit models.RoundingUnit) models.Money {
+	step := 1.0
+	switch unit {
+	case models.RoundingJiao:
+		step = 10
+	case models.RoundingYuan:
+		step = 100
+	}
+	scaled := math.Abs(math.Round(fen*1e4) / 1e4 / step)
+	switch mode {
+	case models.RoundingUp:
+		scaled = math.Ceil(scaled)
+	case models.RoundingDown:
+		scaled = math.Floor(scaled)
+	case models.RoundingHalfEven:
+		scaled = math.RoundToEven(scaled)
+	default:
+		scaled = math.Round(scaled)
+	}
+	return models.Money(math.Round(math.Copysign(scaled, fen) * step))
+}
+
+// checkContributions 按规则计算每条记录的应缴金额并与社保局金额比较。
+// 申报工资不为空时以其限定上下限后的结果作为基数，否则以社保局的缴费基数限定上下限；
+// 住房公积金的基数上下限与社保不同，不参与核对。应缴金额按规则中该险种“每条明细”的舍入规则舍入，
+// 没有时四舍五入到分
+func checkContributions(records []models.RawRecord, rs *models.ContributionRuleSet) *ContributionCheckResult {
+	floor, ceiling := contributionBaseBounds(rs)
+	rounding := newRoundingPolicies(rs.RoundingPolicies)
+	rates := make(map[string]models.ContributionRate, len(rs.Rates))
+	for _, rate := range rs.Rates {
+		rates[string(rate.Scheme)+"/"+string(rate.Part)] = rate
+	}
+
+	result := &ContributionCheckResult{
+		RuleSet:     rs,
+		BaseFloor:   floor,
+		BaseCeiling: ceiling,
+		Issues:      []ContributionIssue{},
+	}
+	unrated := map[string]bool{}
+	for _, rec := range records {
+		if rec.FileType == models.FileTypeAdjustment || rec.Scheme == models.SchemeHousingFund {
+			result.Skipped++
+			continue
+		}
+		key := string(rec.Scheme) + "/" + string(rec.Part)
+		rate, ok := rates[key]
+		if !ok {
+			unrated[key] = true
+			result.Skipped++
+			continue
+		}
+		result.Checked++
+
+		declared := rec.PayBase
+		if rec.PaySalary > 0 {
+			declared = rec.PaySalary
+		}
+		expectedBase := clampBase(declared, floor, ceiling)
+		expected := rate.FixedAmount
+		if expected == 0 {
+			expected = rounding.contribution(rec.Scheme, rec.Part, float64(expectedBase)*rate.Rate/100)
+		}
+		diff := rec.AmountDue - expected
+		if diff.Abs() <= rs.Tolerance {
+			continue
+		}
+
+		var reasons []string
+		if rate.FixedAmount == 0 && rec.PayBase != expectedBase {
+			switch {
+			case rec.PayBase < floor:
+				reasons = append(reasons, fmt.Sprintf("缴费基数 %s 低于下限 %s", rec.PayBase, floor))
+			case ceiling > 0 && rec.PayBase > ceiling:
+				reasons = append(reasons, fmt.Sprintf("缴费基数 %s 高于上限 %s", rec.PayBase, ceiling))
+			default:
+				reasons = append(reasons, fmt.Sprintf("缴费基数 %s 与申报工资 %s 确定的基数 %s 不一致", rec.PayBase, rec.PaySalary, expectedBase))
+			}
+		}
+		if rate.FixedAmount > 0 {
+			reasons = append(reasons, fmt.Sprintf("应按定额 %s 缴纳，社保局金额 %s", expected, rec.AmountDue))
+		} else {
+			reasons = append(reasons, fmt.Sprintf("按基数 %s × %g%% 应缴 %s，社保局金额 %s", expectedBase, rate.Rate, expected, rec.AmountDue))
+		}
+		result.Mismatched++
+		result.Issues = append(result.Issues, ContributionIssue{
+			RecordID:       rec.ID,
+			SourceFileID:   rec.SourceFileID,
+			Sequence:       rec.Sequence,
+			Name:           rec.Name,
+			IDNumber:       rec.IDNumber,
+			Scheme:         rec.Scheme,
+			Part:           rec.Part,
+			PaySalary:      rec.PaySalary,
+			PayBase:        rec.PayBase,
+			ExpectedBase:   expectedBase,
+			Rate:           rate.Rate,
+			ExpectedAmount: expected,
+			AmountDue:      rec.AmountDue,
+			Difference:     diff,
+			Reasons:        reasons,
+		})
+	}
+	for key := range unrated {
+		result.UnratedSchemes = append(result.UnratedSchemes, key)
+	}
+	sort.Strings(result.UnratedSchemes)
+	return result
+}
+
+// CheckContributions 按参保城市在账期月份生效的缴费规则核对账期内生效版本的社保局文件，
+// city 为空时使用账期设置的参保城市
+func (p *Processor) CheckContributions(periodID uint, city string) (*ContributionCheckResult, error) {
+	var period models.Period
+	if err := p.db.First(&period, periodID).Error; err != nil {
+		return nil, fmt.Errorf("load period: %w", err)
+	}
+	if city = strings.TrimSpace(city); city == "" {
+		city = period.City
+	}
+	if city == "" {
+		return nil, ErrContributionCityRequired
+	}
+	rs, err := FindContributionRuleSet(p.db, period.UserID, city, period.YearMonth)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []models.RawRecord
+	if err := p.activeRecords().
+		Where("period_id = ? AND file_type = ?", periodID, models.FileTypeNormal).
+		Order("scheme, part, sequence").
+		Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("load raw records: %w", err)
+	}
+	return checkContributions(records, rs), nil
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestRoundContribution(t *testing.T) {
+	cases := []struct {
+		fen  float64
+		mode models.RoundingMode
+		unit models.RoundingUnit
+		want models.Money
+	}{
+		{40012.5, models.RoundingHalfUp, models.RoundingFen, yuan(400.13)},
+		{1230, models.RoundingUp, models.RoundingYuan, yuan(13)},
+		{1200, models.RoundingUp, models.RoundingYuan, yuan(12)},
+		{5678, models.RoundingDown, models.RoundingJiao, yuan(56.7)},
+		{5675, models.RoundingHalfUp, models.RoundingJiao, yuan(56.8)},
+		{5650, models.RoundingHalfEven, models.RoundingYuan, yuan(56)},
+		{5750, models.RoundingHalfEven, models.RoundingYuan, yuan(58)},
+		{-5675, models.RoundingHalfUp, models.RoundingJiao, yuan(-56.8)}, // 退费按绝对值舍入
+		{-5678, models.RoundingDown, models.RoundingJiao, yuan(-56.7)},
+		{0.1 * 3 * 1e4 / 3, models.RoundingUp, models.RoundingFen, yuan(10)}, // 浮点误差不应多进一分
+	}
+	for _, c := range cases {
+		if got := roundContribution(c.fen, c.mode, c.unit); got != c.want {
+			t.Errorf("roundContribution(%v, %s, %s) = %s，期望 %s", c.fen, c.mode, c.unit, got, c.want)
+		}
+	}
+}
+
+func TestCheckContributions(t *testing.T) {
+	rs := &models.ContributionRuleSet{
+		City:          "北京",
+		EffectiveFrom: "2025-01",
+		AverageWage:   yuan(10000), // 下限 6000，上限 30000
+		Rates: []models.ContributionRate{
+			{Scheme: models.SchemePension, Part: models.PartPersonal, Rate: 8},
+			{Scheme: models.SchemeSeriousIllness, Part: models.PartPersonal, FixedAmount: yuan(3)},
+		},
+	}
+	if err := ValidateContributionRuleSet(rs, NewSchemeRegistry(nil)); err != nil {
+		t.Fatalf("规则校验失败: %v", err)
+	}
+	record := func(id uint, scheme models.Scheme, salary, base, amount float64) models.RawRecord {
+		return models.RawRecord{ID: id, Name: "张三", IDNumber: "ID123", Scheme: scheme, Part: models.PartPersonal,
+			PaySalary: yuan(salary), PayBase: yuan(base), AmountDue: yuan(amount), FileType: models.FileTypeNormal}
+	}
+	records := []models.RawRecord{
+		record(1, models.SchemePension, 8000, 8000, 640),   // 一致
+		record(2, models.SchemePension, 5000, 5000, 400),   // 工资低于下限，应按 6000 缴 480
+		record(3, models.SchemePension, 0, 40000, 3200),    // 基数高于上限，应按 30000 缴 2400
+		record(4, models.SchemeSeriousIllness, 0, 8000, 5), // 定额 3 元
+		record(5, models.SchemeMedical, 8000, 8000, 160),   // 规则中没有医疗个人费率
+	}
+
+	result := checkContributions(records, rs)
+	if result.BaseFloor != yuan(6000) || result.BaseCeiling != yuan(30000) {
+		t.Errorf("基数上下限 = %v ~ %v", result.BaseFloor, result.BaseCeiling)
+	}
+	if result.Checked != 4 || result.Mismatched != 3 || result.Skipped != 1 {
+		t.Fatalf("核对统计不符: checked=%d mismatched=%d skipped=%d", result.Checked, result.Mismatched, result.Skipped)
+	}
+	if len(result.UnratedSchemes) != 1 || result.UnratedSchemes[0] != "medical/personal" {
+		t.Errorf("未配置费率的险种 = %v", result.UnratedSchemes)
+	}
+	low := result.Issues[0]
+	if low.RecordID != 2 || low.ExpectedBase != yuan(6000) || low.ExpectedAmount != yuan(480) || low.Difference != yuan(-80) || len(low.Reasons) != 2 {
+		t.Errorf("低于下限的记录不符: %+v", low)
+	}
+	if high := result.Issues[1]; high.ExpectedBase != yuan(30000) || high.ExpectedAmount != yuan(2400) {
+		t.Errorf("高于上限的记录不符: %+v", high)
+	}
+	if fixed := result.Issues[2]; fixed.ExpectedAmount != yuan(3) || fixed.Difference != yuan(2) {
+		t.Errorf("定额险种的记录不符: %+v", fixed)
+	}
+
+	// 允许差异内不视为不一致
+	rs.Tolerance = yuan(100)
+	if result := checkContributions(records, rs); result.Mismatched != 1 {
+		t.Errorf("允许差异 100 元时应只剩高于上限的 1 条，实际 %d", result.Mismatched)
+	}
+
+	// 应缴金额按险种“每条明细”的舍入规则舍入，其他环节的规则不影响核对
+	rs.Tolerance = 0
+	odd := []models.RawRecord{record(6, models.SchemePension, 8001, 8001, 641)} // 640.08 见零进元为 641
+	if result := checkContributions(odd, rs); result.Mismatched != 1 || result.Issues[0].ExpectedAmount != yuan(640.08) {
+		t.Errorf("没有舍入规则时应四舍五入到分: %+v", result.Issues)
+	}
+	rs.RoundingPolicies = []models.RoundingPolicy{{Scheme: models.SchemePension, Mode: models.RoundingUp, Unit: models.RoundingYuan, Scope: models.RoundingPerPerson}}
+	if result := checkContributions(odd, rs); result.Mismatched != 1 {
+		t.Errorf("每人合计的舍入规则不应作用于单条核对，实际 %+v", result.Issues)
+	}
+	rs.RoundingPolicies[0].Scope = models.RoundingPerLine
+	if result := checkContributions(odd, rs); result.Mismatched != 0 {
+		t.Errorf("应按每条明细的舍入规则核对，实际 %+v", result.Issues)
+	}
+}
+
+func TestValidateContributionRuleSet(t *testing.T) {
+	valid := func() *models.ContributionRuleSet {
+		return &models.ContributionRuleSet{
+			City:          " 上海 ",
+			EffectiveFrom: "2025-07",
+			Rates:         []models.ContributionRate{{Scheme: models.SchemePension, Part: models.PartUnit, Rate: 16}},
+		}
+	}
+	rs := valid()
+	if err := ValidateContributionRuleSet(rs, nil); err != nil {
+		t.Fatalf("规则校验失败: %v", err)
+	}
+	if rs.City != "上海" {
+		t.Errorf("默认值不符: %+v", rs)
+	}
+
+	invalid := map[string]func(*models.ContributionRuleSet){
+		"生效月份":   func(rs *models.ContributionRuleSet) { rs.EffectiveFrom = "2025-13" },
+		"下限高于上限": func(rs *models.ContributionRuleSet) { rs.BaseFloor, rs.BaseCeiling = yuan(9000), yuan(8000) },
+		"费率重复":   func(rs *models.ContributionRuleSet) { rs.Rates = append(rs.Rates, rs.Rates[0]) },
+		"未知险种":   func(rs *models.ContributionRuleSet) { rs.Rates[0].Scheme = "unknown" },
+		"舍入方式": func(rs *models.ContributionRuleSet) {
+			rs.RoundingPolicies = []models.RoundingPolicy{{Scheme: models.SchemePension, Mode: "bankers"}}
+		},
+	}
+	for name, mutate := range invalid {
+		rs := valid()
+		mutate(rs)
+		if err := ValidateContributionRuleSet(rs, NewSchemeRegistry(nil)); err == nil {
+			t.Errorf("%s 无效时应报错", name)
+		}
+	}
+}
+
+func TestProcessor_CheckContributions_UsesLatestEffectiveRules(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	db := processor.db
+	if err := db.AutoMigrate(&models.User{}, &models.ContributionRuleSet{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	user := models.User{Username: "hr", Email: "hr@example.com", CompanyID: "acme"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	period := models.Period{UserID: &user.ID, YearMonth: "2025-08", City: "北京"}
+	if err := db.Create(&period).Error; err != nil {
+		t.Fatalf("创建账期失败: %v", err)
+	}
+	rates := []models.ContributionRate{{Scheme: models.SchemePension, Part: models.PartPersonal, Rate: 8}}
+	for _, rs := range []models.ContributionRuleSet{
+		{CompanyID: "acme", City: "北京", EffectiveFrom: "2024-07", BaseFloor: yuan(6000), Rates: rates},
+		{CompanyID: "acme", City: "北京", EffectiveFrom: "2025-07", BaseFloor: yuan(7000), Rates: rates},
+		{CompanyID: "acme", City: "北京", EffectiveFrom: "2025-09", BaseFloor: yuan(8000), Rates: rates},
+	} {
+		if err := db.Create(&rs).Error; err != nil {
+			t.Fatalf("创建规则失败: %v", err)
+		}
+	}
+	if err := db.Create(&models.RawRecord{PeriodID: period.ID, Name: "张三", IDNumber: "ID123", PayBase: yuan(6000), AmountDue: yuan(480),
+		Scheme: models.SchemePension, Part: models.PartPersonal, FileType: models.FileTypeNormal}).Error; err != nil {
+		t.Fatalf("创建记录失败: %v", err)
+	}
+
+	result, err := processor.CheckContributions(period.ID, "")
+	if err != nil {
+		t.Fatalf("核对失败: %v", err)
+	}
+	if result.RuleSet.EffectiveFrom != "2025-07" || result.Mismatched != 1 || result.Issues[0].ExpectedAmount != yuan(560) {
+		t.Errorf("应按 2025-07 生效的规则（下限 7000）核对: %+v", result)
+	}
+
+	if _, err := processor.CheckContributions(period.ID, "上海"); !errors.Is(err, ErrContributionRuleNotFound) {
+		t.Errorf("没有规则的城市应返回 ErrContributionRuleNotFound，实际 %v", err)
+	}
+}
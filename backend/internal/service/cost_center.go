@@ -0,0 +1,339 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+)
+
+var (
+	// ErrInvalidAllocationGroup 分摊报表只能按部门或成本中心分组
+	ErrInvalidAllocationGroup = errors.New("group_by 只能为 department 或 cost_center")
+	// ErrNoAllocationPeriods 所选范围内没有账期
+	ErrNoAllocationPeriods = errors.New("所选范围内没有账期")
+)
+
+// AllocationGroup 分摊报表的分组方式
+type AllocationGroup string
+
+const (
+	AllocationByDepartment AllocationGroup = "department"  // 按扣款明细中的部门
+	AllocationByCostCenter AllocationGroup = "cost_center" // 按成本中心：员工分摊比例优先，其次为部门对应的成本中心
+)
+
+// ParseAllocationGroup 解析分组方式，为空时按部门
+func ParseAllocationGroup(value string) (AllocationGroup, error) {
+	switch AllocationGroup(strings.TrimSpace(value)) {
+	case "", AllocationByDepartment:
+		return AllocationByDepartment, nil
+	case AllocationByCostCenter:
+		return AllocationByCostCenter, nil
+	default:
+		return "", ErrInvalidAllocationGroup
+	}
+}
+
+// CostCenterMappingScope 返回当前用户可见的部门成本中心对应关系，同公司共享
+func CostCenterMappingScope(db *gorm.DB, user *models.User) *gorm.DB {
+	return companyScope(db.Model(&models.CostCenterMapping{}), user)
+}
+
+// CostCenterSplitScope 返回当前用户可见的员工成本中心分摊比例，同公司共享
+func CostCenterSplitScope(db *gorm.DB, user *models.User) *gorm.DB {
+	return companyScope(db.Model(&models.CostCenterSplit{}), user)
+}
+
+// ValidateCostCenterMapping 检查部门与成本中心编码，去掉首尾空白
+func ValidateCostCenterMapping(m *models.CostCenterMapping) error {
+	m.Department = strings.TrimSpace(m.Department)
+	m.CostCenter = strings.TrimSpace(m.CostCenter)
+	m.CostCenterName = strings.TrimSpace(m.CostCenterName)
+	if m.Department == "" {
+		return errors.New("部门不能为空")
+	}
+	if m.CostCenter == "" {
+		return errors.New("成本中心编码不能为空")
+	}
+	return nil
+}
+
+// ValidateCostCenterSplit 检查员工的分摊比例：成本中心不能为空或重复，比例须大于 0 且合计为 100
+func ValidateCostCenterSplit(s *models.CostCenterSplit) error {
+	s.IDNumber = strings.TrimSpace(s.IDNumber)
+	s.Name = strings.TrimSpace(s.Name)
+	if s.IDNumber == "" {
+		return errors.New("证件号码不能为空")
+	}
+	if len(s.Shares) == 0 {
+		return errors.New("至少需要一个成本中心")
+	}
+	seen := map[string]bool{}
+	var total float64
+	for i := range s.Shares {
+		share := &s.Shares[i]
+		share.CostCenter = strings.TrimSpace(share.CostCenter)
+		if share.CostCenter == "" {
+			return errors.New("成本中心编码不能为空")
+		}
+		if seen[share.CostCenter] {
+			return fmt.Errorf("成本中心 %s 重复", share.CostCenter)
+		}
+		seen[share.CostCenter] = true
+		if share.Percent <= 0 {
+			return fmt.Errorf("成本中心 %s 的比例必须大于 0", share.CostCenter)
+		}
+		total += share.Percent
+	}
+	if math.Abs(total-100) > 0.001 {
+		return fmt.Errorf("分摊比例合计为 %g%%，应为 100%%", round2(total))
+	}
+	return nil
+}
+
+// AllocationRow 一个部门或成本中心的扣款合计
+type AllocationRow struct {
+	Key           string               `json:"key"`            // 部门名称或成本中心编码，未分配时为空
+	Name          string               `json:"name,omitempty"` // 成本中心名称
+	Headcount     int                  `json:"headcount"`      // 涉及的人数，分摊到多个成本中心的员工在每个成本中心各计一次
+	Personal      models.SchemeAmounts `json:"personal"`
+	Unit          models.SchemeAmounts `json:"unit"`
+	PersonalTotal models.Money         `json:"personal_total"`
+	UnitTotal     models.Money         `json:"unit_total"`
+	Total         models.Money         `json:"total"`
+}
+
+// AllocationReport 按部门或成本中心汇总的扣款分摊报表，含补退
+type AllocationReport struct {
+	GroupBy         AllocationGroup `json:"group_by"`
+	From            string          `json:"from"`
+	To              string          `json:"to"`
+	Periods         []string        `json:"periods"`     // 有扣款明细的账期
+	Unprocessed     []string        `json:"unprocessed"` // 范围内尚无扣款明细的账期
+	PersonalColumns []ChargeColumn  `json:"personal_columns"`
+	UnitColumns     []ChargeColumn  `json:"unit_columns"`
+	Rows            []AllocationRow `json:"rows"`
+	Totals          AllocationRow   `json:"totals"`
+	Unmapped        []string        `json:"unmapped"` // 按成本中心分组时没有对应成本中心的部门
+}
+
+// allocationCharge 参与分摊的一条扣款明细
+type allocationCharge struct {
+	idNumber   string
+	department string
+	part       models.Part
+	amounts    models.SchemeAmounts
+}
+
+// allocationTarget 扣款分摊到的分组及比例
+type allocationTarget struct {
+	key     string
+	percent float64
+}
+
+type allocationAccumulator struct {
+	row    AllocationRow
+	people map[string]bool
+}
+
+// allocate 按分组汇总扣款明细。按成本中心分组时，员工有分摊比例的按比例拆分，
+// 否则归入所在部门对应的成本中心，都没有时归入未分配（key 为空）
+func allocate(charges []allocationCharge, groupBy AllocationGroup, mappings []models.CostCenterMapping, splits []models.CostCenterSplit) ([]AllocationRow, []string) {
+	departments := make(map[string]models.CostCenterMapping, len(mappings))
+	names := map[string]string{}
+	for _, m := range mappings {
+		departments[m.Department] = m
+		if m.CostCenterName != "" {
+			names[m.CostCenter] = m.CostCenterName
+		}
+	}
+	shares := make(map[string][]models.CostCenterShare, len(splits))
+	for _, s := range splits {
+		shares[s.IDNumber] = s.Shares
+	}
+
+	groups := map[string]*allocationAccumulator{}
+	unmapped := map[string]bool{}
+	group := func(key string) *allocationAccumulator {
+		acc, ok := groups[key]
+		if !ok {
+			acc = &allocationAccumulator{
+				row:    AllocationRow{Key: key, Name: names[key], Personal: models.SchemeAmounts{}, Unit: models.SchemeAmounts{}},
+				people: map[string]bool{},
+			}
+			groups[key] = acc
+		}
+		return acc
+	}
+
+	for _, charge := range charges {
+		department := strings.TrimSpace(charge.department)
+		targets := []allocationTarget{{key: department, percent: 100}}
+		if groupBy == AllocationByCostCenter {
+			if list, ok := shares[strings.TrimSpace(charge.idNumber)]; ok && len(list) > 0 {
+				targets = targets[:0]
+				for _, share := range list {
+					targets = append(targets, allocationTarget{key: share.CostCenter, percent: share.Percent})
+				}
+			} else if m, ok := departments[department]; ok {
+				targets[0].key = m.CostCenter
+			} else {
+				targets[0].key = ""
+				unmapped[department] = true
+			}
+		}
+
+		for scheme, amount := range charge.amounts {
+			for i, part := range splitAmount(amount, targets) {
+				acc := group(targets[i].key)
+				if charge.part == models.PartPersonal {
+					acc.row.Personal[scheme] += part
+				} else {
+					acc.row.Unit[scheme] += part
+				}
+			}
+		}
+		for _, target := range targets {
+			group(target.key).people[charge.idNumber] = true
+		}
+	}
+
+	rows := make([]AllocationRow, 0, len(groups))
+	for _, acc := range groups {
+		row := acc.row
+		row.Headcount = len(acc.people)
+		row.Personal = compactAmounts(row.Personal)
+		row.Unit = compactAmounts(row.Unit)
+		row.PersonalTotal = row.Personal.Total()
+		row.UnitTotal = row.Unit.Total()
+		row.Total = row.PersonalTotal + row.UnitTotal
+		rows = append(rows, row)
+	}
+	// 未分配排在最后
+	sort.Slice(rows, func(i, j int) bool {
+		if (rows[i].Key == "") != (rows[j].Key == "") {
+			return rows[j].Key == ""
+		}
+		return rows[i].Key < rows[j].Key
+	})
+
+	unmappedList := make([]string, 0, len(unmapped))
+	for department := range unmapped {
+		unmappedList = append(unmappedList, department)
+	}
+	sort.Strings(unmappedList)
+	return rows, unmappedList
+}
+
+// splitAmount 按比例拆分金额并舍入到分，尾差计入最后一项，保证拆分后合计不变
+func splitAmount(amount models.Money, targets []allocationTarget) []models.Money {
+	parts := make([]models.Money, len(targets))
+	remaining := amount
+	for i, target := range targets {
+		if i == len(targets)-1 {
+			parts[i] = remaining
+			break
+		}
+		parts[i] = amount.MulPercent(target.percent)
+		remaining -= parts[i]
+	}
+	return parts
+}
+
+// BuildAllocationReport 汇总账期的扣款明细（含补退）并按部门或成本中心分摊；
+// 部门成本中心对应关系与员工分摊比例按 user 所在公司读取
+func (p *Processor) BuildAllocationReport(user *models.User, periods []models.Period, groupBy AllocationGroup) (*AllocationReport, error) {
+	if len(periods) == 0 {
+		return nil, ErrNoAllocationPeriods
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].YearMonth < periods[j].YearMonth })
+	ids := make([]uint, 0, len(periods))
+	for _, period := range periods {
+		ids = append(ids, period.ID)
+	}
+
+	var personal []models.PersonalCharge
+	if err := p.db.Where("period_id IN ?", ids).Find(&personal).Error; err != nil {
+		return nil, fmt.Errorf("load personal charges: %w", err)
+	}
+	var unit []models.UnitCharge
+	if err := p.db.Where("period_id IN ?", ids).Find(&unit).Error; err != nil {
+		return nil, fmt.Errorf("load unit charges: %w", err)
+	}
+
+	processed := map[uint]bool{}
+	charges := make([]allocationCharge, 0, len(personal)+len(unit))
+	for _, c := range personal {
+		processed[c.PeriodID] = true
+		charges = append(charges, allocationCharge{c.IDNumber, c.Department, models.PartPersonal, c.AmountsByScheme()})
+	}
+	for _, c := range unit {
+		processed[c.PeriodID] = true
+		charges = append(charges, allocationCharge{c.IDNumber, c.Department, models.PartUnit, c.AmountsByScheme()})
+	}
+
+	var mappings []models.CostCenterMapping
+	var splits []models.CostCenterSplit
+	if groupBy == AllocationByCostCenter {
+		if err := CostCenterMappingScope(p.db, user).Find(&mappings).Error; err != nil {
+			return nil, fmt.Errorf("load cost center mappings: %w", err)
+		}
+		if err := CostCenterSplitScope(p.db, user).Find(&splits).Error; err != nil {
+			return nil, fmt.Errorf("load cost center splits: %w", err)
+		}
+	}
+	schemes, err := LoadSchemeRegistry(p.db, &user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, unmapped := allocate(charges, groupBy, mappings, splits)
+	report := &AllocationReport{
+		GroupBy:     groupBy,
+		From:        periods[0].YearMonth,
+		To:          periods[len(periods)-1].YearMonth,
+		Periods:     []string{},
+		Unprocessed: []string{},
+		Rows:        rows,
+		Totals:      AllocationRow{Personal: models.SchemeAmounts{}, Unit: models.SchemeAmounts{}},
+		Unmapped:    unmapped,
+	}
+	for _, period := range periods {
+		if processed[period.ID] {
+			report.Periods = append(report.Periods, period.YearMonth)
+		} else {
+			report.Unprocessed = append(report.Unprocessed, period.YearMonth)
+		}
+	}
+
+	people := map[string]bool{}
+	for _, c := range charges {
+		people[c.idNumber] = true
+	}
+	personalAmounts := make([]models.SchemeAmounts, 0, len(rows))
+	unitAmounts := make([]models.SchemeAmounts, 0, len(rows))
+	for _, row := range rows {
+		for scheme, amount := range row.Personal {
+			report.Totals.Personal[scheme] += amount
+		}
+		for scheme, amount := range row.Unit {
+			report.Totals.Unit[scheme] += amount
+		}
+		personalAmounts = append(personalAmounts, row.Personal)
+		unitAmounts = append(unitAmounts, row.Unit)
+	}
+	report.Totals.Headcount = len(people)
+	report.Totals.Personal = compactAmounts(report.Totals.Personal)
+	report.Totals.Unit = compactAmounts(report.Totals.Unit)
+	report.Totals.PersonalTotal = report.Totals.Personal.Total()
+	report.Totals.UnitTotal = report.Totals.Unit.Total()
+	report.Totals.Total = report.Totals.PersonalTotal + report.Totals.UnitTotal
+	report.PersonalColumns = schemes.Columns(models.PartPersonal, personalAmounts...)
+	report.UnitColumns = schemes.Columns(models.PartUnit, unitAmounts...)
+	return report, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func share(costCenter string, percent float64) models.CostCenterShare {
+	return models.CostCenterShare{CostCenter: costCenter, Percent: percent}
+}
+
+func TestValidateCostCenterSplit(t *testing.T) {
+	cases := []struct {
+		shares []models.CostCenterShare
+		valid  bool
+	}{
+		{[]models.CostCenterShare{share("CC01", 60), share(" CC02 ", 40)}, true},
+		{[]models.CostCenterShare{share("CC01", 100)}, true},
+		{[]models.CostCenterShare{share("CC01", 60), share("CC02", 30)}, false},
+		{[]models.CostCenterShare{share("CC01", 50), share("CC01", 50)}, false},
+		{[]models.CostCenterShare{share("CC01", 100), share("CC02", 0)}, false},
+		{[]models.CostCenterShare{share("", 100)}, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		split := models.CostCenterSplit{IDNumber: "A", Shares: c.shares}
+		if err := ValidateCostCenterSplit(&split); (err == nil) != c.valid {
+			t.Errorf("ValidateCostCenterSplit(%+v) = %v，期望有效 %v", c.shares, err, c.valid)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	charges := []allocationCharge{
+		{"A", "财务部", models.PartPersonal, models.SchemeAmounts{models.SchemePension: yuan(400)}},
+		{"A", "财务部", models.PartUnit, models.SchemeAmounts{models.SchemePension: yuan(800)}},
+		{"B", "行政部", models.PartPersonal, models.SchemeAmounts{models.SchemePension: yuan(100)}},
+		{"C", "后勤部", models.PartPersonal, models.SchemeAmounts{models.SchemePension: yuan(50)}},
+	}
+	mappings := []models.CostCenterMapping{
+		{Department: "财务部", CostCenter: "CC01", CostCenterName: "财务"},
+		{Department: "行政部", CostCenter: "CC02", CostCenterName: "行政"},
+	}
+	// B 分摊到三个成本中心，100 元按三分之一拆分时尾差计入最后一项
+	splits := []models.CostCenterSplit{
+		{IDNumber: "B", Shares: []models.CostCenterShare{share("CC01", 33.33), share("CC02", 33.33), share("CC03", 33.34)}},
+	}
+
+	rows, unmapped := allocate(charges, AllocationByDepartment, mappings, splits)
+	if len(rows) != 3 || len(unmapped) != 0 {
+		t.Fatalf("按部门分组结果不符: %+v", rows)
+	}
+	if rows[2].Key != "财务部" || rows[2].PersonalTotal != yuan(400) || rows[2].UnitTotal != yuan(800) || rows[2].Total != yuan(1200) {
+		t.Errorf("财务部合计不符: %+v", rows[2])
+	}
+
+	rows, unmapped = allocate(charges, AllocationByCostCenter, mappings, splits)
+	if len(rows) != 4 || len(unmapped) != 1 || unmapped[0] != "后勤部" {
+		t.Fatalf("按成本中心分组结果不符: %+v / %v", rows, unmapped)
+	}
+	want := []struct {
+		key       string
+		personal  models.Money
+		headcount int
+	}{
+		{"CC01", yuan(433.33), 2},
+		{"CC02", yuan(33.33), 1},
+		{"CC03", yuan(33.34), 1},
+		{"", yuan(50), 1},
+	}
+	var total models.Money
+	for i, w := range want {
+		if rows[i].Key != w.key || rows[i].PersonalTotal != w.personal || rows[i].Headcount != w.headcount {
+			t.Errorf("第 %d 行 = %+v，期望 %s %s %d 人", i, rows[i], w.key, w.personal, w.headcount)
+		}
+		total += rows[i].PersonalTotal
+	}
+	if total != yuan(550) {
+		t.Errorf("拆分后个人合计 = %s，期望 550", total)
+	}
+	if rows[0].Name != "财务" {
+		t.Errorf("成本中心名称 = %q，期望 财务", rows[0].Name)
+	}
+}
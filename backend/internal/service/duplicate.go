@@ -0,0 +1,160 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"siapp/internal/models"
+)
+
+// DuplicatePolicy 控制上传内容与已导入文件相同时的处理方式
+type DuplicatePolicy string
+
+const (
+	// DuplicateWarn 照常导入，并在结果中列出相同内容的已导入文件
+	DuplicateWarn DuplicatePolicy = "warn"
+	// DuplicateReject 拒绝导入
+	DuplicateReject DuplicatePolicy = "reject"
+)
+
+// ParseDuplicatePolicy 解析表单中的 duplicate_policy，空值按 warn 处理
+func ParseDuplicatePolicy(value string) (DuplicatePolicy, error) {
+	switch policy := DuplicatePolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "", DuplicateWarn:
+		return DuplicateWarn, nil
+	case DuplicateReject:
+		return DuplicateReject, nil
+	default:
+		return "", fmt.Errorf("invalid duplicate_policy: %s", value)
+	}
+}
+
+// DuplicateSource 与上传文件内容相同的已导入文件
+type DuplicateSource struct {
+	SourceFileID uint            `json:"source_file_id"`
+	PeriodID     uint            `json:"period_id"`
+	YearMonth    string          `json:"year_month"`
+	SamePeriod   bool            `json:"same_period"`
+	Scheme       models.Scheme   `json:"scheme"`
+	Part         models.Part     `json:"part"`
+	FileType     models.FileType `json:"file_type"`
+	OriginalName string          `json:"original_name"`
+	UploadedAt   time.Time       `json:"uploaded_at"`
+}
+
+// DuplicateFileError 按 DuplicateReject 策略拒绝重复内容时返回
+type DuplicateFileError struct {
+	Matches []DuplicateSource
+}
+
+func (e *DuplicateFileError) Error() string {
+	if len(e.Matches) == 0 {
+		return "文件内容与已导入文件相同"
+	}
+	m := e.Matches[0]
+	if m.SamePeriod {
+		return fmt.Sprintf("文件内容与本账期已导入的文件“%s”相同", m.OriginalName)
+	}
+	return fmt.Sprintf("文件内容与账期 %s 已导入的文件“%s”相同", m.YearMonth, m.OriginalName)
+}
+
+// hashFile 计算文件内容的 SHA-256
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("hash file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FindDuplicateSources 查找同一用户下内容哈希相同的已导入文件，本账期的排在前面。
+// 账期没有归属用户时只在本账期内查找，不跨用户比较
+func (p *Processor) FindDuplicateSources(userID *uint, periodID uint, hash string) ([]DuplicateSource, error) {
+	if hash == "" {
+		return nil, nil
+	}
+
+	query := p.db.Where("content_hash = ?", hash)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	} else {
+		query = query.Where("period_id = ?", periodID)
+	}
+	var sources []models.SourceFile
+	if err := query.Order("uploaded_at DESC").Find(&sources).Error; err != nil {
+		return nil, fmt.Errorf("query duplicate source files: %w", err)
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	periodIDs := make([]uint, 0, len(sources))
+	for _, src := range sources {
+		periodIDs = append(periodIDs, src.PeriodID)
+	}
+	var periods []models.Period
+	if err := p.db.Where("id IN ?", periodIDs).Find(&periods).Error; err != nil {
+		return nil, fmt.Errorf("query periods: %w", err)
+	}
+	yearMonths := make(map[uint]string, len(periods))
+	for _, period := range periods {
+		yearMonths[period.ID] = period.YearMonth
+	}
+
+	matches := make([]DuplicateSource, 0, len(sources))
+	for _, src := range sources {
+		match := DuplicateSource{
+			SourceFileID: src.ID,
+			PeriodID:     src.PeriodID,
+			YearMonth:    yearMonths[src.PeriodID],
+			SamePeriod:   src.PeriodID == periodID,
+			Scheme:       src.Scheme,
+			Part:         src.Part,
+			FileType:     src.FileType,
+			OriginalName: src.OriginalName,
+			UploadedAt:   src.UploadedAt,
+		}
+		if match.SamePeriod {
+			matches = append([]DuplicateSource{match}, matches...)
+		} else {
+			matches = append(matches, match)
+		}
+	}
+	return matches, nil
+}
+
+// checkDuplicateContent 计算文件哈希并按策略处理重复内容，excludeID 为重新解析时的源文件本身
+func (p *Processor) checkDuplicateContent(userID *uint, periodID uint, storedPath string, policy DuplicatePolicy, excludeID uint) (string, []DuplicateSource, error) {
+	hash, err := hashFile(storedPath)
+	if err != nil {
+		return "", nil, err
+	}
+	matches, err := p.FindDuplicateSources(userID, periodID, hash)
+	if err != nil {
+		return "", nil, err
+	}
+	if excludeID != 0 {
+		kept := matches[:0]
+		for _, m := range matches {
+			if m.SourceFileID != excludeID {
+				kept = append(kept, m)
+			}
+		}
+		matches = kept
+	}
+	if len(matches) > 0 && policy == DuplicateReject {
+		return "", nil, &DuplicateFileError{Matches: matches}
+	}
+	return hash, matches, nil
+}
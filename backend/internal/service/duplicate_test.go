@@ -0,0 +1,74 @@
+package service
+
+import (
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestHashFile_SameContentSameHash(t *testing.T) {
+	a := writeTempFile(t, "2025-07.xlsx", []byte("养老保险明细"))
+	b := writeTempFile(t, "2025-08.xlsx", []byte("养老保险明细"))
+	c := writeTempFile(t, "other.xlsx", []byte("医疗保险明细"))
+
+	hashA, err := hashFile(a)
+	if err != nil {
+		t.Fatalf("计算哈希失败: %v", err)
+	}
+	hashB, _ := hashFile(b)
+	hashC, _ := hashFile(c)
+	if hashA != hashB {
+		t.Error("内容相同的文件哈希应一致")
+	}
+	if hashA == hashC {
+		t.Error("内容不同的文件哈希不应一致")
+	}
+	if len(hashA) != 64 {
+		t.Errorf("SHA-256 十六进制长度应为64，实际 %d", len(hashA))
+	}
+}
+
+func TestParseDuplicatePolicy(t *testing.T) {
+	if policy, err := ParseDuplicatePolicy(""); err != nil || policy != DuplicateWarn {
+		t.Errorf("空值应为 warn，实际 %v, %v", policy, err)
+	}
+	if policy, err := ParseDuplicatePolicy(" Reject "); err != nil || policy != DuplicateReject {
+		t.Errorf("应解析为 reject，实际 %v, %v", policy, err)
+	}
+	if _, err := ParseDuplicatePolicy("ignore"); err == nil {
+		t.Error("未知策略应报错")
+	}
+}
+
+func TestDuplicateFileError_Message(t *testing.T) {
+	err := &DuplicateFileError{Matches: []DuplicateSource{{YearMonth: "2025-07", OriginalName: "养老个人.xlsx"}}}
+	if got := err.Error(); got != "文件内容与账期 2025-07 已导入的文件“养老个人.xlsx”相同" {
+		t.Errorf("错误信息不符: %s", got)
+	}
+}
+
+func TestProcessor_FindDuplicateSources_ScopedToOwner(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	alice, bob := uint(1), uint(2)
+	files := []models.SourceFile{
+		{UserID: &alice, PeriodID: 1, OriginalName: "alice.xlsx", ContentHash: "same"},
+		{UserID: &bob, PeriodID: 2, OriginalName: "bob.xlsx", ContentHash: "same"},
+		{PeriodID: 3, OriginalName: "legacy-3.xlsx", ContentHash: "same"},
+		{PeriodID: 4, OriginalName: "legacy-4.xlsx", ContentHash: "same"},
+	}
+	if err := processor.db.Create(&files).Error; err != nil {
+		t.Fatalf("插入文件失败: %v", err)
+	}
+
+	matches, err := processor.FindDuplicateSources(&alice, 5, "same")
+	if err != nil || len(matches) != 1 || matches[0].OriginalName != "alice.xlsx" {
+		t.Errorf("只应找到同一用户的文件: %+v, %v", matches, err)
+	}
+	matches, err = processor.FindDuplicateSources(nil, 3, "same")
+	if err != nil || len(matches) != 1 || matches[0].OriginalName != "legacy-3.xlsx" || !matches[0].SamePeriod {
+		t.Errorf("没有归属用户时只应在本账期内查找: %+v, %v", matches, err)
+	}
+	if matches, _ := processor.FindDuplicateSources(nil, 5, "same"); len(matches) != 0 {
+		t.Errorf("不应跨用户匹配: %+v", matches)
+	}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+	"siapp/internal/storage"
+)
+
+// retentionSweepInterval 清理过期原始文件的间隔
+const retentionSweepInterval = 24 * time.Hour
+
+// FileRetentionFromEnv 读取 SIAPP_FILE_RETENTION_DAYS，未设置或为0表示永久保留原始文件
+func FileRetentionFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("SIAPP_FILE_RETENTION_DAYS"))
+	if raw == "" {
+		return 0
+	}
+	days, err := strconv.Atoi(raw)
+	if err != nil || days < 0 {
+		log.Printf("invalid SIAPP_FILE_RETENTION_DAYS %q, keeping files forever", raw)
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PurgeExpiredFiles 删除早于 cutoff 的原始文件，并标记对应的源文件记录。
+// 只清理已不再生效的版本和已关账账期的源文件；花名册、员工档案等不对应源文件记录的文件，
+// 以及排队或执行中的任务仍要读取的文件不受影响。按租户前缀分别列出存储中的文件，只删除属于该租户的记录。
+// 已导入的记录与处理结果不受影响，只是无法再下载或重新解析原文件。
+func (p *Processor) PurgeExpiredFiles(ctx context.Context, cutoff time.Time) (int, error) {
+	var files []models.SourceFile
+	if err := p.db.Select("id", "period_id", "stored_path").
+		Where("purged_at IS NULL AND stored_path <> ''").
+		Where("active = ? OR period_id IN (?)", false,
+			p.db.Model(&models.Period{}).Select("id").Where("status = ?", models.PeriodClosed)).
+		Find(&files).Error; err != nil {
+		return 0, fmt.Errorf("load source files: %w", err)
+	}
+	if len(files) == 0 {
+		return 0, nil
+	}
+	busy, err := p.pendingJobFiles()
+	if err != nil {
+		return 0, err
+	}
+	groups, err := p.retentionGroups(files)
+	if err != nil {
+		return 0, err
+	}
+
+	prefixes := make([]string, 0, len(groups))
+	for prefix := range groups {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	var purged []string
+	for _, prefix := range prefixes {
+		objects, err := p.store.List(ctx, prefix)
+		if err != nil {
+			return len(purged), fmt.Errorf("list stored files under %s: %w", prefix, err)
+		}
+		modTimes := make(map[string]time.Time, len(objects))
+		for _, obj := range objects {
+			modTimes[obj.Key] = obj.ModTime
+		}
+		for _, key := range groups[prefix] {
+			modTime, ok := modTimes[key]
+			if !ok || !modTime.Before(cutoff) || busy[key] {
+				continue
+			}
+			if err := p.store.Delete(ctx, key); err != nil {
+				return len(purged), fmt.Errorf("delete %s: %w", key, err)
+			}
+			purged = append(purged, key)
+		}
+	}
+
+	now := time.Now()
+	for start := 0; start < len(purged); start += p.batchSize {
+		end := min(start+p.batchSize, len(purged))
+		if err := p.db.Model(&models.SourceFile{}).
+			Where("stored_path IN ? AND purged_at IS NULL", purged[start:end]).
+			Update("purged_at", now).Error; err != nil {
+			return len(purged), fmt.Errorf("mark purged source files: %w", err)
+		}
+	}
+	return len(purged), nil
+}
+
+// retentionGroups 按账期所属租户的存储前缀对待清理的文件分组。
+// 引入租户前缀之前保存的文件（key 不在租户前缀下）按所在目录分组，同样只列出该目录
+func (p *Processor) retentionGroups(files []models.SourceFile) (map[string][]string, error) {
+	periodIDs := make([]uint, 0, len(files))
+	for _, file := range files {
+		periodIDs = append(periodIDs, file.PeriodID)
+	}
+	var periods []models.Period
+	if err := p.db.Select("id", "user_id").Where("id IN ?", periodIDs).Find(&periods).Error; err != nil {
+		return nil, fmt.Errorf("load periods: %w", err)
+	}
+	owners := make(map[uint]*uint, len(periods))
+	var userIDs []uint
+	for _, period := range periods {
+		owners[period.ID] = period.UserID
+		if period.UserID != nil {
+			userIDs = append(userIDs, *period.UserID)
+		}
+	}
+	companies := map[uint]string{}
+	if len(userIDs) > 0 {
+		var users []models.User
+		if err := p.db.Select("id", "company_id").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			return nil, fmt.Errorf("load users: %w", err)
+		}
+		for _, user := range users {
+			companies[user.ID] = user.CompanyID
+		}
+	}
+
+	groups := map[string][]string{}
+	for _, file := range files {
+		userID := owners[file.PeriodID]
+		companyID := ""
+		if userID != nil {
+			companyID = companies[*userID]
+		}
+		prefix := storage.TenantPrefix(companyID, userID) + "/"
+		if !strings.HasPrefix(file.StoredPath, prefix) {
+			prefix = path.Dir(file.StoredPath) + "/"
+		}
+		groups[prefix] = append(groups[prefix], file.StoredPath)
+	}
+	return groups, nil
+}
+
+// pendingJobFiles 排队或执行中的批量上传任务仍要读取的存储 key
+func (p *Processor) pendingJobFiles() (map[string]bool, error) {
+	var jobs []models.Job
+	if err := p.db.Where("type = ? AND status IN ?", models.JobUploadBatch, []models.JobStatus{models.JobQueued, models.JobRunning}).
+		Find(&jobs).Error; err != nil {
+		return nil, fmt.Errorf("load pending jobs: %w", err)
+	}
+	busy := map[string]bool{}
+	for _, job := range jobs {
+		var payload UploadBatchPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			continue
+		}
+		for _, file := range payload.Files {
+			busy[file.StoredPath] = true
+		}
+	}
+	return busy, nil
+}
+
+// StartFileRetention 启动后台协程，每天清理一次超过 retention 的原始文件；retention<=0 时不启动
+func (p *Processor) StartFileRetention(ctx context.Context, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(retentionSweepInterval)
+		defer ticker.Stop()
+		for {
+			count, err := p.PurgeExpiredFiles(ctx, time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("purge expired files: %v", err)
+			} else if count > 0 {
+				log.Printf("purged %d expired file(s)", count)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// legacyUploadPrefixes 引入文件存储之前，StoredPath 保存的是 ./uploads 下的相对路径
+var legacyUploadPrefixes = []string{"./uploads/", "uploads/"}
+
+// MigrateLegacyStoredPaths 将旧版本保存的 uploads/{periodID}/xxx.xlsx 路径改写为存储 key（{periodID}/xxx.xlsx）。
+// 本地存储目录默认就是 ./uploads，因此旧文件无需移动；使用 S3 时需先将 ./uploads 下的内容按相同的相对路径上传到存储桶。
+func MigrateLegacyStoredPaths(db *gorm.DB) error {
+	var files []models.SourceFile
+	if err := db.Select("id", "stored_path").
+		Where("stored_path LIKE ? OR stored_path LIKE ?", "uploads/%", "./uploads/%").
+		Find(&files).Error; err != nil {
+		return fmt.Errorf("load legacy source files: %w", err)
+	}
+	for _, file := range files {
+		key := legacyStorageKey(file.StoredPath)
+		if err := db.Model(&models.SourceFile{}).Where("id = ?", file.ID).Update("stored_path", key).Error; err != nil {
+			return fmt.Errorf("migrate source file %d: %w", file.ID, err)
+		}
+	}
+	if len(files) > 0 {
+		log.Printf("migrated %d legacy stored path(s)", len(files))
+	}
+	return nil
+}
+
+func legacyStorageKey(storedPath string) string {
+	key := strings.ReplaceAll(storedPath, "\\", "/")
+	for _, prefix := range legacyUploadPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return strings.TrimPrefix(key, prefix)
+		}
+	}
+	return key
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"siapp/internal/models"
+)
+
+// HeaderSpec 描述一次解析使用的表头映射：源列名（规范化后）→ 标准字段，以及必需字段
+type HeaderSpec struct {
+	Aliases  map[string]string `json:"aliases"`
+	Required []string          `json:"required"`
+}
+
+// ParseOptions 控制单个文件的解析行为
+type ParseOptions struct {
+	// Header 为空时使用内置表头映射
+	Header *HeaderSpec `json:"header,omitempty"`
+	// MaxRejectedRows 大于0时，被拒绝行数超过该值则整个文件不导入
+	MaxRejectedRows int `json:"max_rejected_rows,omitempty"`
+	// Duplicates 内容与已导入文件相同时的处理方式，空值按 warn 处理
+	Duplicates DuplicatePolicy `json:"duplicates,omitempty"`
+	// Schemes 识别险种使用的登记表，为空时使用内置险种（ParseClassifiedFile 会按上传用户加载）
+	Schemes *SchemeRegistry `json:"-"`
+}
+
+var (
+	sourceRequiredFields = []string{"seq", "name", "id_number", "salary", "base", "rate", "amount_due"}
+	rosterRequiredFields = []string{"id_number", "department"}
+
+	// rosterFallbackHeaders 兼容英文表头的花名册
+	rosterFallbackHeaders = map[string]string{
+		"name":       "name",
+		"idnumber":   "id_number",
+		"id_no":      "id_number",
+		"id":         "id_number",
+		"department": "department",
+		"dept":       "department",
+		"title":      "title",
+		"position":   "title",
+		"remarks":    "remarks",
+		"remark":     "remarks",
+		"note":       "remarks",
+	}
+)
+
+// HeaderFields 返回各类映射方案允许使用的标准字段
+func HeaderFields(kind models.HeaderProfileKind) []string {
+	var fields map[string]bool
+	switch kind {
+	case models.HeaderProfileSource:
+		fields = valueSet(headerMap)
+	case models.HeaderProfileRoster:
+		fields = valueSet(rosterHeaderMap)
+	case models.HeaderProfileHousingFund:
+		fields = valueSet(housingFundHeaderMap)
+	default:
+		return nil
+	}
+	result := make([]string, 0, len(fields))
+	for field := range fields {
+		result = append(result, field)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// DefaultHeaderSpec 返回内置的表头映射
+func DefaultHeaderSpec(kind models.HeaderProfileKind) HeaderSpec {
+	switch kind {
+	case models.HeaderProfileRoster:
+		spec := newHeaderSpec(rosterHeaderMap, rosterRequiredFields)
+		for header, field := range rosterFallbackHeaders {
+			spec.Aliases[normalizeHeader(header)] = field
+		}
+		return spec
+	case models.HeaderProfileHousingFund:
+		return newHeaderSpec(housingFundHeaderMap, housingFundRequiredFields)
+	default:
+		return newHeaderSpec(headerMap, sourceRequiredFields)
+	}
+}
+
+// HeaderSpecFromProfile 在内置映射基础上叠加映射方案中的列名；方案填写了必需字段时取代内置必需字段，
+// 以便导入缺少“缴费工资”“费率”等列的文件。证件号码用于识别员工，始终必需
+func HeaderSpecFromProfile(profile *models.HeaderProfile) HeaderSpec {
+	spec := DefaultHeaderSpec(profile.Kind)
+	for _, mapping := range profile.Mappings {
+		if key := normalizeHeader(mapping.SourceHeader); key != "" {
+			spec.Aliases[key] = mapping.Field
+		}
+	}
+	if len(profile.RequiredFields) == 0 {
+		return spec
+	}
+	spec.Required = []string{"id_number"}
+	for _, field := range profile.RequiredFields {
+		if !slices.Contains(spec.Required, field) {
+			spec.Required = append(spec.Required, field)
+		}
+	}
+	return spec
+}
+
+// ValidateHeaderProfile 校验映射方案中的字段是否为该类型允许的标准字段
+func ValidateHeaderProfile(profile *models.HeaderProfile) error {
+	if strings.TrimSpace(profile.Name) == "" {
+		return fmt.Errorf("映射方案名称不能为空")
+	}
+	allowed := HeaderFields(profile.Kind)
+	if allowed == nil {
+		return fmt.Errorf("不支持的映射方案类型: %s", profile.Kind)
+	}
+	isAllowed := func(field string) bool {
+		idx := sort.SearchStrings(allowed, field)
+		return idx < len(allowed) && allowed[idx] == field
+	}
+
+	seen := map[string]bool{}
+	for _, mapping := range profile.Mappings {
+		key := normalizeHeader(mapping.SourceHeader)
+		if key == "" {
+			return fmt.Errorf("源列名不能为空")
+		}
+		if seen[key] {
+			return fmt.Errorf("源列名重复: %s", mapping.SourceHeader)
+		}
+		seen[key] = true
+		if !isAllowed(mapping.Field) {
+			return fmt.Errorf("未知的标准字段: %s", mapping.Field)
+		}
+	}
+	for _, field := range profile.RequiredFields {
+		if !isAllowed(field) {
+			return fmt.Errorf("未知的必需字段: %s", field)
+		}
+	}
+	return nil
+}
+
+func newHeaderSpec(aliases map[string]string, required []string) HeaderSpec {
+	spec := HeaderSpec{
+		Aliases:  make(map[string]string, len(aliases)),
+		Required: append([]string(nil), required...),
+	}
+	for header, field := range aliases {
+		spec.Aliases[normalizeHeader(header)] = field
+	}
+	return spec
+}
+
+// indexHeader 返回标准字段在表头中的列序号
+func (s HeaderSpec) indexHeader(header []string) map[string]int {
+	indexMap := map[string]int{}
+	for idx, cell := range header {
+		key := normalizeHeader(cell)
+		if key == "" {
+			continue
+		}
+		if field, ok := s.Aliases[key]; ok {
+			indexMap[field] = idx
+		}
+	}
+	return indexMap
+}
+
+// missingRequired 返回表头中缺失的第一个必需字段
+func (s HeaderSpec) missingRequired(indexMap map[string]int) (string, bool) {
+	for _, field := range s.Required {
+		if _, ok := indexMap[field]; !ok {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// rosterFieldLabel 返回花名册字段的中文列名，用于错误提示
+func rosterFieldLabel(field string) string {
+	switch field {
+	case "id_number":
+		return "证件号码"
+	case "department":
+		return "部门"
+	case "name":
+		return "姓名"
+	case "title":
+		return "岗位"
+	case "remarks":
+		return "备注"
+	default:
+		return field
+	}
+}
+
+// cellByField 读取指定标准字段所在列的值，表头中没有该字段时返回空字符串
+func cellByField(row []string, indexMap map[string]int, field string) string {
+	idx, ok := indexMap[field]
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(getCell(row, idx))
+}
+
+func (o ParseOptions) headerSpec(kind models.HeaderProfileKind) HeaderSpec {
+	if o.Header != nil {
+		return *o.Header
+	}
+	return DefaultHeaderSpec(kind)
+}
+
+func (o ParseOptions) schemeRegistry() *SchemeRegistry {
+	if o.Schemes != nil {
+		return o.Schemes
+	}
+	return NewSchemeRegistry(nil)
+}
+
+// normalizeHeader 去除空白、括号并统一小写，使 "应补(退)费额" 与 "应补（退）费额" 等写法一致
+func normalizeHeader(header string) string {
+	return normalizeEmployeeHeader(stripBOM(header))
+}
+
+func valueSet(m map[string]string) map[string]bool {
+	set := make(map[string]bool, len(m))
+	for _, v := range m {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestHeaderSpecFromProfile_LayersOverDefaults(t *testing.T) {
+	profile := &models.HeaderProfile{
+		Name: "海淀区",
+		Kind: models.HeaderProfileSource,
+		Mappings: []models.HeaderMapping{
+			{SourceHeader: "个人缴费基数", Field: "base"},
+			{SourceHeader: "应缴金额（元）", Field: "amount_due"},
+		},
+		RequiredFields: []string{"person_code"},
+	}
+	if err := ValidateHeaderProfile(profile); err != nil {
+		t.Fatalf("映射方案校验失败: %v", err)
+	}
+
+	spec := HeaderSpecFromProfile(profile)
+	header := []string{"序号", "姓名", "证件号码", "缴费工资", "个人缴费基数", "费率", "应缴金额(元)", "人员编号"}
+	indexMap := spec.indexHeader(header)
+	if indexMap["base"] != 4 || indexMap["amount_due"] != 6 {
+		t.Errorf("自定义列名未生效: %v", indexMap)
+	}
+	if field, missing := spec.missingRequired(indexMap); missing {
+		t.Errorf("不应缺少必需列，实际缺少 %s", field)
+	}
+
+	_, missing := spec.missingRequired(spec.indexHeader(header[:7]))
+	if !missing {
+		t.Error("方案要求的必需列 person_code 缺失时应报错")
+	}
+}
+
+func TestHeaderSpecFromProfile_RequiredFieldsReplaceDefaults(t *testing.T) {
+	// 没有缴费工资、费率列的文件
+	header := []string{"姓名", "证件号码", "缴费基数", "应缴费额"}
+	defaults := DefaultHeaderSpec(models.HeaderProfileSource)
+	if _, missing := defaults.missingRequired(defaults.indexHeader(header)); !missing {
+		t.Fatal("内置必需字段应包含缴费工资与费率")
+	}
+
+	spec := HeaderSpecFromProfile(&models.HeaderProfile{
+		Kind:           models.HeaderProfileSource,
+		RequiredFields: []string{"name", "base", "amount_due"},
+	})
+	if field, missing := spec.missingRequired(spec.indexHeader(header)); missing {
+		t.Errorf("方案的必需字段应取代内置必需字段，实际缺少 %s", field)
+	}
+	if field, missing := spec.missingRequired(spec.indexHeader(header[:1])); !missing || field != "id_number" {
+		t.Errorf("证件号码应始终必需，实际 %s, %v", field, missing)
+	}
+
+	spec = HeaderSpecFromProfile(&models.HeaderProfile{Kind: models.HeaderProfileSource})
+	if len(spec.Required) != len(sourceRequiredFields) {
+		t.Errorf("方案没有必需字段时应沿用内置必需字段: %v", spec.Required)
+	}
+}
+
+func TestDefaultHeaderSpec_RosterEnglishHeaders(t *testing.T) {
+	spec := DefaultHeaderSpec(models.HeaderProfileRoster)
+	indexMap := spec.indexHeader([]string{"\uFEFFName", "ID_No", "Dept"})
+	if indexMap["name"] != 0 || indexMap["id_number"] != 1 || indexMap["department"] != 2 {
+		t.Errorf("英文花名册表头识别错误: %v", indexMap)
+	}
+}
+
+func TestValidateHeaderProfile_Rejects(t *testing.T) {
+	cases := map[string]*models.HeaderProfile{
+		"空名称":  {Kind: models.HeaderProfileSource},
+		"未知类型": {Name: "x", Kind: "other"},
+		"未知字段": {Name: "x", Kind: models.HeaderProfileRoster, Mappings: []models.HeaderMapping{{SourceHeader: "基数", Field: "base"}}},
+		"重复列名": {Name: "x", Kind: models.HeaderProfileSource, Mappings: []models.HeaderMapping{
+			{SourceHeader: "基数", Field: "base"},
+			{SourceHeader: " 基数 ", Field: "salary"},
+		}},
+	}
+	for name, profile := range cases {
+		if err := ValidateHeaderProfile(profile); err == nil {
+			t.Errorf("%s: 期望校验失败", name)
+		}
+	}
+}
+
+func TestParseSourceFile_ProfileWithoutSeqAndName(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+	period := models.Period{YearMonth: "2026-05"}
+	if err := processor.db.Create(&period).Error; err != nil {
+		t.Fatalf("创建账期失败: %v", err)
+	}
+	key := "periods/1/pension.csv"
+	content := "证件号码,缴费基数,应缴费额\n110101199001011234,5000,400\n110101199001015678,6000,480\n"
+	if err := store.Put(t.Context(), key, strings.NewReader(content)); err != nil {
+		t.Fatalf("保存文件失败: %v", err)
+	}
+	spec := HeaderSpecFromProfile(&models.HeaderProfile{Kind: models.HeaderProfileSource, RequiredFields: []string{"id_number", "amount_due"}})
+	result, err := processor.ParseSourceFile(period.ID, nil, key, "养老.csv", models.SchemePension, models.PartPersonal, ParseOptions{Header: &spec})
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if result.Imported != 2 || result.Rejected != 0 {
+		t.Errorf("缺少序号、姓名列时应照常导入: %+v", result)
+	}
+	var records []models.RawRecord
+	processor.db.Order("sequence").Find(&records)
+	if len(records) != 2 || records[0].Name != "" || records[0].Sequence != 1 || records[1].Sequence != 2 ||
+		records[0].IDNumber != "110101199001011234" || records[0].AmountDue != yuan(400) {
+		t.Errorf("不应把第一列当作序号或姓名: %+v", records)
+	}
+}
+
+func TestParseRosterFile_ProfileWithoutDepartment(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+	if err := processor.db.AutoMigrate(&models.RosterEntry{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	key := "periods/1/roster.csv"
+	if err := store.Put(t.Context(), key, strings.NewReader("姓名,证件号码\n张三,110101199001011234\n")); err != nil {
+		t.Fatalf("保存文件失败: %v", err)
+	}
+	spec := HeaderSpecFromProfile(&models.HeaderProfile{Kind: models.HeaderProfileRoster, RequiredFields: []string{"id_number"}})
+	if _, err := processor.ParseRosterFile(1, nil, key, "花名册.csv", ParseOptions{Header: &spec}); err == nil || !strings.Contains(err.Error(), "部门") {
+		t.Errorf("缺少部门列时应报错，实际 %v", err)
+	}
+	var count int64
+	processor.db.Model(&models.RosterEntry{}).Count(&count)
+	if count != 0 {
+		t.Errorf("不应把姓名当作部门保存，实际 %d 条", count)
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"siapp/internal/models"
+)
+
+// housingFundHeaderMap 公积金中心汇缴清册的常见列名
+var housingFundHeaderMap = map[string]string{
+	"序号":      "seq",
+	"姓名":      "name",
+	"职工姓名":    "name",
+	"证件号码":    "id_number",
+	"身份证号码":   "id_number",
+	"身份证号":    "id_number",
+	"部门":      "department",
+	"个人账号":    "account_number",
+	"公积金账号":   "account_number",
+	"职工账号":    "account_number",
+	"个人公积金账号": "account_number",
+	"缴存基数":    "base",
+	"月缴存基数":   "base",
+	"工资基数":    "base",
+	"个人月缴存额":  "personal_amount",
+	"个人缴存额":   "personal_amount",
+	"职工月缴存额":  "personal_amount",
+	"单位月缴存额":  "unit_amount",
+	"单位缴存额":   "unit_amount",
+	"个人缴存比例":  "personal_rate",
+	"单位缴存比例":  "unit_rate",
+}
+
+var housingFundRequiredFields = []string{"name", "id_number", "base", "personal_amount", "unit_amount"}
+
+// housingFundHeaderRows 公积金文件表头之前可能有标题行（如“住房公积金汇缴清册”），在前几行中查找表头
+const housingFundHeaderRows = 3
+
+// ParseHousingFundFile 导入住房公积金缴存明细。每行拆成个人与单位两条记录，
+// 与社保险种一样参与汇总与扣款明细，不需要指定缴费部分
+func (p *Processor) ParseHousingFundFile(periodID uint, userID *uint, key, originalName string, opts ParseOptions) (*ParseResult, error) {
+	return p.parseStoredFile(periodID, userID, key, originalName, models.SchemeHousingFund, "", models.FileTypeNormal, opts)
+}
+
+// scanHousingFundSheet 逐行读取并校验公积金文件，签名与 scanSourceSheet 相同；
+// 一行同时包含个人与单位缴存额，分别作为两条记录交给 emit
+func scanHousingFundSheet(periodID uint, userID *uint, storedPath string, scheme models.Scheme, _ models.Part, fileType models.FileType, opts ParseOptions, emit func(models.RawRecord) error) (*sourceScan, error) {
+	rows, err := openSheetRows(storedPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	spec := opts.headerSpec(models.HeaderProfileHousingFund)
+	var header []string
+	var indexMap map[string]int
+	rowNum := 0
+	for rows.Next() {
+		rowNum++
+		header = rows.Row()
+		indexMap = spec.indexHeader(header)
+		if _, missing := spec.missingRequired(indexMap); !missing || rowNum >= housingFundHeaderRows {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if rowNum == 0 {
+		return nil, errors.New("Excel文件中没有数据行，请检查文件内容是否正确")
+	}
+	if key, missing := spec.missingRequired(indexMap); missing {
+		return nil, fmt.Errorf("missing required column: %s", key)
+	}
+
+	now := time.Now()
+	report := newRowReport(header)
+	seenIDs := map[string]int{}
+	count := 0
+	_, hasName := indexMap["name"] // 映射方案可以不要求姓名列
+
+	for rows.Next() {
+		rowNum++
+		row := rows.Row()
+		if isBlankRow(row) {
+			continue
+		}
+		if isSummaryRow(row) {
+			report.warn(rowNum, "", "", "合计行，已忽略")
+			continue
+		}
+		name := cellByField(row, indexMap, "name")
+		idNumber := cellByField(row, indexMap, "id_number")
+		switch {
+		case hasName && name == "":
+			report.reject(rowNum, report.columnName(indexMap["name"], "name"), "", "姓名为空")
+			continue
+		case idNumber == "":
+			report.reject(rowNum, report.columnName(indexMap["id_number"], "id_number"), "", "证件号码为空")
+			continue
+		}
+		if firstRow, ok := seenIDs[idNumber]; ok {
+			report.warn(rowNum, report.columnName(indexMap["id_number"], "id_number"), idNumber, fmt.Sprintf("证件号码与第%d行重复", firstRow))
+		} else {
+			seenIDs[idNumber] = rowNum
+		}
+
+		seq := toInt(cellByField(row, indexMap, "seq"))
+		if seq == 0 {
+			seq = count + 1
+		}
+		base := report.money(rowNum, row, indexMap, "base")
+		amounts := []struct {
+			part      models.Part
+			amount    models.Money
+			rateField string
+		}{
+			{models.PartPersonal, report.money(rowNum, row, indexMap, "personal_amount"), "personal_rate"},
+			{models.PartUnit, report.money(rowNum, row, indexMap, "unit_amount"), "unit_rate"},
+		}
+		for _, a := range amounts {
+			rateText, rate, rateFixed := report.rate(rowNum, row, indexMap, a.rateField, base, a.amount)
+			record := models.RawRecord{
+				UserID:        userID,
+				PeriodID:      periodID,
+				Sequence:      seq,
+				Name:          name,
+				IDNumber:      idNumber,
+				Department:    cellByField(row, indexMap, "department"),
+				PayBase:       base,
+				RateText:      rateText,
+				Rate:          rate,
+				RateFixed:     rateFixed,
+				AmountDue:     a.amount,
+				AmountAdjust:  a.amount,
+				AccountNumber: cellByField(row, indexMap, "account_number"),
+				Scheme:        scheme,
+				Part:          a.part,
+				FileType:      fileType,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			}
+			if err := emit(record); err != nil {
+				return nil, err
+			}
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if report.exceeds(opts.MaxRejectedRows) {
+		return nil, &RejectionThresholdError{Rejected: report.rejected, Limit: opts.MaxRejectedRows, Issues: report.issues}
+	}
+	if count == 0 {
+		return nil, errors.New("Excel文件中没有找到有效的数据行，请检查文件格式和内容")
+	}
+
+	return &sourceScan{
+		header:   header,
+		indexMap: indexMap,
+		report:   report,
+		count:    count,
+	}, nil
+}
+
+// buildHousingFundCharges 按证件号码汇总公积金记录，生成公积金缴存明细；公积金在登记表中停用时不生成
+func buildHousingFundCharges(records []models.RawRecord, roster map[string]models.RosterEntry, schemes *SchemeRegistry, rounding roundingPolicies, now time.Time) []models.HousingFundCharge {
+	if !schemes.Valid(models.SchemeHousingFund) {
+		return nil
+	}
+	chargeMap := map[string]*models.HousingFundCharge{}
+	for _, rec := range records {
+		if rec.Scheme != models.SchemeHousingFund {
+			continue
+		}
+		charge, ok := chargeMap[rec.IDNumber]
+		if !ok {
+			charge = &models.HousingFundCharge{
+				UserID:     rec.UserID,
+				PeriodID:   rec.PeriodID,
+				Name:       rec.Name,
+				IDNumber:   rec.IDNumber,
+				Department: rec.Department,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			}
+			if entry, exists := roster[rec.IDNumber]; exists {
+				if entry.Name != "" {
+					charge.Name = entry.Name
+				}
+				if entry.Department != "" {
+					charge.Department = entry.Department
+				}
+			}
+			chargeMap[rec.IDNumber] = charge
+		}
+		if charge.AccountNumber == "" {
+			charge.AccountNumber = rec.AccountNumber
+		}
+		if charge.Base == 0 {
+			charge.Base = rec.PayBase
+		}
+		switch rec.Part {
+		case models.PartPersonal:
+			charge.Personal += rounding.line(rec)
+		case models.PartUnit:
+			charge.Unit += rounding.line(rec)
+		}
+	}
+
+	charges := make([]models.HousingFundCharge, 0, len(chargeMap))
+	for _, charge := range chargeMap {
+		charge.Personal = rounding.round(models.SchemeHousingFund, models.PartPersonal, models.RoundingPerPerson, charge.Personal)
+		charge.Unit = rounding.round(models.SchemeHousingFund, models.PartUnit, models.RoundingPerPerson, charge.Unit)
+		charge.Total = charge.Personal + charge.Unit
+		charges = append(charges, *charge)
+	}
+	sort.Slice(charges, func(i, j int) bool {
+		return charges[i].IDNumber < charges[j].IDNumber
+	})
+	return charges
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestProcessor_ParseHousingFundFile(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+
+	// 公积金中心汇缴清册：首行为标题，表头在第二行
+	content := "住房公积金汇缴清册\n" +
+		"序号,职工姓名,身份证号码,个人账号,月缴存基数,个人月缴存额,单位月缴存额\n" +
+		"1,张三,110101199001011234,GJJ001,5000,600,600\n" +
+		"2,李四,110101199001015678,GJJ002,6000,720,720\n" +
+		"合计,,,,11000,1320,1320\n"
+	key := "periods/1/housing-fund/gjj.csv"
+	if err := store.Put(t.Context(), key, strings.NewReader(content)); err != nil {
+		t.Fatalf("保存文件失败: %v", err)
+	}
+	result, err := processor.ParseHousingFundFile(1, nil, key, "公积金.csv", ParseOptions{})
+	if err != nil {
+		t.Fatalf("导入公积金文件失败: %v", err)
+	}
+	if result.Imported != 2 || result.File.Scheme != models.SchemeHousingFund {
+		t.Fatalf("导入结果不符: %+v", result)
+	}
+
+	var records []models.RawRecord
+	if err := processor.db.Where("period_id = ?", 1).Order("sequence, part").Find(&records).Error; err != nil {
+		t.Fatalf("读取记录失败: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("每行应拆成个人与单位两条记录，实际 %d 条", len(records))
+	}
+	if records[0].AccountNumber != "GJJ001" || records[0].Part != models.PartPersonal || records[1].Part != models.PartUnit {
+		t.Errorf("记录内容不符: %+v", records[:2])
+	}
+
+	// 与社保记录一起聚合：公积金计入扣款明细小计，基数仍取社保缴费基数
+	records = append(records, models.RawRecord{
+		PeriodID: 1, Name: "张三", IDNumber: "110101199001011234", PayBase: yuan(4000), AmountDue: yuan(320),
+		Scheme: models.SchemePension, Part: models.PartPersonal,
+	})
+	registry := NewSchemeRegistry(nil)
+	aggregates := buildAggregates(records, nil, registry, nil)
+	personal := aggregates.personalCharges[0]
+	if personal.Amounts[models.SchemeHousingFund] != yuan(600) || personal.Subtotal != yuan(920) || personal.Base != yuan(4000) {
+		t.Errorf("个人扣款明细不符: %+v", personal)
+	}
+	if len(aggregates.housingFundCharges) != 2 {
+		t.Fatalf("应生成 2 条公积金缴存明细，实际 %d", len(aggregates.housingFundCharges))
+	}
+	fund := aggregates.housingFundCharges[0]
+	if fund.AccountNumber != "GJJ001" || fund.Base != yuan(5000) || fund.Personal != yuan(600) || fund.Unit != yuan(600) || fund.Total != yuan(1200) {
+		t.Errorf("公积金缴存明细不符: %+v", fund)
+	}
+
+	var labels []string
+	for _, column := range registry.Columns(models.PartPersonal, personal.Amounts) {
+		labels = append(labels, column.Label)
+	}
+	if labels[len(labels)-1] != "住房公积金" {
+		t.Errorf("有公积金金额时导出应增加公积金列: %v", labels)
+	}
+}
@@ -0,0 +1,397 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+)
+
+// jobPollInterval 没有新任务通知时，工作协程轮询任务表的间隔
+const jobPollInterval = 5 * time.Second
+
+const (
+	// jobHeartbeatInterval 运行中的任务刷新心跳的间隔
+	jobHeartbeatInterval = 30 * time.Second
+	// jobStaleAfter 心跳超过该时长未刷新的运行中任务视为所在实例已退出
+	jobStaleAfter = 3 * jobHeartbeatInterval
+)
+
+// ErrJobInterrupted 服务重启时仍在运行且不可恢复的任务以此标记失败
+var ErrJobInterrupted = errors.New("服务重启，任务已中断，请重新提交")
+
+// JobContext 传递给任务函数，用于读取参数、上报进度与保存阶段性结果
+type JobContext struct {
+	context.Context
+	runner *JobRunner
+	job    *models.Job
+}
+
+// Job 返回当前任务
+func (c *JobContext) Job() *models.Job {
+	return c.job
+}
+
+// Decode 将任务参数解析到 v
+func (c *JobContext) Decode(v any) error {
+	if len(c.job.Payload) == 0 {
+		return errors.New("任务参数为空")
+	}
+	return json.Unmarshal(c.job.Payload, v)
+}
+
+// Progress 更新任务进度（0-100）与提示信息
+func (c *JobContext) Progress(percent int, message string) {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	c.job.Progress = percent
+	c.job.Message = message
+	if err := c.runner.db.Model(&models.Job{}).Where("id = ?", c.job.ID).
+		Updates(map[string]any{"progress": percent, "message": message}).Error; err != nil {
+		log.Printf("job %d: update progress: %v", c.job.ID, err)
+	}
+}
+
+// Checkpoint 保存阶段性结果，任务恢复运行时可通过 Partial 读取
+func (c *JobContext) Checkpoint(partial any) error {
+	data, err := json.Marshal(partial)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+	c.job.Result = data
+	// 按列更新时不经过序列化器，直接写入 JSON 文本
+	return c.runner.db.Model(&models.Job{}).Where("id = ?", c.job.ID).
+		Update("result", string(data)).Error
+}
+
+// Partial 读取上次运行保存的阶段性结果，没有时返回 false
+func (c *JobContext) Partial(v any) (bool, error) {
+	if len(c.job.Result) == 0 || string(c.job.Result) == "null" {
+		return false, nil
+	}
+	if err := json.Unmarshal(c.job.Result, v); err != nil {
+		return false, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	return true, nil
+}
+
+// JobFunc 执行一种类型的任务，返回值会以 JSON 保存为任务结果
+type JobFunc func(ctx *JobContext) (any, error)
+
+type jobDefinition struct {
+	run       JobFunc
+	resumable bool
+}
+
+// JobRunner 基于任务表的后台任务池。任务先写入数据库再由工作协程领取，
+// 因此 SQLite 与 PostgreSQL 均可使用，服务重启后未完成的任务也不会丢失。
+// 多个实例共用任务表时，每个实例以 owner 标识自己领取的任务，并定期刷新心跳
+type JobRunner struct {
+	db      *gorm.DB
+	workers int
+	owner   string
+	defs    map[models.JobType]jobDefinition
+	wake    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewJobRunner(db *gorm.DB, workers int) *JobRunner {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &JobRunner{
+		db:      db,
+		workers: workers,
+		owner:   runnerOwner(),
+		defs:    map[models.JobType]jobDefinition{},
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// runnerOwner 生成实例标识：主机名、进程号与启动时间，重启后的进程不会与旧进程混淆
+func runnerOwner() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
+// Register 注册任务类型。resumable 表示任务可安全地重新执行，服务重启时会重新排队而不是标记失败
+func (r *JobRunner) Register(jobType models.JobType, resumable bool, run JobFunc) {
+	r.defs[jobType] = jobDefinition{run: run, resumable: resumable}
+}
+
+// Enqueue 创建任务并通知工作协程
+func (r *JobRunner) Enqueue(userID, periodID *uint, jobType models.JobType, payload any) (*models.Job, error) {
+	def, ok := r.defs[jobType]
+	if !ok {
+		return nil, fmt.Errorf("unknown job type: %s", jobType)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode job payload: %w", err)
+	}
+
+	job := models.Job{
+		UserID:    userID,
+		PeriodID:  periodID,
+		Type:      jobType,
+		Status:    models.JobQueued,
+		Message:   "等待执行",
+		Payload:   data,
+		Resumable: def.resumable,
+	}
+	if err := r.db.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("create job: %w", err)
+	}
+	r.notify()
+	return &job, nil
+}
+
+// Recover 处理所在实例已退出的任务（心跳超过 jobStaleAfter 未刷新）：可恢复的任务重新排队，其余标记为失败。
+// 其他实例仍在执行的任务心跳持续刷新，不受影响
+func (r *JobRunner) Recover() error {
+	staleBefore := time.Now().Add(-jobStaleAfter)
+	stale := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", models.JobRunning, staleBefore)
+	}
+	var running []models.Job
+	if err := stale(r.db).Find(&running).Error; err != nil {
+		return fmt.Errorf("load interrupted jobs: %w", err)
+	}
+	now := time.Now()
+	recovered := 0
+	for _, job := range running {
+		updates := map[string]any{"owner": ""}
+		if job.Resumable {
+			updates["status"] = models.JobQueued
+			updates["message"] = "服务重启，等待继续执行"
+		} else {
+			updates["status"] = models.JobFailed
+			updates["error"] = ErrJobInterrupted.Error()
+			updates["message"] = "任务已中断"
+			updates["finished_at"] = now
+		}
+		// 以心跳仍过期为条件更新，期间恢复心跳的任务不受影响
+		res := stale(r.db.Model(&models.Job{}).Where("id = ?", job.ID)).Updates(updates)
+		if res.Error != nil {
+			return fmt.Errorf("recover job %d: %w", job.ID, res.Error)
+		}
+		recovered += int(res.RowsAffected)
+	}
+	if recovered > 0 {
+		log.Printf("recovered %d interrupted job(s)", recovered)
+		r.notify()
+	}
+	return nil
+}
+
+// Start 启动工作协程，并定期回收其他实例遗留的任务；ctx 取消后协程在当前任务结束后退出
+func (r *JobRunner) Start(ctx context.Context) {
+	for i := 0; i < r.workers; i++ {
+		r.wg.Add(1)
+		go r.work(ctx)
+	}
+	r.wg.Add(1)
+	go r.reap(ctx)
+	r.notify()
+}
+
+// reap 定期执行 Recover，使其他实例退出后遗留的任务无需等到本实例重启即可继续
+func (r *JobRunner) reap(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(jobStaleAfter)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Recover(); err != nil {
+				log.Printf("recover jobs: %v", err)
+			}
+		}
+	}
+}
+
+// Wait 等待所有工作协程退出
+func (r *JobRunner) Wait() {
+	r.wg.Wait()
+}
+
+func (r *JobRunner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *JobRunner) work(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			job, err := r.claim()
+			if err != nil {
+				log.Printf("claim job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			// 可能还有排队的任务，唤醒其他协程
+			r.notify()
+			r.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim 以条件更新的方式领取最早排队的任务，保证同一任务只被一个协程执行
+func (r *JobRunner) claim() (*models.Job, error) {
+	for {
+		// 使用 Find 而非 First，空队列时不产生 record not found 日志
+		var candidates []models.Job
+		if err := r.db.Where("status = ?", models.JobQueued).Order("id ASC").Limit(1).Find(&candidates).Error; err != nil {
+			return nil, err
+		}
+		if len(candidates) == 0 {
+			return nil, nil
+		}
+		job := candidates[0]
+
+		now := time.Now()
+		res := r.db.Model(&models.Job{}).
+			Where("id = ? AND status = ?", job.ID, models.JobQueued).
+			Updates(map[string]any{
+				"status":       models.JobRunning,
+				"attempts":     gorm.Expr("attempts + 1"),
+				"started_at":   now,
+				"message":      "执行中",
+				"owner":        r.owner,
+				"heartbeat_at": now,
+			})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue // 已被其他协程领取
+		}
+		job.Status = models.JobRunning
+		job.Attempts++
+		job.StartedAt = &now
+		job.Owner = r.owner
+		job.HeartbeatAt = &now
+		return &job, nil
+	}
+}
+
+func (r *JobRunner) run(ctx context.Context, job *models.Job) {
+	stop := r.heartbeat(job)
+	result, err := r.execute(ctx, job)
+	stop()
+
+	now := time.Now()
+	updates := map[string]any{"finished_at": now}
+	if err != nil && ctx.Err() != nil {
+		// 服务停止导致任务中断：可恢复的任务交还队列，由下次启动或其他实例继续
+		updates = map[string]any{"owner": ""}
+		if job.Resumable {
+			updates["status"] = models.JobQueued
+			updates["message"] = "服务停止，等待继续执行"
+		} else {
+			updates["status"] = models.JobFailed
+			updates["error"] = ErrJobInterrupted.Error()
+			updates["message"] = "任务已中断"
+			updates["finished_at"] = now
+		}
+	} else if err != nil {
+		updates["status"] = models.JobFailed
+		updates["error"] = err.Error()
+		updates["message"] = "执行失败"
+	} else {
+		data, encErr := json.Marshal(result)
+		if encErr != nil {
+			updates["status"] = models.JobFailed
+			updates["error"] = fmt.Sprintf("encode job result: %v", encErr)
+			updates["message"] = "执行失败"
+		} else {
+			updates["status"] = models.JobSucceeded
+			updates["result"] = string(data)
+			updates["progress"] = 100
+			updates["message"] = "已完成"
+		}
+	}
+	// 心跳超时后任务可能已被其他实例重新领取，只有仍归本实例所有时才写入结果
+	res := r.db.Model(&models.Job{}).Where("id = ? AND owner = ?", job.ID, r.owner).Updates(updates)
+	if res.Error != nil {
+		log.Printf("job %d: save result: %v", job.ID, res.Error)
+	} else if res.RowsAffected == 0 {
+		log.Printf("job %d: owned by another runner, result discarded", job.ID)
+	}
+}
+
+// heartbeat 在任务执行期间定期刷新心跳，返回的函数用于停止刷新
+func (r *JobRunner) heartbeat(job *models.Job) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := r.db.Model(&models.Job{}).Where("id = ? AND owner = ?", job.ID, r.owner).
+					Update("heartbeat_at", time.Now()).Error; err != nil {
+					log.Printf("job %d: update heartbeat: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (r *JobRunner) execute(ctx context.Context, job *models.Job) (result any, err error) {
+	def, ok := r.defs[job.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown job type: %s", job.Type)
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("job %d panic: %v\n%s", job.ID, rec, debug.Stack())
+			err = fmt.Errorf("任务执行异常: %v", rec)
+		}
+	}()
+	return def.run(&JobContext{Context: ctx, runner: r, job: job})
+}
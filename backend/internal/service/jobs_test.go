@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+)
+
+func createJobTempTable(t *testing.T, tx *gorm.DB) {
+	t.Helper()
+	if err := tx.Exec(`CREATE TEMP TABLE jobs (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT,
+		period_id BIGINT,
+		type TEXT NOT NULL,
+		status TEXT NOT NULL,
+		progress INTEGER DEFAULT 0,
+		message TEXT,
+		payload TEXT,
+		result TEXT,
+		error TEXT,
+		attempts INTEGER DEFAULT 0,
+		resumable BOOLEAN DEFAULT FALSE,
+		started_at TIMESTAMPTZ,
+		finished_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW(),
+		owner TEXT,
+		heartbeat_at TIMESTAMPTZ
+	) ON COMMIT DROP`).Error; err != nil {
+		_ = tx.Rollback()
+		t.Fatalf("创建任务临时表失败: %v", err)
+	}
+}
+
+// runNextJob 在测试协程中同步领取并执行一个任务
+func runNextJob(t *testing.T, runner *JobRunner) *models.Job {
+	t.Helper()
+	job, err := runner.claim()
+	if err != nil {
+		t.Fatalf("领取任务失败: %v", err)
+	}
+	if job == nil {
+		t.Fatal("没有可领取的任务")
+	}
+	runner.run(context.Background(), job)
+
+	var saved models.Job
+	if err := runner.db.First(&saved, job.ID).Error; err != nil {
+		t.Fatalf("读取任务失败: %v", err)
+	}
+	return &saved
+}
+
+func TestJobRunner_RunAndCheckpoint(t *testing.T) {
+	db := setupTestDB(t)
+	tx := newTestTransaction(t, db)
+	defer tx.Rollback()
+	createJobTempTable(t, tx)
+
+	runner := NewJobRunner(tx, 1)
+	runner.Register(models.JobProcessPeriod, true, func(ctx *JobContext) (any, error) {
+		var payload PeriodJobPayload
+		if err := ctx.Decode(&payload); err != nil {
+			return nil, err
+		}
+		ctx.Progress(50, "处理中")
+		return map[string]uint{"period_id": payload.PeriodID}, nil
+	})
+	runner.Register(models.JobProcessAdjustments, false, func(ctx *JobContext) (any, error) {
+		return nil, errors.New("没有补退数据")
+	})
+
+	job, err := runner.Enqueue(nil, nil, models.JobProcessPeriod, PeriodJobPayload{PeriodID: 7})
+	if err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	if job.Status != models.JobQueued || !job.Resumable {
+		t.Errorf("新任务状态不符: %+v", job)
+	}
+
+	done := runNextJob(t, runner)
+	if done.Status != models.JobSucceeded || done.Progress != 100 || done.Attempts != 1 {
+		t.Errorf("任务应成功完成: %+v", done)
+	}
+	if string(done.Result) != `{"period_id":7}` {
+		t.Errorf("任务结果不符: %s", done.Result)
+	}
+
+	if _, err := runner.Enqueue(nil, nil, models.JobProcessAdjustments, PeriodJobPayload{PeriodID: 7}); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	failed := runNextJob(t, runner)
+	if failed.Status != models.JobFailed || failed.Error != "没有补退数据" {
+		t.Errorf("任务应失败并记录错误: %+v", failed)
+	}
+}
+
+func TestJobRunner_Recover(t *testing.T) {
+	db := setupTestDB(t)
+	tx := newTestTransaction(t, db)
+	defer tx.Rollback()
+	createJobTempTable(t, tx)
+
+	runner := NewJobRunner(tx, 1)
+	stale := time.Now().Add(-2 * jobStaleAfter)
+	fresh := time.Now()
+	jobs := []models.Job{
+		{Type: models.JobProcessPeriod, Status: models.JobRunning, Resumable: true, Owner: "old", HeartbeatAt: &stale},
+		{Type: models.JobProcessAdjustments, Status: models.JobRunning, Resumable: false},
+		{Type: models.JobProcessPeriod, Status: models.JobSucceeded, Resumable: true},
+		// 其他实例仍在执行的任务心跳未过期，不应被回收
+		{Type: models.JobProcessPeriod, Status: models.JobRunning, Resumable: true, Owner: "replica", HeartbeatAt: &fresh},
+	}
+	if err := tx.Create(&jobs).Error; err != nil {
+		t.Fatalf("插入任务失败: %v", err)
+	}
+
+	if err := runner.Recover(); err != nil {
+		t.Fatalf("恢复任务失败: %v", err)
+	}
+
+	expected := []models.JobStatus{models.JobQueued, models.JobFailed, models.JobSucceeded, models.JobRunning}
+	for i, job := range jobs {
+		var saved models.Job
+		if err := tx.First(&saved, job.ID).Error; err != nil {
+			t.Fatalf("读取任务失败: %v", err)
+		}
+		if saved.Status != expected[i] {
+			t.Errorf("任务 %d 恢复后状态应为 %s，实际 %s", i, expected[i], saved.Status)
+		}
+	}
+}
+
+func TestJobContext_Partial(t *testing.T) {
+	ctx := &JobContext{job: &models.Job{Result: []byte(`{"items":[{"original_name":"a.xlsx","imported":3}]}`)}}
+	var result UploadBatchResult
+	ok, err := ctx.Partial(&result)
+	if err != nil || !ok {
+		t.Fatalf("读取阶段性结果失败: %v", err)
+	}
+	if len(result.Items) != 1 || result.Items[0].Imported != 3 {
+		t.Errorf("阶段性结果不符: %+v", result)
+	}
+
+	empty := &JobContext{job: &models.Job{}}
+	if ok, _ := empty.Partial(&result); ok {
+		t.Error("没有阶段性结果时应返回 false")
+	}
+}
+
+func TestJobRunner_StaleRecoveryAndShutdown(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	runner := NewJobRunner(processor.db, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	runner.Register(models.JobProcessPeriod, true, func(jc *JobContext) (any, error) {
+		cancel()
+		return nil, jc.Err()
+	})
+
+	job, err := runner.Enqueue(nil, nil, models.JobProcessPeriod, PeriodJobPayload{PeriodID: 1})
+	if err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	claimed, err := runner.claim()
+	if err != nil || claimed == nil || claimed.Owner != runner.owner || claimed.HeartbeatAt == nil {
+		t.Fatalf("领取任务应记录所属实例与心跳: %+v, %v", claimed, err)
+	}
+
+	// 心跳未过期的运行中任务属于仍在运行的实例，不回收
+	other := NewJobRunner(processor.db, 1)
+	if err := other.Recover(); err != nil {
+		t.Fatalf("恢复任务失败: %v", err)
+	}
+	var saved models.Job
+	processor.db.First(&saved, job.ID)
+	if saved.Status != models.JobRunning {
+		t.Fatalf("心跳正常的任务不应被回收，实际 %s", saved.Status)
+	}
+
+	// 服务停止时中断的可恢复任务交还队列
+	runner.run(ctx, claimed)
+	processor.db.First(&saved, job.ID)
+	if saved.Status != models.JobQueued || saved.Owner != "" {
+		t.Errorf("服务停止后可恢复的任务应重新排队: %+v", saved)
+	}
+}
+
+func TestJobRunner_RunDiscardsResultAfterReclaim(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	runner := NewJobRunner(processor.db, 1)
+	runner.Register(models.JobProcessPeriod, true, func(jc *JobContext) (any, error) {
+		return "done", nil
+	})
+
+	job, err := runner.Enqueue(nil, nil, models.JobProcessPeriod, PeriodJobPayload{PeriodID: 1})
+	if err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	claimed, err := runner.claim()
+	if err != nil || claimed == nil {
+		t.Fatalf("领取任务失败: %+v, %v", claimed, err)
+	}
+
+	// 心跳超时后任务已被其他实例重新领取，原实例的结果不应覆盖
+	if err := processor.db.Model(&models.Job{}).Where("id = ?", job.ID).Update("owner", "other").Error; err != nil {
+		t.Fatalf("更新任务失败: %v", err)
+	}
+	runner.run(context.Background(), claimed)
+
+	var saved models.Job
+	processor.db.First(&saved, job.ID)
+	if saved.Status != models.JobRunning || saved.Owner != "other" || saved.FinishedAt != nil {
+		t.Errorf("已被其他实例领取的任务不应写入原实例的结果: %+v", saved)
+	}
+}
+
+func TestProcessor_UploadBatchJob_SkipsCommittedFiles(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+	db := processor.db
+	period := models.Period{YearMonth: "2026-05"}
+	if err := db.Create(&period).Error; err != nil {
+		t.Fatalf("创建账期失败: %v", err)
+	}
+	key := "periods/1/pension.csv"
+	content := "序号,姓名,证件号码,缴费工资,缴费基数,费率,应缴费额\n1,张三,110101199001011234,5000,5000,8%,400\n"
+	if err := store.Put(t.Context(), key, strings.NewReader(content)); err != nil {
+		t.Fatalf("保存文件失败: %v", err)
+	}
+	opts := ParseOptions{Duplicates: DuplicateReject}
+
+	// 上次运行已提交导入，但在保存进度前中断
+	if _, err := processor.ParseSourceFile(period.ID, nil, key, "pension.csv", models.SchemePension, models.PartPersonal, opts); err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+
+	runner := NewJobRunner(db, 1)
+	processor.RegisterJobs(runner)
+	payload := UploadBatchPayload{PeriodID: period.ID, Options: opts, Files: []UploadBatchFile{
+		{StoredPath: key, OriginalName: "pension.csv", Scheme: models.SchemePension, Part: models.PartPersonal},
+	}}
+	if _, err := runner.Enqueue(nil, &period.ID, models.JobUploadBatch, payload); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	job, err := runner.claim()
+	if err != nil || job == nil {
+		t.Fatalf("领取任务失败: %v", err)
+	}
+	out, err := processor.runUploadBatchJob(&JobContext{Context: t.Context(), runner: runner, job: job})
+	if err != nil {
+		t.Fatalf("执行任务失败: %v", err)
+	}
+	items := out.(UploadBatchResult).Items
+	if len(items) != 1 || items[0].Error != "" || items[0].Imported != 1 || items[0].SourceFileID == 0 {
+		t.Fatalf("已提交的文件应直接记录结果: %+v", items)
+	}
+	var files int64
+	db.Model(&models.SourceFile{}).Where("period_id = ?", period.ID).Count(&files)
+	if files != 1 {
+		t.Errorf("恢复后不应重复导入，实际 %d 个源文件", files)
+	}
+}
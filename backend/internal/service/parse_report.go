@@ -0,0 +1,206 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"siapp/internal/models"
+)
+
+// RowIssueLevel 行问题级别：rejected 表示该行未导入，warning 表示已导入但数据可疑
+type RowIssueLevel string
+
+const (
+	RowIssueRejected RowIssueLevel = "rejected"
+	RowIssueWarning  RowIssueLevel = "warning"
+)
+
+// RowIssue 描述源文件中被拒绝或可疑的一行
+type RowIssue struct {
+	Row    int           `json:"row"` // 表格中的行号（表头为第1行）
+	Column string        `json:"column,omitempty"`
+	Value  string        `json:"value,omitempty"`
+	Reason string        `json:"reason"`
+	Level  RowIssueLevel `json:"level"`
+}
+
+// RejectionThresholdError 被拒绝行数超过 ParseOptions.MaxRejectedRows 时返回，整个文件不会导入
+type RejectionThresholdError struct {
+	Rejected int
+	Limit    int
+	Issues   []RowIssue
+}
+
+func (e *RejectionThresholdError) Error() string {
+	return fmt.Sprintf("被拒绝的数据行共%d行，超过允许的%d行，文件未导入", e.Rejected, e.Limit)
+}
+
+// summaryRowMarkers 社保局导出文件末尾的合计行标记，此类行不计入拒绝行
+var summaryRowMarkers = []string{"合计", "总计", "小计"}
+
+// maxReportedIssues 单个文件最多保留的问题行明细，超出部分只计数，避免大文件占用过多内存
+const maxReportedIssues = 1000
+
+// rowReport 收集解析过程中每行的问题
+type rowReport struct {
+	header    []string
+	issues    []RowIssue
+	rejected  int
+	truncated bool
+}
+
+func newRowReport(header []string) *rowReport {
+	return &rowReport{header: header}
+}
+
+// columnName 返回列在源文件中的表头文字，便于用户对照原文件
+func (r *rowReport) columnName(idx int, field string) string {
+	if idx >= 0 && idx < len(r.header) {
+		if name := strings.TrimSpace(stripBOM(r.header[idx])); name != "" {
+			return name
+		}
+	}
+	return field
+}
+
+func (r *rowReport) reject(row int, column, value, reason string) {
+	r.rejected++
+	r.add(RowIssue{Row: row, Column: column, Value: value, Reason: reason, Level: RowIssueRejected})
+}
+
+func (r *rowReport) warn(row int, column, value, reason string) {
+	r.add(RowIssue{Row: row, Column: column, Value: value, Reason: reason, Level: RowIssueWarning})
+}
+
+func (r *rowReport) add(issue RowIssue) {
+	if len(r.issues) >= maxReportedIssues {
+		r.truncated = true
+		return
+	}
+	r.issues = append(r.issues, issue)
+}
+
+// money 按十进制精确解析指定字段的金额，无法识别时记录警告并按0处理
+func (r *rowReport) money(rowNum int, row []string, indexMap map[string]int, field string) models.Money {
+	idx, ok := indexMap[field]
+	if !ok {
+		return 0
+	}
+	raw := getCell(row, idx)
+	value, err := models.ParseMoney(raw)
+	if err != nil {
+		r.warn(rowNum, r.columnName(idx, field), raw, "无法识别的数值，已按0处理")
+	}
+	return value
+}
+
+// exceeds 判断被拒绝行数是否超过阈值（limit<=0 表示不限制）
+func (r *rowReport) exceeds(limit int) bool {
+	return limit > 0 && r.rejected > limit
+}
+
+// isBlankRow 判断整行是否为空
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(stripBOM(cell)) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// isSummaryRow 判断是否为合计/小计行
+func isSummaryRow(row []string) bool {
+	for _, cell := range row {
+		cell = strings.ReplaceAll(strings.TrimSpace(cell), " ", "")
+		for _, marker := range summaryRowMarkers {
+			if strings.HasPrefix(cell, marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rate 读取并解析费率文字，不带百分号的小数按缴费基数与应缴金额判断写法；无法识别时记录警告，数值按0处理
+func (r *rowReport) rate(rowNum int, row []string, indexMap map[string]int, field string, base, amount models.Money) (string, float64, models.Money) {
+	idx, ok := indexMap[field]
+	if !ok {
+		return "", 0, 0
+	}
+	text := strings.TrimSpace(getCell(row, idx))
+	if text == "" {
+		return "", 0, 0
+	}
+	rate, ok := parseRecordRate(text, base, amount)
+	if !ok {
+		r.warn(rowNum, r.columnName(idx, field), text, "无法识别的费率，不参与基数×费率核对")
+	}
+	return text, rate.Percent, rate.Fixed
+}
+
+// month 读取费款所属期并统一为 YYYY-MM，无法识别时记录警告并留空
+func (r *rowReport) month(rowNum int, row []string, indexMap map[string]int, field string) string {
+	idx, ok := indexMap[field]
+	if !ok {
+		return ""
+	}
+	raw := getCell(row, idx)
+	month, ok := parseContributionMonth(raw)
+	if !ok {
+		r.warn(rowNum, r.columnName(idx, field), raw, "无法识别的费款所属期，已留空")
+	}
+	return month
+}
+
+// parseContributionMonth 将费款所属期统一为 YYYY-MM，兼容 202405、20240501、2024-05、2024.5、
+// 2024年5月与 Excel 日期序号；空值返回空字符串，无法识别时 ok 为 false
+func parseContributionMonth(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", true
+	}
+	// Excel 中设为日期格式的单元格读出来是序号，20000 约为 1954 年
+	if f, err := strconv.ParseFloat(value, 64); err == nil && f >= 20000 && f < 100000 {
+		t, err := excelize.ExcelDateToTime(f, false)
+		if err != nil {
+			return "", false
+		}
+		return t.Format("2006-01"), true
+	}
+
+	clean := strings.NewReplacer("年", "-", "月", "", "日", "", ".", "-", "/", "-", " ", "").Replace(value)
+	if _, err := strconv.Atoi(clean); err == nil {
+		switch len(clean) {
+		case 6, 8:
+			clean = clean[:4] + "-" + clean[4:6]
+		default:
+			return "", false
+		}
+	}
+	for _, layout := range []string{"2006-1", "2006-1-2"} {
+		if t, err := time.Parse(layout, clean); err == nil {
+			return t.Format("2006-01"), true
+		}
+	}
+	return "", false
+}
+
+// parseNumber 解析序号、比例等数值，兼容千分位与百分号；空值视为0，无法识别时 ok 为 false
+func parseNumber(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	value = strings.ReplaceAll(value, ",", "")
+	value = strings.TrimSuffix(value, "%")
+	if value == "" {
+		return 0, true
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
@@ -0,0 +1,92 @@
+package service
+
+import "testing"
+
+func TestParseNumber(t *testing.T) {
+	cases := []struct {
+		raw   string
+		want  float64
+		valid bool
+	}{
+		{"1,234.50", 1234.5, true},
+		{"8%", 8, true},
+		{"", 0, true},
+		{"－", 0, false},
+		{"12元", 0, false},
+	}
+	for _, tc := range cases {
+		got, ok := parseNumber(tc.raw)
+		if got != tc.want || ok != tc.valid {
+			t.Errorf("parseNumber(%q) = %v,%v，期望 %v,%v", tc.raw, got, ok, tc.want, tc.valid)
+		}
+	}
+}
+
+func TestRowReport(t *testing.T) {
+	header := []string{"序号", "姓名", "缴费基数"}
+	indexMap := map[string]int{"seq": 0, "name": 1, "base": 2}
+	report := newRowReport(header)
+
+	if v := report.money(2, []string{"1", "张三", "5,000.10"}, indexMap, "base"); v != yuan(5000.1) {
+		t.Errorf("基数解析错误: %v", v)
+	}
+	if v := report.money(3, []string{"2", "李四", "N/A"}, indexMap, "base"); v != 0 {
+		t.Errorf("无法识别的数值应按0处理，实际 %v", v)
+	}
+	report.reject(4, report.columnName(indexMap["name"], "name"), "", "姓名为空")
+
+	if len(report.issues) != 2 || report.rejected != 1 {
+		t.Fatalf("问题行统计错误: %+v", report.issues)
+	}
+	warning := report.issues[0]
+	if warning.Row != 3 || warning.Column != "缴费基数" || warning.Value != "N/A" || warning.Level != RowIssueWarning {
+		t.Errorf("警告内容不符: %+v", warning)
+	}
+	if report.issues[1].Column != "姓名" || report.issues[1].Level != RowIssueRejected {
+		t.Errorf("拒绝行内容不符: %+v", report.issues[1])
+	}
+	if report.exceeds(0) {
+		t.Error("阈值为0时不应限制")
+	}
+	if report.exceeds(1) {
+		t.Error("拒绝行数等于阈值时不应失败")
+	}
+	report.reject(5, "序号", "", "序号为空")
+	if !report.exceeds(1) {
+		t.Error("拒绝行数超过阈值时应失败")
+	}
+}
+
+func TestIsSummaryRow(t *testing.T) {
+	if !isSummaryRow([]string{"", "合 计", "", "125000"}) {
+		t.Error("应识别合计行")
+	}
+	if isSummaryRow([]string{"1", "张三", "110101199001011234"}) {
+		t.Error("普通数据行不应识别为合计行")
+	}
+}
+
+func TestParseContributionMonth(t *testing.T) {
+	cases := []struct {
+		raw   string
+		want  string
+		valid bool
+	}{
+		{"202405", "2024-05", true},
+		{"20240501", "2024-05", true},
+		{"2024-05", "2024-05", true},
+		{"2024.5", "2024-05", true},
+		{"2024/05/31", "2024-05", true},
+		{"2024年5月", "2024-05", true},
+		{"45413", "2024-05", true}, // Excel 日期序号 2024-05-01
+		{"", "", true},
+		{"202413", "", false},
+		{"2024-01至2024-03", "", false},
+	}
+	for _, tc := range cases {
+		got, ok := parseContributionMonth(tc.raw)
+		if got != tc.want || ok != tc.valid {
+			t.Errorf("parseContributionMonth(%q) = %q,%v，期望 %q,%v", tc.raw, got, ok, tc.want, tc.valid)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"siapp/internal/models"
+)
+
+// ErrNoPreviousPeriod 没有更早的账期可供比较
+var ErrNoPreviousPeriod = errors.New("没有更早的账期可供比较")
+
+// DiffPerson 增员或减员的人员及其扣款金额
+type DiffPerson struct {
+	IDNumber     string       `json:"id_number"`
+	Name         string       `json:"name"`
+	Department   string       `json:"department"`
+	PersonalBase models.Money `json:"personal_base"`
+	UnitBase     models.Money `json:"unit_base"`
+	Personal     models.Money `json:"personal"` // 个人扣款小计
+	Unit         models.Money `json:"unit"`     // 单位扣款小计
+}
+
+// DiffPeopleSection 增员或减员
+type DiffPeopleSection struct {
+	Count         int          `json:"count"`
+	PersonalTotal models.Money `json:"personal_total"`
+	UnitTotal     models.Money `json:"unit_total"`
+	People        []DiffPerson `json:"people"`
+}
+
+// DiffBaseChange 两个账期都在的人员缴费基数变化
+type DiffBaseChange struct {
+	IDNumber   string       `json:"id_number"`
+	Name       string       `json:"name"`
+	Department string       `json:"department"`
+	Part       models.Part  `json:"part"`
+	Before     models.Money `json:"before"`
+	After      models.Money `json:"after"`
+	Delta      models.Money `json:"delta"`
+}
+
+// DiffBaseSection 基数变化
+type DiffBaseSection struct {
+	Count         int              `json:"count"`
+	PersonalDelta models.Money     `json:"personal_delta"`
+	UnitDelta     models.Money     `json:"unit_delta"`
+	Changes       []DiffBaseChange `json:"changes"`
+}
+
+// DiffAmountChange 两个账期都在的人员某险种金额变化
+type DiffAmountChange struct {
+	IDNumber   string        `json:"id_number"`
+	Name       string        `json:"name"`
+	Department string        `json:"department"`
+	Scheme     models.Scheme `json:"scheme"`
+	SchemeName string        `json:"scheme_name"`
+	Part       models.Part   `json:"part"`
+	Before     models.Money  `json:"before"`
+	After      models.Money  `json:"after"`
+	Delta      models.Money  `json:"delta"`
+}
+
+// DiffSchemeTotal 某险种某缴费部分的金额变化及其构成：增员 + 减员 + 在册人员变化 = 变化合计
+type DiffSchemeTotal struct {
+	Scheme     models.Scheme `json:"scheme"`
+	SchemeName string        `json:"scheme_name"`
+	Part       models.Part   `json:"part"`
+	Before     models.Money  `json:"before"`
+	After      models.Money  `json:"after"`
+	Delta      models.Money  `json:"delta"`
+	Additions  models.Money  `json:"additions"`
+	Removals   models.Money  `json:"removals"`
+	Changes    models.Money  `json:"changes"`
+}
+
+// DiffAmountSection 各险种金额变化
+type DiffAmountSection struct {
+	Count   int                `json:"count"`
+	Totals  []DiffSchemeTotal  `json:"totals"`
+	Changes []DiffAmountChange `json:"changes"`
+}
+
+// DiffDepartmentMove 部门调动
+type DiffDepartmentMove struct {
+	IDNumber string `json:"id_number"`
+	Name     string `json:"name"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+}
+
+// DiffDepartmentSection 部门调动
+type DiffDepartmentSection struct {
+	Count int                  `json:"count"`
+	Moves []DiffDepartmentMove `json:"moves"`
+}
+
+// DiffPartTotal 某缴费部分的扣款合计变化，补退金额单独列出
+type DiffPartTotal struct {
+	Part             models.Part  `json:"part"`
+	Before           models.Money `json:"before"`
+	After            models.Money `json:"after"`
+	Delta            models.Money `json:"delta"`
+	AdjustmentBefore models.Money `json:"adjustment_before"`
+	AdjustmentAfter  models.Money `json:"adjustment_after"`
+}
+
+// PeriodDiff 两个账期扣款明细的变化分析，Against 为比较的基准账期（通常为上月）
+type PeriodDiff struct {
+	PeriodID         uint                  `json:"period_id"`
+	YearMonth        string                `json:"year_month"`
+	AgainstID        uint                  `json:"against_id"`
+	AgainstYearMonth string                `json:"against_year_month"`
+	Totals           []DiffPartTotal       `json:"totals"`
+	Additions        DiffPeopleSection     `json:"additions"`
+	Removals         DiffPeopleSection     `json:"removals"`
+	BaseChanges      DiffBaseSection       `json:"base_changes"`
+	AmountChanges    DiffAmountSection     `json:"amount_changes"`
+	DepartmentMoves  DiffDepartmentSection `json:"department_moves"`
+}
+
+// diffCharge 一人某缴费部分的扣款
+type diffCharge struct {
+	base    models.Money
+	amounts models.SchemeAmounts
+	total   models.Money
+}
+
+// diffPerson 一个账期中的一人
+type diffPerson struct {
+	name       string
+	department string
+	parts      map[models.Part]diffCharge
+}
+
+// periodCharges 一个账期的扣款明细（不含补退），按证件号码索引
+type periodCharges struct {
+	people      map[string]*diffPerson
+	adjustments map[models.Part]models.Money
+}
+
+func (c *periodCharges) person(id, name, department string) *diffPerson {
+	person, ok := c.people[id]
+	if !ok {
+		person = &diffPerson{name: name, department: department, parts: map[models.Part]diffCharge{}}
+		c.people[id] = person
+	}
+	return person
+}
+
+// loadPeriodCharges 读取账期的扣款明细；账期尚未处理时按生效版本的导入记录现场汇总
+func (p *Processor) loadPeriodCharges(period *models.Period, schemes *SchemeRegistry) (*periodCharges, error) {
+	var personal []models.PersonalCharge
+	if err := p.db.Where("period_id = ?", period.ID).Find(&personal).Error; err != nil {
+		return nil, fmt.Errorf("load personal charges: %w", err)
+	}
+	var unit []models.UnitCharge
+	if err := p.db.Where("period_id = ?", period.ID).Find(&unit).Error; err != nil {
+		return nil, fmt.Errorf("load unit charges: %w", err)
+	}
+
+	regular := 0
+	for _, c := range personal {
+		if !c.IsAdjustment {
+			regular++
+		}
+	}
+	for _, c := range unit {
+		if !c.IsAdjustment {
+			regular++
+		}
+	}
+	if regular == 0 {
+		var records []models.RawRecord
+		if err := p.activeRecords().Where("period_id = ? AND file_type = ?", period.ID, models.FileTypeNormal).Find(&records).Error; err != nil {
+			return nil, fmt.Errorf("load raw records: %w", err)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("账期 %s 没有扣款明细或导入记录", period.YearMonth)
+		}
+		var rosterEntries []models.RosterEntry
+		if err := p.db.Where("period_id = ?", period.ID).Find(&rosterEntries).Error; err != nil {
+			return nil, fmt.Errorf("load roster entries: %w", err)
+		}
+		roster := make(map[string]models.RosterEntry, len(rosterEntries))
+		for _, entry := range rosterEntries {
+			if entry.IDNumber != "" {
+				roster[entry.IDNumber] = entry
+			}
+		}
+		rounding, err := p.loadRoundingPolicies(period)
+		if err != nil {
+			return nil, err
+		}
+		result := buildAggregates(records, roster, schemes, rounding)
+		personal = append(personal, result.personalCharges...)
+		unit = append(unit, result.unitCharges...)
+	}
+
+	charges := &periodCharges{people: map[string]*diffPerson{}, adjustments: map[models.Part]models.Money{}}
+	for _, c := range personal {
+		if c.IsAdjustment {
+			charges.adjustments[models.PartPersonal] += c.Subtotal
+			continue
+		}
+		charges.person(c.IDNumber, c.Name, c.Department).parts[models.PartPersonal] = diffCharge{c.Base, c.AmountsByScheme(), c.Subtotal}
+	}
+	for _, c := range unit {
+		if c.IsAdjustment {
+			charges.adjustments[models.PartUnit] += c.Subtotal
+			continue
+		}
+		charges.person(c.IDNumber, c.Name, c.Department).parts[models.PartUnit] = diffCharge{c.Base, c.AmountsByScheme(), c.Subtotal}
+	}
+	return charges, nil
+}
+
+// PreviousPeriod 返回同一用户 YearMonth 早于指定账期的最近一个账期
+func (p *Processor) PreviousPeriod(period *models.Period) (*models.Period, error) {
+	var previous models.Period
+	query := p.db.Where("year_month < ?", period.YearMonth)
+	if period.UserID != nil {
+		query = query.Where("user_id = ?", *period.UserID)
+	}
+	if err := query.Order("year_month DESC").Limit(1).Find(&previous).Error; err != nil {
+		return nil, fmt.Errorf("load previous period: %w", err)
+	}
+	if previous.ID == 0 {
+		return nil, ErrNoPreviousPeriod
+	}
+	return &previous, nil
+}
+
+// DiffPeriods 比较两个账期的扣款明细：增员、减员、基数变化、各险种金额变化与部门调动
+func (p *Processor) DiffPeriods(period, against *models.Period) (*PeriodDiff, error) {
+	schemes, err := LoadSchemeRegistry(p.db, period.UserID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := p.loadPeriodCharges(period, schemes)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := p.loadPeriodCharges(against, schemes)
+	if err != nil {
+		return nil, err
+	}
+	diff := diffPeriodCharges(previous, current, schemes)
+	diff.PeriodID, diff.YearMonth = period.ID, period.YearMonth
+	diff.AgainstID, diff.AgainstYearMonth = against.ID, against.YearMonth
+	return diff, nil
+}
+
+// diffPeriodCharges 比较基准账期 before 与当前账期 after
+func diffPeriodCharges(before, after *periodCharges, schemes *SchemeRegistry) *PeriodDiff {
+	diff := &PeriodDiff{
+		Additions:       DiffPeopleSection{People: []DiffPerson{}},
+		Removals:        DiffPeopleSection{People: []DiffPerson{}},
+		BaseChanges:     DiffBaseSection{Changes: []DiffBaseChange{}},
+		AmountChanges:   DiffAmountSection{Changes: []DiffAmountChange{}},
+		DepartmentMoves: DiffDepartmentSection{Moves: []DiffDepartmentMove{}},
+	}
+	parts := []models.Part{models.PartPersonal, models.PartUnit}
+
+	type schemeKey struct {
+		scheme models.Scheme
+		part   models.Part
+	}
+	totals := map[schemeKey]*DiffSchemeTotal{}
+	total := func(scheme models.Scheme, part models.Part) *DiffSchemeTotal {
+		key := schemeKey{scheme, part}
+		if _, ok := totals[key]; !ok {
+			totals[key] = &DiffSchemeTotal{Scheme: scheme, SchemeName: schemes.Name(scheme), Part: part}
+		}
+		return totals[key]
+	}
+	toPerson := func(id string, person *diffPerson) DiffPerson {
+		return DiffPerson{
+			IDNumber:     id,
+			Name:         person.name,
+			Department:   person.department,
+			PersonalBase: person.parts[models.PartPersonal].base,
+			UnitBase:     person.parts[models.PartUnit].base,
+			Personal:     person.parts[models.PartPersonal].total,
+			Unit:         person.parts[models.PartUnit].total,
+		}
+	}
+
+	ids := map[string]bool{}
+	for id := range before.people {
+		ids[id] = true
+	}
+	for id := range after.people {
+		ids[id] = true
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	for _, id := range sorted {
+		old, hadBefore := before.people[id]
+		cur, hasAfter := after.people[id]
+		for _, part := range parts {
+			if hadBefore {
+				for scheme, amount := range old.parts[part].amounts {
+					total(scheme, part).Before += amount
+				}
+			}
+			if hasAfter {
+				for scheme, amount := range cur.parts[part].amounts {
+					total(scheme, part).After += amount
+				}
+			}
+		}
+
+		switch {
+		case !hadBefore:
+			person := toPerson(id, cur)
+			diff.Additions.People = append(diff.Additions.People, person)
+			diff.Additions.PersonalTotal += person.Personal
+			diff.Additions.UnitTotal += person.Unit
+			for _, part := range parts {
+				for scheme, amount := range cur.parts[part].amounts {
+					total(scheme, part).Additions += amount
+				}
+			}
+			continue
+		case !hasAfter:
+			person := toPerson(id, old)
+			diff.Removals.People = append(diff.Removals.People, person)
+			diff.Removals.PersonalTotal += person.Personal
+			diff.Removals.UnitTotal += person.Unit
+			for _, part := range parts {
+				for scheme, amount := range old.parts[part].amounts {
+					total(scheme, part).Removals -= amount
+				}
+			}
+			continue
+		}
+
+		if old.department != cur.department {
+			diff.DepartmentMoves.Moves = append(diff.DepartmentMoves.Moves, DiffDepartmentMove{
+				IDNumber: id, Name: cur.name, From: old.department, To: cur.department,
+			})
+		}
+		for _, part := range parts {
+			oldCharge, curCharge := old.parts[part], cur.parts[part]
+			if delta := curCharge.base - oldCharge.base; delta != 0 {
+				diff.BaseChanges.Changes = append(diff.BaseChanges.Changes, DiffBaseChange{
+					IDNumber: id, Name: cur.name, Department: cur.department, Part: part,
+					Before: oldCharge.base, After: curCharge.base, Delta: delta,
+				})
+				if part == models.PartPersonal {
+					diff.BaseChanges.PersonalDelta += delta
+				} else {
+					diff.BaseChanges.UnitDelta += delta
+				}
+			}
+
+			changed := map[models.Scheme]bool{}
+			for scheme := range oldCharge.amounts {
+				changed[scheme] = true
+			}
+			for scheme := range curCharge.amounts {
+				changed[scheme] = true
+			}
+			for _, def := range schemeOrder(changed, schemes) {
+				delta := curCharge.amounts[def] - oldCharge.amounts[def]
+				if delta == 0 {
+					continue
+				}
+				total(def, part).Changes += delta
+				diff.AmountChanges.Changes = append(diff.AmountChanges.Changes, DiffAmountChange{
+					IDNumber: id, Name: cur.name, Department: cur.department,
+					Scheme: def, SchemeName: schemes.Name(def), Part: part,
+					Before: oldCharge.amounts[def], After: curCharge.amounts[def], Delta: delta,
+				})
+			}
+		}
+	}
+
+	diff.Additions.Count = len(diff.Additions.People)
+	diff.Removals.Count = len(diff.Removals.People)
+	diff.BaseChanges.Count = len(diff.BaseChanges.Changes)
+	diff.AmountChanges.Count = len(diff.AmountChanges.Changes)
+	diff.DepartmentMoves.Count = len(diff.DepartmentMoves.Moves)
+
+	partTotals := map[models.Part]*DiffPartTotal{}
+	for _, part := range parts {
+		partTotals[part] = &DiffPartTotal{
+			Part:             part,
+			AdjustmentBefore: before.adjustments[part],
+			AdjustmentAfter:  after.adjustments[part],
+		}
+	}
+	for _, t := range totals {
+		t.Delta = t.After - t.Before
+		partTotals[t.Part].Before += t.Before
+		partTotals[t.Part].After += t.After
+		// 两个账期都没有金额的险种（如未上传单位文件）不列出
+		if t.Before == 0 && t.After == 0 && t.Additions == 0 && t.Removals == 0 {
+			continue
+		}
+		diff.AmountChanges.Totals = append(diff.AmountChanges.Totals, *t)
+	}
+	sort.Slice(diff.AmountChanges.Totals, func(i, j int) bool {
+		a, b := diff.AmountChanges.Totals[i], diff.AmountChanges.Totals[j]
+		if a.Part != b.Part {
+			return a.Part < b.Part
+		}
+		if oa, ob := schemes.order(a.Scheme), schemes.order(b.Scheme); oa != ob {
+			return oa < ob
+		}
+		return a.Scheme < b.Scheme
+	})
+	for _, part := range parts {
+		t := partTotals[part]
+		t.Delta = t.After - t.Before
+		diff.Totals = append(diff.Totals, *t)
+	}
+	return diff
+}
+
+// schemeOrder 按险种登记表的顺序排列险种
+func schemeOrder(set map[models.Scheme]bool, schemes *SchemeRegistry) []models.Scheme {
+	list := make([]models.Scheme, 0, len(set))
+	for scheme := range set {
+		list = append(list, scheme)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if oi, oj := schemes.order(list[i]), schemes.order(list[j]); oi != oj {
+			return oi < oj
+		}
+		return list[i] < list[j]
+	})
+	return list
+}
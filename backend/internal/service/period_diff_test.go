@@ -0,0 +1,59 @@
+package service
+
+import (
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestDiffPeriodCharges(t *testing.T) {
+	charges := func(adjustment models.Money) *periodCharges {
+		return &periodCharges{people: map[string]*diffPerson{}, adjustments: map[models.Part]models.Money{models.PartPersonal: adjustment}}
+	}
+	add := func(c *periodCharges, id, name, department string, part models.Part, base models.Money, amounts models.SchemeAmounts) {
+		var total models.Money
+		for _, amount := range amounts {
+			total += amount
+		}
+		c.person(id, name, department).parts[part] = diffCharge{base, amounts, total}
+	}
+
+	before := charges(0)
+	add(before, "A", "张三", "财务部", models.PartPersonal, yuan(5000), models.SchemeAmounts{models.SchemePension: yuan(400), models.SchemeMedical: yuan(100)})
+	add(before, "A", "张三", "财务部", models.PartUnit, yuan(5000), models.SchemeAmounts{models.SchemePension: yuan(800)})
+	add(before, "B", "李四", "行政部", models.PartPersonal, yuan(4000), models.SchemeAmounts{models.SchemePension: yuan(320)})
+
+	after := charges(yuan(-20))
+	add(after, "A", "张三", "人事部", models.PartPersonal, yuan(6000), models.SchemeAmounts{models.SchemePension: yuan(480), models.SchemeMedical: yuan(100)})
+	add(after, "A", "张三", "人事部", models.PartUnit, yuan(6000), models.SchemeAmounts{models.SchemePension: yuan(960)})
+	add(after, "C", "王五", "财务部", models.PartPersonal, yuan(3000), models.SchemeAmounts{models.SchemePension: yuan(240)})
+
+	diff := diffPeriodCharges(before, after, NewSchemeRegistry(nil))
+	if diff.Additions.Count != 1 || diff.Additions.People[0].IDNumber != "C" || diff.Additions.PersonalTotal != yuan(240) {
+		t.Errorf("增员不符: %+v", diff.Additions)
+	}
+	if diff.Removals.Count != 1 || diff.Removals.People[0].IDNumber != "B" || diff.Removals.PersonalTotal != yuan(320) {
+		t.Errorf("减员不符: %+v", diff.Removals)
+	}
+	if diff.BaseChanges.Count != 2 || diff.BaseChanges.PersonalDelta != yuan(1000) || diff.BaseChanges.UnitDelta != yuan(1000) {
+		t.Errorf("基数变化不符: %+v", diff.BaseChanges)
+	}
+	// 医疗保险金额未变化，不列出
+	if diff.AmountChanges.Count != 2 {
+		t.Errorf("金额变化项数 = %d，期望 2: %+v", diff.AmountChanges.Count, diff.AmountChanges.Changes)
+	}
+	if diff.DepartmentMoves.Count != 1 || diff.DepartmentMoves.Moves[0].From != "财务部" || diff.DepartmentMoves.Moves[0].To != "人事部" {
+		t.Errorf("部门调动不符: %+v", diff.DepartmentMoves)
+	}
+
+	pension := diff.AmountChanges.Totals[0]
+	if pension.Scheme != models.SchemePension || pension.Part != models.PartPersonal ||
+		pension.Before != yuan(720) || pension.After != yuan(720) || pension.Delta != 0 ||
+		pension.Additions != yuan(240) || pension.Removals != yuan(-320) || pension.Changes != yuan(80) {
+		t.Errorf("养老保险个人汇总不符: %+v", pension)
+	}
+	personal := diff.Totals[0]
+	if personal.Part != models.PartPersonal || personal.Before != yuan(820) || personal.After != yuan(820) || personal.AdjustmentAfter != yuan(-20) {
+		t.Errorf("个人合计不符: %+v", personal)
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+)
+
+var (
+	// ErrPeriodClosed 账期已关账，拒绝一切修改数据的操作
+	ErrPeriodClosed = errors.New("账期已关账，如需修改请先重新打开")
+	// ErrAdjustmentsNotAllowed 账期未开启补退
+	ErrAdjustmentsNotAllowed = errors.New("账期不允许补退")
+	// ErrReopenReasonRequired 重新打开账期必须说明原因
+	ErrReopenReasonRequired = errors.New("重新打开账期须填写原因")
+)
+
+// PeriodTransitionError 账期当前状态不能执行所请求的流转
+type PeriodTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *PeriodTransitionError) Error() string {
+	return fmt.Sprintf("账期状态为 %s，不能变更为 %s", e.From, e.To)
+}
+
+// PeriodTransition 需要显式操作的账期流转：审核、关账与重新打开。
+// 上传与处理引起的流转由对应操作自动完成
+type PeriodTransition struct {
+	Action models.ActionType
+	From   string
+	To     string
+}
+
+var (
+	TransitionReview = PeriodTransition{Action: models.ActionReviewPeriod, From: models.PeriodProcessed, To: models.PeriodReviewed}
+	TransitionClose  = PeriodTransition{Action: models.ActionClosePeriod, From: models.PeriodReviewed, To: models.PeriodClosed}
+	TransitionReopen = PeriodTransition{Action: models.ActionReopenPeriod, From: models.PeriodClosed, To: models.PeriodReviewed}
+)
+
+// PeriodStatus 返回账期状态，早期数据中为空的状态视为草稿
+func PeriodStatus(period *models.Period) string {
+	if period.Status == "" {
+		return models.PeriodDraft
+	}
+	return period.Status
+}
+
+// EnsurePeriodOpen 检查账期未关账
+func EnsurePeriodOpen(period *models.Period) error {
+	if PeriodStatus(period) == models.PeriodClosed {
+		return ErrPeriodClosed
+	}
+	return nil
+}
+
+// EnsureAdjustmentsAllowed 检查账期未关账且开启了补退
+func EnsureAdjustmentsAllowed(period *models.Period) error {
+	if err := EnsurePeriodOpen(period); err != nil {
+		return err
+	}
+	if !period.AllowAdjustments {
+		return ErrAdjustmentsNotAllowed
+	}
+	return nil
+}
+
+// checkPeriodImport 在导入事务中检查账期能否接收该类型的文件；账期记录不存在时不做限制
+func checkPeriodImport(tx *gorm.DB, periodID uint, fileType models.FileType) error {
+	var period models.Period
+	if err := tx.Select("id", "status", "allow_adjustments").Where("id = ?", periodID).Limit(1).Find(&period).Error; err != nil {
+		return fmt.Errorf("load period: %w", err)
+	}
+	if period.ID == 0 {
+		return nil
+	}
+	if fileType == models.FileTypeAdjustment {
+		return EnsureAdjustmentsAllowed(&period)
+	}
+	return EnsurePeriodOpen(&period)
+}
+
+// markPeriodUploaded 生效的缴费文件发生变化后将账期置为已上传；已处理或已审核的结果与审批随之失效，须重新处理
+func markPeriodUploaded(tx *gorm.DB, periodID uint) error {
+	if err := tx.Model(&models.Period{}).
+		Where("id = ? AND (status IS NULL OR status IN ?)", periodID,
+			[]string{"", models.PeriodDraft, models.PeriodProcessed, models.PeriodReviewed}).
+		Updates(map[string]any{"status": models.PeriodUploaded, "updated_at": time.Now()}).Error; err != nil {
+		return fmt.Errorf("update period status: %w", err)
+	}
+	return InvalidateApprovals(tx, periodID)
+}
+
+// TransitionPeriod 执行审核、关账或重新打开，并在同一事务中写入审计日志（含原状态、新状态与原因）。
+// 状态以原状态为条件更新，并发请求只有一个生效；审核要求最近一次为完整处理，审核与关账要求账期已批准，
+// 重新打开必须填写原因
+func (p *Processor) TransitionPeriod(period *models.Period, transition PeriodTransition, userID *uint, reason string) error {
+	from := PeriodStatus(period)
+	if from != transition.From {
+		return &PeriodTransitionError{From: from, To: transition.To}
+	}
+	reason = strings.TrimSpace(reason)
+	if transition.Action == models.ActionReviewPeriod {
+		if err := RequireFullProcessing(period); err != nil {
+			return err
+		}
+	}
+	if transition.Action == models.ActionReviewPeriod || transition.Action == models.ActionClosePeriod {
+		approval, err := p.CurrentApproval(period)
+		if err != nil {
+			return err
+		}
+		if approval == nil || approval.Status != models.ApprovalApproved {
+			return ErrApprovalRequired
+		}
+	}
+	if transition.Action == models.ActionReopenPeriod && reason == "" {
+		return ErrReopenReasonRequired
+	}
+
+	now := time.Now()
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Period{}).Where("id = ? AND status = ?", period.ID, transition.From).
+			Updates(map[string]any{"status": transition.To, "updated_at": now})
+		if result.Error != nil {
+			return fmt.Errorf("update period status: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			var current models.Period
+			if err := tx.Select("status").First(&current, period.ID).Error; err != nil {
+				return fmt.Errorf("load period: %w", err)
+			}
+			return &PeriodTransitionError{From: PeriodStatus(&current), To: transition.To}
+		}
+
+		custom := map[string]interface{}{"from": from, "to": transition.To}
+		if reason != "" {
+			custom["reason"] = reason
+		}
+		return savePeriodAuditLog(tx, period, transition.Action, userID, custom)
+	})
+	if err != nil {
+		return err
+	}
+	period.Status = transition.To
+	period.UpdatedAt = now
+	return nil
+}
+
+// savePeriodAuditLog 在业务事务中写入账期操作的审计记录，custom 为操作的具体内容
+func savePeriodAuditLog(tx *gorm.DB, period *models.Period, action models.ActionType, userID *uint, custom map[string]interface{}) error {
+	resourceID := strconv.FormatUint(uint64(period.ID), 10)
+	entry := models.CreateAuditLog(models.CreateAuditLogParams{
+		UserID:     userID,
+		Action:     action,
+		Resource:   "periods",
+		ResourceID: &resourceID,
+		Status:     models.StatusSuccess,
+		StatusCode: 200,
+		Details:    &models.LogDetails{PeriodID: period.ID, YearMonth: period.YearMonth, Custom: custom},
+	})
+	if err := tx.Create(entry).Error; err != nil {
+		return fmt.Errorf("save audit log: %w", err)
+	}
+	return nil
+}
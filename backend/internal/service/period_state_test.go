@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestProcessor_PeriodLifecycle(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+	db := processor.db
+	if err := db.AutoMigrate(&models.RosterEntry{}, &models.PeriodSummary{}, &models.PersonalCharge{},
+		&models.UnitCharge{}, &models.HousingFundCharge{}, &models.AuditLog{}, &models.User{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	preparer := models.User{Username: "maker", Email: "maker@example.com", CompanyID: "acme"}
+	checker := models.User{Username: "checker", Email: "checker@example.com", CompanyID: "acme", Approver: true}
+	for _, user := range []*models.User{&preparer, &checker} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+	}
+	period := models.Period{YearMonth: "2026-05", Status: models.PeriodDraft}
+	if err := db.Create(&period).Error; err != nil {
+		t.Fatalf("创建账期失败: %v", err)
+	}
+	reload := func() models.Period {
+		t.Helper()
+		var saved models.Period
+		if err := db.First(&saved, period.ID).Error; err != nil {
+			t.Fatalf("读取账期失败: %v", err)
+		}
+		return saved
+	}
+	upload := func(name string, fileType models.FileType) error {
+		content := "序号,姓名,证件号码,缴费工资,缴费基数,费率,应缴费额\n1,张三,110101199001011234,5000,5000,8%,400\n"
+		key := "periods/1/" + name
+		if err := store.Put(t.Context(), key, strings.NewReader(content)); err != nil {
+			t.Fatalf("保存文件失败: %v", err)
+		}
+		var err error
+		if fileType == models.FileTypeAdjustment {
+			_, err = processor.ParseAdjustmentFile(period.ID, nil, key, name, models.SchemePension, models.PartPersonal, ParseOptions{})
+		} else {
+			_, err = processor.ParseSourceFile(period.ID, nil, key, name, models.SchemePension, models.PartPersonal, ParseOptions{})
+		}
+		return err
+	}
+
+	// 其余必需险种直接写入，养老个人部分通过上传导入
+	record := func(scheme models.Scheme, part models.Part, amount float64) models.RawRecord {
+		return models.RawRecord{PeriodID: period.ID, Sequence: 1, Name: "张三", IDNumber: "110101199001011234",
+			PayBase: yuan(5000), AmountDue: yuan(amount), Scheme: scheme, Part: part, FileType: models.FileTypeNormal}
+	}
+	records := []models.RawRecord{
+		record(models.SchemeMedical, models.PartPersonal, 100),
+		record(models.SchemeUnemployment, models.PartPersonal, 25),
+		record(models.SchemeSeriousIllness, models.PartPersonal, 3),
+		record(models.SchemePension, models.PartUnit, 800),
+		record(models.SchemeMedical, models.PartUnit, 425),
+		record(models.SchemeUnemployment, models.PartUnit, 40),
+		record(models.SchemeSeriousIllness, models.PartUnit, 75),
+		record(models.SchemeInjury, models.PartUnit, 20),
+	}
+	if err := db.Create(&records).Error; err != nil {
+		t.Fatalf("插入原始记录失败: %v", err)
+	}
+	if err := upload("pension.csv", models.FileTypeNormal); err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	if got := reload().Status; got != models.PeriodUploaded {
+		t.Fatalf("上传后状态 = %s，期望 uploaded", got)
+	}
+
+	if _, err := processor.ProcessPeriod(period.ID, ProcessFull); err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	saved := reload()
+	var transitionErr *PeriodTransitionError
+	if err := processor.TransitionPeriod(&saved, TransitionClose, nil, ""); !errors.As(err, &transitionErr) {
+		t.Fatalf("未审核的账期不能关账，实际 %v", err)
+	}
+	if err := processor.TransitionPeriod(&saved, TransitionReview, nil, ""); !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("未批准的账期不能审核，实际 %v", err)
+	}
+	if _, err := processor.SubmitForApproval(&saved, preparer.ID); err != nil {
+		t.Fatalf("提交审批失败: %v", err)
+	}
+	if _, err := processor.DecideApproval(&saved, &checker, true, ""); err != nil {
+		t.Fatalf("批准失败: %v", err)
+	}
+	if err := processor.TransitionPeriod(&saved, TransitionReview, nil, ""); err != nil {
+		t.Fatalf("审核失败: %v", err)
+	}
+	if err := processor.TransitionPeriod(&saved, TransitionClose, nil, ""); err != nil {
+		t.Fatalf("关账失败: %v", err)
+	}
+	if got := reload().Status; got != models.PeriodClosed {
+		t.Fatalf("关账后状态 = %s", got)
+	}
+
+	// 关账后拒绝上传、处理与补退
+	if _, err := processor.ProcessPeriod(period.ID, ProcessFull); !errors.Is(err, ErrPeriodClosed) {
+		t.Errorf("关账后处理应返回 ErrPeriodClosed，实际 %v", err)
+	}
+	if err := upload("pension-v2.csv", models.FileTypeNormal); !errors.Is(err, ErrPeriodClosed) {
+		t.Errorf("关账后上传应返回 ErrPeriodClosed，实际 %v", err)
+	}
+	if err := upload("adj.csv", models.FileTypeAdjustment); !errors.Is(err, ErrPeriodClosed) {
+		t.Errorf("关账后上传补退应返回 ErrPeriodClosed，实际 %v", err)
+	}
+	var files int64
+	db.Model(&models.SourceFile{}).Where("period_id = ?", period.ID).Count(&files)
+	if files != 1 {
+		t.Errorf("关账后被拒绝的上传不应留下源文件，实际 %d 个", files)
+	}
+
+	// 重新打开必须填写原因，原因写入审计日志
+	saved = reload()
+	if err := processor.TransitionPeriod(&saved, TransitionReopen, nil, "  "); !errors.Is(err, ErrReopenReasonRequired) {
+		t.Errorf("未填写原因应返回 ErrReopenReasonRequired，实际 %v", err)
+	}
+	if err := processor.TransitionPeriod(&saved, TransitionReopen, nil, "社保局退回更正"); err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	if saved.Status != models.PeriodReviewed {
+		t.Errorf("重新打开后状态 = %s，期望 reviewed", saved.Status)
+	}
+	var logs []models.AuditLog
+	if err := db.Order("id").Find(&logs).Error; err != nil {
+		t.Fatalf("读取审计日志失败: %v", err)
+	}
+	if len(logs) != 5 || logs[4].Action != string(models.ActionReopenPeriod) {
+		t.Fatalf("审计日志不符: %+v", logs)
+	}
+	details := logs[4].GetParsedDetails()
+	if details.Custom["reason"] != "社保局退回更正" || details.Custom["from"] != models.PeriodClosed || details.PeriodID != period.ID {
+		t.Errorf("重新打开的审计内容不符: %+v", details)
+	}
+
+	// 重新上传使审核与审批失效：旧的扣款明细仍在，但批准不再有效
+	if err := upload("pension-v2.csv", models.FileTypeNormal); err != nil {
+		t.Fatalf("重新打开后上传失败: %v", err)
+	}
+	saved = reload()
+	if saved.Status != models.PeriodUploaded {
+		t.Errorf("重新上传后状态 = %s，期望 uploaded", saved.Status)
+	}
+	if current, err := processor.CurrentApproval(&saved); err != nil || current.Status != models.ApprovalInvalidated || current.InvalidatedAt == nil {
+		t.Errorf("重新上传后审批应失效: %+v, %v", current, err)
+	}
+
+	// 未开启补退的账期拒绝补退
+	if err := db.Model(&models.Period{}).Where("id = ?", period.ID).Update("allow_adjustments", false).Error; err != nil {
+		t.Fatalf("更新账期失败: %v", err)
+	}
+	if err := upload("adj.csv", models.FileTypeAdjustment); !errors.Is(err, ErrAdjustmentsNotAllowed) {
+		t.Errorf("未开启补退时上传应返回 ErrAdjustmentsNotAllowed，实际 %v", err)
+	}
+	if _, err := processor.ProcessAdjustments(period.ID); !errors.Is(err, ErrAdjustmentsNotAllowed) {
+		t.Errorf("未开启补退时处理应返回 ErrAdjustmentsNotAllowed，实际 %v", err)
+	}
+}
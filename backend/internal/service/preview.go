@@ -0,0 +1,225 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"siapp/internal/models"
+)
+
+// DefaultPreviewRows 预览默认返回的数据行数
+const DefaultPreviewRows = 20
+
+// PreviewColumn 源文件中的一列及其识别出的标准字段（未识别时 Field 为空）
+type PreviewColumn struct {
+	Index  int    `json:"index"`
+	Header string `json:"header"`
+	Field  string `json:"field,omitempty"`
+}
+
+// PreviewTotals 一组记录的人数与金额合计
+type PreviewTotals struct {
+	Rows         int          `json:"rows"`
+	Persons      int          `json:"persons"`
+	PaySalary    models.Money `json:"pay_salary"`
+	PayBase      models.Money `json:"pay_base"`
+	AmountDue    models.Money `json:"amount_due"`
+	AmountAdjust models.Money `json:"amount_adjust"`
+}
+
+// PreviewPerson 差异中的一个人员
+type PreviewPerson struct {
+	IDNumber  string       `json:"id_number"`
+	Name      string       `json:"name"`
+	PayBase   models.Money `json:"pay_base"`
+	AmountDue models.Money `json:"amount_due"`
+}
+
+// PreviewChange 同一人员在新旧文件中的基数或金额变化
+type PreviewChange struct {
+	IDNumber        string       `json:"id_number"`
+	Name            string       `json:"name"`
+	PayBaseBefore   models.Money `json:"pay_base_before"`
+	PayBaseAfter    models.Money `json:"pay_base_after"`
+	AmountDueBefore models.Money `json:"amount_due_before"`
+	AmountDueAfter  models.Money `json:"amount_due_after"`
+}
+
+// PreviewDiff 上传文件与当前已导入记录的差异
+type PreviewDiff struct {
+	Existing  *models.SourceFile `json:"existing,omitempty"`
+	Before    PreviewTotals      `json:"before"`
+	Added     []PreviewPerson    `json:"added"`
+	Removed   []PreviewPerson    `json:"removed"`
+	Changed   []PreviewChange    `json:"changed"`
+	Unchanged int                `json:"unchanged"`
+}
+
+// PreviewResult 上传预览结果，不写入任何数据
+type PreviewResult struct {
+	Scheme   models.Scheme      `json:"scheme"`
+	Part     models.Part        `json:"part"`
+	Columns  []PreviewColumn    `json:"columns"`
+	Totals   PreviewTotals      `json:"totals"`
+	Rejected int                `json:"rejected"`
+	Issues   []RowIssue         `json:"issues,omitempty"`
+	Sample   []models.RawRecord `json:"sample"`
+	Diff     PreviewDiff        `json:"diff"`
+	// Overwrite 为 true 时表示正式上传将替换已有的同险种记录
+	Overwrite bool `json:"overwrite"`
+	// ExceedsThreshold 为 true 时表示按相同的 max_rejected_rows 正式上传会被拒绝
+	ExceedsThreshold bool `json:"exceeds_threshold"`
+	// Duplicates 内容相同的已导入文件
+	Duplicates []DuplicateSource `json:"duplicates,omitempty"`
+}
+
+// PreviewSourceFile 完整解析并校验险种明细文件，返回识别的列、合计、前 limit 行以及与已导入记录的差异，不写入数据库
+func (p *Processor) PreviewSourceFile(periodID uint, storedPath string, scheme models.Scheme, part models.Part, opts ParseOptions, limit int) (*PreviewResult, error) {
+	// 预览时始终返回完整的问题行，阈值只用于提示
+	readOpts := opts
+	readOpts.MaxRejectedRows = 0
+	sheet, err := readSourceSheet(periodID, nil, storedPath, scheme, part, models.FileTypeNormal, readOpts)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultPreviewRows
+	}
+
+	result := &PreviewResult{
+		Scheme:   scheme,
+		Part:     part,
+		Columns:  previewColumns(sheet.header, sheet.indexMap),
+		Totals:   totalRecords(sheet.records),
+		Rejected: sheet.report.rejected,
+		Issues:   sheet.report.issues,
+
+		ExceedsThreshold: sheet.report.exceeds(opts.MaxRejectedRows),
+	}
+	if len(sheet.records) > limit {
+		result.Sample = sheet.records[:limit]
+	} else {
+		result.Sample = sheet.records
+	}
+
+	var existingFiles []models.SourceFile
+	if err := p.db.Where("period_id = ? AND scheme = ? AND part = ? AND file_type = ? AND active = ?", periodID, scheme, part, models.FileTypeNormal, true).
+		Order("uploaded_at DESC").
+		Limit(1).
+		Find(&existingFiles).Error; err != nil {
+		return nil, fmt.Errorf("query existing source file: %w", err)
+	}
+	var existingFile *models.SourceFile
+	if len(existingFiles) > 0 {
+		existingFile = &existingFiles[0]
+	}
+
+	var existing []models.RawRecord
+	if err := p.activeRecords().Where("period_id = ? AND scheme = ? AND part = ? AND file_type = ?", periodID, scheme, part, models.FileTypeNormal).
+		Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("query existing raw records: %w", err)
+	}
+	result.Overwrite = len(existing) > 0
+	result.Diff = diffRecords(existing, sheet.records, existingFile)
+
+	var period models.Period
+	if err := p.db.First(&period, periodID).Error; err != nil {
+		return nil, fmt.Errorf("query period: %w", err)
+	}
+	hash, err := hashFile(storedPath)
+	if err != nil {
+		return nil, err
+	}
+	if result.Duplicates, err = p.FindDuplicateSources(period.UserID, periodID, hash); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func previewColumns(header []string, indexMap map[string]int) []PreviewColumn {
+	fieldByIndex := make(map[int]string, len(indexMap))
+	for field, idx := range indexMap {
+		fieldByIndex[idx] = field
+	}
+	columns := make([]PreviewColumn, 0, len(header))
+	for idx, cell := range header {
+		cell = strings.TrimSpace(stripBOM(cell))
+		if cell == "" {
+			continue
+		}
+		columns = append(columns, PreviewColumn{Index: idx, Header: cell, Field: fieldByIndex[idx]})
+	}
+	return columns
+}
+
+func totalRecords(records []models.RawRecord) PreviewTotals {
+	totals := PreviewTotals{Rows: len(records)}
+	persons := map[string]bool{}
+	for _, rec := range records {
+		persons[rec.IDNumber] = true
+		totals.PaySalary += rec.PaySalary
+		totals.PayBase += rec.PayBase
+		totals.AmountDue += rec.AmountDue
+		totals.AmountAdjust += rec.AmountAdjust
+	}
+	totals.Persons = len(persons)
+	return totals
+}
+
+// diffRecords 按证件号码比较已导入记录与新文件记录（同一人多行时合计后比较）
+func diffRecords(existing, incoming []models.RawRecord, existingFile *models.SourceFile) PreviewDiff {
+	before := groupPreviewPersons(existing)
+	after := groupPreviewPersons(incoming)
+
+	diff := PreviewDiff{
+		Existing: existingFile,
+		Before:   totalRecords(existing),
+		Added:    []PreviewPerson{},
+		Removed:  []PreviewPerson{},
+		Changed:  []PreviewChange{},
+	}
+	for id, person := range after {
+		old, ok := before[id]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, person)
+		case old.PayBase != person.PayBase || old.AmountDue != person.AmountDue:
+			diff.Changed = append(diff.Changed, PreviewChange{
+				IDNumber:        id,
+				Name:            person.Name,
+				PayBaseBefore:   old.PayBase,
+				PayBaseAfter:    person.PayBase,
+				AmountDueBefore: old.AmountDue,
+				AmountDueAfter:  person.AmountDue,
+			})
+		default:
+			diff.Unchanged++
+		}
+	}
+	for id, person := range before {
+		if _, ok := after[id]; !ok {
+			diff.Removed = append(diff.Removed, person)
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].IDNumber < diff.Added[j].IDNumber })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].IDNumber < diff.Removed[j].IDNumber })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].IDNumber < diff.Changed[j].IDNumber })
+	return diff
+}
+
+func groupPreviewPersons(records []models.RawRecord) map[string]PreviewPerson {
+	persons := make(map[string]PreviewPerson, len(records))
+	for _, rec := range records {
+		person := persons[rec.IDNumber]
+		person.IDNumber = rec.IDNumber
+		if person.Name == "" {
+			person.Name = rec.Name
+		}
+		person.PayBase = maxMoney(person.PayBase, rec.PayBase)
+		person.AmountDue += rec.AmountDue
+		persons[rec.IDNumber] = person
+	}
+	return persons
+}
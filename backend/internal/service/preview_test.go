@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestDiffRecords(t *testing.T) {
+	existing := []models.RawRecord{
+		{IDNumber: "A", Name: "张三", PayBase: yuan(5000), AmountDue: yuan(400)},
+		{IDNumber: "B", Name: "李四", PayBase: yuan(6000), AmountDue: yuan(480)},
+		{IDNumber: "C", Name: "王五", PayBase: yuan(7000), AmountDue: yuan(560)},
+	}
+	incoming := []models.RawRecord{
+		{IDNumber: "A", Name: "张三", PayBase: yuan(5000), AmountDue: yuan(400)},
+		{IDNumber: "B", Name: "李四", PayBase: yuan(6500), AmountDue: yuan(520)},
+		{IDNumber: "D", Name: "赵六", PayBase: yuan(4000), AmountDue: yuan(320)},
+	}
+
+	diff := diffRecords(existing, incoming, nil)
+	if diff.Unchanged != 1 {
+		t.Errorf("未变化人数应为1，实际 %d", diff.Unchanged)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].IDNumber != "D" {
+		t.Errorf("新增人员不符: %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].IDNumber != "C" {
+		t.Errorf("移除人员不符: %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].PayBaseBefore != yuan(6000) || diff.Changed[0].PayBaseAfter != yuan(6500) {
+		t.Errorf("变化人员不符: %+v", diff.Changed)
+	}
+	if diff.Before.AmountDue != yuan(1440) || diff.Before.Persons != 3 {
+		t.Errorf("原有记录合计不符: %+v", diff.Before)
+	}
+}
+
+func TestPreviewColumns(t *testing.T) {
+	header := []string{"序号", "姓名", "", "备用列"}
+	columns := previewColumns(header, map[string]int{"seq": 0, "name": 1})
+	if len(columns) != 3 {
+		t.Fatalf("应返回3个非空列，实际 %d", len(columns))
+	}
+	if columns[0].Field != "seq" || columns[2].Header != "备用列" || columns[2].Field != "" {
+		t.Errorf("列识别结果不符: %+v", columns)
+	}
+}
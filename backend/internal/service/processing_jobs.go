@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"siapp/internal/models"
+)
+
+// BatchUploadItem 批量上传中单个文件的导入结果
+type BatchUploadItem struct {
+	FileName     string            `json:"file_name"`
+	OriginalName string            `json:"original_name"`
+	Scheme       models.Scheme     `json:"scheme"`
+	Part         models.Part       `json:"part"`
+	Imported     int               `json:"imported"`
+	Rejected     int               `json:"rejected"`
+	Issues       []RowIssue        `json:"issues,omitempty"`
+	Truncated    bool              `json:"issues_truncated,omitempty"`
+	Duplicates   []DuplicateSource `json:"duplicates,omitempty"`
+	// Classification 险种与缴费部分的识别结果，无法确定时 Error 说明原因
+	Classification *Classification `json:"classification,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	// SourceFileID 导入已提交的源文件，恢复运行时据此跳过
+	SourceFileID uint `json:"source_file_id,omitempty"`
+}
+
+// ApplyParseResult 将解析结果或错误写入条目
+func (item *BatchUploadItem) ApplyParseResult(result *ParseResult, err error) {
+	if err != nil {
+		item.Error = err.Error()
+		var thresholdErr *RejectionThresholdError
+		if errors.As(err, &thresholdErr) {
+			item.Rejected = thresholdErr.Rejected
+			item.Issues = thresholdErr.Issues
+		}
+		var duplicateErr *DuplicateFileError
+		if errors.As(err, &duplicateErr) {
+			item.Duplicates = duplicateErr.Matches
+		}
+		return
+	}
+	item.FileName = path.Base(result.File.StoredPath)
+	item.SourceFileID = result.File.ID
+	item.Imported = result.Imported
+	item.Rejected = result.Rejected
+	item.Issues = result.Issues
+	item.Truncated = result.IssuesTruncated
+	item.Duplicates = result.Duplicates
+}
+
+// ApplyClassifiedResult 记录 ParseClassifiedFile 的识别结果与导入结果
+func (item *BatchUploadItem) ApplyClassifiedResult(c *Classification, result *ParseResult, err error) {
+	item.Classification = c
+	var ambiguousErr *AmbiguousFileError
+	if c != nil && !errors.As(err, &ambiguousErr) {
+		item.Scheme = c.Scheme
+		item.Part = c.Part
+	}
+	item.ApplyParseResult(result, err)
+}
+
+// UploadBatchFile 批量上传任务中已写入文件存储、等待解析的文件（StoredPath 为存储 key）。
+// Scheme/Part 为表单指定的值，可为空，解析前按文件名与内容识别
+type UploadBatchFile struct {
+	StoredPath   string        `json:"stored_path"`
+	OriginalName string        `json:"original_name"`
+	Scheme       models.Scheme `json:"scheme,omitempty"`
+	Part         models.Part   `json:"part,omitempty"`
+	// Error 非空表示上传阶段已校验失败，解析时直接跳过
+	Error string `json:"error,omitempty"`
+}
+
+// UploadBatchPayload 批量上传任务参数
+type UploadBatchPayload struct {
+	PeriodID uint              `json:"period_id"`
+	UserID   *uint             `json:"user_id,omitempty"`
+	Files    []UploadBatchFile `json:"files"`
+	Options  ParseOptions      `json:"options"`
+}
+
+// UploadBatchResult 批量上传任务结果，运行中保存已完成的条目以便恢复
+type UploadBatchResult struct {
+	Items []BatchUploadItem `json:"items"`
+}
+
+// PeriodJobPayload 账期处理类任务参数
+type PeriodJobPayload struct {
+	PeriodID uint `json:"period_id"`
+	// Mode 账期处理方式，为空时为完整处理；补退处理不使用
+	Mode ProcessMode `json:"mode,omitempty"`
+}
+
+// RegisterJobs 注册文件解析与账期处理任务。三类任务均可安全重跑：
+// 正常文件按险种覆盖导入，处理结果在事务中整体替换；批量上传恢复时跳过已完成的文件。
+func (p *Processor) RegisterJobs(runner *JobRunner) {
+	runner.Register(models.JobUploadBatch, true, p.runUploadBatchJob)
+	runner.Register(models.JobProcessPeriod, true, func(ctx *JobContext) (any, error) {
+		var payload PeriodJobPayload
+		if err := ctx.Decode(&payload); err != nil {
+			return nil, err
+		}
+		ctx.Progress(10, "正在处理账期数据")
+		mode, err := ParseProcessMode(string(payload.Mode))
+		if err != nil {
+			return nil, err
+		}
+		return p.ProcessPeriod(payload.PeriodID, mode)
+	})
+	runner.Register(models.JobProcessAdjustments, true, func(ctx *JobContext) (any, error) {
+		var payload PeriodJobPayload
+		if err := ctx.Decode(&payload); err != nil {
+			return nil, err
+		}
+		ctx.Progress(10, "正在处理补退数据")
+		return p.ProcessAdjustments(payload.PeriodID)
+	})
+}
+
+func (p *Processor) runUploadBatchJob(ctx *JobContext) (any, error) {
+	var payload UploadBatchPayload
+	if err := ctx.Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	var result UploadBatchResult
+	if _, err := ctx.Partial(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Items) > len(payload.Files) {
+		result.Items = result.Items[:0]
+	}
+
+	total := len(payload.Files)
+	for idx := len(result.Items); idx < total; idx++ {
+		file := payload.Files[idx]
+		ctx.Progress(idx*100/total, fmt.Sprintf("正在解析 %s（%d/%d）", file.OriginalName, idx+1, total))
+
+		item := BatchUploadItem{
+			OriginalName: file.OriginalName,
+			Scheme:       file.Scheme,
+			Part:         file.Part,
+			Error:        file.Error,
+		}
+		if item.Error == "" {
+			committed, err := p.committedBatchFile(payload.PeriodID, file.StoredPath)
+			if err != nil {
+				return nil, err
+			}
+			if committed != nil {
+				// 上次运行已提交导入但未来得及保存进度，直接记录结果，避免重复导入或被判为与自身重复
+				item.Scheme = committed.Scheme
+				item.Part = committed.Part
+				item.FileName = path.Base(committed.StoredPath)
+				item.SourceFileID = committed.ID
+				item.Imported = committed.Rows
+				item.Rejected = committed.RejectedRows
+			} else {
+				item.ApplyClassifiedResult(p.ParseClassifiedFile(payload.PeriodID, payload.UserID, file.StoredPath, file.OriginalName, models.FileTypeNormal, file.Scheme, file.Part, payload.Options))
+			}
+		}
+		result.Items = append(result.Items, item)
+		if err := ctx.Checkpoint(result); err != nil {
+			return nil, fmt.Errorf("save progress: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// committedBatchFile 查找批量上传中已由该存储 key 导入的源文件，没有时返回 nil
+func (p *Processor) committedBatchFile(periodID uint, key string) (*models.SourceFile, error) {
+	var files []models.SourceFile
+	if err := p.db.Where("period_id = ? AND stored_path = ? AND file_type = ?", periodID, key, models.FileTypeNormal).
+		Order("id DESC").Limit(1).Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("load imported file: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	return &files[0], nil
+}
@@ -1,13 +1,13 @@
 package service
 
 import (
-	"bufio"
-	"encoding/csv"
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"math"
 	"os"
-	"path/filepath"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
@@ -18,19 +18,55 @@ import (
 	"gorm.io/gorm/clause"
 
 	"siapp/internal/models"
+	"siapp/internal/storage"
 )
 
+// defaultInsertBatchSize 批量写入的默认行数，兼顾 SQLite 的单语句变量上限与写入速度
+const defaultInsertBatchSize = 500
+
 type Processor struct {
-	db *gorm.DB
+	db            *gorm.DB
+	store         storage.Storage
+	batchSize     int
+	rateTolerance models.Money
+}
+
+func NewProcessor(db *gorm.DB, store storage.Storage) *Processor {
+	return &Processor{db: db, store: store, batchSize: insertBatchSize(), rateTolerance: rateTolerance()}
 }
 
-func NewProcessor(db *gorm.DB) *Processor {
-	return &Processor{db: db}
+// fetch 将存储中的文件取到本地供表格读取器使用，用完后调用 cleanup
+func (p *Processor) fetch(key string) (string, func(), error) {
+	localPath, cleanup, err := storage.Fetch(context.Background(), p.store, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", nil, fmt.Errorf("%w: %s", ErrStoredFileMissing, key)
+		}
+		return "", nil, fmt.Errorf("fetch %s: %w", key, err)
+	}
+	return localPath, cleanup, nil
+}
+
+// insertBatchSize 读取 SIAPP_INSERT_BATCH_SIZE，未设置或无效时使用默认值
+func insertBatchSize() int {
+	if raw := strings.TrimSpace(os.Getenv("SIAPP_INSERT_BATCH_SIZE")); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			return n
+		}
+		log.Printf("invalid SIAPP_INSERT_BATCH_SIZE %q, using %d", raw, defaultInsertBatchSize)
+	}
+	return defaultInsertBatchSize
 }
 
 type ParseResult struct {
 	File     models.SourceFile `json:"file"`
 	Imported int               `json:"imported"`
+	Rejected int               `json:"rejected"`
+	Issues   []RowIssue        `json:"issues,omitempty"`
+	// IssuesTruncated 问题行过多时只保留前 maxReportedIssues 条
+	IssuesTruncated bool `json:"issues_truncated,omitempty"`
+	// Duplicates 内容相同的已导入文件（warn 策略下仍会导入）
+	Duplicates []DuplicateSource `json:"duplicates,omitempty"`
 }
 
 type RosterParseResult struct {
@@ -56,6 +92,9 @@ var headerMap = map[string]string{
 	"减免费额":    "deduction",
 	"应补(退)费额": "amount_adjust",
 	"人员编号":    "person_code",
+	"费款所属期":   "contribution_month",
+	"所属期":     "contribution_month",
+	"缴费所属期":   "contribution_month",
 }
 
 var rosterHeaderMap = map[string]string{
@@ -130,136 +169,184 @@ var employeeHeaderAliases = map[string]string{
 	"离职时间":          "resign_date",
 }
 
-func (p *Processor) ParseSourceFile(periodID uint, userID *uint, storedPath, originalName string, scheme models.Scheme, part models.Part) (*ParseResult, error) {
-	return p.parseSourceFileWithType(periodID, userID, storedPath, originalName, scheme, part, models.FileTypeNormal)
+// ParseSourceFile 导入存储中 key 对应的险种明细文件
+func (p *Processor) ParseSourceFile(periodID uint, userID *uint, key, originalName string, scheme models.Scheme, part models.Part, opts ParseOptions) (*ParseResult, error) {
+	return p.parseStoredFile(periodID, userID, key, originalName, scheme, part, models.FileTypeNormal, opts)
 }
 
-func (p *Processor) ParseAdjustmentFile(periodID uint, userID *uint, storedPath, originalName string, scheme models.Scheme, part models.Part) (*ParseResult, error) {
-	return p.parseSourceFileWithType(periodID, userID, storedPath, originalName, scheme, part, models.FileTypeAdjustment)
+func (p *Processor) ParseAdjustmentFile(periodID uint, userID *uint, key, originalName string, scheme models.Scheme, part models.Part, opts ParseOptions) (*ParseResult, error) {
+	return p.parseStoredFile(periodID, userID, key, originalName, scheme, part, models.FileTypeAdjustment, opts)
 }
 
-func (p *Processor) parseSourceFileWithType(periodID uint, userID *uint, storedPath, originalName string, scheme models.Scheme, part models.Part, fileType models.FileType) (*ParseResult, error) {
-	f, err := excelize.OpenFile(storedPath)
+// ParseClassifiedFile 先按文件名与内容确定险种和缴费部分（见 ResolveSchemePart），再导入文件。
+// 无法确定时返回 AmbiguousFileError，此时 Classification 仍会返回以便展示识别线索
+func (p *Processor) ParseClassifiedFile(periodID uint, userID *uint, key, originalName string, fileType models.FileType, formScheme models.Scheme, formPart models.Part, opts ParseOptions) (*Classification, *ParseResult, error) {
+	localPath, cleanup, err := p.fetch(key)
 	if err != nil {
-		return nil, fmt.Errorf("open excel: %w", err)
+		return nil, nil, err
 	}
-	defer func() { _ = f.Close() }()
+	defer cleanup()
 
-	sheets := f.GetSheetList()
-	if len(sheets) == 0 {
-		return nil, errors.New("Excel文件中没有找到工作表")
-	}
-	sheetName := sheets[0]
-
-	rows, err := f.GetRows(sheetName)
-	if err != nil {
-		return nil, fmt.Errorf("read rows: %w", err)
-	}
-	if len(rows) < 2 {
-		return nil, errors.New("Excel文件中没有数据行，请检查文件内容是否正确")
-	}
-
-	header := rows[0]
-	indexMap := map[string]int{}
-	for idx, cell := range header {
-		cell = strings.TrimSpace(cell)
-		if key, ok := headerMap[cell]; ok {
-			indexMap[key] = idx
+	if opts.Schemes == nil {
+		if opts.Schemes, err = LoadSchemeRegistry(p.db, userID); err != nil {
+			return nil, nil, err
 		}
 	}
-	required := []string{"seq", "name", "id_number", "salary", "base", "rate", "amount_due"}
-	for _, key := range required {
-		if _, ok := indexMap[key]; !ok {
-			return nil, fmt.Errorf("missing required column: %s", key)
+	c, err := ResolveSchemePart(localPath, originalName, opts, formScheme, formPart)
+	if err != nil {
+		var ambiguousErr *AmbiguousFileError
+		if errors.As(err, &ambiguousErr) {
+			return ambiguousErr.Classification, nil, err
 		}
+		return nil, nil, err
 	}
+	result, err := p.parseSourceFileWithType(periodID, userID, key, localPath, originalName, c.Scheme, c.Part, fileType, opts, nil)
+	return c, result, err
+}
 
-	var records []models.RawRecord
-	now := time.Now()
-
-	for _, row := range rows[1:] {
-		if len(row) == 0 {
-			continue
-		}
-		seq := getCell(row, indexMap["seq"])
-		name := strings.TrimSpace(getCell(row, indexMap["name"]))
-		idNumber := strings.TrimSpace(getCell(row, indexMap["id_number"]))
-		if seq == "" || name == "" || idNumber == "" {
-			continue
-		}
+func (p *Processor) parseStoredFile(periodID uint, userID *uint, key, originalName string, scheme models.Scheme, part models.Part, fileType models.FileType, opts ParseOptions) (*ParseResult, error) {
+	localPath, cleanup, err := p.fetch(key)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	return p.parseSourceFileWithType(periodID, userID, key, localPath, originalName, scheme, part, fileType, opts, nil)
+}
 
-		record := models.RawRecord{
-			UserID:     userID,
-			PeriodID:   periodID,
-			Sequence:   toInt(seq),
-			Name:       name,
-			IDType:     strings.TrimSpace(getCell(row, indexMap["id_type"])),
-			IDNumber:   idNumber,
-			Department: strings.TrimSpace(getCell(row, indexMap["department"])),
-			PaySalary:  toFloat(getCell(row, indexMap["salary"])),
-			PayBase:    toFloat(getCell(row, indexMap["base"])),
-			RateText:   strings.TrimSpace(getCell(row, indexMap["rate"])),
-			AmountDue:  toFloat(getCell(row, indexMap["amount_due"])),
-			Scheme:     scheme,
-			Part:       part,
-			FileType:   fileType,
-			CreatedAt:  now,
-			UpdatedAt:  now,
-		}
+// sourceSheet 为一次源文件解析的结果，尚未写入数据库
+type sourceSheet struct {
+	header   []string
+	indexMap map[string]int
+	records  []models.RawRecord
+	report   *rowReport
+}
 
-		if idx, ok := indexMap["amount_adjust"]; ok {
-			record.AmountAdjust = toFloat(getCell(row, idx))
-		} else {
-			record.AmountAdjust = record.AmountDue
-		}
-		if idx, ok := indexMap["person_code"]; ok {
-			record.PersonCode = strings.TrimSpace(getCell(row, idx))
-		}
+// sourceScan 为逐行扫描源文件后的统计信息，记录本身已交给回调处理
+type sourceScan struct {
+	header   []string
+	indexMap map[string]int
+	report   *rowReport
+	count    int
+}
 
-		records = append(records, record)
+// parseSourceFileWithType 导入已取到本地 localPath 的文件，key 为其在存储中的位置。
+// replace 不为空时表示重新解析该源文件：先删除它及其记录，新记录沿用原 ID 与上传时间
+func (p *Processor) parseSourceFileWithType(periodID uint, userID *uint, key, localPath, originalName string, scheme models.Scheme, part models.Part, fileType models.FileType, opts ParseOptions, replace *models.SourceFile) (*ParseResult, error) {
+	var excludeID uint
+	if replace != nil {
+		excludeID = replace.ID
 	}
-
-	if len(records) == 0 {
-		return nil, errors.New("Excel文件中没有找到有效的数据行，请检查文件格式和内容")
+	hash, duplicates, err := p.checkDuplicateContent(userID, periodID, localPath, opts.Duplicates, excludeID)
+	if err != nil {
+		return nil, err
 	}
+	now := time.Now()
 
+	// 逐行读取并分批写入，文件再大也只在内存中保留一个批次的记录；
+	// 任何错误（含拒绝行超过阈值）都会回滚整个事务
 	var savedSource models.SourceFile
+	var scan *sourceScan
 	txErr := p.db.Transaction(func(tx *gorm.DB) error {
-		// 对于正常文件，删除同类旧记录（覆盖模式）
-		// 对于补退文件，不删除旧记录（累加模式）
-		if fileType == models.FileTypeNormal {
-			if err := tx.Where("period_id = ? AND scheme = ? AND part = ? AND file_type = ?", periodID, scheme, part, fileType).Delete(&models.RawRecord{}).Error; err != nil {
-				return fmt.Errorf("cleanup existing raw records: %w", err)
+		if err := checkPeriodImport(tx, periodID, fileType); err != nil {
+			return err
+		}
+		if replace != nil {
+			if err := tx.Where("source_file_id = ?", replace.ID).Delete(&models.RawRecord{}).Error; err != nil {
+				return fmt.Errorf("cleanup reparsed raw records: %w", err)
 			}
-			if err := tx.Where("period_id = ? AND scheme = ? AND part = ? AND file_type = ?", periodID, scheme, part, fileType).Delete(&models.SourceFile{}).Error; err != nil {
-				return fmt.Errorf("cleanup existing source files: %w", err)
+			if err := tx.Delete(&models.SourceFile{}, replace.ID).Error; err != nil {
+				return fmt.Errorf("cleanup reparsed source file: %w", err)
 			}
 		}
 
 		source := models.SourceFile{
 			UserID:       userID,
 			PeriodID:     periodID,
-			FileName:     filepath.Base(storedPath),
-			StoredPath:   storedPath,
+			FileName:     path.Base(key),
+			StoredPath:   key,
 			Scheme:       scheme,
 			Part:         part,
 			FileType:     fileType,
-			Rows:         len(records),
+			Version:      1,
+			Active:       true,
 			Status:       "parsed",
 			OriginalName: originalName,
+			ContentHash:  hash,
 			UploadedAt:   now,
 		}
+		switch {
+		case replace != nil:
+			source.ID = replace.ID
+			source.Version = replace.Version
+			source.Active = replace.Active
+			source.UploadedAt = replace.UploadedAt
+			source.Notes = replace.Notes
+		case fileType == models.FileTypeNormal:
+			// 正常文件按版本保存：旧版本及其记录保留，仅取消生效，可随时切换回去；
+			// 补退文件为累加模式，没有版本之分
+			version, err := nextSourceVersion(tx, periodID, scheme, part)
+			if err != nil {
+				return err
+			}
+			if err := deactivateSourceVersions(tx, periodID, scheme, part); err != nil {
+				return err
+			}
+			source.Version = version
+		}
+		active := source.Active
 		if err := tx.Create(&source).Error; err != nil {
 			return fmt.Errorf("save source file: %w", err)
 		}
-		savedSource = source
+		if !active {
+			// active 列默认为 true，Create 会把零值替换为默认值
+			if err := tx.Model(&source).Update("active", false).Error; err != nil {
+				return fmt.Errorf("save source file: %w", err)
+			}
+		}
+
+		batch := make([]models.RawRecord, 0, p.batchSize)
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if err := tx.Create(&batch).Error; err != nil {
+				return fmt.Errorf("insert raw records: %w", err)
+			}
+			batch = batch[:0]
+			return nil
+		}
+
+		scanSheet := scanSourceSheet
+		if scheme == models.SchemeHousingFund {
+			scanSheet = scanHousingFundSheet
+		}
+		var err error
+		scan, err = scanSheet(periodID, userID, localPath, scheme, part, fileType, opts, func(record models.RawRecord) error {
+			record.SourceFileID = source.ID
+			batch = append(batch, record)
+			if len(batch) >= p.batchSize {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := flush(); err != nil {
+			return err
+		}
 
-		for i := range records {
-			records[i].SourceFileID = source.ID
+		source.Rows = scan.count
+		source.RejectedRows = scan.report.rejected
+		if err := tx.Model(&source).Updates(map[string]any{"rows": source.Rows, "rejected_rows": source.RejectedRows}).Error; err != nil {
+			return fmt.Errorf("update source file: %w", err)
 		}
-		if err := tx.Create(&records).Error; err != nil {
-			return fmt.Errorf("insert raw records: %w", err)
+		if fileType == models.FileTypeNormal && source.Active {
+			if err := markPeriodUploaded(tx, periodID); err != nil {
+				return err
+			}
 		}
+		savedSource = source
 		return nil
 	})
 	if txErr != nil {
@@ -267,73 +354,181 @@ func (p *Processor) parseSourceFileWithType(periodID uint, userID *uint, storedP
 	}
 
 	return &ParseResult{
-		File:     savedSource,
-		Imported: len(records),
+		File:            savedSource,
+		Imported:        scan.count,
+		Rejected:        scan.report.rejected,
+		Issues:          scan.report.issues,
+		IssuesTruncated: scan.report.truncated,
+
+		Duplicates: duplicates,
 	}, nil
 }
 
-func (p *Processor) ParseRosterFile(periodID uint, userID *uint, storedPath, originalName string) (*RosterParseResult, error) {
-	fmt.Printf("ParseRosterFile: starting to parse file %s (original: %s)\n", storedPath, originalName)
-
-	f, err := excelize.OpenFile(storedPath)
+// readSourceSheet 读取并校验险种明细文件，返回待导入的记录及问题行报告
+func readSourceSheet(periodID uint, userID *uint, storedPath string, scheme models.Scheme, part models.Part, fileType models.FileType, opts ParseOptions) (*sourceSheet, error) {
+	var records []models.RawRecord
+	scan, err := scanSourceSheet(periodID, userID, storedPath, scheme, part, fileType, opts, func(record models.RawRecord) error {
+		records = append(records, record)
+		return nil
+	})
 	if err != nil {
-		fmt.Printf("ParseRosterFile: failed to open excel file: %v\n", err)
-		return nil, fmt.Errorf("open roster excel: %w", err)
+		return nil, err
 	}
-	defer func() { _ = f.Close() }()
+	return &sourceSheet{
+		header:   scan.header,
+		indexMap: scan.indexMap,
+		records:  records,
+		report:   scan.report,
+	}, nil
+}
 
-	sheets := f.GetSheetList()
-	fmt.Printf("ParseRosterFile: found %d sheets: %v\n", len(sheets), sheets)
-	if len(sheets) == 0 {
-		return nil, errors.New("花名册Excel文件中没有找到工作表")
+// scanSourceSheet 逐行读取并校验险种明细文件，每条有效记录交给 emit 处理
+func scanSourceSheet(periodID uint, userID *uint, storedPath string, scheme models.Scheme, part models.Part, fileType models.FileType, opts ParseOptions, emit func(models.RawRecord) error) (*sourceScan, error) {
+	rows, err := openSheetRows(storedPath)
+	if err != nil {
+		return nil, err
 	}
-	sheetName := sheets[0]
+	defer func() { _ = rows.Close() }()
 
-	rows, err := f.GetRows(sheetName)
-	if err != nil {
-		fmt.Printf("ParseRosterFile: failed to read rows: %v\n", err)
-		return nil, fmt.Errorf("read rows: %w", err)
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("Excel文件中没有数据行，请检查文件内容是否正确")
 	}
-	fmt.Printf("ParseRosterFile: found %d rows\n", len(rows))
-	if len(rows) < 2 {
-		return nil, errors.New("花名册Excel文件中没有数据行，请检查文件内容是否正确")
+	header := rows.Row()
+
+	spec := opts.headerSpec(models.HeaderProfileSource)
+	indexMap := spec.indexHeader(header)
+	if key, missing := spec.missingRequired(indexMap); missing {
+		return nil, fmt.Errorf("missing required column: %s", key)
 	}
 
-	header := rows[0]
-	fmt.Printf("ParseRosterFile: header row: %v\n", header)
-	indexMap := map[string]int{}
-	for idx, cell := range header {
-		cell = strings.TrimSpace(cell)
-		if cell == "" {
+	now := time.Now()
+	report := newRowReport(header)
+	seenIDs := map[string]int{}
+	count := 0
+	// 映射方案可以不要求序号、姓名列，缺少时不按空值拒绝，序号按行顺序编号
+	_, hasSeq := indexMap["seq"]
+	_, hasName := indexMap["name"]
+
+	for rowNum := 2; rows.Next(); rowNum++ {
+		row := rows.Row()
+		if isBlankRow(row) {
+			continue
+		}
+		if isSummaryRow(row) {
+			report.warn(rowNum, "", "", "合计行，已忽略")
 			continue
 		}
-		if key, ok := rosterHeaderMap[cell]; ok {
-			indexMap[key] = idx
+		seq := cellByField(row, indexMap, "seq")
+		name := cellByField(row, indexMap, "name")
+		idNumber := cellByField(row, indexMap, "id_number")
+		switch {
+		case hasSeq && seq == "":
+			report.reject(rowNum, report.columnName(indexMap["seq"], "seq"), "", "序号为空")
+			continue
+		case hasName && name == "":
+			report.reject(rowNum, report.columnName(indexMap["name"], "name"), "", "姓名为空")
+			continue
+		case idNumber == "":
+			report.reject(rowNum, report.columnName(indexMap["id_number"], "id_number"), "", "证件号码为空")
 			continue
 		}
-		switch strings.ToLower(cell) {
-		case "name":
-			indexMap["name"] = idx
-		case "idnumber", "id_no", "id", "身份证号":
-			indexMap["id_number"] = idx
-		case "department", "dept":
-			indexMap["department"] = idx
-		case "title", "position":
-			indexMap["title"] = idx
-		case "remarks", "remark", "note":
-			indexMap["remarks"] = idx
+		if _, ok := parseNumber(seq); hasSeq && !ok {
+			report.warn(rowNum, report.columnName(indexMap["seq"], "seq"), seq, "序号不是数字")
+		}
+		// 正常文件中同一人只应出现一次；补退文件可能按月份重复出现
+		if fileType == models.FileTypeNormal {
+			if firstRow, ok := seenIDs[idNumber]; ok {
+				report.warn(rowNum, report.columnName(indexMap["id_number"], "id_number"), idNumber, fmt.Sprintf("证件号码与第%d行重复", firstRow))
+			} else {
+				seenIDs[idNumber] = rowNum
+			}
+		}
+
+		sequence := count + 1
+		if hasSeq {
+			sequence = toInt(seq)
+		}
+		record := models.RawRecord{
+			UserID:     userID,
+			PeriodID:   periodID,
+			Sequence:   sequence,
+			Name:       name,
+			IDType:     cellByField(row, indexMap, "id_type"),
+			IDNumber:   idNumber,
+			Department: cellByField(row, indexMap, "department"),
+			PaySalary:  report.money(rowNum, row, indexMap, "salary"),
+			PayBase:    report.money(rowNum, row, indexMap, "base"),
+			AmountDue:  report.money(rowNum, row, indexMap, "amount_due"),
+			Scheme:     scheme,
+			Part:       part,
+			FileType:   fileType,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+
+		record.RateText, record.Rate, record.RateFixed = report.rate(rowNum, row, indexMap, "rate", record.PayBase, record.AmountDue)
+		if _, ok := indexMap["amount_adjust"]; ok {
+			record.AmountAdjust = report.money(rowNum, row, indexMap, "amount_adjust")
+		} else {
+			record.AmountAdjust = record.AmountDue
 		}
+		if idx, ok := indexMap["person_code"]; ok {
+			record.PersonCode = strings.TrimSpace(getCell(row, idx))
+		}
+		record.ContributionMonth = report.month(rowNum, row, indexMap, "contribution_month")
+
+		if err := emit(record); err != nil {
+			return nil, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("ParseRosterFile: indexMap: %v\n", indexMap)
+	if report.exceeds(opts.MaxRejectedRows) {
+		return nil, &RejectionThresholdError{Rejected: report.rejected, Limit: opts.MaxRejectedRows, Issues: report.issues}
+	}
+	if count == 0 {
+		return nil, errors.New("Excel文件中没有找到有效的数据行，请检查文件格式和内容")
+	}
 
-	if _, ok := indexMap["id_number"]; !ok {
-		fmt.Printf("ParseRosterFile: missing id_number column in indexMap\n")
-		return nil, errors.New("花名册文件缺少必需的列：证件号码")
+	return &sourceScan{
+		header:   header,
+		indexMap: indexMap,
+		report:   report,
+		count:    count,
+	}, nil
+}
+
+func (p *Processor) ParseRosterFile(periodID uint, userID *uint, key, originalName string, opts ParseOptions) (*RosterParseResult, error) {
+	localPath, cleanup, err := p.fetch(key)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	rows, err := loadSheetRows(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("read roster: %w", err)
+	}
+	if len(rows) < 2 {
+		return nil, errors.New("花名册Excel文件中没有数据行，请检查文件内容是否正确")
 	}
-	if _, ok := indexMap["department"]; !ok {
-		fmt.Printf("ParseRosterFile: missing department column in indexMap\n")
-		return nil, errors.New("花名册文件缺少必需的列：部门")
+
+	header := rows[0]
+	spec := opts.headerSpec(models.HeaderProfileRoster)
+	indexMap := spec.indexHeader(header)
+	if key, missing := spec.missingRequired(indexMap); missing {
+		return nil, fmt.Errorf("花名册文件缺少必需的列：%s", rosterFieldLabel(key))
+	}
+	// 花名册用于确定员工部门，映射方案不要求部门列时也必须有
+	deptIdx, ok := indexMap["department"]
+	if !ok {
+		return nil, fmt.Errorf("花名册文件缺少必需的列：%s", rosterFieldLabel("department"))
 	}
 
 	now := time.Now()
@@ -350,7 +545,7 @@ func (p *Processor) ParseRosterFile(periodID uint, userID *uint, storedPath, ori
 			UserID:     userID,
 			PeriodID:   periodID,
 			IDNumber:   idNumber,
-			Department: strings.TrimSpace(getCell(row, indexMap["department"])),
+			Department: strings.TrimSpace(getCell(row, deptIdx)),
 			CreatedAt:  now,
 			UpdatedAt:  now,
 		}
@@ -377,7 +572,7 @@ func (p *Processor) ParseRosterFile(periodID uint, userID *uint, storedPath, ori
 		if err := tx.Where("period_id = ?", periodID).Delete(&models.RosterEntry{}).Error; err != nil {
 			return fmt.Errorf("cleanup roster: %w", err)
 		}
-		if err := tx.Create(&entries).Error; err != nil {
+		if err := tx.CreateInBatches(&entries, p.batchSize).Error; err != nil {
 			return fmt.Errorf("insert roster: %w", err)
 		}
 		return nil
@@ -388,13 +583,19 @@ func (p *Processor) ParseRosterFile(periodID uint, userID *uint, storedPath, ori
 	return &RosterParseResult{Imported: len(entries)}, nil
 }
 
-func (p *Processor) ParseEmployeeFile(userID uint, storedPath, originalName string) (*EmployeeImportResult, error) {
+func (p *Processor) ParseEmployeeFile(userID uint, key, originalName string) (*EmployeeImportResult, error) {
 	normalizedMap := make(map[string]string, len(employeeHeaderAliases))
 	for raw, field := range employeeHeaderAliases {
 		normalizedMap[normalizeEmployeeHeader(raw)] = field
 	}
 
-	rows, err := loadEmployeeRows(storedPath)
+	localPath, cleanup, err := p.fetch(key)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	rows, err := loadEmployeeRows(localPath)
 	if err != nil {
 		return nil, err
 	}
@@ -653,61 +854,10 @@ func (p *Processor) ParseEmployeeFile(userID uint, storedPath, originalName stri
 }
 
 func loadEmployeeRows(path string) ([][]string, error) {
-	if strings.EqualFold(filepath.Ext(path), ".csv") {
-		return readEmployeeCSV(path)
-	}
-
-	f, err := excelize.OpenFile(path)
-	if err == nil {
-		defer func() { _ = f.Close() }()
-		sheets := f.GetSheetList()
-		if len(sheets) == 0 {
-			return nil, errors.New("员工Excel文件中没有找到工作表")
-		}
-
-		rows, err := f.GetRows(sheets[0])
-		if err != nil {
-			return nil, fmt.Errorf("读取员工Excel数据失败: %w", err)
-		}
-		return rows, nil
-	}
-
-	rows, csvErr := readEmployeeCSV(path)
-	if csvErr == nil {
-		return rows, nil
-	}
-
-	return nil, fmt.Errorf("无法解析员工文件，请确认格式为Excel或CSV: %w", err)
-}
-
-func readEmployeeCSV(path string) ([][]string, error) {
-	file, err := os.Open(path)
+	rows, err := loadSheetRows(path)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("无法解析员工文件，请确认格式为Excel或CSV: %w", err)
 	}
-	defer func() { _ = file.Close() }()
-
-	reader := csv.NewReader(bufio.NewReader(file))
-	reader.FieldsPerRecord = -1
-
-	rows, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
-	}
-	if len(rows) == 0 {
-		return nil, errors.New("员工CSV文件为空")
-	}
-
-	for i := range rows {
-		for j := range rows[i] {
-			value := rows[i][j]
-			if i == 0 && j == 0 {
-				value = stripBOM(value)
-			}
-			rows[i][j] = strings.TrimSpace(value)
-		}
-	}
-
 	return rows, nil
 }
 
@@ -716,43 +866,82 @@ func stripBOM(value string) string {
 }
 
 type ProcessOutput struct {
-	PeriodID uint                    `json:"period_id"`
-	Summary  []models.PeriodSummary  `json:"summary"`
-	Personal []models.PersonalCharge `json:"personal"`
-	Unit     []models.UnitCharge     `json:"unit"`
+	PeriodID    uint                       `json:"period_id"`
+	Summary     []models.PeriodSummary     `json:"summary"`
+	Personal    []models.PersonalCharge    `json:"personal"`
+	Unit        []models.UnitCharge        `json:"unit"`
+	HousingFund []models.HousingFundCharge `json:"housing_fund,omitempty"`
+	// RateIssues 缴费基数×费率与应缴金额相差超过允许差异的记录
+	RateIssues []RateIssue `json:"rate_issues,omitempty"`
+	// Provisional 为预估结果，Missing 为缺少文件的必需险种与缴费部分
+	Provisional bool                   `json:"provisional,omitempty"`
+	Missing     []models.MissingUpload `json:"missing,omitempty"`
+	// RoundingNotice 各险种舍入规则未生效的原因（账期未设置参保城市或城市没有生效的缴费规则）
+	RoundingNotice string `json:"rounding_notice,omitempty"`
 }
 
-var requiredUploads = map[models.Part][]models.Scheme{
-	models.PartPersonal: {
-		models.SchemePension,
-		models.SchemeMedical,
-		models.SchemeSeriousIllness,
-		models.SchemeUnemployment,
-	},
-	models.PartUnit: {
-		models.SchemePension,
-		models.SchemeMedical,
-		models.SchemeSeriousIllness,
-		models.SchemeUnemployment,
-		models.SchemeInjury,
-	},
+// ProcessMode 账期处理方式
+type ProcessMode string
+
+const (
+	ProcessFull        ProcessMode = "full"        // 必需险种齐全才处理
+	ProcessProvisional ProcessMode = "provisional" // 按已上传的文件预估，缺少的险种列在结果中
+)
+
+// ErrProvisionalPeriod 账期最近一次为预估处理，不能定稿
+var ErrProvisionalPeriod = errors.New("账期为预估处理结果，请在必需险种文件齐全后完整处理一次")
+
+// ParseProcessMode 解析处理方式，为空时为完整处理
+func ParseProcessMode(value string) (ProcessMode, error) {
+	switch mode := ProcessMode(strings.TrimSpace(value)); mode {
+	case "":
+		return ProcessFull, nil
+	case ProcessFull, ProcessProvisional:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("无效的处理方式: %s", value)
+	}
+}
+
+// RequireFullProcessing 账期定稿前检查最近一次处理是否完整
+func RequireFullProcessing(period *models.Period) error {
+	if period.Provisional {
+		return ErrProvisionalPeriod
+	}
+	return nil
 }
 
-func (p *Processor) ProcessPeriod(periodID uint) (*ProcessOutput, error) {
+// ProcessPeriod 汇总账期生效版本的记录，生成汇总、扣款明细与公积金缴存明细。
+// 完整处理要求必需险种齐全；预估处理按已上传的文件汇总，并将账期与汇总标记为预估。
+// 已关账的账期不能处理；已审核的账期重新处理后回到已处理，需要重新审核
+func (p *Processor) ProcessPeriod(periodID uint, mode ProcessMode) (*ProcessOutput, error) {
 	var period models.Period
 	if err := p.db.First(&period, periodID).Error; err != nil {
 		return nil, fmt.Errorf("load period: %w", err)
 	}
+	if err := EnsurePeriodOpen(&period); err != nil {
+		return nil, err
+	}
 
 	var records []models.RawRecord
-	if err := p.db.Where("period_id = ? AND file_type = ?", periodID, models.FileTypeNormal).Find(&records).Error; err != nil {
+	if err := p.activeRecords().Where("period_id = ? AND file_type = ?", periodID, models.FileTypeNormal).Find(&records).Error; err != nil {
 		return nil, fmt.Errorf("load raw records: %w", err)
 	}
 	if len(records) == 0 {
 		return nil, errors.New("no raw records found for period")
 	}
 
-	if err := validateRequired(records); err != nil {
+	schemes, err := LoadSchemeRegistry(p.db, period.UserID)
+	if err != nil {
+		return nil, err
+	}
+	missing := missingRequired(records, schemes)
+	if len(missing) > 0 && mode != ProcessProvisional {
+		return nil, fmt.Errorf("missing required data for part=%s scheme=%s", missing[0].Part, missing[0].Scheme)
+	}
+	provisional := len(missing) > 0
+	rounding, roundingNotice, err := p.findRoundingPolicies(&period)
+	if err != nil {
 		return nil, err
 	}
 
@@ -768,9 +957,12 @@ func (p *Processor) ProcessPeriod(periodID uint) (*ProcessOutput, error) {
 		rosterMap[entry.IDNumber] = entry
 	}
 
-	result := buildAggregates(records, rosterMap)
+	result := buildAggregates(records, rosterMap, schemes, rounding)
+	for i := range result.summaries {
+		result.summaries[i].Provisional = provisional
+	}
 
-	err := p.db.Transaction(func(tx *gorm.DB) error {
+	err = p.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Where("period_id = ?", periodID).Delete(&models.PeriodSummary{}).Error; err != nil {
 			return fmt.Errorf("cleanup summary: %w", err)
 		}
@@ -780,22 +972,40 @@ func (p *Processor) ProcessPeriod(periodID uint) (*ProcessOutput, error) {
 		if err := tx.Where("period_id = ?", periodID).Delete(&models.UnitCharge{}).Error; err != nil {
 			return fmt.Errorf("cleanup unit charges: %w", err)
 		}
+		if err := tx.Where("period_id = ?", periodID).Delete(&models.HousingFundCharge{}).Error; err != nil {
+			return fmt.Errorf("cleanup housing fund charges: %w", err)
+		}
 
-		if err := tx.Create(&result.summaries).Error; err != nil {
+		if err := tx.CreateInBatches(&result.summaries, p.batchSize).Error; err != nil {
 			return fmt.Errorf("insert summaries: %w", err)
 		}
-		if err := tx.Create(&result.personalCharges).Error; err != nil {
+		if err := tx.CreateInBatches(&result.personalCharges, p.batchSize).Error; err != nil {
 			return fmt.Errorf("insert personal charges: %w", err)
 		}
-		if err := tx.Create(&result.unitCharges).Error; err != nil {
+		if err := tx.CreateInBatches(&result.unitCharges, p.batchSize).Error; err != nil {
 			return fmt.Errorf("insert unit charges: %w", err)
 		}
+		if len(result.housingFundCharges) > 0 {
+			if err := tx.CreateInBatches(&result.housingFundCharges, p.batchSize).Error; err != nil {
+				return fmt.Errorf("insert housing fund charges: %w", err)
+			}
+		}
 
-		period.Status = "processed"
-		period.UpdatedAt = time.Now()
-		if err := tx.Save(&period).Error; err != nil {
-			return fmt.Errorf("update period status: %w", err)
+		// 以未关账为条件只更新处理相关的列：并发关账时整个处理回滚，不覆盖其他请求修改的账期设置
+		now := time.Now()
+		result := tx.Model(&models.Period{}).Where("id = ? AND status <> ?", periodID, models.PeriodClosed).
+			Select("status", "provisional", "missing_uploads", "updated_at").
+			Updates(&models.Period{Status: models.PeriodProcessed, Provisional: provisional, MissingUploads: missing, UpdatedAt: now})
+		if result.Error != nil {
+			return fmt.Errorf("update period status: %w", result.Error)
 		}
+		if result.RowsAffected == 0 {
+			return ErrPeriodClosed
+		}
+		period.Status = models.PeriodProcessed
+		period.Provisional = provisional
+		period.MissingUploads = missing
+		period.UpdatedAt = now
 		return nil
 	})
 	if err != nil {
@@ -803,14 +1013,21 @@ func (p *Processor) ProcessPeriod(periodID uint) (*ProcessOutput, error) {
 	}
 
 	return &ProcessOutput{
-		PeriodID: periodID,
-		Summary:  result.summaries,
-		Personal: result.personalCharges,
-		Unit:     result.unitCharges,
+		PeriodID:    periodID,
+		Summary:     result.summaries,
+		Personal:    result.personalCharges,
+		Unit:        result.unitCharges,
+		HousingFund: result.housingFundCharges,
+		RateIssues:  checkRates(records, p.rateTolerance),
+		Provisional: provisional,
+		Missing:     missing,
+
+		RoundingNotice: roundingNotice,
 	}, nil
 }
 
-func validateRequired(records []models.RawRecord) error {
+// missingRequired 列出险种登记表中必需、但尚未上传的险种与缴费部分，先个人后单位
+func missingRequired(records []models.RawRecord, schemes *SchemeRegistry) []models.MissingUpload {
 	found := map[models.Part]map[models.Scheme]bool{}
 	for _, rec := range records {
 		if _, ok := found[rec.Part]; !ok {
@@ -819,72 +1036,41 @@ func validateRequired(records []models.RawRecord) error {
 		found[rec.Part][rec.Scheme] = true
 	}
 
-	for part, schemes := range requiredUploads {
-		for _, scheme := range schemes {
+	var missing []models.MissingUpload
+	required := schemes.RequiredUploads()
+	for _, part := range []models.Part{models.PartPersonal, models.PartUnit} {
+		for _, scheme := range required[part] {
 			if !found[part][scheme] {
-				return fmt.Errorf("missing required data for part=%s scheme=%s", part, scheme)
+				missing = append(missing, models.MissingUpload{Scheme: scheme, Part: part})
 			}
 		}
 	}
-	return nil
+	return missing
 }
 
 type aggregateResult struct {
-	summaries       []models.PeriodSummary
-	personalCharges []models.PersonalCharge
-	unitCharges     []models.UnitCharge
+	summaries          []models.PeriodSummary
+	personalCharges    []models.PersonalCharge
+	unitCharges        []models.UnitCharge
+	housingFundCharges []models.HousingFundCharge
 }
 
 type personAccumulator struct {
 	Name         string
 	IDNumber     string
 	Department   string
-	PersonalBase float64
-	UnitBase     float64
-
-	Personal struct {
-		Pension        float64
-		Medical        float64
-		SeriousIllness float64
-		Unemployment   float64
-	}
-	Unit struct {
-		Pension        float64
-		Medical        float64
-		SeriousIllness float64
-		Injury         float64
-		Unemployment   float64
-	}
+	PersonalBase models.Money
+	UnitBase     models.Money
+
+	Personal models.SchemeAmounts
+	Unit     models.SchemeAmounts
 }
 
-func buildAggregates(records []models.RawRecord, roster map[string]models.RosterEntry) aggregateResult {
-	now := time.Now()
-	summaryMap := map[string]*models.PeriodSummary{}
-	headcountSet := map[string]map[string]struct{}{}
+// accumulatePeople 按证件号码累加每人各险种的金额，只计入险种登记表中适用于该缴费部分的险种；
+// 金额按社保局的舍入规则逐条或按人舍入
+func accumulatePeople(records []models.RawRecord, roster map[string]models.RosterEntry, schemes *SchemeRegistry, rounding roundingPolicies) map[string]*personAccumulator {
 	personMap := map[string]*personAccumulator{}
-
-	// deterministic order by IDNumber
 	for _, rec := range records {
-		sumKey := fmt.Sprintf("%s_%s", rec.Scheme, rec.Part)
-		if _, ok := summaryMap[sumKey]; !ok {
-			summaryMap[sumKey] = &models.PeriodSummary{
-				UserID:    rec.UserID,
-				PeriodID:  rec.PeriodID,
-				Scheme:    rec.Scheme,
-				Part:      rec.Part,
-				CreatedAt: now,
-				UpdatedAt: now,
-			}
-		}
-		sum := summaryMap[sumKey]
-		sum.BaseTotal += rec.PayBase
-		sum.AmountTotal += rec.AmountDue
-
-		if _, ok := headcountSet[sumKey]; !ok {
-			headcountSet[sumKey] = map[string]struct{}{}
-		}
-		headcountSet[sumKey][rec.IDNumber] = struct{}{}
-
 		person, ok := personMap[rec.IDNumber]
 		if !ok {
 			var name, department string
@@ -903,100 +1089,102 @@ func buildAggregates(records []models.RawRecord, roster map[string]models.Roster
 				Name:       name,
 				IDNumber:   rec.IDNumber,
 				Department: department,
+				Personal:   models.SchemeAmounts{},
+				Unit:       models.SchemeAmounts{},
 			}
 			personMap[rec.IDNumber] = person
 		}
+		if !schemes.Applies(rec.Scheme, rec.Part) {
+			continue
+		}
+		// 扣款明细的基数取社保缴费基数，公积金缴存基数另见公积金缴存明细
+		socialBase := rec.Scheme != models.SchemeHousingFund
 		switch rec.Part {
 		case models.PartPersonal:
-			if person.PersonalBase == 0 {
+			if person.PersonalBase == 0 && socialBase {
 				person.PersonalBase = rec.PayBase
 			}
-			switch rec.Scheme {
-			case models.SchemePension:
-				person.Personal.Pension += rec.AmountDue
-			case models.SchemeMedical:
-				person.Personal.Medical += rec.AmountDue
-			case models.SchemeSeriousIllness:
-				person.Personal.SeriousIllness += rec.AmountDue
-			case models.SchemeUnemployment:
-				person.Personal.Unemployment += rec.AmountDue
-			}
+			person.Personal[rec.Scheme] += rounding.line(rec)
 		case models.PartUnit:
-			if person.UnitBase == 0 {
+			if person.UnitBase == 0 && socialBase {
 				person.UnitBase = rec.PayBase
 			}
-			switch rec.Scheme {
-			case models.SchemePension:
-				person.Unit.Pension += rec.AmountDue
-			case models.SchemeMedical:
-				person.Unit.Medical += rec.AmountDue
-			case models.SchemeSeriousIllness:
-				person.Unit.SeriousIllness += rec.AmountDue
-			case models.SchemeUnemployment:
-				person.Unit.Unemployment += rec.AmountDue
-			case models.SchemeInjury:
-				person.Unit.Injury += rec.AmountDue
-			}
+			person.Unit[rec.Scheme] += rounding.line(rec)
 		}
 	}
+	for _, person := range personMap {
+		rounding.person(models.PartPersonal, person.Personal)
+		rounding.person(models.PartUnit, person.Unit)
+	}
+	return personMap
+}
 
-	summaries := make([]models.PeriodSummary, 0, len(summaryMap))
-	for _, value := range summaryMap {
-		key := fmt.Sprintf("%s_%s", value.Scheme, value.Part)
-		if set, ok := headcountSet[key]; ok {
-			value.Headcount = len(set)
+// compactAmounts 去掉金额为0的险种
+func compactAmounts(amounts models.SchemeAmounts) models.SchemeAmounts {
+	compacted := models.SchemeAmounts{}
+	for scheme, amount := range amounts {
+		if amount != 0 {
+			compacted[scheme] = amount
 		}
-		value.BaseTotal = round2(value.BaseTotal)
-		value.AmountTotal = round2(value.AmountTotal)
-		summaries = append(summaries, *value)
 	}
+	return compacted
+}
+
+// newPersonalCharge 生成个人扣款明细。固定列保留给旧接口使用，新增险种只体现在 Amounts 与小计中
+func newPersonalCharge(userID *uint, periodID uint, person *personAccumulator, now time.Time) models.PersonalCharge {
+	amounts := compactAmounts(person.Personal)
+	return models.PersonalCharge{
+		UserID:           userID,
+		PeriodID:         periodID,
+		Name:             person.Name,
+		IDNumber:         person.IDNumber,
+		Department:       person.Department,
+		Base:             person.PersonalBase,
+		Pension:          amounts[models.SchemePension],
+		MedicalMaternity: amounts[models.SchemeMedical],
+		SeriousIllness:   amounts[models.SchemeSeriousIllness],
+		Unemployment:     amounts[models.SchemeUnemployment],
+		Amounts:          amounts,
+		Subtotal:         person.Personal.Total(),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+}
+
+// newUnitCharge 生成单位扣款明细，固定列中的医疗含大额医疗
+func newUnitCharge(userID *uint, periodID uint, person *personAccumulator, now time.Time) models.UnitCharge {
+	amounts := compactAmounts(person.Unit)
+	return models.UnitCharge{
+		UserID:           userID,
+		PeriodID:         periodID,
+		Name:             person.Name,
+		IDNumber:         person.IDNumber,
+		Department:       person.Department,
+		Base:             maxMoney(person.UnitBase, person.PersonalBase), // fallback to personal base if unit missing
+		Pension:          amounts[models.SchemePension],
+		MedicalMaternity: amounts[models.SchemeMedical] + amounts[models.SchemeSeriousIllness],
+		SeriousIllness:   amounts[models.SchemeSeriousIllness],
+		Injury:           amounts[models.SchemeInjury],
+		Unemployment:     amounts[models.SchemeUnemployment],
+		Amounts:          amounts,
+		Subtotal:         person.Unit.Total(),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+}
+
+func buildAggregates(records []models.RawRecord, roster map[string]models.RosterEntry, schemes *SchemeRegistry, rounding roundingPolicies) aggregateResult {
+	now := time.Now()
+	summaries := buildSummaryFromRecords(records, rounding)
+	schemes.SortSummaries(summaries)
 
 	var personalCharges []models.PersonalCharge
 	var unitCharges []models.UnitCharge
-	for _, person := range personMap {
-		personalSubtotal := round2(person.Personal.Pension + person.Personal.Medical + person.Personal.SeriousIllness + person.Personal.Unemployment)
-		personalCharges = append(personalCharges, models.PersonalCharge{
-			UserID:           records[0].UserID,
-			PeriodID:         records[0].PeriodID,
-			Name:             person.Name,
-			IDNumber:         person.IDNumber,
-			Department:       person.Department,
-			Base:             round2(person.PersonalBase),
-			Pension:          round2(person.Personal.Pension),
-			MedicalMaternity: round2(person.Personal.Medical),
-			SeriousIllness:   round2(person.Personal.SeriousIllness),
-			Unemployment:     round2(person.Personal.Unemployment),
-			Subtotal:         personalSubtotal,
-			CreatedAt:        now,
-			UpdatedAt:        now,
-		})
-
-		unitMedicalTotal := person.Unit.Medical + person.Unit.SeriousIllness
-		unitSubtotal := round2(person.Unit.Pension + unitMedicalTotal + person.Unit.Injury + person.Unit.Unemployment)
-		unitCharges = append(unitCharges, models.UnitCharge{
-			UserID:           records[0].UserID,
-			PeriodID:         records[0].PeriodID,
-			Name:             person.Name,
-			IDNumber:         person.IDNumber,
-			Department:       person.Department,
-			Base:             round2(maxFloat(person.UnitBase, person.PersonalBase)), // fallback to personal base if unit missing
-			Pension:          round2(person.Unit.Pension),
-			MedicalMaternity: round2(unitMedicalTotal),
-			SeriousIllness:   round2(person.Unit.SeriousIllness),
-			Injury:           round2(person.Unit.Injury),
-			Unemployment:     round2(person.Unit.Unemployment),
-			Subtotal:         unitSubtotal,
-			CreatedAt:        now,
-			UpdatedAt:        now,
-		})
+	for _, person := range accumulatePeople(records, roster, schemes, rounding) {
+		personalCharges = append(personalCharges, newPersonalCharge(records[0].UserID, records[0].PeriodID, person, now))
+		unitCharges = append(unitCharges, newUnitCharge(records[0].UserID, records[0].PeriodID, person, now))
 	}
 
-	sort.Slice(summaries, func(i, j int) bool {
-		if summaries[i].Part == summaries[j].Part {
-			return summaries[i].Scheme < summaries[j].Scheme
-		}
-		return summaries[i].Part < summaries[j].Part
-	})
 	sort.Slice(personalCharges, func(i, j int) bool {
 		return personalCharges[i].IDNumber < personalCharges[j].IDNumber
 	})
@@ -1005,9 +1193,10 @@ func buildAggregates(records []models.RawRecord, roster map[string]models.Roster
 	})
 
 	return aggregateResult{
-		summaries:       summaries,
-		personalCharges: personalCharges,
-		unitCharges:     unitCharges,
+		summaries:          summaries,
+		personalCharges:    personalCharges,
+		unitCharges:        unitCharges,
+		housingFundCharges: buildHousingFundCharges(records, roster, schemes, rounding, now),
 	}
 }
 
@@ -1094,35 +1283,31 @@ func toInt(value string) int {
 }
 
 func toFloat(value string) float64 {
-	value = strings.TrimSpace(value)
-	value = strings.ReplaceAll(value, ",", "")
-	value = strings.TrimSuffix(value, "%")
-	if value == "" {
-		return 0
-	}
-	if f, err := strconv.ParseFloat(value, 64); err == nil {
-		return f
-	}
-	return 0
+	f, _ := parseNumber(value)
+	return f
 }
 
 func round2(val float64) float64 {
 	return math.Round(val*100) / 100
 }
 
-func maxFloat(a, b float64) float64 {
+func maxMoney(a, b models.Money) models.Money {
 	if a >= b {
 		return a
 	}
 	return b
 }
 
-// ProcessAdjustments 处理补退数据，将其累加到现有的扣款明细中
+// ProcessAdjustments 处理补退数据，将其累加到现有的扣款明细中。
+// 要求账期未关账且开启了补退；已审核的账期处理补退后回到已处理
 func (p *Processor) ProcessAdjustments(periodID uint) (*ProcessOutput, error) {
 	var period models.Period
 	if err := p.db.First(&period, periodID).Error; err != nil {
 		return nil, fmt.Errorf("load period: %w", err)
 	}
+	if err := EnsureAdjustmentsAllowed(&period); err != nil {
+		return nil, err
+	}
 
 	// 检查是否有补退数据
 	var adjustmentRecords []models.RawRecord
@@ -1146,8 +1331,17 @@ func (p *Processor) ProcessAdjustments(periodID uint) (*ProcessOutput, error) {
 		rosterMap[entry.IDNumber] = entry
 	}
 
+	schemes, err := LoadSchemeRegistry(p.db, period.UserID)
+	if err != nil {
+		return nil, err
+	}
+	rounding, err := p.loadRoundingPolicies(&period)
+	if err != nil {
+		return nil, err
+	}
+
 	// 构建补退数据的聚合结果
-	adjustmentResult := buildAdjustments(adjustmentRecords, rosterMap)
+	adjustmentResult := buildAdjustments(adjustmentRecords, rosterMap, schemes, rounding)
 
 	// 获取现有的扣款明细
 	var existingPersonal []models.PersonalCharge
@@ -1169,7 +1363,7 @@ func (p *Processor) ProcessAdjustments(periodID uint) (*ProcessOutput, error) {
 	}
 
 	// 在事务中插入补退数据
-	err := p.db.Transaction(func(tx *gorm.DB) error {
+	err = p.db.Transaction(func(tx *gorm.DB) error {
 		// 删除已存在的补退记录（如果有的话）
 		if err := tx.Where("period_id = ? AND is_adjustment = ?", periodID, true).Delete(&models.PersonalCharge{}).Error; err != nil {
 			return fmt.Errorf("cleanup existing adjustment personal charges: %w", err)
@@ -1180,12 +1374,12 @@ func (p *Processor) ProcessAdjustments(periodID uint) (*ProcessOutput, error) {
 
 		// 插入新的补退数据
 		if len(adjustmentResult.personalCharges) > 0 {
-			if err := tx.Create(&adjustmentResult.personalCharges).Error; err != nil {
+			if err := tx.CreateInBatches(&adjustmentResult.personalCharges, p.batchSize).Error; err != nil {
 				return fmt.Errorf("insert adjustment personal charges: %w", err)
 			}
 		}
 		if len(adjustmentResult.unitCharges) > 0 {
-			if err := tx.Create(&adjustmentResult.unitCharges).Error; err != nil {
+			if err := tx.CreateInBatches(&adjustmentResult.unitCharges, p.batchSize).Error; err != nil {
 				return fmt.Errorf("insert adjustment unit charges: %w", err)
 			}
 		}
@@ -1197,11 +1391,13 @@ func (p *Processor) ProcessAdjustments(periodID uint) (*ProcessOutput, error) {
 	}
 
 	// 为补退数据创建汇总记录
-	adjustmentSummaryResult := buildSummaryFromRecords(adjustmentRecords)
+	adjustmentSummaryResult := buildSummaryFromRecords(adjustmentRecords, rounding)
+	schemes.SortSummaries(adjustmentSummaryResult)
 
 	// 为补退汇总数据标记为补退记录
 	for i := range adjustmentSummaryResult {
 		adjustmentSummaryResult[i].IsAdjustment = true
+		adjustmentSummaryResult[i].Provisional = period.Provisional
 	}
 
 	err = p.db.Transaction(func(tx *gorm.DB) error {
@@ -1212,10 +1408,16 @@ func (p *Processor) ProcessAdjustments(periodID uint) (*ProcessOutput, error) {
 
 		// 插入新的补退汇总数据
 		if len(adjustmentSummaryResult) > 0 {
-			if err := tx.Create(&adjustmentSummaryResult).Error; err != nil {
+			if err := tx.CreateInBatches(&adjustmentSummaryResult, p.batchSize).Error; err != nil {
 				return fmt.Errorf("insert adjustment summaries: %w", err)
 			}
 		}
+
+		// 补退改变了处理结果，已审核的账期须重新审核
+		if err := tx.Model(&models.Period{}).Where("id = ? AND status = ?", periodID, models.PeriodReviewed).
+			Update("status", models.PeriodProcessed).Error; err != nil {
+			return fmt.Errorf("update period status: %w", err)
+		}
 		return nil
 	})
 	if err != nil {
@@ -1246,104 +1448,14 @@ func (p *Processor) ProcessAdjustments(periodID uint) (*ProcessOutput, error) {
 }
 
 // buildAdjustments 构建补退数据的聚合结果（类似buildAggregates，但只处理补退数据）
-func buildAdjustments(records []models.RawRecord, roster map[string]models.RosterEntry) aggregateResult {
+func buildAdjustments(records []models.RawRecord, roster map[string]models.RosterEntry, schemes *SchemeRegistry, rounding roundingPolicies) aggregateResult {
 	now := time.Now()
-	personMap := map[string]*personAccumulator{}
-
-	for _, rec := range records {
-		person, ok := personMap[rec.IDNumber]
-		if !ok {
-			var name, department string
-			if entry, exists := roster[rec.IDNumber]; exists {
-				name = entry.Name
-				department = entry.Department
-			}
-			if name == "" {
-				name = rec.Name
-			}
-			if department == "" {
-				department = rec.Department
-			}
-
-			person = &personAccumulator{
-				Name:       name,
-				IDNumber:   rec.IDNumber,
-				Department: department,
-			}
-			personMap[rec.IDNumber] = person
-		}
-
-		switch rec.Part {
-		case models.PartPersonal:
-			if person.PersonalBase == 0 {
-				person.PersonalBase = rec.PayBase
-			}
-			switch rec.Scheme {
-			case models.SchemePension:
-				person.Personal.Pension += rec.AmountDue
-			case models.SchemeMedical:
-				person.Personal.Medical += rec.AmountDue
-			case models.SchemeSeriousIllness:
-				person.Personal.SeriousIllness += rec.AmountDue
-			case models.SchemeUnemployment:
-				person.Personal.Unemployment += rec.AmountDue
-			}
-		case models.PartUnit:
-			if person.UnitBase == 0 {
-				person.UnitBase = rec.PayBase
-			}
-			switch rec.Scheme {
-			case models.SchemePension:
-				person.Unit.Pension += rec.AmountDue
-			case models.SchemeMedical:
-				person.Unit.Medical += rec.AmountDue
-			case models.SchemeSeriousIllness:
-				person.Unit.SeriousIllness += rec.AmountDue
-			case models.SchemeUnemployment:
-				person.Unit.Unemployment += rec.AmountDue
-			case models.SchemeInjury:
-				person.Unit.Injury += rec.AmountDue
-			}
-		}
-	}
 
 	var personalCharges []models.PersonalCharge
 	var unitCharges []models.UnitCharge
-	for _, person := range personMap {
-		personalSubtotal := round2(person.Personal.Pension + person.Personal.Medical + person.Personal.SeriousIllness + person.Personal.Unemployment)
-		personalCharges = append(personalCharges, models.PersonalCharge{
-			UserID:           records[0].UserID,
-			PeriodID:         records[0].PeriodID,
-			Name:             person.Name,
-			IDNumber:         person.IDNumber,
-			Department:       person.Department,
-			Base:             round2(person.PersonalBase),
-			Pension:          round2(person.Personal.Pension),
-			MedicalMaternity: round2(person.Personal.Medical),
-			SeriousIllness:   round2(person.Personal.SeriousIllness),
-			Unemployment:     round2(person.Personal.Unemployment),
-			Subtotal:         personalSubtotal,
-			CreatedAt:        now,
-			UpdatedAt:        now,
-		})
-
-		unitMedicalTotal := person.Unit.Medical + person.Unit.SeriousIllness
-		unitSubtotal := round2(person.Unit.Pension + unitMedicalTotal + person.Unit.Injury + person.Unit.Unemployment)
-		unitCharges = append(unitCharges, models.UnitCharge{
-			PeriodID:         records[0].PeriodID,
-			Name:             person.Name,
-			IDNumber:         person.IDNumber,
-			Department:       person.Department,
-			Base:             round2(maxFloat(person.UnitBase, person.PersonalBase)),
-			Pension:          round2(person.Unit.Pension),
-			MedicalMaternity: round2(unitMedicalTotal),
-			SeriousIllness:   round2(person.Unit.SeriousIllness),
-			Injury:           round2(person.Unit.Injury),
-			Unemployment:     round2(person.Unit.Unemployment),
-			Subtotal:         unitSubtotal,
-			CreatedAt:        now,
-			UpdatedAt:        now,
-		})
+	for _, person := range accumulatePeople(records, roster, schemes, rounding) {
+		personalCharges = append(personalCharges, newPersonalCharge(records[0].UserID, records[0].PeriodID, person, now))
+		unitCharges = append(unitCharges, newUnitCharge(records[0].UserID, records[0].PeriodID, person, now))
 	}
 
 	return aggregateResult{
@@ -1353,6 +1465,18 @@ func buildAdjustments(records []models.RawRecord, roster map[string]models.Roste
 	}
 }
 
+// mergeAmounts 按险种累加两组金额
+func mergeAmounts(a, b models.SchemeAmounts) models.SchemeAmounts {
+	merged := models.SchemeAmounts{}
+	for scheme, amount := range a {
+		merged[scheme] += amount
+	}
+	for scheme, amount := range b {
+		merged[scheme] += amount
+	}
+	return compactAmounts(merged)
+}
+
 // mergePersonalCharges 合并现有个人扣款明细和补退明细
 func mergePersonalCharges(existing []models.PersonalCharge, adjustments []models.PersonalCharge) []models.PersonalCharge {
 	existingMap := make(map[string]*models.PersonalCharge)
@@ -1369,7 +1493,8 @@ func mergePersonalCharges(existing []models.PersonalCharge, adjustments []models
 			existingCharge.MedicalMaternity += adj.MedicalMaternity
 			existingCharge.SeriousIllness += adj.SeriousIllness
 			existingCharge.Unemployment += adj.Unemployment
-			existingCharge.Subtotal = round2(existingCharge.Pension + existingCharge.MedicalMaternity + existingCharge.SeriousIllness + existingCharge.Unemployment)
+			existingCharge.Amounts = mergeAmounts(existingCharge.AmountsByScheme(), adj.AmountsByScheme())
+			existingCharge.Subtotal = existingCharge.Amounts.Total()
 			existingCharge.UpdatedAt = now
 
 			// 如果补退数据有部门信息而现有数据没有，则更新部门信息
@@ -1412,7 +1537,8 @@ func mergeUnitCharges(existing []models.UnitCharge, adjustments []models.UnitCha
 			existingCharge.SeriousIllness += adj.SeriousIllness
 			existingCharge.Injury += adj.Injury
 			existingCharge.Unemployment += adj.Unemployment
-			existingCharge.Subtotal = round2(existingCharge.Pension + existingCharge.MedicalMaternity + existingCharge.Injury + existingCharge.Unemployment)
+			existingCharge.Amounts = mergeAmounts(existingCharge.AmountsByScheme(), adj.AmountsByScheme())
+			existingCharge.Subtotal = existingCharge.Amounts.Total()
 			existingCharge.UpdatedAt = now
 
 			// 如果补退数据有部门信息而现有数据没有，则更新部门信息
@@ -1438,11 +1564,11 @@ func mergeUnitCharges(existing []models.UnitCharge, adjustments []models.UnitCha
 	return existing
 }
 
-// buildSummaryFromRecords 从记录构建汇总数据
-func buildSummaryFromRecords(records []models.RawRecord) []models.PeriodSummary {
+// buildSummaryFromRecords 从记录构建汇总数据，应缴金额合计按社保局的舍入规则逐条、按人或对合计舍入
+func buildSummaryFromRecords(records []models.RawRecord, rounding roundingPolicies) []models.PeriodSummary {
 	now := time.Now()
 	summaryMap := map[string]*models.PeriodSummary{}
-	headcountSet := map[string]map[string]struct{}{}
+	personAmounts := map[string]map[string]models.Money{}
 
 	for _, rec := range records {
 		sumKey := fmt.Sprintf("%s_%s", rec.Scheme, rec.Part)
@@ -1458,22 +1584,22 @@ func buildSummaryFromRecords(records []models.RawRecord) []models.PeriodSummary
 		}
 		sum := summaryMap[sumKey]
 		sum.BaseTotal += rec.PayBase
-		sum.AmountTotal += rec.AmountDue
 
-		if _, ok := headcountSet[sumKey]; !ok {
-			headcountSet[sumKey] = map[string]struct{}{}
+		if _, ok := personAmounts[sumKey]; !ok {
+			personAmounts[sumKey] = map[string]models.Money{}
 		}
-		headcountSet[sumKey][rec.IDNumber] = struct{}{}
+		personAmounts[sumKey][rec.IDNumber] += rounding.line(rec)
 	}
 
 	summaries := make([]models.PeriodSummary, 0, len(summaryMap))
 	for _, value := range summaryMap {
 		key := fmt.Sprintf("%s_%s", value.Scheme, value.Part)
-		if set, ok := headcountSet[key]; ok {
-			value.Headcount = len(set)
+		amounts := personAmounts[key]
+		value.Headcount = len(amounts)
+		for _, amount := range amounts {
+			value.AmountTotal += rounding.round(value.Scheme, value.Part, models.RoundingPerPerson, amount)
 		}
-		value.BaseTotal = round2(value.BaseTotal)
-		value.AmountTotal = round2(value.AmountTotal)
+		value.AmountTotal = rounding.round(value.Scheme, value.Part, models.RoundingPerTotal, value.AmountTotal)
 		summaries = append(summaries, *value)
 	}
 
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"siapp/internal/models"
+	"siapp/internal/storage"
+)
+
+// benchmarkSourceRows 基准测试使用的明细行数，对应一个大型单位的全年补缴明细
+const benchmarkSourceRows = 100000
+
+// benchmarkPeakHeapLimit 导入 10 万行时允许的堆内存峰值
+const benchmarkPeakHeapLimit = 256 << 20
+
+// writeLargeSourceWorkbook 使用流式写入生成指定行数的险种明细文件
+func writeLargeSourceWorkbook(b *testing.B, path string, rows int) {
+	b.Helper()
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+
+	sw, err := f.NewStreamWriter("Sheet1")
+	if err != nil {
+		b.Fatalf("创建流式写入失败: %v", err)
+	}
+	header := []any{"序号", "姓名", "证件类型", "证件号码", "缴费工资", "缴费基数", "费率", "应缴费额"}
+	if err := sw.SetRow("A1", header); err != nil {
+		b.Fatalf("写入表头失败: %v", err)
+	}
+	for i := 1; i <= rows; i++ {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		row := []any{i, fmt.Sprintf("员工%06d", i), "居民身份证", fmt.Sprintf("110101199001%06d", i), 8000, 8000, "8%", 640}
+		if err := sw.SetRow(cell, row); err != nil {
+			b.Fatalf("写入第%d行失败: %v", i+1, err)
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		b.Fatalf("写入文件失败: %v", err)
+	}
+	if err := f.SaveAs(path); err != nil {
+		b.Fatalf("保存文件失败: %v", err)
+	}
+}
+
+// heapSampler 定期采样堆内存，记录导入过程中的峰值
+type heapSampler struct {
+	peak atomic.Uint64
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func startHeapSampler() *heapSampler {
+	s := &heapSampler{stop: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > s.peak.Load() {
+				s.peak.Store(stats.HeapAlloc)
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+func (s *heapSampler) Stop() uint64 {
+	close(s.stop)
+	s.wg.Wait()
+	return s.peak.Load()
+}
+
+func BenchmarkParseSourceFile_100kRows(b *testing.B) {
+	dir := b.TempDir()
+	path := filepath.Join(dir, "large.xlsx")
+	writeLargeSourceWorkbook(b, path, benchmarkSourceRows)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "bench.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		b.Fatalf("打开SQLite失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Period{}, &models.SourceFile{}, &models.RawRecord{}, &models.PeriodApproval{}); err != nil {
+		b.Fatalf("建表失败: %v", err)
+	}
+	store, err := storage.NewLocal(dir)
+	if err != nil {
+		b.Fatalf("创建文件存储失败: %v", err)
+	}
+	processor := NewProcessor(db, store)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		sampler := startHeapSampler()
+		result, err := processor.ParseSourceFile(1, nil, "large.xlsx", "large.xlsx", models.SchemePension, models.PartPersonal, ParseOptions{})
+		peak := sampler.Stop()
+		if err != nil {
+			b.Fatalf("导入失败: %v", err)
+		}
+		if result.Imported != benchmarkSourceRows {
+			b.Fatalf("导入行数应为 %d，实际 %d", benchmarkSourceRows, result.Imported)
+		}
+		if peak > benchmarkPeakHeapLimit {
+			b.Errorf("堆内存峰值 %.1f MB 超过上限 %d MB", float64(peak)/(1<<20), benchmarkPeakHeapLimit>>20)
+		}
+		b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+	}
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 	"time"
 
@@ -9,6 +11,11 @@ import (
 	"siapp/internal/models"
 )
 
+// yuan 以元为单位构造金额，便于测试中书写
+func yuan(v float64) models.Money {
+	return models.MoneyFromFloat(v)
+}
+
 func createProcessorTempTables(t *testing.T, tx *gorm.DB) {
 	t.Helper()
 
@@ -19,7 +26,9 @@ func createProcessorTempTables(t *testing.T, tx *gorm.DB) {
 			year_month TEXT,
 			status TEXT,
 			created_at TIMESTAMPTZ DEFAULT NOW(),
-			updated_at TIMESTAMPTZ DEFAULT NOW()
+			updated_at TIMESTAMPTZ DEFAULT NOW(),
+			provisional BOOLEAN DEFAULT FALSE,
+			missing_uploads TEXT
 		) ON COMMIT DROP`,
 		`CREATE TEMP TABLE raw_records (
 			id BIGSERIAL PRIMARY KEY,
@@ -31,17 +40,21 @@ func createProcessorTempTables(t *testing.T, tx *gorm.DB) {
 			id_type TEXT,
 			id_number TEXT,
 			department TEXT,
-			pay_salary DOUBLE PRECISION,
-			pay_base DOUBLE PRECISION,
+			pay_salary NUMERIC(15,2),
+			pay_base NUMERIC(15,2),
 			rate_text TEXT,
-			amount_due DOUBLE PRECISION,
-			amount_adjust DOUBLE PRECISION,
+			rate DOUBLE PRECISION,
+			rate_fixed NUMERIC(15,2),
+			amount_due NUMERIC(15,2),
+			amount_adjust NUMERIC(15,2),
 			person_code TEXT,
+			account_number TEXT,
 			scheme TEXT,
 			part TEXT,
 			file_type TEXT,
 			created_at TIMESTAMPTZ DEFAULT NOW(),
-			updated_at TIMESTAMPTZ DEFAULT NOW()
+			updated_at TIMESTAMPTZ DEFAULT NOW(),
+			contribution_month TEXT
 		) ON COMMIT DROP`,
 		`CREATE TEMP TABLE roster_entries (
 			id BIGSERIAL PRIMARY KEY,
@@ -62,9 +75,10 @@ func createProcessorTempTables(t *testing.T, tx *gorm.DB) {
 			scheme TEXT,
 			part TEXT,
 			headcount INTEGER,
-			base_total DOUBLE PRECISION,
-			amount_total DOUBLE PRECISION,
+			base_total NUMERIC(15,2),
+			amount_total NUMERIC(15,2),
 			is_adjustment BOOLEAN DEFAULT FALSE,
+			provisional BOOLEAN DEFAULT FALSE,
 			created_at TIMESTAMPTZ DEFAULT NOW(),
 			updated_at TIMESTAMPTZ DEFAULT NOW()
 		) ON COMMIT DROP`,
@@ -75,12 +89,13 @@ func createProcessorTempTables(t *testing.T, tx *gorm.DB) {
 			name TEXT,
 			id_number TEXT,
 			department TEXT,
-			base DOUBLE PRECISION,
-			pension DOUBLE PRECISION,
-			medical_maternity DOUBLE PRECISION,
-			serious_illness DOUBLE PRECISION,
-			unemployment DOUBLE PRECISION,
-			subtotal DOUBLE PRECISION,
+			base NUMERIC(15,2),
+			pension NUMERIC(15,2),
+			medical_maternity NUMERIC(15,2),
+			serious_illness NUMERIC(15,2),
+			unemployment NUMERIC(15,2),
+			amounts TEXT,
+			subtotal NUMERIC(15,2),
 			is_adjustment BOOLEAN DEFAULT FALSE,
 			created_at TIMESTAMPTZ DEFAULT NOW(),
 			updated_at TIMESTAMPTZ DEFAULT NOW()
@@ -92,17 +107,33 @@ func createProcessorTempTables(t *testing.T, tx *gorm.DB) {
 			name TEXT,
 			id_number TEXT,
 			department TEXT,
-			base DOUBLE PRECISION,
-			pension DOUBLE PRECISION,
-			medical_maternity DOUBLE PRECISION,
-			serious_illness DOUBLE PRECISION,
-			injury DOUBLE PRECISION,
-			unemployment DOUBLE PRECISION,
-			subtotal DOUBLE PRECISION,
+			base NUMERIC(15,2),
+			pension NUMERIC(15,2),
+			medical_maternity NUMERIC(15,2),
+			serious_illness NUMERIC(15,2),
+			injury NUMERIC(15,2),
+			unemployment NUMERIC(15,2),
+			amounts TEXT,
+			subtotal NUMERIC(15,2),
 			is_adjustment BOOLEAN DEFAULT FALSE,
 			created_at TIMESTAMPTZ DEFAULT NOW(),
 			updated_at TIMESTAMPTZ DEFAULT NOW()
 		) ON COMMIT DROP`,
+		`CREATE TEMP TABLE housing_fund_charges (
+			id BIGSERIAL PRIMARY KEY,
+			user_id BIGINT,
+			period_id BIGINT NOT NULL,
+			name TEXT,
+			id_number TEXT,
+			account_number TEXT,
+			department TEXT,
+			base NUMERIC(15,2),
+			personal NUMERIC(15,2),
+			unit NUMERIC(15,2),
+			total NUMERIC(15,2),
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			updated_at TIMESTAMPTZ DEFAULT NOW()
+		) ON COMMIT DROP`,
 		`CREATE TEMP TABLE source_files (
 			id BIGSERIAL PRIMARY KEY,
 			user_id BIGINT,
@@ -112,10 +143,30 @@ func createProcessorTempTables(t *testing.T, tx *gorm.DB) {
 			scheme TEXT,
 			part TEXT,
 			file_type TEXT,
+			version INTEGER DEFAULT 1,
+			active BOOLEAN DEFAULT TRUE,
 			rows INTEGER,
+			rejected_rows INTEGER DEFAULT 0,
 			status TEXT,
 			uploaded_at TIMESTAMPTZ DEFAULT NOW(),
 			original_name TEXT,
+			content_hash TEXT,
+			purged_at TIMESTAMPTZ,
+			notes TEXT,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			updated_at TIMESTAMPTZ DEFAULT NOW()
+		) ON COMMIT DROP`,
+		`CREATE TEMP TABLE period_approvals (
+			id BIGSERIAL PRIMARY KEY,
+			period_id BIGINT,
+			status TEXT,
+			summary_hash TEXT,
+			submitted_by BIGINT,
+			submitted_at TIMESTAMPTZ,
+			decided_by BIGINT,
+			decided_at TIMESTAMPTZ,
+			comment TEXT,
+			invalidated_at TIMESTAMPTZ,
 			created_at TIMESTAMPTZ DEFAULT NOW(),
 			updated_at TIMESTAMPTZ DEFAULT NOW()
 		) ON COMMIT DROP`,
@@ -153,8 +204,8 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 			Name:       "张三",
 			IDNumber:   "ID123",
 			Department: "人事部",
-			PayBase:    5000,
-			AmountDue:  500,
+			PayBase:    yuan(5000),
+			AmountDue:  yuan(500),
 			Scheme:     models.SchemePension,
 			Part:       models.PartPersonal,
 			FileType:   models.FileTypeNormal,
@@ -167,8 +218,8 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 			Name:       "张三",
 			IDNumber:   "ID123",
 			Department: "人事部",
-			PayBase:    5000,
-			AmountDue:  400,
+			PayBase:    yuan(5000),
+			AmountDue:  yuan(400),
 			Scheme:     models.SchemeMedical,
 			Part:       models.PartPersonal,
 			FileType:   models.FileTypeNormal,
@@ -181,8 +232,8 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 			Name:       "张三",
 			IDNumber:   "ID123",
 			Department: "人事部",
-			PayBase:    5000,
-			AmountDue:  50,
+			PayBase:    yuan(5000),
+			AmountDue:  yuan(50),
 			Scheme:     models.SchemeSeriousIllness,
 			Part:       models.PartPersonal,
 			FileType:   models.FileTypeNormal,
@@ -195,8 +246,8 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 			Name:       "张三",
 			IDNumber:   "ID123",
 			Department: "人事部",
-			PayBase:    5000,
-			AmountDue:  30,
+			PayBase:    yuan(5000),
+			AmountDue:  yuan(30),
 			Scheme:     models.SchemeUnemployment,
 			Part:       models.PartPersonal,
 			FileType:   models.FileTypeNormal,
@@ -209,8 +260,8 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 			Name:       "张三",
 			IDNumber:   "ID123",
 			Department: "人事部",
-			PayBase:    6000,
-			AmountDue:  1000,
+			PayBase:    yuan(6000),
+			AmountDue:  yuan(1000),
 			Scheme:     models.SchemePension,
 			Part:       models.PartUnit,
 			FileType:   models.FileTypeNormal,
@@ -223,8 +274,8 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 			Name:       "张三",
 			IDNumber:   "ID123",
 			Department: "人事部",
-			PayBase:    6000,
-			AmountDue:  800,
+			PayBase:    yuan(6000),
+			AmountDue:  yuan(800),
 			Scheme:     models.SchemeMedical,
 			Part:       models.PartUnit,
 			FileType:   models.FileTypeNormal,
@@ -237,8 +288,8 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 			Name:       "张三",
 			IDNumber:   "ID123",
 			Department: "人事部",
-			PayBase:    6000,
-			AmountDue:  100,
+			PayBase:    yuan(6000),
+			AmountDue:  yuan(100),
 			Scheme:     models.SchemeSeriousIllness,
 			Part:       models.PartUnit,
 			FileType:   models.FileTypeNormal,
@@ -251,8 +302,8 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 			Name:       "张三",
 			IDNumber:   "ID123",
 			Department: "人事部",
-			PayBase:    6000,
-			AmountDue:  60,
+			PayBase:    yuan(6000),
+			AmountDue:  yuan(60),
 			Scheme:     models.SchemeUnemployment,
 			Part:       models.PartUnit,
 			FileType:   models.FileTypeNormal,
@@ -265,8 +316,8 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 			Name:       "张三",
 			IDNumber:   "ID123",
 			Department: "人事部",
-			PayBase:    6000,
-			AmountDue:  70,
+			PayBase:    yuan(6000),
+			AmountDue:  yuan(70),
 			Scheme:     models.SchemeInjury,
 			Part:       models.PartUnit,
 			FileType:   models.FileTypeNormal,
@@ -291,8 +342,8 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 		t.Fatalf("插入花名册失败: %v", err)
 	}
 
-	processor := NewProcessor(tx)
-	output, err := processor.ProcessPeriod(period.ID)
+	processor := NewProcessor(tx, nil)
+	output, err := processor.ProcessPeriod(period.ID, ProcessFull)
 	if err != nil {
 		t.Fatalf("处理期间失败: %v", err)
 	}
@@ -301,22 +352,22 @@ func TestProcessor_ProcessPeriod_Success(t *testing.T) {
 		t.Fatalf("个人扣款条目数量不符，期望 1，实际 %d", len(output.Personal))
 	}
 	personal := output.Personal[0]
-	if personal.Subtotal != 980 {
-		t.Errorf("个人扣款汇总不符，期望 980，实际 %.2f", personal.Subtotal)
+	if personal.Subtotal != yuan(980) {
+		t.Errorf("个人扣款汇总不符，期望 980，实际 %s", personal.Subtotal)
 	}
-	if personal.Base != 5000 {
-		t.Errorf("个人缴费基数不符，期望 5000，实际 %.2f", personal.Base)
+	if personal.Base != yuan(5000) {
+		t.Errorf("个人缴费基数不符，期望 5000，实际 %s", personal.Base)
 	}
 
 	if len(output.Unit) != 1 {
 		t.Fatalf("单位扣款条目数量不符，期望 1，实际 %d", len(output.Unit))
 	}
 	unit := output.Unit[0]
-	if unit.Subtotal != 2030 {
-		t.Errorf("单位扣款汇总不符，期望 2030，实际 %.2f", unit.Subtotal)
+	if unit.Subtotal != yuan(2030) {
+		t.Errorf("单位扣款汇总不符，期望 2030，实际 %s", unit.Subtotal)
 	}
-	if unit.Base != 6000 {
-		t.Errorf("单位缴费基数不符，期望 6000，实际 %.2f", unit.Base)
+	if unit.Base != yuan(6000) {
+		t.Errorf("单位缴费基数不符，期望 6000，实际 %s", unit.Base)
 	}
 
 	var updatedPeriod models.Period
@@ -351,8 +402,8 @@ func TestProcessor_ProcessPeriod_MissingScheme(t *testing.T) {
 			Name:       "李四",
 			IDNumber:   "ID999",
 			Department: "财务部",
-			PayBase:    4800,
-			AmountDue:  480,
+			PayBase:    yuan(4800),
+			AmountDue:  yuan(480),
 			Scheme:     models.SchemePension,
 			Part:       models.PartPersonal,
 			FileType:   models.FileTypeNormal,
@@ -365,8 +416,8 @@ func TestProcessor_ProcessPeriod_MissingScheme(t *testing.T) {
 			Name:       "李四",
 			IDNumber:   "ID999",
 			Department: "财务部",
-			PayBase:    4800,
-			AmountDue:  380,
+			PayBase:    yuan(4800),
+			AmountDue:  yuan(380),
 			Scheme:     models.SchemeMedical,
 			Part:       models.PartPersonal,
 			FileType:   models.FileTypeNormal,
@@ -379,8 +430,8 @@ func TestProcessor_ProcessPeriod_MissingScheme(t *testing.T) {
 			Name:       "李四",
 			IDNumber:   "ID999",
 			Department: "财务部",
-			PayBase:    4800,
-			AmountDue:  25,
+			PayBase:    yuan(4800),
+			AmountDue:  yuan(25),
 			Scheme:     models.SchemeUnemployment,
 			Part:       models.PartPersonal,
 			FileType:   models.FileTypeNormal,
@@ -393,8 +444,8 @@ func TestProcessor_ProcessPeriod_MissingScheme(t *testing.T) {
 			Name:       "李四",
 			IDNumber:   "ID999",
 			Department: "财务部",
-			PayBase:    5800,
-			AmountDue:  900,
+			PayBase:    yuan(5800),
+			AmountDue:  yuan(900),
 			Scheme:     models.SchemePension,
 			Part:       models.PartUnit,
 			FileType:   models.FileTypeNormal,
@@ -407,8 +458,8 @@ func TestProcessor_ProcessPeriod_MissingScheme(t *testing.T) {
 			Name:       "李四",
 			IDNumber:   "ID999",
 			Department: "财务部",
-			PayBase:    5800,
-			AmountDue:  700,
+			PayBase:    yuan(5800),
+			AmountDue:  yuan(700),
 			Scheme:     models.SchemeMedical,
 			Part:       models.PartUnit,
 			FileType:   models.FileTypeNormal,
@@ -421,8 +472,8 @@ func TestProcessor_ProcessPeriod_MissingScheme(t *testing.T) {
 			Name:       "李四",
 			IDNumber:   "ID999",
 			Department: "财务部",
-			PayBase:    5800,
-			AmountDue:  55,
+			PayBase:    yuan(5800),
+			AmountDue:  yuan(55),
 			Scheme:     models.SchemeUnemployment,
 			Part:       models.PartUnit,
 			FileType:   models.FileTypeNormal,
@@ -435,8 +486,8 @@ func TestProcessor_ProcessPeriod_MissingScheme(t *testing.T) {
 			Name:       "李四",
 			IDNumber:   "ID999",
 			Department: "财务部",
-			PayBase:    5800,
-			AmountDue:  65,
+			PayBase:    yuan(5800),
+			AmountDue:  yuan(65),
 			Scheme:     models.SchemeInjury,
 			Part:       models.PartUnit,
 			FileType:   models.FileTypeNormal,
@@ -449,8 +500,84 @@ func TestProcessor_ProcessPeriod_MissingScheme(t *testing.T) {
 		t.Fatalf("插入原始记录失败: %v", err)
 	}
 
-	processor := NewProcessor(tx)
-	if _, err := processor.ProcessPeriod(period.ID); err == nil {
+	processor := NewProcessor(tx, nil)
+	if _, err := processor.ProcessPeriod(period.ID, ProcessFull); err == nil {
 		t.Fatalf("缺少险种时应返回错误")
 	}
 }
+
+func TestProcessor_ProcessPeriod_Provisional(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	db := processor.db
+	if err := db.AutoMigrate(&models.RosterEntry{}, &models.PeriodSummary{}, &models.PersonalCharge{},
+		&models.UnitCharge{}, &models.HousingFundCharge{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	period := models.Period{YearMonth: "2026-05", Status: "draft"}
+	if err := db.Create(&period).Error; err != nil {
+		t.Fatalf("创建账期失败: %v", err)
+	}
+	record := func(scheme models.Scheme, part models.Part, amount float64) models.RawRecord {
+		return models.RawRecord{PeriodID: period.ID, Sequence: 1, Name: "张三", IDNumber: "110101199001011234",
+			PayBase: yuan(5000), AmountDue: yuan(amount), Scheme: scheme, Part: part, FileType: models.FileTypeNormal}
+	}
+	// 缺少单位工伤保险
+	records := []models.RawRecord{
+		record(models.SchemePension, models.PartPersonal, 400),
+		record(models.SchemeMedical, models.PartPersonal, 100),
+		record(models.SchemeUnemployment, models.PartPersonal, 25),
+		record(models.SchemeSeriousIllness, models.PartPersonal, 3),
+		record(models.SchemePension, models.PartUnit, 800),
+		record(models.SchemeMedical, models.PartUnit, 425),
+		record(models.SchemeUnemployment, models.PartUnit, 40),
+		record(models.SchemeSeriousIllness, models.PartUnit, 75),
+	}
+	if err := db.Create(&records).Error; err != nil {
+		t.Fatalf("插入原始记录失败: %v", err)
+	}
+
+	if _, err := processor.ProcessPeriod(period.ID, ProcessFull); err == nil {
+		t.Fatal("完整处理缺少必需险种时应返回错误")
+	}
+	output, err := processor.ProcessPeriod(period.ID, ProcessProvisional)
+	if err != nil {
+		t.Fatalf("预估处理失败: %v", err)
+	}
+	want := []models.MissingUpload{{Scheme: models.SchemeInjury, Part: models.PartUnit}}
+	if !output.Provisional || !reflect.DeepEqual(output.Missing, want) {
+		t.Errorf("预估结果不符: provisional=%v missing=%v", output.Provisional, output.Missing)
+	}
+	if len(output.Unit) != 1 || output.Unit[0].Subtotal != yuan(1340) {
+		t.Errorf("单位扣款应按已上传的险种汇总: %+v", output.Unit)
+	}
+	var saved models.Period
+	if err := db.First(&saved, period.ID).Error; err != nil {
+		t.Fatalf("读取账期失败: %v", err)
+	}
+	if saved.Status != "processed" || !saved.Provisional || !reflect.DeepEqual(saved.MissingUploads, want) {
+		t.Errorf("账期应标记为预估: %+v", saved)
+	}
+	if err := RequireFullProcessing(&saved); !errors.Is(err, ErrProvisionalPeriod) {
+		t.Errorf("预估处理的账期不能定稿，实际 %v", err)
+	}
+	var provisionalSummaries int64
+	db.Model(&models.PeriodSummary{}).Where("period_id = ? AND provisional = ?", period.ID, true).Count(&provisionalSummaries)
+	if provisionalSummaries != int64(len(output.Summary)) {
+		t.Errorf("汇总应全部标记为预估: %d / %d", provisionalSummaries, len(output.Summary))
+	}
+
+	// 补齐文件后完整处理，预估标记清除
+	if err := db.Create(&[]models.RawRecord{record(models.SchemeInjury, models.PartUnit, 20)}).Error; err != nil {
+		t.Fatalf("插入原始记录失败: %v", err)
+	}
+	output, err = processor.ProcessPeriod(period.ID, ProcessProvisional)
+	if err != nil || output.Provisional || len(output.Missing) != 0 {
+		t.Fatalf("险种齐全时应为完整结果: %+v, %v", output, err)
+	}
+	if err := db.First(&saved, period.ID).Error; err != nil {
+		t.Fatalf("读取账期失败: %v", err)
+	}
+	if saved.Provisional || len(saved.MissingUploads) != 0 || RequireFullProcessing(&saved) != nil {
+		t.Errorf("完整处理后应清除预估标记: %+v", saved)
+	}
+}
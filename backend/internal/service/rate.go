@@ -0,0 +1,164 @@
+package service
+
+import (
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"siapp/internal/models"
+)
+
+// defaultRateTolerance 基数×费率与应缴金额允许的差异（1 分），可用 SIAPP_RATE_TOLERANCE 按元调整
+const defaultRateTolerance models.Money = 1
+
+// ParsedRate 费率文字的解析结果
+type ParsedRate struct {
+	Percent float64      // 按基数计算的部分，百分比
+	Fixed   models.Money // 按人定额的部分
+}
+
+// Amount 按缴费基数计算应缴金额
+func (r ParsedRate) Amount(base models.Money) models.Money {
+	return base.MulPercent(r.Percent) + r.Fixed
+}
+
+var rateTextReplacer = strings.NewReplacer("％", "%", "＋", "+", " ", "", "　", "", ",", "")
+
+// maxRateFraction 不带百分号的单个费率不超过该值时可能是小数写法（0.08 即 8%）；
+// 各险种费率都不超过 30%，更大的数只能是百分比（0.5 即 0.5%）
+const maxRateFraction = 0.3
+
+// ParseRateText 解析社保局文件中的费率文字：
+// “8%”“8”“0.08”均为 8%；“0.5”“5‰”为 0.5%；“2%+3”“2%+3元”为 2% 加每人 3 元；“8%+2%”各项相加。
+// 复合写法中不带百分号的项按定额处理；单独一项不带百分号时，不超过 0.3 视为小数，否则视为百分比。
+// 知道缴费基数与应缴金额时使用 parseRecordRate
+func ParseRateText(text string) (ParsedRate, bool) {
+	return parseRecordRate(text, 0, 0)
+}
+
+// parseRecordRate 同 ParseRateText；单独一项不带百分号且不超过 0.3 时（如“0.2”可能是 20% 也可能是 0.2%），
+// 取缴费基数×费率更接近应缴金额的一种理解，基数或应缴金额为 0 时视为小数
+func parseRecordRate(text string, base, amount models.Money) (ParsedRate, bool) {
+	text = rateTextReplacer.Replace(strings.TrimSpace(text))
+	if text == "" {
+		return ParsedRate{}, false
+	}
+	terms := strings.Split(text, "+")
+	compound := len(terms) > 1
+	var rate ParsedRate
+	for _, term := range terms {
+		var (
+			value float64
+			err   error
+		)
+		if term == "" {
+			return ParsedRate{}, false
+		}
+		switch {
+		case strings.HasSuffix(term, "%"):
+			value, err = strconv.ParseFloat(strings.TrimSuffix(term, "%"), 64)
+			rate.Percent += value
+		case strings.HasSuffix(term, "‰"):
+			value, err = strconv.ParseFloat(strings.TrimSuffix(term, "‰"), 64)
+			rate.Percent += value / 10
+		case strings.HasSuffix(term, "元") || compound:
+			var fixed models.Money
+			fixed, err = models.ParseMoney(strings.TrimSuffix(term, "元"))
+			value = fixed.Float()
+			rate.Fixed += fixed
+		default:
+			value, err = strconv.ParseFloat(term, 64)
+			rate.Percent += bareRatePercent(value, base, amount)
+		}
+		if err != nil || value < 0 {
+			return ParsedRate{}, false
+		}
+	}
+	rate.Percent = math.Round(rate.Percent*1e6) / 1e6
+	return rate, true
+}
+
+// bareRatePercent 将不带百分号的单个费率换算为百分比
+func bareRatePercent(value float64, base, amount models.Money) float64 {
+	if value > maxRateFraction {
+		return value
+	}
+	fraction := value * 100
+	if base <= 0 || amount == 0 {
+		return fraction
+	}
+	target := amount.Abs()
+	if (base.MulPercent(value) - target).Abs() < (base.MulPercent(fraction) - target).Abs() {
+		return value
+	}
+	return fraction
+}
+
+// rateTolerance 读取 SIAPP_RATE_TOLERANCE，未设置或无效时使用默认值
+func rateTolerance() models.Money {
+	if raw := strings.TrimSpace(os.Getenv("SIAPP_RATE_TOLERANCE")); raw != "" {
+		if v, err := models.ParseMoney(raw); err == nil && v >= 0 {
+			return v
+		}
+		log.Printf("invalid SIAPP_RATE_TOLERANCE %q, using %s", raw, defaultRateTolerance)
+	}
+	return defaultRateTolerance
+}
+
+// RateIssue 缴费基数×费率与社保局应缴金额不一致的记录
+type RateIssue struct {
+	RecordID       uint          `json:"record_id"`
+	SourceFileID   uint          `json:"source_file_id"`
+	Sequence       int           `json:"sequence"`
+	Name           string        `json:"name"`
+	IDNumber       string        `json:"id_number"`
+	Scheme         models.Scheme `json:"scheme"`
+	Part           models.Part   `json:"part"`
+	PayBase        models.Money  `json:"pay_base"`
+	RateText       string        `json:"rate_text"`
+	ExpectedAmount models.Money  `json:"expected_amount"`
+	AmountDue      models.Money  `json:"amount_due"`
+	Difference     models.Money  `json:"difference"` // 社保局应缴金额减去基数×费率
+}
+
+// checkRates 逐条核对 缴费基数×费率≈应缴金额，差异超过 tolerance 的记录列入结果；
+// 费率为空或无法识别的记录不核对。费率按文字重新解析，兼容解析费率之前导入的记录
+func checkRates(records []models.RawRecord, tolerance models.Money) []RateIssue {
+	var issues []RateIssue
+	for _, rec := range records {
+		rate, ok := parseRecordRate(rec.RateText, rec.PayBase, rec.AmountDue)
+		if !ok {
+			continue
+		}
+		expected := rate.Amount(rec.PayBase)
+		diff := rec.AmountDue - expected
+		if diff.Abs() <= tolerance {
+			continue
+		}
+		issues = append(issues, RateIssue{
+			RecordID:       rec.ID,
+			SourceFileID:   rec.SourceFileID,
+			Sequence:       rec.Sequence,
+			Name:           rec.Name,
+			IDNumber:       rec.IDNumber,
+			Scheme:         rec.Scheme,
+			Part:           rec.Part,
+			PayBase:        rec.PayBase,
+			RateText:       rec.RateText,
+			ExpectedAmount: expected,
+			AmountDue:      rec.AmountDue,
+			Difference:     diff,
+		})
+	}
+	return issues
+}
+
+// effectiveRate 汇总的实际费率（百分比）：应缴金额合计 / 基数合计
+func effectiveRate(summary models.PeriodSummary) float64 {
+	if summary.BaseTotal == 0 {
+		return 0
+	}
+	return math.Round(float64(summary.AmountTotal)/float64(summary.BaseTotal)*100*1e4) / 1e4
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestParseRateText(t *testing.T) {
+	cases := []struct {
+		text  string
+		want  ParsedRate
+		valid bool
+	}{
+		{"8%", ParsedRate{Percent: 8}, true},
+		{"0.08", ParsedRate{Percent: 8}, true},
+		{"8", ParsedRate{Percent: 8}, true},
+		{"0.5％", ParsedRate{Percent: 0.5}, true},
+		{"0.5", ParsedRate{Percent: 0.5}, true}, // 大于 0.3 不可能是小数写法
+		{"0.3", ParsedRate{Percent: 30}, true},
+		{"0.2", ParsedRate{Percent: 20}, true}, // 无法判断时按小数
+		{"5‰", ParsedRate{Percent: 0.5}, true},
+		{"2%+3", ParsedRate{Percent: 2, Fixed: yuan(3)}, true},
+		{"2% + 3元", ParsedRate{Percent: 2, Fixed: yuan(3)}, true},
+		{"8%+2%", ParsedRate{Percent: 10}, true},
+		{"2%+1.5元", ParsedRate{Percent: 2, Fixed: yuan(1.5)}, true},
+		{"2%+", ParsedRate{}, false},
+		{"", ParsedRate{}, false},
+		{"按规定", ParsedRate{}, false},
+		{"-1%", ParsedRate{}, false},
+	}
+	for _, c := range cases {
+		got, ok := ParseRateText(c.text)
+		if ok != c.valid || got != c.want {
+			t.Errorf("ParseRateText(%q) = %+v, %v，期望 %+v, %v", c.text, got, ok, c.want, c.valid)
+		}
+	}
+}
+
+func TestParseRecordRate(t *testing.T) {
+	cases := []struct {
+		text         string
+		base, amount float64
+		want         float64
+	}{
+		{"0.2", 5000, 10, 0.2},    // 5000×0.2% = 10
+		{"0.2", 5000, 1000, 20},   // 5000×20% = 1000
+		{"0.2", 5000, -10, 0.2},   // 退费按绝对值比较
+		{"0.2", 0, 10, 20},        // 没有基数时按小数
+		{"0.08", 5000, 400, 8},    // 小数写法
+		{"0.08", 5000, 4, 0.08},   // 百分比写法
+		{"0.5", 5000, 2500, 0.5},  // 大于 0.3 只能是百分比
+		{"0.2%", 5000, 1000, 0.2}, // 带百分号不做判断
+	}
+	for _, c := range cases {
+		got, ok := parseRecordRate(c.text, yuan(c.base), yuan(c.amount))
+		if !ok || got.Percent != c.want {
+			t.Errorf("parseRecordRate(%q, %v, %v) = %+v, %v，期望 %v%%", c.text, c.base, c.amount, got, ok, c.want)
+		}
+	}
+}
+
+func TestCheckRates(t *testing.T) {
+	record := func(id uint, base float64, rate string, amount float64) models.RawRecord {
+		return models.RawRecord{ID: id, Name: "张三", IDNumber: "ID123", PayBase: yuan(base), RateText: rate, AmountDue: yuan(amount),
+			Scheme: models.SchemePension, Part: models.PartPersonal}
+	}
+	records := []models.RawRecord{
+		record(1, 5000, "8%", 400),
+		record(2, 5000, "8%", 410),
+		record(3, 5000, "2%+3", 103),
+		record(4, 3333.33, "8%", 266.67),
+		record(5, 5000, "", 999),   // 没有费率不核对
+		record(6, 5000, "0.2", 10), // 工伤 0.2%，不应按 20% 核对
+	}
+	issues := checkRates(records, yuan(0.01))
+	if len(issues) != 1 || issues[0].RecordID != 2 || issues[0].ExpectedAmount != yuan(400) || issues[0].Difference != yuan(10) {
+		t.Fatalf("核对结果不符: %+v", issues)
+	}
+	if issues := checkRates(records, yuan(10)); len(issues) != 0 {
+		t.Errorf("允许差异 10 元时不应有问题记录: %+v", issues)
+	}
+}
+
+func TestSortSummaries_EffectiveRate(t *testing.T) {
+	summaries := []models.PeriodSummary{
+		{Scheme: models.SchemePension, Part: models.PartPersonal, BaseTotal: yuan(11000), AmountTotal: yuan(880)},
+		{Scheme: models.SchemeMedical, Part: models.PartPersonal, BaseTotal: 0, AmountTotal: 0},
+	}
+	NewSchemeRegistry(nil).SortSummaries(summaries)
+	if summaries[0].EffectiveRate != 8 || summaries[1].EffectiveRate != 0 {
+		t.Errorf("实际费率 = %v / %v，期望 8 / 0", summaries[0].EffectiveRate, summaries[1].EffectiveRate)
+	}
+}
+
+func TestProcessor_ParseSourceFile_ParsesRate(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+
+	content := "序号,姓名,证件号码,缴费工资,缴费基数,费率,应缴费额\n" +
+		"1,张三,110101199001011234,5000,5000,2%+3,103\n" +
+		"2,李四,110101199001015678,6000,6000,按规定,480\n"
+	key := "periods/1/pension.csv"
+	if err := store.Put(t.Context(), key, strings.NewReader(content)); err != nil {
+		t.Fatalf("保存文件失败: %v", err)
+	}
+	result, err := processor.ParseSourceFile(1, nil, key, "养老.csv", models.SchemePension, models.PartPersonal, ParseOptions{})
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if len(result.Issues) != 1 || result.Issues[0].Row != 3 || result.Issues[0].Level != RowIssueWarning {
+		t.Errorf("无法识别的费率应记录警告: %+v", result.Issues)
+	}
+
+	var records []models.RawRecord
+	if err := processor.db.Order("sequence").Find(&records).Error; err != nil {
+		t.Fatalf("读取记录失败: %v", err)
+	}
+	if records[0].RateText != "2%+3" || records[0].Rate != 2 || records[0].RateFixed != yuan(3) {
+		t.Errorf("复合费率解析不符: %+v", records[0])
+	}
+	if records[1].RateText != "按规定" || records[1].Rate != 0 {
+		t.Errorf("无法识别的费率应保留原文: %+v", records[1])
+	}
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"siapp/internal/models"
+)
+
+// ReconciliationKind 花名册与社保局文件核对问题的类型
+type ReconciliationKind string
+
+const (
+	ReconcileMissingFromScheme  ReconciliationKind = "missing_from_scheme" // 花名册中有，但某些险种文件中没有
+	ReconcileNotOnRoster        ReconciliationKind = "not_on_roster"       // 社保局文件中有，但花名册中没有
+	ReconcileNameMismatch       ReconciliationKind = "name_mismatch"       // 姓名不一致
+	ReconcileDepartmentMismatch ReconciliationKind = "department_mismatch" // 部门不一致
+	ReconcilePartMismatch       ReconciliationKind = "part_mismatch"       // 同一险种只出现在单位或个人缴费其中一方
+)
+
+// reconciliationKinds 问题类型按报告中的顺序排列，附导出时使用的名称
+var reconciliationKinds = []struct {
+	kind  ReconciliationKind
+	label string
+}{
+	{ReconcileMissingFromScheme, "险种文件缺失"},
+	{ReconcileNotOnRoster, "不在花名册"},
+	{ReconcileNameMismatch, "姓名不一致"},
+	{ReconcileDepartmentMismatch, "部门不一致"},
+	{ReconcilePartMismatch, "单位/个人不一致"},
+}
+
+// Label 返回问题类型的中文名称
+func (k ReconciliationKind) Label() string {
+	for _, item := range reconciliationKinds {
+		if item.kind == k {
+			return item.label
+		}
+	}
+	return string(k)
+}
+
+func (k ReconciliationKind) order() int {
+	for idx, item := range reconciliationKinds {
+		if item.kind == k {
+			return idx
+		}
+	}
+	return len(reconciliationKinds)
+}
+
+// SchemePart 险种与缴费部分
+type SchemePart struct {
+	Scheme models.Scheme `json:"scheme"`
+	Part   models.Part   `json:"part"`
+}
+
+// ReconciliationItem 核对发现的一项问题，同一人可能有多项
+type ReconciliationItem struct {
+	Kind             ReconciliationKind `json:"kind"`
+	IDNumber         string             `json:"id_number"`
+	RosterName       string             `json:"roster_name,omitempty"`
+	BureauName       string             `json:"bureau_name,omitempty"`
+	RosterDepartment string             `json:"roster_department,omitempty"`
+	BureauDepartment string             `json:"bureau_department,omitempty"`
+	Missing          []SchemePart       `json:"missing,omitempty"` // 缺失的险种与缴费部分
+	Detail           string             `json:"detail"`
+}
+
+// ReconciliationReport 账期花名册与社保局文件的核对结果
+type ReconciliationReport struct {
+	PeriodID    uint                       `json:"period_id"`
+	RosterCount int                        `json:"roster_count"`
+	BureauCount int                        `json:"bureau_count"`
+	Uploaded    []SchemePart               `json:"uploaded"` // 参与核对的险种文件
+	Counts      map[ReconciliationKind]int `json:"counts"`
+	Items       []ReconciliationItem       `json:"items"`
+}
+
+// bureauPerson 社保局文件中的一个人
+type bureauPerson struct {
+	name       string
+	department string
+	present    map[SchemePart]bool
+}
+
+// reconcile 比对花名册与社保局文件：花名册为空时只检查单位、个人缴费是否一致
+func reconcile(periodID uint, records []models.RawRecord, roster []models.RosterEntry, schemes *SchemeRegistry) *ReconciliationReport {
+	uploadedSet := map[SchemePart]bool{}
+	people := map[string]*bureauPerson{}
+	for _, rec := range records {
+		id := strings.TrimSpace(rec.IDNumber)
+		if id == "" {
+			continue
+		}
+		sp := SchemePart{rec.Scheme, rec.Part}
+		uploadedSet[sp] = true
+		person, ok := people[id]
+		if !ok {
+			person = &bureauPerson{present: map[SchemePart]bool{}}
+			people[id] = person
+		}
+		if person.name == "" {
+			person.name = strings.TrimSpace(rec.Name)
+		}
+		if person.department == "" {
+			person.department = strings.TrimSpace(rec.Department)
+		}
+		person.present[sp] = true
+	}
+
+	uploaded := make([]SchemePart, 0, len(uploadedSet))
+	for sp := range uploadedSet {
+		uploaded = append(uploaded, sp)
+	}
+	sort.Slice(uploaded, func(i, j int) bool {
+		if oi, oj := schemes.order(uploaded[i].Scheme), schemes.order(uploaded[j].Scheme); oi != oj {
+			return oi < oj
+		}
+		if uploaded[i].Scheme != uploaded[j].Scheme {
+			return uploaded[i].Scheme < uploaded[j].Scheme
+		}
+		return uploaded[i].Part < uploaded[j].Part
+	})
+	label := func(sp SchemePart) string {
+		return fmt.Sprintf("%s（%s）", schemes.Name(sp.Scheme), partLabel(sp.Part))
+	}
+
+	report := &ReconciliationReport{
+		PeriodID:    periodID,
+		BureauCount: len(people),
+		Uploaded:    uploaded,
+		Counts:      map[ReconciliationKind]int{},
+		Items:       []ReconciliationItem{},
+	}
+	add := func(item ReconciliationItem) {
+		report.Counts[item.Kind]++
+		report.Items = append(report.Items, item)
+	}
+
+	onRoster := map[string]bool{}
+	for _, entry := range roster {
+		id := strings.TrimSpace(entry.IDNumber)
+		if id == "" || onRoster[id] {
+			continue
+		}
+		onRoster[id] = true
+		name, department := strings.TrimSpace(entry.Name), strings.TrimSpace(entry.Department)
+		person, ok := people[id]
+		if !ok {
+			add(ReconciliationItem{
+				Kind: ReconcileMissingFromScheme, IDNumber: id, RosterName: name, RosterDepartment: department,
+				Missing: uploaded, Detail: "社保局文件中均没有此人",
+			})
+			continue
+		}
+
+		var missing []SchemePart
+		var labels []string
+		for _, sp := range uploaded {
+			if !person.present[sp] {
+				missing = append(missing, sp)
+				labels = append(labels, label(sp))
+			}
+		}
+		if len(missing) > 0 {
+			add(ReconciliationItem{
+				Kind: ReconcileMissingFromScheme, IDNumber: id, RosterName: name, BureauName: person.name,
+				RosterDepartment: department, BureauDepartment: person.department,
+				Missing: missing, Detail: "缺少：" + strings.Join(labels, "、"),
+			})
+		}
+		if name != "" && person.name != "" && name != person.name {
+			add(ReconciliationItem{
+				Kind: ReconcileNameMismatch, IDNumber: id, RosterName: name, BureauName: person.name,
+				Detail: fmt.Sprintf("花名册为“%s”，社保局为“%s”", name, person.name),
+			})
+		}
+		if department != "" && person.department != "" && department != person.department {
+			add(ReconciliationItem{
+				Kind: ReconcileDepartmentMismatch, IDNumber: id, RosterName: name, BureauName: person.name,
+				RosterDepartment: department, BureauDepartment: person.department,
+				Detail: fmt.Sprintf("花名册为“%s”，社保局为“%s”", department, person.department),
+			})
+		}
+	}
+	report.RosterCount = len(onRoster)
+
+	ids := make([]string, 0, len(people))
+	for id := range people {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		person := people[id]
+		if len(onRoster) > 0 && !onRoster[id] {
+			var labels []string
+			for _, sp := range uploaded {
+				if person.present[sp] {
+					labels = append(labels, label(sp))
+				}
+			}
+			add(ReconciliationItem{
+				Kind: ReconcileNotOnRoster, IDNumber: id, BureauName: person.name, BureauDepartment: person.department,
+				Detail: "出现在：" + strings.Join(labels, "、"),
+			})
+		}
+		// 单位与个人文件都已上传的险种，同一人应同时出现在两边
+		for _, sp := range uploaded {
+			if sp.Part != models.PartUnit || !uploadedSet[SchemePart{sp.Scheme, models.PartPersonal}] {
+				continue
+			}
+			personal := SchemePart{sp.Scheme, models.PartPersonal}
+			var missing SchemePart
+			switch {
+			case person.present[sp] && !person.present[personal]:
+				missing = personal
+			case !person.present[sp] && person.present[personal]:
+				missing = sp
+			default:
+				continue
+			}
+			add(ReconciliationItem{
+				Kind: ReconcilePartMismatch, IDNumber: id, BureauName: person.name, BureauDepartment: person.department,
+				Missing: []SchemePart{missing}, Detail: "缺少：" + label(missing),
+			})
+		}
+	}
+
+	sort.SliceStable(report.Items, func(i, j int) bool {
+		if oi, oj := report.Items[i].Kind.order(), report.Items[j].Kind.order(); oi != oj {
+			return oi < oj
+		}
+		return report.Items[i].IDNumber < report.Items[j].IDNumber
+	})
+	return report
+}
+
+func partLabel(part models.Part) string {
+	if part == models.PartPersonal {
+		return "个人"
+	}
+	return "单位"
+}
+
+// ReconcilePeriod 核对账期花名册与社保局文件（生效版本的正常文件，不含补退）
+func (p *Processor) ReconcilePeriod(periodID uint) (*ReconciliationReport, error) {
+	var period models.Period
+	if err := p.db.First(&period, periodID).Error; err != nil {
+		return nil, fmt.Errorf("load period: %w", err)
+	}
+	var records []models.RawRecord
+	if err := p.activeRecords().Where("period_id = ? AND file_type = ?", periodID, models.FileTypeNormal).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("load raw records: %w", err)
+	}
+	var roster []models.RosterEntry
+	if err := p.db.Where("period_id = ?", periodID).Order("id_number ASC").Find(&roster).Error; err != nil {
+		return nil, fmt.Errorf("load roster entries: %w", err)
+	}
+	schemes, err := LoadSchemeRegistry(p.db, period.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return reconcile(periodID, records, roster, schemes), nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestReconcile(t *testing.T) {
+	record := func(id, name, department string, scheme models.Scheme, part models.Part) models.RawRecord {
+		return models.RawRecord{PeriodID: 1, Name: name, IDNumber: id, Department: department, Scheme: scheme, Part: part}
+	}
+	records := []models.RawRecord{
+		// A 全部齐全
+		record("A", "张三", "财务部", models.SchemePension, models.PartPersonal),
+		record("A", "张三", "财务部", models.SchemePension, models.PartUnit),
+		record("A", "张三", "财务部", models.SchemeInjury, models.PartUnit),
+		// B 缺少养老个人，且姓名、部门与花名册不一致
+		record("B", "李四", "行政部", models.SchemePension, models.PartUnit),
+		record("B", "李四", "行政部", models.SchemeInjury, models.PartUnit),
+		// D 不在花名册
+		record("D", "赵六", "", models.SchemePension, models.PartPersonal),
+		record("D", "赵六", "", models.SchemePension, models.PartUnit),
+		record("D", "赵六", "", models.SchemeInjury, models.PartUnit),
+	}
+	roster := []models.RosterEntry{
+		{IDNumber: "A", Name: "张三", Department: "财务部"},
+		{IDNumber: "B", Name: "李肆", Department: "人事部"},
+		{IDNumber: "C", Name: "王五", Department: "财务部"}, // 社保局文件中没有
+	}
+
+	report := reconcile(1, records, roster, NewSchemeRegistry(nil))
+	if report.RosterCount != 3 || report.BureauCount != 3 || len(report.Uploaded) != 3 {
+		t.Fatalf("人数或参与核对的文件不符: %+v", report)
+	}
+	want := map[ReconciliationKind]int{
+		ReconcileMissingFromScheme:  2,
+		ReconcileNotOnRoster:        1,
+		ReconcileNameMismatch:       1,
+		ReconcileDepartmentMismatch: 1,
+		ReconcilePartMismatch:       1,
+	}
+	for kind, count := range want {
+		if report.Counts[kind] != count {
+			t.Errorf("%s 数量 = %d，期望 %d", kind, report.Counts[kind], count)
+		}
+	}
+
+	first := report.Items[0]
+	if first.Kind != ReconcileMissingFromScheme || first.IDNumber != "B" || len(first.Missing) != 1 ||
+		first.Missing[0] != (SchemePart{models.SchemePension, models.PartPersonal}) || first.Detail != "缺少：养老保险（个人）" {
+		t.Errorf("险种文件缺失项不符: %+v", first)
+	}
+	if c := report.Items[1]; c.IDNumber != "C" || len(c.Missing) != 3 {
+		t.Errorf("社保局文件中没有的人应缺少全部文件: %+v", c)
+	}
+	if d := report.Items[2]; d.Kind != ReconcileNotOnRoster || d.IDNumber != "D" || d.BureauName != "赵六" {
+		t.Errorf("不在花名册项不符: %+v", d)
+	}
+	last := report.Items[len(report.Items)-1]
+	if last.Kind != ReconcilePartMismatch || last.IDNumber != "B" || last.Missing[0].Part != models.PartPersonal {
+		t.Errorf("单位/个人不一致项不符: %+v", last)
+	}
+
+	// 没有花名册时只检查单位与个人是否一致
+	report = reconcile(1, records, nil, NewSchemeRegistry(nil))
+	if len(report.Items) != 1 || report.Items[0].Kind != ReconcilePartMismatch {
+		t.Errorf("没有花名册时的核对结果不符: %+v", report.Items)
+	}
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+)
+
+// normalizeRounding 校验舍入方式与单位，为空时补齐为四舍五入到分
+func normalizeRounding(mode *models.RoundingMode, unit *models.RoundingUnit) error {
+	switch *mode {
+	case "":
+		*mode = models.RoundingHalfUp
+	case models.RoundingHalfUp, models.RoundingHalfEven, models.RoundingUp, models.RoundingDown:
+	default:
+		return fmt.Errorf("无效的舍入方式: %s", *mode)
+	}
+	switch *unit {
+	case "":
+		*unit = models.RoundingFen
+	case models.RoundingFen, models.RoundingJiao, models.RoundingYuan:
+	default:
+		return fmt.Errorf("无效的舍入单位: %s", *unit)
+	}
+	return nil
+}
+
+// validateRoundingPolicies 校验各险种的舍入规则并补齐默认值；同一险种、缴费部分只能有一条，
+// 缴费部分为空的规则与指定缴费部分的规则可以并存，后者优先
+func validateRoundingPolicies(policies []models.RoundingPolicy, schemes *SchemeRegistry) error {
+	seen := map[string]bool{}
+	for i := range policies {
+		policy := &policies[i]
+		policy.Scheme = models.Scheme(strings.TrimSpace(string(policy.Scheme)))
+		if schemes != nil {
+			if _, ok := schemes.Lookup(policy.Scheme); !ok {
+				return fmt.Errorf("舍入规则中的险种无效: %s", policy.Scheme)
+			}
+		} else if policy.Scheme == "" {
+			return errors.New("舍入规则缺少险种")
+		}
+		if policy.Part != "" && policy.Part != models.PartPersonal && policy.Part != models.PartUnit {
+			return fmt.Errorf("舍入规则中的缴费部分无效: %s", policy.Part)
+		}
+		if err := normalizeRounding(&policy.Mode, &policy.Unit); err != nil {
+			return err
+		}
+		switch policy.Scope {
+		case "":
+			policy.Scope = models.RoundingPerLine
+		case models.RoundingPerLine, models.RoundingPerPerson, models.RoundingPerTotal:
+		default:
+			return fmt.Errorf("无效的舍入环节: %s", policy.Scope)
+		}
+		key := roundingKey(policy.Scheme, policy.Part)
+		if seen[key] {
+			return fmt.Errorf("舍入规则重复: %s", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func roundingKey(scheme models.Scheme, part models.Part) string {
+	return string(scheme) + "/" + string(part)
+}
+
+// roundingPolicies 按险种与缴费部分索引的舍入规则；为 nil 时所有金额按原值累加
+type roundingPolicies map[string]models.RoundingPolicy
+
+func newRoundingPolicies(list []models.RoundingPolicy) roundingPolicies {
+	if len(list) == 0 {
+		return nil
+	}
+	policies := roundingPolicies{}
+	for _, policy := range list {
+		policies[roundingKey(policy.Scheme, policy.Part)] = policy
+	}
+	return policies
+}
+
+// policy 查找险种在缴费部分上的舍入规则，指定缴费部分的规则优先于不分部分的规则
+func (rp roundingPolicies) policy(scheme models.Scheme, part models.Part) (models.RoundingPolicy, bool) {
+	if policy, ok := rp[roundingKey(scheme, part)]; ok {
+		return policy, true
+	}
+	policy, ok := rp[roundingKey(scheme, "")]
+	return policy, ok
+}
+
+// round 舍入规则的环节为 scope 时按规则舍入金额，否则原样返回
+func (rp roundingPolicies) round(scheme models.Scheme, part models.Part, scope models.RoundingScope, amount models.Money) models.Money {
+	policy, ok := rp.policy(scheme, part)
+	if !ok || policy.Scope != scope || policy.Unit == models.RoundingFen {
+		return amount // 金额已精确到分，舍入到分不改变金额
+	}
+	return roundContribution(float64(amount), policy.Mode, policy.Unit)
+}
+
+// contribution 按“每条明细”规则舍入基数×费率得出的金额（分，可含小数），供核对应缴金额；
+// 没有规则或规则作用于每人合计、汇总合计时四舍五入到分
+func (rp roundingPolicies) contribution(scheme models.Scheme, part models.Part, fen float64) models.Money {
+	policy, ok := rp.policy(scheme, part)
+	if !ok || policy.Scope != models.RoundingPerLine {
+		return roundContribution(fen, models.RoundingHalfUp, models.RoundingFen)
+	}
+	return roundContribution(fen, policy.Mode, policy.Unit)
+}
+
+// line 返回按“每条明细”规则舍入后的应缴金额
+func (rp roundingPolicies) line(rec models.RawRecord) models.Money {
+	return rp.round(rec.Scheme, rec.Part, models.RoundingPerLine, rec.AmountDue)
+}
+
+// person 按“每人合计”规则舍入一人各险种的金额
+func (rp roundingPolicies) person(part models.Part, amounts models.SchemeAmounts) {
+	for scheme, amount := range amounts {
+		amounts[scheme] = rp.round(scheme, part, models.RoundingPerPerson, amount)
+	}
+}
+
+// loadRoundingPolicies 读取账期参保城市在账期月份生效的缴费规则中的舍入规则；
+// 账期未设置参保城市或没有适用的规则时不舍入
+func (p *Processor) loadRoundingPolicies(period *models.Period) (roundingPolicies, error) {
+	rounding, _, err := p.findRoundingPolicies(period)
+	return rounding, err
+}
+
+// findRoundingPolicies 同 loadRoundingPolicies，因账期未设置参保城市或城市没有生效的缴费规则而不舍入时，
+// 同时返回提示，供处理结果告知用户各险种舍入规则未生效
+func (p *Processor) findRoundingPolicies(period *models.Period) (roundingPolicies, string, error) {
+	city := strings.TrimSpace(period.City)
+	if city == "" {
+		return nil, "账期未设置参保城市，未按缴费规则中的险种舍入规则舍入", nil
+	}
+	rs, err := FindContributionRuleSet(p.db, period.UserID, city, period.YearMonth)
+	if errors.Is(err, ErrContributionRuleNotFound) {
+		return nil, fmt.Sprintf("参保城市 %s 没有在 %s 生效的缴费规则，未按险种舍入规则舍入", city, period.YearMonth), nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return newRoundingPolicies(rs.RoundingPolicies), "", nil
+}
+
+// legacyRoundingPolicies 将旧版本规则统一的舍入方式转为各费率险种“每条明细”的舍入规则，已有规则的险种不变
+func legacyRoundingPolicies(rs *models.ContributionRuleSet, mode models.RoundingMode, unit models.RoundingUnit) []models.RoundingPolicy {
+	existing := newRoundingPolicies(rs.RoundingPolicies)
+	policies := append([]models.RoundingPolicy{}, rs.RoundingPolicies...)
+	for _, rate := range rs.Rates {
+		if rate.FixedAmount > 0 {
+			continue
+		}
+		if _, ok := existing.policy(rate.Scheme, rate.Part); ok {
+			continue
+		}
+		policies = append(policies, models.RoundingPolicy{Scheme: rate.Scheme, Part: rate.Part, Mode: mode, Unit: unit, Scope: models.RoundingPerLine})
+	}
+	return policies
+}
+
+// MigrateLegacyRounding 将旧版本缴费规则的 rounding / rounding_unit 列转为各险种的舍入规则后删除这两列。
+// 四舍五入到分与没有舍入规则时的结果相同，无需转换
+func MigrateLegacyRounding(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&models.ContributionRuleSet{}, "rounding") || !migrator.HasColumn(&models.ContributionRuleSet{}, "rounding_unit") {
+		return nil
+	}
+	var legacy []struct {
+		ID           uint
+		Rounding     models.RoundingMode
+		RoundingUnit models.RoundingUnit
+	}
+	if err := db.Table("contribution_rule_sets").Select("id", "rounding", "rounding_unit").Find(&legacy).Error; err != nil {
+		return fmt.Errorf("load legacy rounding: %w", err)
+	}
+	migrated := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range legacy {
+			mode, unit := row.Rounding, row.RoundingUnit
+			if normalizeRounding(&mode, &unit) != nil || (mode == models.RoundingHalfUp && unit == models.RoundingFen) {
+				continue
+			}
+			var rs models.ContributionRuleSet
+			if err := tx.First(&rs, row.ID).Error; err != nil {
+				return fmt.Errorf("load contribution rule set %d: %w", row.ID, err)
+			}
+			rs.RoundingPolicies = legacyRoundingPolicies(&rs, mode, unit)
+			if err := tx.Model(&rs).Select("rounding_policies").Updates(&rs).Error; err != nil {
+				return fmt.Errorf("migrate contribution rule set %d: %w", row.ID, err)
+			}
+			migrated++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, column := range []string{"rounding", "rounding_unit"} {
+		if err := migrator.DropColumn(&models.ContributionRuleSet{}, column); err != nil {
+			return fmt.Errorf("drop column %s: %w", column, err)
+		}
+	}
+	if migrated > 0 {
+		log.Printf("migrated legacy rounding of %d contribution rule set(s)", migrated)
+	}
+	return nil
+}
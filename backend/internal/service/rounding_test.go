@@ -0,0 +1,186 @@
+package service
+
+import (
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestBuildSummaryFromRecords_RoundingPolicies(t *testing.T) {
+	record := func(id string, amount float64) models.RawRecord {
+		return models.RawRecord{IDNumber: id, Name: id, PayBase: yuan(1000), AmountDue: yuan(amount),
+			Scheme: models.SchemePension, Part: models.PartPersonal, FileType: models.FileTypeNormal}
+	}
+	// A 有两条明细，B、C 各一条
+	records := []models.RawRecord{record("A", 5.05), record("A", 5.05), record("B", 10.15), record("C", 10.15)}
+	policy := func(mode models.RoundingMode, scope models.RoundingScope) roundingPolicies {
+		return newRoundingPolicies([]models.RoundingPolicy{{Scheme: models.SchemePension, Mode: mode, Unit: models.RoundingJiao, Scope: scope}})
+	}
+	cases := []struct {
+		name     string
+		rounding roundingPolicies
+		personA  models.Money
+		personB  models.Money
+		total    models.Money
+	}{
+		{"不舍入", nil, yuan(10.10), yuan(10.15), yuan(30.40)},
+		{"逐条四舍五入到角", policy(models.RoundingHalfUp, models.RoundingPerLine), yuan(10.20), yuan(10.20), yuan(30.60)},
+		{"逐条舍去分", policy(models.RoundingDown, models.RoundingPerLine), yuan(10.00), yuan(10.10), yuan(30.20)},
+		{"按人四舍五入到角", policy(models.RoundingHalfUp, models.RoundingPerPerson), yuan(10.10), yuan(10.20), yuan(30.50)},
+		{"按人五成双", policy(models.RoundingHalfEven, models.RoundingPerPerson), yuan(10.10), yuan(10.20), yuan(30.50)},
+		{"只对合计见分进角", policy(models.RoundingUp, models.RoundingPerTotal), yuan(10.10), yuan(10.15), yuan(30.40)},
+	}
+	for _, c := range cases {
+		summaries := buildSummaryFromRecords(records, c.rounding)
+		if len(summaries) != 1 || summaries[0].Headcount != 3 || summaries[0].BaseTotal != yuan(4000) {
+			t.Fatalf("%s: 汇总不符: %+v", c.name, summaries)
+		}
+		if summaries[0].AmountTotal != c.total {
+			t.Errorf("%s: 合计 = %s，期望 %s", c.name, summaries[0].AmountTotal, c.total)
+		}
+		people := accumulatePeople(records, nil, NewSchemeRegistry(nil), c.rounding)
+		if a, b := people["A"].Personal[models.SchemePension], people["B"].Personal[models.SchemePension]; a != c.personA || b != c.personB {
+			t.Errorf("%s: 个人金额 = %s / %s，期望 %s / %s", c.name, a, b, c.personA, c.personB)
+		}
+	}
+
+	// 合计 30.45 时五成双舍入为 30.4，四舍五入为 30.5
+	records = append(records, record("D", 0.05))
+	if got := buildSummaryFromRecords(records, policy(models.RoundingHalfEven, models.RoundingPerTotal))[0].AmountTotal; got != yuan(30.40) {
+		t.Errorf("合计五成双 = %s，期望 30.40", got)
+	}
+	if got := buildSummaryFromRecords(records, policy(models.RoundingHalfUp, models.RoundingPerTotal))[0].AmountTotal; got != yuan(30.50) {
+		t.Errorf("合计四舍五入 = %s，期望 30.50", got)
+	}
+}
+
+func TestRoundingPolicies_Lookup(t *testing.T) {
+	list := []models.RoundingPolicy{
+		{Scheme: models.SchemeMedical, Unit: models.RoundingJiao},
+		{Scheme: models.SchemeMedical, Part: models.PartUnit, Mode: models.RoundingDown, Unit: models.RoundingYuan, Scope: models.RoundingPerTotal},
+	}
+	if err := validateRoundingPolicies(list, NewSchemeRegistry(nil)); err != nil {
+		t.Fatalf("舍入规则校验失败: %v", err)
+	}
+	if list[0].Mode != models.RoundingHalfUp || list[0].Scope != models.RoundingPerLine {
+		t.Errorf("默认值不符: %+v", list[0])
+	}
+	rounding := newRoundingPolicies(list)
+	if got := rounding.round(models.SchemeMedical, models.PartPersonal, models.RoundingPerLine, yuan(12.35)); got != yuan(12.4) {
+		t.Errorf("个人部分应使用不分部分的规则，实际 %s", got)
+	}
+	if got := rounding.round(models.SchemeMedical, models.PartUnit, models.RoundingPerLine, yuan(12.35)); got != yuan(12.35) {
+		t.Errorf("单位部分的规则只对合计舍入，实际 %s", got)
+	}
+	if got := rounding.round(models.SchemeMedical, models.PartUnit, models.RoundingPerTotal, yuan(-12.35)); got != yuan(-12) {
+		t.Errorf("退费合计应按绝对值舍去，实际 %s", got)
+	}
+
+	invalid := map[string][]models.RoundingPolicy{
+		"险种":   {{Scheme: "unknown"}},
+		"缴费部分": {{Scheme: models.SchemePension, Part: "both"}},
+		"舍入环节": {{Scheme: models.SchemePension, Scope: "month"}},
+		"舍入方式": {{Scheme: models.SchemePension, Mode: "bankers"}},
+		"重复":   {{Scheme: models.SchemePension}, {Scheme: models.SchemePension}},
+	}
+	for name, policies := range invalid {
+		if err := validateRoundingPolicies(policies, NewSchemeRegistry(nil)); err == nil {
+			t.Errorf("%s 无效时应报错", name)
+		}
+	}
+}
+
+func TestProcessor_LoadRoundingPolicies(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	db := processor.db
+	if err := db.AutoMigrate(&models.User{}, &models.ContributionRuleSet{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	user := models.User{Username: "hr", Email: "hr@example.com", CompanyID: "acme"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	rs := models.ContributionRuleSet{CompanyID: "acme", City: "北京", EffectiveFrom: "2025-01",
+		Rates:            []models.ContributionRate{{Scheme: models.SchemePension, Part: models.PartPersonal, Rate: 8}},
+		RoundingPolicies: []models.RoundingPolicy{{Scheme: models.SchemePension, Mode: models.RoundingHalfUp, Unit: models.RoundingJiao, Scope: models.RoundingPerPerson}},
+	}
+	if err := db.Create(&rs).Error; err != nil {
+		t.Fatalf("创建规则失败: %v", err)
+	}
+
+	rounding, err := processor.loadRoundingPolicies(&models.Period{UserID: &user.ID, YearMonth: "2025-08", City: "北京"})
+	if err != nil {
+		t.Fatalf("读取舍入规则失败: %v", err)
+	}
+	if policy, ok := rounding.policy(models.SchemePension, models.PartUnit); !ok || policy.Scope != models.RoundingPerPerson {
+		t.Errorf("舍入规则不符: %+v", rounding)
+	}
+	for _, period := range []models.Period{
+		{UserID: &user.ID, YearMonth: "2025-08"},             // 未设置参保城市
+		{UserID: &user.ID, YearMonth: "2024-12", City: "北京"}, // 规则尚未生效
+		{UserID: &user.ID, YearMonth: "2025-08", City: "上海"}, // 城市没有规则
+	} {
+		if rounding, notice, err := processor.findRoundingPolicies(&period); err != nil || rounding != nil || notice == "" {
+			t.Errorf("%s %s 应不舍入并给出提示，实际 %v, %q, %v", period.City, period.YearMonth, rounding, notice, err)
+		}
+	}
+	if _, notice, _ := processor.findRoundingPolicies(&models.Period{UserID: &user.ID, YearMonth: "2025-08", City: "北京"}); notice != "" {
+		t.Errorf("找到规则时不应提示: %q", notice)
+	}
+}
+
+func TestMigrateLegacyRounding(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	db := processor.db
+	if err := db.AutoMigrate(&models.ContributionRuleSet{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	if err := MigrateLegacyRounding(db); err != nil {
+		t.Fatalf("没有旧列时应直接返回: %v", err)
+	}
+	for _, column := range []string{"rounding", "rounding_unit"} {
+		if err := db.Exec("ALTER TABLE `contribution_rule_sets` ADD `" + column + "` varchar(20)").Error; err != nil {
+			t.Fatalf("添加旧列失败: %v", err)
+		}
+	}
+	rates := []models.ContributionRate{
+		{Scheme: models.SchemePension, Part: models.PartPersonal, Rate: 8},
+		{Scheme: models.SchemeMedical, Part: models.PartPersonal, Rate: 2},
+		{Scheme: models.SchemeSeriousIllness, Part: models.PartPersonal, FixedAmount: yuan(3)},
+	}
+	legacy := models.ContributionRuleSet{City: "北京", EffectiveFrom: "2025-01", Rates: rates,
+		RoundingPolicies: []models.RoundingPolicy{{Scheme: models.SchemeMedical, Mode: models.RoundingDown, Unit: models.RoundingJiao, Scope: models.RoundingPerPerson}}}
+	plain := models.ContributionRuleSet{City: "上海", EffectiveFrom: "2025-01", Rates: rates}
+	for _, rs := range []*models.ContributionRuleSet{&legacy, &plain} {
+		if err := db.Create(rs).Error; err != nil {
+			t.Fatalf("创建规则失败: %v", err)
+		}
+	}
+	db.Exec("UPDATE contribution_rule_sets SET rounding = ?, rounding_unit = ? WHERE id = ?", models.RoundingUp, models.RoundingYuan, legacy.ID)
+	db.Exec("UPDATE contribution_rule_sets SET rounding = ?, rounding_unit = ? WHERE id = ?", models.RoundingHalfUp, models.RoundingFen, plain.ID)
+
+	if err := MigrateLegacyRounding(db); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+	if db.Migrator().HasColumn(&models.ContributionRuleSet{}, "rounding") || db.Migrator().HasColumn(&models.ContributionRuleSet{}, "rounding_unit") {
+		t.Error("迁移后应删除旧列")
+	}
+	var saved models.ContributionRuleSet
+	db.First(&saved, legacy.ID)
+	rounding := newRoundingPolicies(saved.RoundingPolicies)
+	if len(saved.RoundingPolicies) != 2 {
+		t.Fatalf("应为养老新增一条规则并保留医疗的规则: %+v", saved.RoundingPolicies)
+	}
+	if policy, ok := rounding.policy(models.SchemePension, models.PartPersonal); !ok || policy.Mode != models.RoundingUp ||
+		policy.Unit != models.RoundingYuan || policy.Scope != models.RoundingPerLine {
+		t.Errorf("旧的舍入方式应转为每条明细的规则: %+v", saved.RoundingPolicies)
+	}
+	if policy, _ := rounding.policy(models.SchemeMedical, models.PartPersonal); policy.Scope != models.RoundingPerPerson {
+		t.Errorf("已有的舍入规则不应改变: %+v", saved.RoundingPolicies)
+	}
+	var unchanged models.ContributionRuleSet
+	db.First(&unchanged, plain.ID)
+	if len(unchanged.RoundingPolicies) != 0 {
+		t.Errorf("四舍五入到分无需转换: %+v", unchanged.RoundingPolicies)
+	}
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"siapp/internal/models"
+)
+
+// defaultSchemeDefinitions 内置险种。单位扣款明细中大额医疗并入“医疗+生育保险”列，与社保局单位缴费通知单一致
+var defaultSchemeDefinitions = []models.SchemeDefinition{
+	{
+		Code:           models.SchemePension,
+		Name:           "养老保险",
+		Parts:          []models.Part{models.PartPersonal, models.PartUnit},
+		Required:       true,
+		PersonalColumn: "养老保险",
+		UnitColumn:     "养老保险",
+		Keywords:       []string{"养老保险", "养老"},
+		SortOrder:      10,
+	},
+	{
+		Code:           models.SchemeMedical,
+		Name:           "医疗保险",
+		Parts:          []models.Part{models.PartPersonal, models.PartUnit},
+		Required:       true,
+		PersonalColumn: "医疗+生育保险",
+		UnitColumn:     "医疗+生育保险",
+		Keywords:       []string{"医疗保险", "基本医疗", "医保", "生育保险"},
+		SortOrder:      20,
+	},
+	{
+		Code:           models.SchemeSeriousIllness,
+		Name:           "大额医疗",
+		Parts:          []models.Part{models.PartPersonal, models.PartUnit},
+		Required:       true,
+		PersonalColumn: "大额医疗",
+		UnitColumn:     "医疗+生育保险",
+		Keywords:       []string{"大额医疗保险", "大病医疗保险", "大额医疗", "大病医疗", "大额互助"},
+		SortOrder:      30,
+	},
+	{
+		Code:           models.SchemeInjury,
+		Name:           "工伤保险",
+		Parts:          []models.Part{models.PartUnit},
+		Required:       true,
+		PersonalColumn: "工伤保险",
+		UnitColumn:     "工伤保险",
+		Keywords:       []string{"工伤保险", "工伤"},
+		SortOrder:      40,
+	},
+	{
+		Code:           models.SchemeUnemployment,
+		Name:           "失业保险",
+		Parts:          []models.Part{models.PartPersonal, models.PartUnit},
+		Required:       true,
+		PersonalColumn: "失业保险",
+		UnitColumn:     "失业保险",
+		Keywords:       []string{"失业保险", "失业"},
+		SortOrder:      50,
+	},
+	{
+		// 公积金文件通过单独的接口上传（一行含个人与单位缴存额），不参与批量上传的自动识别
+		Code:           models.SchemeHousingFund,
+		Name:           "住房公积金",
+		Parts:          []models.Part{models.PartPersonal, models.PartUnit},
+		PersonalColumn: "住房公积金",
+		UnitColumn:     "住房公积金",
+		SortOrder:      100,
+	},
+}
+
+// DefaultSchemeDefinitions 返回内置险种的副本
+func DefaultSchemeDefinitions() []models.SchemeDefinition {
+	defs := make([]models.SchemeDefinition, len(defaultSchemeDefinitions))
+	for i, def := range defaultSchemeDefinitions {
+		def.Parts = append([]models.Part(nil), def.Parts...)
+		def.Keywords = append([]string(nil), def.Keywords...)
+		def.Enabled = true
+		def.Builtin = true
+		defs[i] = def
+	}
+	return defs
+}
+
+// SchemeRegistry 一个公司可用的险种：内置险种叠加公司自定义的险种，代码相同时以自定义为准。
+// 上传校验、必需险种检查、扣款明细聚合、汇总排序与导出列都由它决定
+type SchemeRegistry struct {
+	all     []models.SchemeDefinition
+	enabled []models.SchemeDefinition
+	byCode  map[models.Scheme]models.SchemeDefinition
+}
+
+// NewSchemeRegistry 以内置险种为基础叠加 overrides
+func NewSchemeRegistry(overrides []models.SchemeDefinition) *SchemeRegistry {
+	merged := map[models.Scheme]models.SchemeDefinition{}
+	for _, def := range DefaultSchemeDefinitions() {
+		merged[def.Code] = def
+	}
+	for _, def := range overrides {
+		_, def.Builtin = merged[def.Code]
+		if existing, ok := merged[def.Code]; ok && existing.ID != 0 {
+			continue // 同一代码只取第一条（调用方按 id 排序）
+		}
+		merged[def.Code] = def
+	}
+
+	r := &SchemeRegistry{byCode: map[models.Scheme]models.SchemeDefinition{}}
+	for _, def := range merged {
+		r.all = append(r.all, def)
+	}
+	sort.Slice(r.all, func(i, j int) bool {
+		if r.all[i].SortOrder != r.all[j].SortOrder {
+			return r.all[i].SortOrder < r.all[j].SortOrder
+		}
+		return r.all[i].Code < r.all[j].Code
+	})
+	for _, def := range r.all {
+		if def.Enabled {
+			r.enabled = append(r.enabled, def)
+			r.byCode[def.Code] = def
+		}
+	}
+	return r
+}
+
+// LoadSchemeRegistry 读取用户所属公司的险种登记表：同公司共享，未设置公司时仅限本人；userID 为空时只有内置险种
+func LoadSchemeRegistry(db *gorm.DB, userID *uint) (*SchemeRegistry, error) {
+	if userID == nil {
+		return NewSchemeRegistry(nil), nil
+	}
+	var user models.User
+	if err := db.Select("id", "company_id").First(&user, *userID).Error; err != nil {
+		return nil, fmt.Errorf("load user: %w", err)
+	}
+	var defs []models.SchemeDefinition
+	if err := SchemeDefinitionScope(db, &user).Order("id ASC").Find(&defs).Error; err != nil {
+		return nil, fmt.Errorf("load scheme definitions: %w", err)
+	}
+	return NewSchemeRegistry(defs), nil
+}
+
+// SchemeDefinitionScope 返回用户可见的自定义险种查询
+func SchemeDefinitionScope(db *gorm.DB, user *models.User) *gorm.DB {
+	return companyScope(db.Model(&models.SchemeDefinition{}), user)
+}
+
+// All 返回全部险种（含已停用），按排序号排列
+func (r *SchemeRegistry) All() []models.SchemeDefinition {
+	return r.all
+}
+
+// Schemes 返回启用的险种，按排序号排列
+func (r *SchemeRegistry) Schemes() []models.SchemeDefinition {
+	return r.enabled
+}
+
+// Lookup 查找启用的险种
+func (r *SchemeRegistry) Lookup(code models.Scheme) (models.SchemeDefinition, bool) {
+	def, ok := r.byCode[code]
+	return def, ok
+}
+
+// Valid 判断险种代码是否可用
+func (r *SchemeRegistry) Valid(code models.Scheme) bool {
+	_, ok := r.byCode[code]
+	return ok
+}
+
+// Applies 判断险种是否启用且适用于指定的缴费部分
+func (r *SchemeRegistry) Applies(code models.Scheme, part models.Part) bool {
+	def, ok := r.byCode[code]
+	return ok && def.AppliesTo(part)
+}
+
+// Name 返回险种的显示名称（含已停用的险种），未登记的险种返回代码本身
+func (r *SchemeRegistry) Name(code models.Scheme) string {
+	for _, def := range r.all {
+		if def.Code == code {
+			return def.Name
+		}
+	}
+	return string(code)
+}
+
+// order 返回险种的排序位置，未登记的险种排在最后
+func (r *SchemeRegistry) order(code models.Scheme) int {
+	for i, def := range r.enabled {
+		if def.Code == code {
+			return i
+		}
+	}
+	return len(r.enabled)
+}
+
+// RequiredUploads 返回处理账期前必须上传的险种，按缴费部分分组
+func (r *SchemeRegistry) RequiredUploads() map[models.Part][]models.Scheme {
+	required := map[models.Part][]models.Scheme{}
+	for _, def := range r.enabled {
+		if !def.Required {
+			continue
+		}
+		for _, part := range def.Parts {
+			required[part] = append(required[part], def.Code)
+		}
+	}
+	return required
+}
+
+// ChargeColumn 扣款明细导出中的一列，可由多个险种合并而成
+type ChargeColumn struct {
+	Label   string          `json:"label"`
+	Schemes []models.Scheme `json:"schemes"`
+}
+
+// Sum 返回该列在一条扣款明细中的金额
+func (c ChargeColumn) Sum(amounts models.SchemeAmounts) models.Money {
+	var total models.Money
+	for _, scheme := range c.Schemes {
+		total += amounts[scheme]
+	}
+	return total
+}
+
+// Columns 返回指定缴费部分扣款明细的险种列。extra 为明细中实际出现的金额：
+// 必需险种总是成列，非必需险种（如住房公积金）只在有金额时成列；
+// 已停用或删除的险种仍有金额时按名称单独成列，避免导出金额与小计对不上
+func (r *SchemeRegistry) Columns(part models.Part, extra ...models.SchemeAmounts) []ChargeColumn {
+	present := map[models.Scheme]bool{}
+	for _, amounts := range extra {
+		for scheme, amount := range amounts {
+			if amount != 0 {
+				present[scheme] = true
+			}
+		}
+	}
+
+	var columns []ChargeColumn
+	index := map[string]int{}
+	covered := map[models.Scheme]bool{}
+	add := func(label string, scheme models.Scheme) {
+		covered[scheme] = true
+		if i, ok := index[label]; ok {
+			columns[i].Schemes = append(columns[i].Schemes, scheme)
+			return
+		}
+		index[label] = len(columns)
+		columns = append(columns, ChargeColumn{Label: label, Schemes: []models.Scheme{scheme}})
+	}
+	for _, def := range r.enabled {
+		if def.AppliesTo(part) && (def.Required || present[def.Code]) {
+			add(def.ColumnFor(part), def.Code)
+		}
+	}
+
+	var missing []models.Scheme
+	for scheme := range present {
+		if !covered[scheme] {
+			missing = append(missing, scheme)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	for _, scheme := range missing {
+		add(r.Name(scheme), scheme)
+	}
+	return columns
+}
+
+// SortSummaries 按缴费部分、再按险种登记表的顺序排列汇总，并填入险种名称与实际费率
+func (r *SchemeRegistry) SortSummaries(summaries []models.PeriodSummary) {
+	for i := range summaries {
+		summaries[i].SchemeName = r.Name(summaries[i].Scheme)
+		summaries[i].EffectiveRate = effectiveRate(summaries[i])
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if summaries[i].Part != summaries[j].Part {
+			return summaries[i].Part < summaries[j].Part
+		}
+		oi, oj := r.order(summaries[i].Scheme), r.order(summaries[j].Scheme)
+		if oi != oj {
+			return oi < oj
+		}
+		return summaries[i].Scheme < summaries[j].Scheme
+	})
+}
+
+// keywordList 返回险种识别关键字。同一段文字命中多个险种时取最长的关键字
+// （如“大额医疗保险”优先于“医疗保险”），长度相同时按登记表顺序
+func (r *SchemeRegistry) keywordList() []schemeKeyword {
+	list := make([]schemeKeyword, 0, len(r.enabled))
+	for _, def := range r.enabled {
+		if len(def.Keywords) > 0 {
+			list = append(list, schemeKeyword{scheme: def.Code, keywords: def.Keywords})
+		}
+	}
+	return list
+}
+
+// singlePart 险种只适用于一个缴费部分时返回该部分（如工伤保险只有单位缴纳）
+func (r *SchemeRegistry) singlePart(code models.Scheme) (models.Part, bool) {
+	def, ok := r.byCode[code]
+	if !ok || len(def.Parts) != 1 {
+		return "", false
+	}
+	return def.Parts[0], true
+}
+
+var schemeCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// ValidateSchemeDefinition 校验自定义险种
+func ValidateSchemeDefinition(def *models.SchemeDefinition) error {
+	def.Code = models.Scheme(strings.TrimSpace(string(def.Code)))
+	def.Name = strings.TrimSpace(def.Name)
+	if !schemeCodePattern.MatchString(string(def.Code)) {
+		return fmt.Errorf("险种代码只能包含小写字母、数字和下划线，且以字母开头: %q", def.Code)
+	}
+	if def.Name == "" {
+		return fmt.Errorf("险种名称不能为空")
+	}
+	if len(def.Parts) == 0 {
+		return fmt.Errorf("险种 %s 至少需要一个适用的缴费部分", def.Code)
+	}
+	seen := map[models.Part]bool{}
+	for _, part := range def.Parts {
+		if part != models.PartPersonal && part != models.PartUnit {
+			return fmt.Errorf("无效的缴费部分: %s", part)
+		}
+		if seen[part] {
+			return fmt.Errorf("缴费部分重复: %s", part)
+		}
+		seen[part] = true
+	}
+	def.PersonalColumn = strings.TrimSpace(def.PersonalColumn)
+	def.UnitColumn = strings.TrimSpace(def.UnitColumn)
+	keywords := def.Keywords[:0]
+	for _, keyword := range def.Keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	def.Keywords = keywords
+	return nil
+}
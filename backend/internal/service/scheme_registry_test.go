@@ -0,0 +1,151 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"siapp/internal/models"
+)
+
+const schemeLongTermCare models.Scheme = "long_term_care"
+
+// longTermCareRegistry 在内置险种上增加长期护理保险并停用大额医疗
+func longTermCareRegistry() *SchemeRegistry {
+	return NewSchemeRegistry([]models.SchemeDefinition{
+		{
+			ID:             1,
+			Code:           schemeLongTermCare,
+			Name:           "长期护理保险",
+			Parts:          []models.Part{models.PartPersonal, models.PartUnit},
+			PersonalColumn: "长护险",
+			UnitColumn:     "长护险",
+			Keywords:       []string{"长期护理保险", "长护险"},
+			SortOrder:      60,
+			Enabled:        true,
+		},
+		{
+			ID:        2,
+			Code:      models.SchemeSeriousIllness,
+			Name:      "大额医疗",
+			Parts:     []models.Part{models.PartPersonal, models.PartUnit},
+			SortOrder: 30,
+			Enabled:   false,
+		},
+	})
+}
+
+func TestSchemeRegistry_Columns(t *testing.T) {
+	defaults := NewSchemeRegistry(nil)
+	var labels []string
+	for _, column := range defaults.Columns(models.PartUnit) {
+		labels = append(labels, column.Label)
+	}
+	// 单位明细中大额医疗并入医疗列，与原固定导出列一致
+	want := []string{"养老保险", "医疗+生育保险", "工伤保险", "失业保险"}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("单位导出列 = %v，期望 %v", labels, want)
+	}
+	medical := defaults.Columns(models.PartUnit)[1]
+	amounts := models.SchemeAmounts{models.SchemeMedical: yuan(300.1), models.SchemeSeriousIllness: yuan(20.2)}
+	if got := medical.Sum(amounts); got != yuan(320.3) {
+		t.Errorf("合并列金额 = %v，期望 320.3", got)
+	}
+
+	registry := longTermCareRegistry()
+	labels = nil
+	// 非必需的长护险有金额时才成列；已停用的大额医疗仍有金额时单独成列
+	extra := models.SchemeAmounts{models.SchemeSeriousIllness: yuan(10), schemeLongTermCare: yuan(12.5)}
+	for _, column := range registry.Columns(models.PartPersonal, extra) {
+		labels = append(labels, column.Label)
+	}
+	want = []string{"养老保险", "医疗+生育保险", "失业保险", "长护险", "大额医疗"}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("个人导出列 = %v，期望 %v", labels, want)
+	}
+}
+
+func TestSchemeRegistry_RequiredUploads(t *testing.T) {
+	registry := longTermCareRegistry()
+	required := registry.RequiredUploads()
+
+	want := map[models.Part][]models.Scheme{
+		models.PartPersonal: {models.SchemePension, models.SchemeMedical, models.SchemeUnemployment},
+		models.PartUnit:     {models.SchemePension, models.SchemeMedical, models.SchemeInjury, models.SchemeUnemployment},
+	}
+	if !reflect.DeepEqual(required, want) {
+		t.Errorf("必需险种 = %v，期望 %v", required, want)
+	}
+	if registry.Valid(models.SchemeSeriousIllness) || !registry.Applies(schemeLongTermCare, models.PartUnit) {
+		t.Error("停用的险种不应可用，新增的险种应可用")
+	}
+	if registry.Applies(models.SchemeInjury, models.PartPersonal) {
+		t.Error("工伤保险不适用于个人缴费")
+	}
+}
+
+func TestBuildAggregates_CustomScheme(t *testing.T) {
+	registry := longTermCareRegistry()
+	record := func(scheme models.Scheme, part models.Part, amount float64) models.RawRecord {
+		return models.RawRecord{PeriodID: 1, Name: "张三", IDNumber: "ID123", PayBase: yuan(5000), AmountDue: yuan(amount), Scheme: scheme, Part: part}
+	}
+	records := []models.RawRecord{
+		record(models.SchemePension, models.PartPersonal, 400),
+		record(schemeLongTermCare, models.PartPersonal, 12.5),
+		// 已停用的险种不计入扣款明细
+		record(models.SchemeSeriousIllness, models.PartPersonal, 10),
+		record(models.SchemeMedical, models.PartUnit, 300),
+		record(schemeLongTermCare, models.PartUnit, 12.5),
+	}
+
+	result := buildAggregates(records, nil, registry, nil)
+	if len(result.personalCharges) != 1 || len(result.unitCharges) != 1 {
+		t.Fatalf("应各有 1 条扣款明细，实际 %d/%d", len(result.personalCharges), len(result.unitCharges))
+	}
+	personal := result.personalCharges[0]
+	if personal.Amounts[schemeLongTermCare] != yuan(12.5) || personal.Subtotal != yuan(412.5) || personal.Pension != yuan(400) {
+		t.Errorf("个人扣款明细不符: %+v", personal)
+	}
+	if _, ok := personal.Amounts[models.SchemeSeriousIllness]; ok {
+		t.Errorf("停用险种不应出现在扣款明细中: %+v", personal.Amounts)
+	}
+	unit := result.unitCharges[0]
+	if unit.Subtotal != yuan(312.5) || unit.MedicalMaternity != yuan(300) {
+		t.Errorf("单位扣款明细不符: %+v", unit)
+	}
+
+	// 汇总按登记表顺序排列，并带出险种名称
+	var order []models.Scheme
+	for _, s := range result.summaries {
+		if s.Part == models.PartPersonal {
+			order = append(order, s.Scheme)
+		}
+	}
+	if !reflect.DeepEqual(order, []models.Scheme{models.SchemePension, schemeLongTermCare, models.SchemeSeriousIllness}) {
+		t.Errorf("个人汇总顺序 = %v", order)
+	}
+	for _, s := range result.summaries {
+		if s.Scheme == schemeLongTermCare && s.SchemeName != "长期护理保险" {
+			t.Errorf("汇总险种名称 = %q", s.SchemeName)
+		}
+	}
+
+	if missing := missingRequired(records, registry); len(missing) == 0 {
+		t.Error("缺少失业保险等必需险种时应列出")
+	}
+}
+
+func TestClassifySourceFile_CustomScheme(t *testing.T) {
+	opts := ParseOptions{Schemes: longTermCareRegistry()}
+	c, err := ClassifySourceFile("", "长期护理保险(单位缴纳)_2025-01.xlsx", opts)
+	if err != nil {
+		t.Fatalf("识别失败: %v", err)
+	}
+	if c.Scheme != schemeLongTermCare || c.Part != models.PartUnit || !c.Confident() {
+		t.Errorf("应识别为长护险单位缴纳，实际 %+v", c)
+	}
+
+	// 停用的大额医疗不再参与识别，且不能通过表单指定
+	if _, err := ResolveSchemePart("", "2025-01.xlsx", opts, models.SchemeSeriousIllness, models.PartUnit); err == nil {
+		t.Error("停用的险种应返回 AmbiguousFileError")
+	}
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// sheetFormat 表示上传表格文件的实际格式（按文件内容判断，而非扩展名）
+type sheetFormat string
+
+const (
+	sheetFormatXLSX sheetFormat = "xlsx"
+	sheetFormatXLS  sheetFormat = "xls"
+	sheetFormatCSV  sheetFormat = "csv"
+)
+
+var (
+	zipMagic  = []byte{0x50, 0x4B, 0x03, 0x04}
+	ole2Magic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+var supportedSheetExtensions = map[string]bool{
+	".xlsx": true,
+	".xlsm": true,
+	".xls":  true,
+	".csv":  true,
+}
+
+// IsSupportedSheetFile 判断上传文件的扩展名是否为支持的表格格式；没有扩展名的文件不接受
+func IsSupportedSheetFile(filename string) bool {
+	return supportedSheetExtensions[strings.ToLower(filepath.Ext(filename))]
+}
+
+// detectSheetFormat 通过文件头识别 xlsx (zip)、xls (OLE2) 或文本格式
+func detectSheetFormat(path string) (sheetFormat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	head := make([]byte, len(ole2Magic))
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, zipMagic):
+		return sheetFormatXLSX, nil
+	case bytes.HasPrefix(head, ole2Magic):
+		return sheetFormatXLS, nil
+	default:
+		return sheetFormatCSV, nil
+	}
+}
+
+// sheetRows 逐行读取表格文件的第一个工作表，避免一次性把整张表载入内存
+type sheetRows interface {
+	Next() bool
+	Row() []string
+	Err() error
+	Close() error
+}
+
+// openSheetRows 按文件内容识别格式并返回行迭代器，支持 xlsx、xls 以及 UTF-8/GBK 编码的 CSV
+func openSheetRows(path string) (sheetRows, error) {
+	format, err := detectSheetFormat(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+
+	switch format {
+	case sheetFormatXLSX:
+		return openXLSXRows(path)
+	case sheetFormatXLS:
+		// BIFF8 需要完整读取复合文档，且单表最多 65536 行，直接载入内存
+		rows, err := readXLSRows(path)
+		if err != nil {
+			return nil, err
+		}
+		return &sliceRows{rows: rows, idx: -1}, nil
+	default:
+		return openCSVRows(path)
+	}
+}
+
+// loadSheetRows 读取表格文件第一个工作表的所有行，适用于花名册、员工信息等较小的文件
+func loadSheetRows(path string) ([][]string, error) {
+	iter, err := openSheetRows(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = iter.Close() }()
+
+	var rows [][]string
+	for iter.Next() {
+		rows = append(rows, iter.Row())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// sliceRows 基于内存中已读取的行
+type sliceRows struct {
+	rows [][]string
+	idx  int
+}
+
+func (r *sliceRows) Next() bool {
+	r.idx++
+	return r.idx < len(r.rows)
+}
+
+func (r *sliceRows) Row() []string { return r.rows[r.idx] }
+func (r *sliceRows) Err() error    { return nil }
+func (r *sliceRows) Close() error  { return nil }
+
+// xlsxRows 使用 excelize 的流式行读取器
+type xlsxRows struct {
+	file *excelize.File
+	rows *excelize.Rows
+	cur  []string
+	err  error
+}
+
+func openXLSXRows(path string) (*xlsxRows, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("open excel: %w", err)
+	}
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		_ = f.Close()
+		return nil, errors.New("Excel文件中没有找到工作表")
+	}
+
+	rows, err := f.Rows(sheets[0])
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("read rows: %w", err)
+	}
+	return &xlsxRows{file: f, rows: rows}, nil
+}
+
+func (r *xlsxRows) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
+	r.cur, r.err = r.rows.Columns()
+	if r.err != nil {
+		r.err = fmt.Errorf("read rows: %w", r.err)
+		return false
+	}
+	return true
+}
+
+func (r *xlsxRows) Row() []string { return r.cur }
+
+func (r *xlsxRows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	if err := r.rows.Error(); err != nil {
+		return fmt.Errorf("read rows: %w", err)
+	}
+	return nil
+}
+
+func (r *xlsxRows) Close() error {
+	_ = r.rows.Close()
+	return r.file.Close()
+}
+
+// csvSniffSize 用于识别编码与分隔符的文件头长度
+const csvSniffSize = 64 << 10
+
+// csvRows 流式读取 CSV，自动识别 UTF-8(含BOM)、UTF-16 与 GBK/GB18030 编码以及逗号/制表符分隔
+type csvRows struct {
+	file   *os.File
+	reader *csv.Reader
+	cur    []string
+	count  int
+	err    error
+}
+
+func openCSVRows(path string) (*csvRows, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReaderSize(file, csvSniffSize)
+	head, err := buffered.Peek(csvSniffSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		_ = file.Close()
+		return nil, err
+	}
+
+	text, err := decodeCSVStream(buffered, head)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	reader := csv.NewReader(text)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.Comma = detectCSVDelimiter(head)
+	return &csvRows{file: file, reader: reader}, nil
+}
+
+func (r *csvRows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	row, err := r.reader.Read()
+	if errors.Is(err, io.EOF) {
+		if r.count == 0 {
+			r.err = errors.New("CSV文件为空")
+		}
+		return false
+	}
+	if err != nil {
+		r.err = fmt.Errorf("解析CSV文件失败: %w", err)
+		return false
+	}
+	for i := range row {
+		row[i] = strings.TrimSpace(row[i])
+	}
+	r.cur = row
+	r.count++
+	return true
+}
+
+func (r *csvRows) Row() []string { return r.cur }
+func (r *csvRows) Err() error    { return r.err }
+func (r *csvRows) Close() error  { return r.file.Close() }
+
+// decodeCSVStream 根据文件头选择解码方式，返回 UTF-8 文本流
+func decodeCSVStream(src *bufio.Reader, head []byte) (io.Reader, error) {
+	switch {
+	case bytes.HasPrefix(head, utf8BOM):
+		if _, err := src.Discard(len(utf8BOM)); err != nil {
+			return nil, err
+		}
+		return src, nil
+	case bytes.HasPrefix(head, utf16LEBOM), bytes.HasPrefix(head, utf16BEBOM):
+		return transform.NewReader(src, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder()), nil
+	case utf8.Valid(trimPartialRune(head)):
+		return src, nil
+	}
+
+	// 本地社保系统导出的 CSV 多为 GBK 编码，GB18030 向下兼容 GBK/GB2312
+	return transform.NewReader(src, simplifiedchinese.GB18030.NewDecoder()), nil
+}
+
+// trimPartialRune 去掉文件头截断处不完整的 UTF-8 字符
+func trimPartialRune(head []byte) []byte {
+	for i := 0; i < utf8.UTFMax && i < len(head); i++ {
+		end := len(head) - i
+		if utf8.Valid(head[:end]) {
+			return head[:end]
+		}
+	}
+	return head
+}
+
+// detectCSVDelimiter 根据首行内容在逗号与制表符之间选择分隔符
+func detectCSVDelimiter(head []byte) rune {
+	firstLine := head
+	if idx := bytes.IndexAny(head, "\r\n"); idx >= 0 {
+		firstLine = head[:idx]
+	}
+	if bytes.Count(firstLine, []byte("\t")) > bytes.Count(firstLine, []byte(",")) {
+		return '\t'
+	}
+	return ','
+}
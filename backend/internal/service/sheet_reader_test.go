@@ -0,0 +1,267 @@
+package service
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func writeTempFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("写入临时文件失败: %v", err)
+	}
+	return path
+}
+
+func TestLoadSheetRows_GBKCSV(t *testing.T) {
+	content := "序号,姓名,证件号码,缴费基数\n1,张三,110101199001011234,5000\n"
+	encoded, err := simplifiedchinese.GBK.NewEncoder().String(content)
+	if err != nil {
+		t.Fatalf("GBK编码失败: %v", err)
+	}
+	path := writeTempFile(t, "gbk.csv", []byte(encoded))
+
+	rows, err := loadSheetRows(path)
+	if err != nil {
+		t.Fatalf("读取GBK CSV失败: %v", err)
+	}
+	expected := [][]string{
+		{"序号", "姓名", "证件号码", "缴费基数"},
+		{"1", "张三", "110101199001011234", "5000"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("GBK CSV解析结果不符，期望 %v，实际 %v", expected, rows)
+	}
+}
+
+func TestLoadSheetRows_UTF8BOMAndTabDelimiter(t *testing.T) {
+	content := append([]byte{0xEF, 0xBB, 0xBF}, []byte("姓名\t部门\n李四\t财务部\n")...)
+	path := writeTempFile(t, "roster.txt", content)
+
+	rows, err := loadSheetRows(path)
+	if err != nil {
+		t.Fatalf("读取UTF-8 CSV失败: %v", err)
+	}
+	if len(rows) != 2 || rows[0][0] != "姓名" || rows[1][1] != "财务部" {
+		t.Errorf("UTF-8 BOM/制表符文件解析结果不符: %v", rows)
+	}
+}
+
+func TestLoadSheetRows_XLSXWithoutExtension(t *testing.T) {
+	f := excelize.NewFile()
+	sheet := f.GetSheetName(0)
+	_ = f.SetCellValue(sheet, "A1", "姓名")
+	_ = f.SetCellValue(sheet, "A2", "王五")
+	path := filepath.Join(t.TempDir(), "upload")
+	if err := f.SaveAs(path + ".xlsx"); err != nil {
+		t.Fatalf("生成xlsx失败: %v", err)
+	}
+	_ = f.Close()
+	if err := os.Rename(path+".xlsx", path); err != nil {
+		t.Fatalf("重命名文件失败: %v", err)
+	}
+
+	rows, err := loadSheetRows(path)
+	if err != nil {
+		t.Fatalf("按内容识别xlsx失败: %v", err)
+	}
+	if len(rows) != 2 || rows[1][0] != "王五" {
+		t.Errorf("xlsx解析结果不符: %v", rows)
+	}
+}
+
+func biffRecordBytes(typ uint16, data []byte) []byte {
+	out := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint16(out, typ)
+	binary.LittleEndian.PutUint16(out[2:], uint16(len(data)))
+	return append(out, data...)
+}
+
+func biffCell(row, col uint16, extra []byte) []byte {
+	out := make([]byte, 6)
+	binary.LittleEndian.PutUint16(out, row)
+	binary.LittleEndian.PutUint16(out[2:], col)
+	return append(out, extra...)
+}
+
+func TestParseBIFFWorkbook(t *testing.T) {
+	bof := make([]byte, 16)
+	binary.LittleEndian.PutUint16(bof, biffVersion8)
+
+	// SST: "姓名"(UTF-16) 被拆分到 CONTINUE 记录中，"base"(压缩字符)
+	sst := make([]byte, 8)
+	binary.LittleEndian.PutUint32(sst, 2)
+	binary.LittleEndian.PutUint32(sst[4:], 2)
+	sst = append(sst, 0x02, 0x00, 0x01, 0xD3, 0x59) // cch=2, wide, "姓"
+	cont := []byte{0x01, 0x0D, 0x54}                // flag=wide, "名"
+	cont = append(cont, 0x04, 0x00, 0x00, 'b', 'a', 's', 'e')
+
+	number := make([]byte, 8)
+	binary.LittleEndian.PutUint64(number, math.Float64bits(5000.5))
+
+	rk := make([]byte, 4)
+	binary.LittleEndian.PutUint32(rk, uint32(12)<<2|0x02)
+
+	isst := func(idx uint32) []byte {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, idx)
+		return b
+	}
+
+	formula := make([]byte, 16)
+	binary.LittleEndian.PutUint64(formula, math.Float64bits(400))
+
+	var sheet []byte
+	sheet = append(sheet, biffRecordBytes(biffRecordBOF, bof)...)
+	sheet = append(sheet, biffRecordBytes(biffRecordLabelSST, biffCell(0, 0, isst(0)))...)
+	sheet = append(sheet, biffRecordBytes(biffRecordLabelSST, biffCell(0, 1, isst(1)))...)
+	sheet = append(sheet, biffRecordBytes(biffRecordLabel, biffCell(1, 0, []byte{0x02, 0x00, 0x00, 'Z', 'S'}))...)
+	sheet = append(sheet, biffRecordBytes(biffRecordNumber, biffCell(1, 1, number))...)
+	sheet = append(sheet, biffRecordBytes(biffRecordRK, biffCell(2, 1, rk))...)
+	sheet = append(sheet, biffRecordBytes(biffRecordFormula, biffCell(2, 2, formula))...)
+	sheet = append(sheet, biffRecordBytes(biffRecordEOF, nil)...)
+
+	buildGlobals := func(offset uint32) []byte {
+		boundSheet := make([]byte, 6)
+		binary.LittleEndian.PutUint32(boundSheet, offset)
+		boundSheet = append(boundSheet, 0x01, 0x00, 'S')
+
+		var globals []byte
+		globals = append(globals, biffRecordBytes(biffRecordBOF, bof)...)
+		globals = append(globals, biffRecordBytes(biffRecordBoundSheet, boundSheet)...)
+		globals = append(globals, biffRecordBytes(biffRecordSST, sst)...)
+		globals = append(globals, biffRecordBytes(biffRecordContinue, cont)...)
+		globals = append(globals, biffRecordBytes(biffRecordEOF, nil)...)
+		return globals
+	}
+	globals := buildGlobals(0)
+	globals = buildGlobals(uint32(len(globals)))
+	stream := append(globals, sheet...)
+
+	rows, err := parseBIFFWorkbook(stream)
+	if err != nil {
+		t.Fatalf("解析BIFF8数据失败: %v", err)
+	}
+	expected := [][]string{
+		{"姓名", "base"},
+		{"ZS", "5000.5"},
+		{"", "12", "400"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("BIFF8解析结果不符，期望 %v，实际 %v", expected, rows)
+	}
+}
+
+func TestParseSST_RejectsOversizedCounts(t *testing.T) {
+	// 字符串数量远超记录长度
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[4:], math.MaxUint32)
+	if _, err := parseSST([][]byte{append(header, 0x01, 0x00, 0x00, 'a')}); err == nil {
+		t.Error("字符串数量超出记录长度时应返回错误")
+	}
+
+	// 扩展数据长度远超剩余数据
+	header = make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[4:], 1)
+	str := []byte{0x01, 0x00, 0x04, 0xFF, 0xFF, 0xFF, 0x7F, 'a'}
+	if _, err := parseSST([][]byte{append(header, str...)}); err == nil {
+		t.Error("扩展数据长度超出记录长度时应返回错误")
+	}
+}
+
+func TestParseBIFFWorkbook_NumberFormatsMatchXLSX(t *testing.T) {
+	bof := make([]byte, 16)
+	binary.LittleEndian.PutUint16(bof, biffVersion8)
+	percent := "0.00%"
+	format := []byte{164, 0, byte(len(percent)), 0, 0}
+	format = append(format, percent...)
+	xf := func(ifmt uint16) []byte {
+		data := make([]byte, 20)
+		binary.LittleEndian.PutUint16(data[2:], ifmt)
+		return data
+	}
+	cell := func(col, ixfe uint16, value float64) []byte {
+		data := make([]byte, 14)
+		binary.LittleEndian.PutUint16(data[2:], col)
+		binary.LittleEndian.PutUint16(data[4:], ixfe)
+		binary.LittleEndian.PutUint64(data[6:], math.Float64bits(value))
+		return biffRecordBytes(biffRecordNumber, data)
+	}
+	// 列：常规、自定义百分比、内置日期（14）、内置两位小数（2）
+	values := []float64{12, 0.08, 45413, 5000.5}
+	var sheet []byte
+	sheet = append(sheet, biffRecordBytes(biffRecordBOF, bof)...)
+	for col, value := range values {
+		sheet = append(sheet, cell(uint16(col), uint16(col), value)...)
+	}
+	sheet = append(sheet, biffRecordBytes(biffRecordEOF, nil)...)
+
+	buildGlobals := func(offset uint32) []byte {
+		boundSheet := make([]byte, 6)
+		binary.LittleEndian.PutUint32(boundSheet, offset)
+		boundSheet = append(boundSheet, 0x01, 0x00, 'S')
+		var globals []byte
+		globals = append(globals, biffRecordBytes(biffRecordBOF, bof)...)
+		globals = append(globals, biffRecordBytes(biffRecordFormat, format)...)
+		for _, ifmt := range []uint16{0, 164, 14, 2} {
+			globals = append(globals, biffRecordBytes(biffRecordXF, xf(ifmt))...)
+		}
+		globals = append(globals, biffRecordBytes(biffRecordBoundSheet, boundSheet)...)
+		globals = append(globals, biffRecordBytes(biffRecordEOF, nil)...)
+		return globals
+	}
+	globals := buildGlobals(0)
+	globals = buildGlobals(uint32(len(globals)))
+	rows, err := parseBIFFWorkbook(append(globals, sheet...))
+	if err != nil {
+		t.Fatalf("解析BIFF8数据失败: %v", err)
+	}
+
+	// 同样的数值与格式保存为 xlsx，读出的文字应一致
+	f := excelize.NewFile()
+	name := f.GetSheetName(0)
+	styles := []*excelize.Style{{NumFmt: 0}, {CustomNumFmt: &percent}, {NumFmt: 14}, {NumFmt: 2}}
+	for col, value := range values {
+		axis, _ := excelize.CoordinatesToCellName(col+1, 1)
+		style, err := f.NewStyle(styles[col])
+		if err != nil {
+			t.Fatalf("创建样式失败: %v", err)
+		}
+		_ = f.SetCellFloat(name, axis, value, -1, 64)
+		_ = f.SetCellStyle(name, axis, axis, style)
+	}
+	path := filepath.Join(t.TempDir(), "formats.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatalf("生成xlsx失败: %v", err)
+	}
+	_ = f.Close()
+	expected, err := loadSheetRows(path)
+	if err != nil {
+		t.Fatalf("读取xlsx失败: %v", err)
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("xls 与 xlsx 读出的文字不一致，xls %q，xlsx %q", rows, expected)
+	}
+	if rows[0][0] != "12" || rows[0][1] != "8.00%" {
+		t.Errorf("格式化结果不符: %q", rows)
+	}
+}
+
+func TestIsSupportedSheetFile(t *testing.T) {
+	for name, want := range map[string]bool{
+		"养老.xlsx": true, "养老.XLS": true, "养老.xlsm": true, "花名册.csv": true,
+		"养老": false, "花名册.txt": false, "养老.pdf": false,
+	} {
+		if got := IsSupportedSheetFile(name); got != want {
+			t.Errorf("IsSupportedSheetFile(%q) = %v，期望 %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"siapp/internal/models"
+	"siapp/internal/storage"
+)
+
+// newSQLiteProcessor 创建基于临时 SQLite 与本地存储的处理器，用于需要真实导入流程的测试
+func newSQLiteProcessor(t *testing.T) (*Processor, storage.Storage) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开SQLite失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Period{}, &models.SourceFile{}, &models.RawRecord{}, &models.PeriodApproval{}, &models.Job{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	store, err := storage.NewLocal(filepath.Join(dir, "uploads"))
+	if err != nil {
+		t.Fatalf("创建文件存储失败: %v", err)
+	}
+	return NewProcessor(db, store), store
+}
+
+func TestProcessor_ReparseSourceFile_UsesCurrentHeaderMapping(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+
+	// “个人编号”不在内置映射中，首次导入时人员编号为空
+	content := "序号,姓名,证件号码,缴费工资,缴费基数,费率,应缴费额,应补(退)费额,个人编号\n" +
+		"1,张三,110101199001011234,5000,5000,8%,400,400,P001\n" +
+		"2,李四,110101199001015678,6000,6000,8%,480,480,P002\n"
+	key := "periods/1/adjustments/adj.csv"
+	if err := store.Put(t.Context(), key, strings.NewReader(content)); err != nil {
+		t.Fatalf("保存文件失败: %v", err)
+	}
+	first, err := processor.ParseAdjustmentFile(1, nil, key, "养老补缴.csv", models.SchemePension, models.PartPersonal, ParseOptions{})
+	if err != nil {
+		t.Fatalf("首次导入失败: %v", err)
+	}
+
+	spec := HeaderSpecFromProfile(&models.HeaderProfile{
+		Kind:     models.HeaderProfileSource,
+		Mappings: []models.HeaderMapping{{SourceHeader: "个人编号", Field: "person_code"}},
+	})
+	result, err := processor.ReparseSourceFile(1, first.File.ID, ParseOptions{Header: &spec, Duplicates: DuplicateReject})
+	if err != nil {
+		t.Fatalf("重新解析失败: %v", err)
+	}
+	if result.File.ID != first.File.ID || !result.File.UploadedAt.Equal(first.File.UploadedAt) {
+		t.Errorf("重新解析应沿用原文件ID与上传时间，原 %d/%v，现 %d/%v", first.File.ID, first.File.UploadedAt, result.File.ID, result.File.UploadedAt)
+	}
+	if len(result.Duplicates) != 0 {
+		t.Errorf("重新解析不应把文件本身视为重复内容: %+v", result.Duplicates)
+	}
+
+	// 补退文件为累加模式，重新解析后不应出现重复记录
+	var records []models.RawRecord
+	if err := processor.db.Where("period_id = ?", 1).Order("sequence").Find(&records).Error; err != nil {
+		t.Fatalf("读取记录失败: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("重新解析后应有 2 条记录，实际 %d", len(records))
+	}
+	if records[0].PersonCode != "P001" || records[1].PersonCode != "P002" {
+		t.Errorf("新的表头映射未生效: %q, %q", records[0].PersonCode, records[1].PersonCode)
+	}
+	if records[0].SourceFileID != first.File.ID {
+		t.Errorf("记录应关联原文件 %d，实际 %d", first.File.ID, records[0].SourceFileID)
+	}
+}
+
+func TestProcessor_ReparseSourceFile_StoredFileMissing(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+
+	content := "序号,姓名,证件号码,缴费工资,缴费基数,费率,应缴费额\n1,张三,110101199001011234,5000,5000,8%,400\n"
+	key := "periods/1/pension.csv"
+	if err := store.Put(t.Context(), key, strings.NewReader(content)); err != nil {
+		t.Fatalf("保存文件失败: %v", err)
+	}
+	first, err := processor.ParseSourceFile(1, nil, key, "养老.csv", models.SchemePension, models.PartPersonal, ParseOptions{})
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+
+	// 只有不再生效的版本或已关账账期的文件会被清理
+	if err := processor.db.Model(&models.SourceFile{}).Where("id = ?", first.File.ID).Update("active", false).Error; err != nil {
+		t.Fatalf("更新源文件失败: %v", err)
+	}
+	if _, err := processor.PurgeExpiredFiles(t.Context(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("清理过期文件失败: %v", err)
+	}
+	if _, err := processor.ReparseSourceFile(1, first.File.ID, ParseOptions{}); !errors.Is(err, ErrStoredFileMissing) {
+		t.Fatalf("原始文件已清理时应返回 ErrStoredFileMissing，实际 %v", err)
+	}
+
+	var count int64
+	processor.db.Model(&models.RawRecord{}).Where("source_file_id = ?", first.File.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("重新解析失败时原记录应保留，实际 %d 条", count)
+	}
+}
+
+func TestProcessor_SourceFileVersions(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+
+	upload := func(name, amount string) *ParseResult {
+		t.Helper()
+		content := "序号,姓名,证件号码,缴费工资,缴费基数,费率,应缴费额\n1,张三,110101199001011234,5000,5000,8%," + amount + "\n"
+		key := "periods/1/" + name
+		if err := store.Put(t.Context(), key, strings.NewReader(content)); err != nil {
+			t.Fatalf("保存文件失败: %v", err)
+		}
+		result, err := processor.ParseSourceFile(1, nil, key, name, models.SchemePension, models.PartPersonal, ParseOptions{})
+		if err != nil {
+			t.Fatalf("导入 %s 失败: %v", name, err)
+		}
+		return result
+	}
+	activeAmount := func() models.Money {
+		t.Helper()
+		var records []models.RawRecord
+		if err := processor.activeRecords().Where("period_id = ?", 1).Find(&records).Error; err != nil {
+			t.Fatalf("读取生效记录失败: %v", err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("应只有 1 条生效记录，实际 %d", len(records))
+		}
+		return records[0].AmountDue
+	}
+
+	v1 := upload("v1.csv", "400")
+	v2 := upload("v2.csv", "4000")
+	if v1.File.Version != 1 || v2.File.Version != 2 {
+		t.Fatalf("版本号应依次为 1、2，实际 %d、%d", v1.File.Version, v2.File.Version)
+	}
+
+	versions, err := processor.ListSourceFileVersions(1, models.SchemePension, models.PartPersonal)
+	if err != nil {
+		t.Fatalf("查询版本失败: %v", err)
+	}
+	if len(versions) != 2 || versions[0].ID != v2.File.ID || !versions[0].Active || versions[1].Active {
+		t.Fatalf("版本列表不符: %+v", versions)
+	}
+	if got := activeAmount(); got != yuan(4000) {
+		t.Errorf("重新上传后应读取新版本，实际金额 %v", got)
+	}
+
+	// 撤销错误的重新上传
+	if _, err := processor.ActivateSourceFileVersion(1, v1.File.ID); err != nil {
+		t.Fatalf("切换版本失败: %v", err)
+	}
+	if got := activeAmount(); got != yuan(400) {
+		t.Errorf("切换回第 1 版后应读取旧记录，实际金额 %v", got)
+	}
+
+	// 重新解析非生效版本不应改变生效状态
+	result, err := processor.ReparseSourceFile(1, v2.File.ID, ParseOptions{})
+	if err != nil {
+		t.Fatalf("重新解析失败: %v", err)
+	}
+	if result.File.Active || result.File.Version != 2 {
+		t.Errorf("重新解析后版本与生效状态应保持不变: %+v", result.File)
+	}
+	if got := activeAmount(); got != yuan(400) {
+		t.Errorf("重新解析旧版本后生效记录不应变化，实际金额 %v", got)
+	}
+}
+
+func TestProcessor_PurgeExpiredFiles_OnlyInactiveOrClosed(t *testing.T) {
+	processor, store := newSQLiteProcessor(t)
+	db := processor.db
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	acme := models.User{Username: "acme", Email: "acme@example.com", CompanyID: "acme"}
+	other := models.User{Username: "other", Email: "other@example.com", CompanyID: "other"}
+	for _, user := range []*models.User{&acme, &other} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+	}
+	open := models.Period{UserID: &acme.ID, YearMonth: "2026-05", Status: models.PeriodProcessed}
+	closed := models.Period{UserID: &acme.ID, YearMonth: "2026-04", Status: models.PeriodClosed}
+	otherClosed := models.Period{UserID: &other.ID, YearMonth: "2026-04", Status: models.PeriodClosed}
+	for _, period := range []*models.Period{&open, &closed, &otherClosed} {
+		if err := db.Create(period).Error; err != nil {
+			t.Fatalf("创建账期失败: %v", err)
+		}
+	}
+
+	put := func(key string) {
+		t.Helper()
+		if err := store.Put(t.Context(), key, strings.NewReader("x")); err != nil {
+			t.Fatalf("保存文件失败: %v", err)
+		}
+	}
+	files := []models.SourceFile{
+		{PeriodID: open.ID, StoredPath: "companies/acme/periods/1/active.csv", Active: true},
+		{PeriodID: open.ID, StoredPath: "companies/acme/periods/1/old.csv"},
+		{PeriodID: closed.ID, StoredPath: "companies/acme/periods/2/closed.csv", Active: true},
+		{PeriodID: otherClosed.ID, StoredPath: "companies/other/periods/3/queued.csv", Active: true},
+	}
+	for i := range files {
+		put(files[i].StoredPath)
+		if err := db.Create(&files[i]).Error; err != nil {
+			t.Fatalf("插入源文件失败: %v", err)
+		}
+	}
+	// GORM 对零值使用默认值 true，显式置为非生效版本
+	db.Model(&models.SourceFile{}).Where("id = ?", files[1].ID).Update("active", false)
+	put("companies/acme/roster/roster.xlsx")
+	put("companies/acme/employees/1/employees.xlsx")
+
+	runner := NewJobRunner(db, 1)
+	processor.RegisterJobs(runner)
+	if _, err := runner.Enqueue(nil, &otherClosed.ID, models.JobUploadBatch, UploadBatchPayload{PeriodID: otherClosed.ID,
+		Files: []UploadBatchFile{{StoredPath: files[3].StoredPath, OriginalName: "queued.csv"}}}); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+
+	count, err := processor.PurgeExpiredFiles(t.Context(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("清理过期文件失败: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("应只清理非生效版本与已关账账期的文件，实际 %d 个", count)
+	}
+	for _, key := range []string{files[0].StoredPath, files[3].StoredPath, "companies/acme/roster/roster.xlsx", "companies/acme/employees/1/employees.xlsx"} {
+		rc, err := store.Open(t.Context(), key)
+		if err != nil {
+			t.Errorf("%s 不应被清理: %v", key, err)
+			continue
+		}
+		rc.Close()
+	}
+	var purged []string
+	db.Model(&models.SourceFile{}).Where("purged_at IS NOT NULL").Order("id").Pluck("stored_path", &purged)
+	if len(purged) != 2 || purged[0] != files[1].StoredPath || purged[1] != files[2].StoredPath {
+		t.Errorf("标记为已清理的源文件不符: %v", purged)
+	}
+}
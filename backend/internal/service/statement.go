@@ -0,0 +1,342 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"siapp/internal/models"
+)
+
+// ErrNoStatementData 所选年度没有该员工的扣款明细
+var ErrNoStatementData = errors.New("没有扣款明细")
+
+// StatementMonth 员工某月的个人、单位缴费。补退按费款所属期计入原缴费月份并单独列出，
+// 未注明所属期的计入支付补退的账期月份；只有补退的月份 PeriodID 为 0
+type StatementMonth struct {
+	YearMonth               string               `json:"year_month"`
+	PeriodID                uint                 `json:"period_id"`
+	Department              string               `json:"department"`
+	PersonalBase            models.Money         `json:"personal_base"`
+	UnitBase                models.Money         `json:"unit_base"`
+	Personal                models.SchemeAmounts `json:"personal"`
+	Unit                    models.SchemeAmounts `json:"unit"`
+	PersonalAdjustment      models.SchemeAmounts `json:"personal_adjustment"`
+	UnitAdjustment          models.SchemeAmounts `json:"unit_adjustment"`
+	PersonalAdjustmentTotal models.Money         `json:"personal_adjustment_total"`
+	UnitAdjustmentTotal     models.Money         `json:"unit_adjustment_total"`
+	PersonalTotal           models.Money         `json:"personal_total"`               // 含补退
+	UnitTotal               models.Money         `json:"unit_total"`                   // 含补退
+	AdjustmentPaidIn        []string             `json:"adjustment_paid_in,omitempty"` // 支付本月补退的账期月份
+}
+
+// PersonalAmounts 返回含补退的个人各险种金额
+func (m StatementMonth) PersonalAmounts() models.SchemeAmounts {
+	return mergeAmounts(m.Personal, m.PersonalAdjustment)
+}
+
+// UnitAmounts 返回含补退的单位各险种金额
+func (m StatementMonth) UnitAmounts() models.SchemeAmounts {
+	return mergeAmounts(m.Unit, m.UnitAdjustment)
+}
+
+// StatementTotals 年度合计（含补退）
+type StatementTotals struct {
+	Personal      models.SchemeAmounts `json:"personal"`
+	Unit          models.SchemeAmounts `json:"unit"`
+	PersonalTotal models.Money         `json:"personal_total"`
+	UnitTotal     models.Money         `json:"unit_total"`
+	Total         models.Money         `json:"total"`
+}
+
+// ContributionStatement 员工年度缴费明细
+type ContributionStatement struct {
+	IDNumber        string           `json:"id_number"`
+	Name            string           `json:"name"`
+	Department      string           `json:"department"` // 最近一个月的部门
+	Year            int              `json:"year"`
+	Months          []StatementMonth `json:"months"`
+	PersonalColumns []ChargeColumn   `json:"personal_columns"`
+	UnitColumns     []ChargeColumn   `json:"unit_columns"`
+	Totals          StatementTotals  `json:"totals"`
+}
+
+// statementCharge 参与年度明细的一条扣款明细
+type statementCharge struct {
+	periodID   uint
+	yearMonth  string
+	idNumber   string
+	name       string
+	department string
+	part       models.Part
+	base       models.Money
+	amounts    models.SchemeAmounts
+	adjustment bool
+	paidIn     string // 补退支付所在的账期月份
+}
+
+// buildStatements 按员工、月份汇总扣款明细，员工按证件号码排列
+func buildStatements(year int, charges []statementCharge, schemes *SchemeRegistry) []*ContributionStatement {
+	sort.SliceStable(charges, func(i, j int) bool { return charges[i].yearMonth < charges[j].yearMonth })
+
+	statements := map[string]*ContributionStatement{}
+	months := map[string]map[string]*StatementMonth{}
+	for _, c := range charges {
+		id := strings.TrimSpace(c.idNumber)
+		if id == "" {
+			continue
+		}
+		st, ok := statements[id]
+		if !ok {
+			st = &ContributionStatement{IDNumber: id, Year: year}
+			statements[id] = st
+			months[id] = map[string]*StatementMonth{}
+		}
+		if c.name != "" {
+			st.Name = c.name
+		}
+		if c.department != "" {
+			st.Department = c.department
+		}
+		month, ok := months[id][c.yearMonth]
+		if !ok {
+			month = &StatementMonth{
+				YearMonth: c.yearMonth,
+				Personal:  models.SchemeAmounts{}, Unit: models.SchemeAmounts{},
+				PersonalAdjustment: models.SchemeAmounts{}, UnitAdjustment: models.SchemeAmounts{},
+			}
+			months[id][c.yearMonth] = month
+		}
+		if !c.adjustment {
+			month.PeriodID = c.periodID
+		} else if c.paidIn != "" && !slices.Contains(month.AdjustmentPaidIn, c.paidIn) {
+			month.AdjustmentPaidIn = append(month.AdjustmentPaidIn, c.paidIn)
+		}
+
+		var target models.SchemeAmounts
+		switch {
+		case c.part == models.PartPersonal && c.adjustment:
+			target = month.PersonalAdjustment
+		case c.part == models.PartPersonal:
+			target = month.Personal
+			month.PersonalBase = c.base
+			month.Department = c.department
+		case c.adjustment:
+			target = month.UnitAdjustment
+		default:
+			target = month.Unit
+			month.UnitBase = c.base
+		}
+		for scheme, amount := range c.amounts {
+			target[scheme] += amount
+		}
+	}
+
+	result := make([]*ContributionStatement, 0, len(statements))
+	for id, st := range statements {
+		st.Totals = StatementTotals{Personal: models.SchemeAmounts{}, Unit: models.SchemeAmounts{}}
+		var personalAmounts, unitAmounts []models.SchemeAmounts
+		for _, month := range months[id] {
+			month.Personal = compactAmounts(month.Personal)
+			month.Unit = compactAmounts(month.Unit)
+			month.PersonalAdjustment = compactAmounts(month.PersonalAdjustment)
+			month.UnitAdjustment = compactAmounts(month.UnitAdjustment)
+			sort.Strings(month.AdjustmentPaidIn)
+			month.PersonalAdjustmentTotal = month.PersonalAdjustment.Total()
+			month.UnitAdjustmentTotal = month.UnitAdjustment.Total()
+			month.PersonalTotal = month.Personal.Total() + month.PersonalAdjustmentTotal
+			month.UnitTotal = month.Unit.Total() + month.UnitAdjustmentTotal
+			st.Totals.Personal = mergeAmounts(st.Totals.Personal, month.PersonalAmounts())
+			st.Totals.Unit = mergeAmounts(st.Totals.Unit, month.UnitAmounts())
+			personalAmounts = append(personalAmounts, month.Personal, month.PersonalAdjustment)
+			unitAmounts = append(unitAmounts, month.Unit, month.UnitAdjustment)
+			st.Months = append(st.Months, *month)
+		}
+		sort.Slice(st.Months, func(i, j int) bool { return st.Months[i].YearMonth < st.Months[j].YearMonth })
+		st.Totals.PersonalTotal = st.Totals.Personal.Total()
+		st.Totals.UnitTotal = st.Totals.Unit.Total()
+		st.Totals.Total = st.Totals.PersonalTotal + st.Totals.UnitTotal
+		st.PersonalColumns = schemes.Columns(models.PartPersonal, personalAmounts...)
+		st.UnitColumns = schemes.Columns(models.PartUnit, unitAmounts...)
+		result = append(result, st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].IDNumber < result[j].IDNumber })
+	return result
+}
+
+// BuildContributionStatements 汇总用户某年度各账期的扣款明细，生成员工年度缴费明细；
+// 补退按费款所属期归属到该年度的月份，因此也读取以后账期中支付的补退。
+// idNumbers 为空时包含该年度有扣款明细的全部员工
+func (p *Processor) BuildContributionStatements(userID uint, year int, idNumbers []string) ([]*ContributionStatement, error) {
+	prefix := fmt.Sprintf("%04d-", year)
+	var periods []models.Period
+	if err := p.db.Where("user_id = ? AND year_month >= ?", userID, prefix+"01").Find(&periods).Error; err != nil {
+		return nil, fmt.Errorf("load periods: %w", err)
+	}
+	if len(periods) == 0 {
+		return nil, ErrNoStatementData
+	}
+	byID := make(map[uint]models.Period, len(periods))
+	ids := make([]uint, 0, len(periods))
+	var yearIDs []uint
+	for _, period := range periods {
+		byID[period.ID] = period
+		ids = append(ids, period.ID)
+		if strings.HasPrefix(period.YearMonth, prefix) {
+			yearIDs = append(yearIDs, period.ID)
+		}
+	}
+
+	var personal []models.PersonalCharge
+	var unit []models.UnitCharge
+	if len(yearIDs) > 0 {
+		personalQuery := p.db.Where("period_id IN ? AND is_adjustment = ?", yearIDs, false)
+		unitQuery := p.db.Where("period_id IN ? AND is_adjustment = ?", yearIDs, false)
+		if len(idNumbers) > 0 {
+			personalQuery = personalQuery.Where("id_number IN ?", idNumbers)
+			unitQuery = unitQuery.Where("id_number IN ?", idNumbers)
+		}
+		if err := personalQuery.Find(&personal).Error; err != nil {
+			return nil, fmt.Errorf("load personal charges: %w", err)
+		}
+		if err := unitQuery.Find(&unit).Error; err != nil {
+			return nil, fmt.Errorf("load unit charges: %w", err)
+		}
+	}
+	adjustmentQuery := p.db.Where("period_id IN ? AND file_type = ?", ids, models.FileTypeAdjustment).
+		Where("contribution_month LIKE ? OR (contribution_month = '' AND period_id IN ?)", prefix+"%", yearIDs)
+	if len(idNumbers) > 0 {
+		adjustmentQuery = adjustmentQuery.Where("id_number IN ?", idNumbers)
+	}
+	var records []models.RawRecord
+	if err := adjustmentQuery.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("load adjustment records: %w", err)
+	}
+
+	schemes, err := LoadSchemeRegistry(p.db, &userID)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := p.adjustmentLines(byID, records, schemes)
+	if err != nil {
+		return nil, err
+	}
+
+	charges := make([]statementCharge, 0, len(personal)+len(unit)+len(lines))
+	for _, c := range personal {
+		charges = append(charges, statementCharge{c.PeriodID, byID[c.PeriodID].YearMonth, c.IDNumber, c.Name, c.Department,
+			models.PartPersonal, c.Base, c.AmountsByScheme(), false, ""})
+	}
+	for _, c := range unit {
+		charges = append(charges, statementCharge{c.PeriodID, byID[c.PeriodID].YearMonth, c.IDNumber, c.Name, c.Department,
+			models.PartUnit, c.Base, c.AmountsByScheme(), false, ""})
+	}
+	for _, line := range lines {
+		month := line.record.ContributionMonth
+		if month == "" {
+			month = line.yearMonth
+		}
+		charges = append(charges, statementCharge{line.periodID, month, line.record.IDNumber, line.record.Name, line.record.Department,
+			line.record.Part, line.record.PayBase, models.SchemeAmounts{line.record.Scheme: line.amount}, true, line.yearMonth})
+	}
+	if len(charges) == 0 {
+		return nil, ErrNoStatementData
+	}
+	return buildStatements(year, charges, schemes), nil
+}
+
+// statementTemplate 可打印的年度缴费证明，每人一页，浏览器中“打印为 PDF”即可
+var statementTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"sum":   func(col ChargeColumn, amounts models.SchemeAmounts) string { return col.Sum(amounts).String() },
+	"money": models.Money.String,
+	"inc":   func(n int) int { return n + 1 },
+	"adjusted": func(month StatementMonth) bool {
+		return len(month.PersonalAdjustment) > 0 || len(month.UnitAdjustment) > 0
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Year}} 年度社会保险缴费明细</title>
+<style>
+body { font-family: "PingFang SC", "Microsoft YaHei", sans-serif; font-size: 12px; margin: 24px; }
+section { page-break-after: always; }
+section:last-child { page-break-after: auto; }
+h1 { font-size: 18px; text-align: center; margin-bottom: 4px; }
+.meta { display: flex; justify-content: space-between; margin: 12px 0; }
+table { width: 100%; border-collapse: collapse; }
+th, td { border: 1px solid #333; padding: 4px 6px; text-align: right; white-space: nowrap; }
+th { background: #f0f0f0; text-align: center; }
+td.text { text-align: left; }
+tfoot td { font-weight: bold; }
+.note { margin-top: 12px; color: #555; }
+.footer { margin-top: 36px; display: flex; justify-content: space-between; }
+</style>
+</head>
+<body>
+{{range .Statements}}
+<section>
+<h1>{{.Year}} 年度社会保险缴费明细</h1>
+<div class="meta">
+<span>姓名：{{.Name}}</span>
+<span>证件号码：{{.IDNumber}}</span>
+<span>部门：{{.Department}}</span>
+</div>
+<table>
+<thead>
+<tr>
+<th rowspan="2">月份</th>
+<th rowspan="2">缴费基数</th>
+<th colspan="{{len .PersonalColumns | inc}}">个人缴纳</th>
+<th colspan="{{len .UnitColumns | inc}}">单位缴纳</th>
+</tr>
+<tr>
+{{range .PersonalColumns}}<th>{{.Label}}</th>{{end}}<th>小计</th>
+{{range .UnitColumns}}<th>{{.Label}}</th>{{end}}<th>小计</th>
+</tr>
+</thead>
+<tbody>
+{{$st := .}}
+{{range .Months}}
+{{$month := .}}
+<tr>
+<td class="text">{{.YearMonth}}{{if adjusted .}}*{{end}}</td>
+<td>{{money .PersonalBase}}</td>
+{{range $st.PersonalColumns}}<td>{{sum . $month.PersonalAmounts}}</td>{{end}}<td>{{money .PersonalTotal}}</td>
+{{range $st.UnitColumns}}<td>{{sum . $month.UnitAmounts}}</td>{{end}}<td>{{money .UnitTotal}}</td>
+</tr>
+{{end}}
+</tbody>
+<tfoot>
+<tr>
+<td class="text">合计</td>
+<td></td>
+{{range .PersonalColumns}}<td>{{sum . $st.Totals.Personal}}</td>{{end}}<td>{{money .Totals.PersonalTotal}}</td>
+{{range .UnitColumns}}<td>{{sum . $st.Totals.Unit}}</td>{{end}}<td>{{money .Totals.UnitTotal}}</td>
+</tr>
+</tfoot>
+</table>
+<p class="note">标 * 的月份含补缴或退费金额。个人与单位缴纳合计 {{money .Totals.Total}} 元。</p>
+<div class="footer">
+<span>出具单位（盖章）：</span>
+<span>出具日期：{{$.Date}}</span>
+</div>
+</section>
+{{end}}
+</body>
+</html>
+`))
+
+// RenderStatementsHTML 输出可打印的年度缴费明细，每人一页
+func RenderStatementsHTML(w io.Writer, year int, statements []*ContributionStatement) error {
+	return statementTemplate.Execute(w, map[string]any{
+		"Year":       year,
+		"Date":       time.Now().Format("2006-01-02"),
+		"Statements": statements,
+	})
+}
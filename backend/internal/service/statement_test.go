@@ -0,0 +1,124 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"siapp/internal/models"
+)
+
+func TestBuildStatements(t *testing.T) {
+	charge := func(yearMonth, id string, part models.Part, amount float64, adjustment bool) statementCharge {
+		return statementCharge{
+			yearMonth: yearMonth, idNumber: id, name: "张三", department: "财务部", part: part, base: yuan(5000),
+			amounts: models.SchemeAmounts{models.SchemePension: yuan(amount)}, adjustment: adjustment,
+		}
+	}
+	charges := []statementCharge{
+		charge("2026-02", "A", models.PartPersonal, 400, false),
+		charge("2026-01", "A", models.PartPersonal, 400, false),
+		charge("2026-01", "A", models.PartUnit, 800, false),
+		charge("2026-02", "A", models.PartPersonal, 40, true), // 2 月处理的补缴
+		charge("2026-01", "B", models.PartPersonal, 300, false),
+	}
+
+	statements := buildStatements(2026, charges, NewSchemeRegistry(nil))
+	if len(statements) != 2 || statements[0].IDNumber != "A" || statements[1].IDNumber != "B" {
+		t.Fatalf("员工数量或顺序不符: %+v", statements)
+	}
+	a := statements[0]
+	if len(a.Months) != 2 || a.Months[0].YearMonth != "2026-01" || a.Months[1].YearMonth != "2026-02" {
+		t.Fatalf("月份不符: %+v", a.Months)
+	}
+	feb := a.Months[1]
+	if feb.Personal[models.SchemePension] != yuan(400) || feb.PersonalAdjustmentTotal != yuan(40) || feb.PersonalTotal != yuan(440) {
+		t.Errorf("2 月个人缴费不符: %+v", feb)
+	}
+	if a.Totals.PersonalTotal != yuan(840) || a.Totals.UnitTotal != yuan(800) || a.Totals.Total != yuan(1640) {
+		t.Errorf("年度合计不符: %+v", a.Totals)
+	}
+
+	var buf bytes.Buffer
+	if err := RenderStatementsHTML(&buf, 2026, statements[:1]); err != nil {
+		t.Fatalf("输出缴费证明失败: %v", err)
+	}
+	html := buf.String()
+	for _, want := range []string{"张三", "2026-02*", "840.00", "1640.00"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("缴费证明中缺少 %q", want)
+		}
+	}
+}
+
+func TestProcessor_StatementAdjustmentsByContributionMonth(t *testing.T) {
+	processor, _ := newSQLiteProcessor(t)
+	db := processor.db
+	if err := db.AutoMigrate(&models.User{}, &models.SchemeDefinition{}, &models.ContributionRuleSet{},
+		&models.PersonalCharge{}, &models.UnitCharge{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	user := models.User{Username: "hr", Email: "hr@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	periods := map[string]*models.Period{}
+	for _, ym := range []string{"2025-12", "2026-03", "2026-06", "2027-01"} {
+		period := models.Period{UserID: &user.ID, YearMonth: ym}
+		if err := db.Create(&period).Error; err != nil {
+			t.Fatalf("创建账期失败: %v", err)
+		}
+		periods[ym] = &period
+	}
+	const id = "110101199001011234"
+	if err := db.Create(&models.PersonalCharge{PeriodID: periods["2026-03"].ID, Name: "张三", IDNumber: id, Base: yuan(5000),
+		Amounts: models.SchemeAmounts{models.SchemePension: yuan(400)}, Subtotal: yuan(400)}).Error; err != nil {
+		t.Fatalf("插入扣款明细失败: %v", err)
+	}
+	adjustment := func(ym, contributionMonth string, amount float64) models.RawRecord {
+		return models.RawRecord{PeriodID: periods[ym].ID, Name: "张三", IDNumber: id, PayBase: yuan(5000), AmountDue: yuan(amount),
+			Scheme: models.SchemePension, Part: models.PartPersonal, FileType: models.FileTypeAdjustment, ContributionMonth: contributionMonth}
+	}
+	records := []models.RawRecord{
+		adjustment("2026-06", "2026-03", 40), // 6 月补缴 3 月
+		adjustment("2027-01", "2026-04", 30), // 次年补缴 4 月
+		adjustment("2026-06", "", 20),        // 未注明所属期，计入 6 月
+		adjustment("2026-03", "2025-12", 10), // 所属期不在本年度
+		adjustment("2027-01", "", 50),        // 次年账期且未注明所属期
+	}
+	if err := db.Create(&records).Error; err != nil {
+		t.Fatalf("插入补退记录失败: %v", err)
+	}
+
+	statements, err := processor.BuildContributionStatements(user.ID, 2026, nil)
+	if err != nil {
+		t.Fatalf("生成缴费明细失败: %v", err)
+	}
+	if len(statements) != 1 {
+		t.Fatalf("员工数量不符: %+v", statements)
+	}
+	got := map[string]StatementMonth{}
+	var months []string
+	for _, month := range statements[0].Months {
+		got[month.YearMonth] = month
+		months = append(months, month.YearMonth)
+	}
+	if strings.Join(months, ",") != "2026-03,2026-04,2026-06" {
+		t.Fatalf("月份不符: %v", months)
+	}
+	if mar := got["2026-03"]; mar.PeriodID != periods["2026-03"].ID || mar.PersonalAdjustmentTotal != yuan(40) || mar.PersonalTotal != yuan(440) {
+		t.Errorf("3 月应包含 6 月补缴的 40 元: %+v", mar)
+	}
+	if mar := got["2026-03"]; strings.Join(mar.AdjustmentPaidIn, ",") != "2026-06" {
+		t.Errorf("3 月补退应记录支付账期: %v", mar.AdjustmentPaidIn)
+	}
+	if apr := got["2026-04"]; apr.PeriodID != 0 || apr.PersonalAdjustmentTotal != yuan(30) || strings.Join(apr.AdjustmentPaidIn, ",") != "2027-01" {
+		t.Errorf("4 月应包含次年补缴的 30 元: %+v", apr)
+	}
+	if jun := got["2026-06"]; jun.PersonalAdjustmentTotal != yuan(20) {
+		t.Errorf("未注明所属期的补退应计入支付月份: %+v", jun)
+	}
+	if statements[0].Totals.PersonalTotal != yuan(490) {
+		t.Errorf("年度合计不符: %+v", statements[0].Totals)
+	}
+}
@@ -0,0 +1,534 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+	"github.com/xuri/excelize/v2"
+)
+
+// BIFF8 记录类型，仅包含读取单元格值所需的部分
+const (
+	biffRecordBOF        = 0x0809
+	biffRecordEOF        = 0x000A
+	biffRecordBoundSheet = 0x0085
+	biffRecordSST        = 0x00FC
+	biffRecordContinue   = 0x003C
+	biffRecordLabelSST   = 0x00FD
+	biffRecordLabel      = 0x0204
+	biffRecordNumber     = 0x0203
+	biffRecordRK         = 0x027E
+	biffRecordMulRK      = 0x00BD
+	biffRecordFormula    = 0x0006
+	biffRecordString     = 0x0207
+	biffRecordBoolErr    = 0x0205
+	biffRecordFormat     = 0x041E
+	biffRecordXF         = 0x00E0
+	biffRecordDateMode   = 0x0022
+
+	biffVersion8 = 0x0600
+)
+
+type biffRecord struct {
+	typ  uint16
+	data []byte
+}
+
+// readXLSRows 读取旧版 Excel 97-2003 (.xls, BIFF8) 文件第一个工作表的所有行
+func readXLSRows(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	doc, err := mscfb.New(file)
+	if err != nil {
+		return nil, fmt.Errorf("打开xls复合文档失败: %w", err)
+	}
+
+	var stream []byte
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if entry.Name != "Workbook" && entry.Name != "Book" {
+			continue
+		}
+		stream, err = io.ReadAll(entry)
+		if err != nil {
+			return nil, fmt.Errorf("读取xls工作簿数据失败: %w", err)
+		}
+		break
+	}
+	if stream == nil {
+		return nil, errors.New("xls文件中没有找到工作簿数据")
+	}
+
+	return parseBIFFWorkbook(stream)
+}
+
+// parseBIFFWorkbook 解析 Workbook 流，返回第一个工作表的单元格文本
+func parseBIFFWorkbook(stream []byte) ([][]string, error) {
+	records, err := splitBIFFRecords(stream)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || records[0].typ != biffRecordBOF {
+		return nil, errors.New("xls文件格式无效：缺少BOF记录")
+	}
+	if len(records[0].data) < 2 || binary.LittleEndian.Uint16(records[0].data) != biffVersion8 {
+		return nil, errors.New("仅支持Excel 97-2003 (BIFF8) 格式的xls文件，请另存为xlsx后上传")
+	}
+
+	var (
+		sst         []string
+		sheetOffset = -1
+		formats     = newBIFFNumberFormats()
+	)
+	defer formats.close()
+	for i := 1; i < len(records); i++ {
+		rec := records[i]
+		if rec.typ == biffRecordEOF {
+			break
+		}
+		switch rec.typ {
+		case biffRecordBoundSheet:
+			// 只关心第一个普通工作表 (dt=0)
+			if sheetOffset < 0 && len(rec.data) >= 6 && rec.data[5] == 0 {
+				sheetOffset = int(binary.LittleEndian.Uint32(rec.data))
+			}
+		case biffRecordSST:
+			segments := [][]byte{rec.data}
+			for i+1 < len(records) && records[i+1].typ == biffRecordContinue {
+				i++
+				segments = append(segments, records[i].data)
+			}
+			sst, err = parseSST(segments)
+			if err != nil {
+				return nil, err
+			}
+		case biffRecordFormat:
+			if len(rec.data) < 5 {
+				continue
+			}
+			code, err := readXLUnicodeString(rec.data[2:])
+			if err != nil {
+				return nil, err
+			}
+			formats.codes[binary.LittleEndian.Uint16(rec.data)] = code
+		case biffRecordXF:
+			if len(rec.data) >= 4 {
+				formats.xf = append(formats.xf, binary.LittleEndian.Uint16(rec.data[2:]))
+			}
+		case biffRecordDateMode:
+			formats.date1904 = len(rec.data) >= 2 && binary.LittleEndian.Uint16(rec.data) == 1
+		}
+	}
+	if sheetOffset < 0 || sheetOffset >= len(stream) {
+		return nil, errors.New("xls文件中没有找到工作表")
+	}
+
+	sheetRecords, err := splitBIFFRecords(stream[sheetOffset:])
+	if err != nil {
+		return nil, err
+	}
+	return collectBIFFCells(sheetRecords, sst, formats)
+}
+
+// splitBIFFRecords 按 [类型][长度][数据] 的格式切分记录流
+func splitBIFFRecords(stream []byte) ([]biffRecord, error) {
+	var records []biffRecord
+	depth := 0
+	for pos := 0; pos+4 <= len(stream); {
+		typ := binary.LittleEndian.Uint16(stream[pos:])
+		size := int(binary.LittleEndian.Uint16(stream[pos+2:]))
+		pos += 4
+		if pos+size > len(stream) {
+			return nil, errors.New("xls文件已损坏：记录长度超出范围")
+		}
+		records = append(records, biffRecord{typ: typ, data: stream[pos : pos+size]})
+		pos += size
+		// 子流以 BOF 开始、EOF 结束，嵌套的图表子流需要跳过
+		switch typ {
+		case biffRecordBOF:
+			depth++
+		case biffRecordEOF:
+			depth--
+			if depth <= 0 {
+				return records, nil
+			}
+		}
+	}
+	return records, nil
+}
+
+func collectBIFFCells(records []biffRecord, sst []string, formats *biffNumberFormats) ([][]string, error) {
+	cells := map[int]map[int]string{}
+	maxRow := -1
+	set := func(row, col int, value string) {
+		if value == "" {
+			return
+		}
+		if _, ok := cells[row]; !ok {
+			cells[row] = map[int]string{}
+		}
+		cells[row][col] = value
+		if row > maxRow {
+			maxRow = row
+		}
+	}
+
+	// 公式结果为字符串时，值保存在紧随其后的 STRING 记录中
+	pendingRow, pendingCol := -1, -1
+
+	for _, rec := range records {
+		data := rec.data
+		switch rec.typ {
+		case biffRecordLabelSST:
+			if len(data) < 10 {
+				continue
+			}
+			idx := int(binary.LittleEndian.Uint32(data[6:]))
+			if idx < len(sst) {
+				set(int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), sst[idx])
+			}
+		case biffRecordLabel:
+			if len(data) < 9 {
+				continue
+			}
+			value, err := readXLUnicodeString(data[6:])
+			if err != nil {
+				return nil, err
+			}
+			set(int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), value)
+		case biffRecordNumber:
+			if len(data) < 14 {
+				continue
+			}
+			value := math.Float64frombits(binary.LittleEndian.Uint64(data[6:]))
+			set(int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), formats.format(binary.LittleEndian.Uint16(data[4:]), value))
+		case biffRecordRK:
+			if len(data) < 10 {
+				continue
+			}
+			value := decodeRK(binary.LittleEndian.Uint32(data[6:]))
+			set(int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), formats.format(binary.LittleEndian.Uint16(data[4:]), value))
+		case biffRecordMulRK:
+			if len(data) < 6 {
+				continue
+			}
+			row := int(binary.LittleEndian.Uint16(data))
+			col := int(binary.LittleEndian.Uint16(data[2:]))
+			for pos := 4; pos+6 <= len(data)-2; pos += 6 {
+				value := decodeRK(binary.LittleEndian.Uint32(data[pos+2:]))
+				set(row, col, formats.format(binary.LittleEndian.Uint16(data[pos:]), value))
+				col++
+			}
+		case biffRecordFormula:
+			if len(data) < 14 {
+				continue
+			}
+			row := int(binary.LittleEndian.Uint16(data))
+			col := int(binary.LittleEndian.Uint16(data[2:]))
+			result := data[6:14]
+			if result[6] != 0xFF || result[7] != 0xFF {
+				set(row, col, formats.format(binary.LittleEndian.Uint16(data[4:]), math.Float64frombits(binary.LittleEndian.Uint64(result))))
+				continue
+			}
+			switch result[0] {
+			case 0:
+				pendingRow, pendingCol = row, col
+			case 1:
+				set(row, col, formatBIFFBool(result[2]))
+			}
+		case biffRecordString:
+			if pendingRow < 0 {
+				continue
+			}
+			value, err := readXLUnicodeString(data)
+			if err != nil {
+				return nil, err
+			}
+			set(pendingRow, pendingCol, value)
+			pendingRow, pendingCol = -1, -1
+		case biffRecordBoolErr:
+			if len(data) < 8 || data[7] != 0 {
+				continue
+			}
+			set(int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), formatBIFFBool(data[6]))
+		}
+	}
+
+	rows := make([][]string, maxRow+1)
+	for rowIdx, cols := range cells {
+		maxCol := -1
+		for col := range cols {
+			if col > maxCol {
+				maxCol = col
+			}
+		}
+		row := make([]string, maxCol+1)
+		for col, value := range cols {
+			row[col] = value
+		}
+		rows[rowIdx] = row
+	}
+	return rows, nil
+}
+
+// readXLUnicodeString 读取 [字符数 uint16][标志 uint8][字符] 格式的字符串
+func readXLUnicodeString(data []byte) (string, error) {
+	if len(data) < 3 {
+		return "", errors.New("xls文件已损坏：字符串记录过短")
+	}
+	cch := int(binary.LittleEndian.Uint16(data))
+	wide := data[2]&0x01 != 0
+	width := 1
+	if wide {
+		width = 2
+	}
+	end := 3 + cch*width
+	if end > len(data) {
+		return "", errors.New("xls文件已损坏：字符串长度超出范围")
+	}
+	return decodeBIFFChars(data[3:end], wide), nil
+}
+
+func decodeBIFFChars(raw []byte, wide bool) string {
+	if !wide {
+		runes := make([]rune, len(raw))
+		for i, b := range raw {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(raw[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// sstReader 顺序读取被 CONTINUE 记录切分的共享字符串表
+type sstReader struct {
+	segments [][]byte
+	seg      int
+	pos      int
+}
+
+func (r *sstReader) ensure() error {
+	for r.seg < len(r.segments) && r.pos >= len(r.segments[r.seg]) {
+		r.seg++
+		r.pos = 0
+	}
+	if r.seg >= len(r.segments) {
+		return errors.New("xls文件已损坏：共享字符串表不完整")
+	}
+	return nil
+}
+
+// remaining 返回尚未读取的字节数
+func (r *sstReader) remaining() int {
+	total := 0
+	for i := r.seg; i < len(r.segments); i++ {
+		total += len(r.segments[i])
+	}
+	return total - r.pos
+}
+
+// bytes 读取 n 个字节；n 来自文件内容，超过剩余数据时直接报错，不按其预先分配内存
+func (r *sstReader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > r.remaining() {
+		return nil, errors.New("xls文件已损坏：共享字符串表不完整")
+	}
+	var out []byte
+	for len(out) < n {
+		if err := r.ensure(); err != nil {
+			return nil, err
+		}
+		seg := r.segments[r.seg]
+		take := n - len(out)
+		if avail := len(seg) - r.pos; take > avail {
+			take = avail
+		}
+		out = append(out, seg[r.pos:r.pos+take]...)
+		r.pos += take
+	}
+	return out, nil
+}
+
+// chars 读取字符数据；跨越 CONTINUE 边界时，新片段首字节重新声明字符宽度
+func (r *sstReader) chars(cch int, wide bool) (string, error) {
+	var result []rune
+	for cch > 0 {
+		if r.pos >= len(r.segments[r.seg]) {
+			r.seg++
+			r.pos = 0
+			if r.seg >= len(r.segments) || len(r.segments[r.seg]) == 0 {
+				return "", errors.New("xls文件已损坏：共享字符串表不完整")
+			}
+			wide = r.segments[r.seg][0]&0x01 != 0
+			r.pos = 1
+		}
+		width := 1
+		if wide {
+			width = 2
+		}
+		avail := (len(r.segments[r.seg]) - r.pos) / width
+		take := cch
+		if take > avail {
+			take = avail
+		}
+		if take == 0 {
+			return "", errors.New("xls文件已损坏：共享字符串被截断")
+		}
+		raw := r.segments[r.seg][r.pos : r.pos+take*width]
+		result = append(result, []rune(decodeBIFFChars(raw, wide))...)
+		r.pos += take * width
+		cch -= take
+	}
+	return string(result), nil
+}
+
+func parseSST(segments [][]byte) ([]string, error) {
+	reader := &sstReader{segments: segments}
+	header, err := reader.bytes(8)
+	if err != nil {
+		return nil, err
+	}
+	unique := int(binary.LittleEndian.Uint32(header[4:]))
+
+	// 每个字符串至少占3字节，声明的数量超出剩余数据能容纳的上限时文件已损坏
+	if unique > reader.remaining()/3 {
+		return nil, errors.New("xls文件已损坏：共享字符串数量超出记录长度")
+	}
+	strs := make([]string, 0, unique)
+	for i := 0; i < unique; i++ {
+		head, err := reader.bytes(3)
+		if err != nil {
+			return nil, err
+		}
+		cch := int(binary.LittleEndian.Uint16(head))
+		flags := head[2]
+
+		runs, extSize := 0, 0
+		if flags&0x08 != 0 {
+			b, err := reader.bytes(2)
+			if err != nil {
+				return nil, err
+			}
+			runs = int(binary.LittleEndian.Uint16(b))
+		}
+		if flags&0x04 != 0 {
+			b, err := reader.bytes(4)
+			if err != nil {
+				return nil, err
+			}
+			extSize = int(binary.LittleEndian.Uint32(b))
+		}
+
+		value, err := reader.chars(cch, flags&0x01 != 0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := reader.bytes(runs*4 + extSize); err != nil {
+			return nil, err
+		}
+		strs = append(strs, value)
+	}
+	return strs, nil
+}
+
+func decodeRK(rk uint32) float64 {
+	var value float64
+	if rk&0x02 != 0 {
+		value = float64(int32(rk) >> 2)
+	} else {
+		value = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		value /= 100
+	}
+	return value
+}
+
+func formatBIFFNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// biffNumberFormats 工作簿的单元格格式（XF）与数字格式（FORMAT）。按格式输出数值时借用 excelize 的格式化，
+// 使日期、百分比等单元格与 xlsx 文件读出的文字一致
+type biffNumberFormats struct {
+	xf       []uint16          // 按 XF 序号排列的数字格式编号
+	codes    map[uint16]string // 工作簿自定义的数字格式
+	date1904 bool
+
+	scratch *excelize.File
+	styles  map[uint16]int // 数字格式编号 → 临时工作簿中的样式，-1 表示无法识别
+}
+
+func newBIFFNumberFormats() *biffNumberFormats {
+	return &biffNumberFormats{codes: map[uint16]string{}, styles: map[uint16]int{}}
+}
+
+// format 按单元格 XF 对应的数字格式输出数值，常规格式或无法识别的格式按原值输出
+func (f *biffNumberFormats) format(ixfe uint16, value float64) string {
+	if int(ixfe) >= len(f.xf) || f.xf[ixfe] == 0 {
+		return formatBIFFNumber(value)
+	}
+	style := f.style(f.xf[ixfe])
+	if style < 0 {
+		return formatBIFFNumber(value)
+	}
+	sheet := f.scratch.GetSheetName(0)
+	if err := f.scratch.SetCellFloat(sheet, "A1", value, -1, 64); err != nil {
+		return formatBIFFNumber(value)
+	}
+	if err := f.scratch.SetCellStyle(sheet, "A1", "A1", style); err != nil {
+		return formatBIFFNumber(value)
+	}
+	text, err := f.scratch.GetCellValue(sheet, "A1")
+	if err != nil {
+		return formatBIFFNumber(value)
+	}
+	return text
+}
+
+// style 返回数字格式在临时工作簿中的样式；工作簿中定义的格式优先，否则按内置格式编号
+func (f *biffNumberFormats) style(ifmt uint16) int {
+	if style, ok := f.styles[ifmt]; ok {
+		return style
+	}
+	if f.scratch == nil {
+		f.scratch = excelize.NewFile()
+		_ = f.scratch.SetWorkbookProps(&excelize.WorkbookPropsOptions{Date1904: &f.date1904})
+	}
+	spec := &excelize.Style{NumFmt: int(ifmt)}
+	if code, ok := f.codes[ifmt]; ok {
+		spec = &excelize.Style{CustomNumFmt: &code}
+	}
+	style, err := f.scratch.NewStyle(spec)
+	if err != nil {
+		style = -1
+	}
+	f.styles[ifmt] = style
+	return style
+}
+
+func (f *biffNumberFormats) close() {
+	if f.scratch != nil {
+		_ = f.scratch.Close()
+	}
+}
+
+func formatBIFFBool(value byte) string {
+	if value != 0 {
+		return "TRUE"
+	}
+	return "FALSE"
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config configures an S3-compatible backend
+type S3Config struct {
+	Endpoint  string // host[:port], e.g. "s3.amazonaws.com" or "localhost:9000"
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// Prefix is prepended to every key, allowing several deployments to share a bucket
+	Prefix string
+}
+
+// S3 stores objects in an S3-compatible bucket so that every replica sees the
+// same files
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3FromEnv reads SIAPP_S3_ENDPOINT, SIAPP_S3_BUCKET, SIAPP_S3_ACCESS_KEY,
+// SIAPP_S3_SECRET_KEY and optionally SIAPP_S3_REGION, SIAPP_S3_USE_SSL
+// (default true) and SIAPP_S3_PREFIX
+func NewS3FromEnv() (*S3, error) {
+	cfg := S3Config{
+		Endpoint:  os.Getenv("SIAPP_S3_ENDPOINT"),
+		Region:    os.Getenv("SIAPP_S3_REGION"),
+		Bucket:    os.Getenv("SIAPP_S3_BUCKET"),
+		AccessKey: os.Getenv("SIAPP_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("SIAPP_S3_SECRET_KEY"),
+		UseSSL:    true,
+		Prefix:    os.Getenv("SIAPP_S3_PREFIX"),
+	}
+	if raw := os.Getenv("SIAPP_S3_USE_SSL"); raw != "" {
+		useSSL, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SIAPP_S3_USE_SSL: %w", err)
+		}
+		cfg.UseSSL = useSSL
+	}
+	return NewS3(context.Background(), cfg)
+}
+
+// NewS3 connects to the bucket and creates it if it does not exist yet
+func NewS3(ctx context.Context, cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("SIAPP_S3_ENDPOINT environment variable is required")
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("SIAPP_S3_BUCKET environment variable is required")
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create s3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check bucket %s: %w", cfg.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("create bucket %s: %w", cfg.Bucket, err)
+		}
+	}
+
+	return &S3{client: client, bucket: cfg.Bucket, prefix: strings.Trim(cfg.Prefix, "/")}, nil
+}
+
+func (s *S3) objectName(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return Key(s.prefix, key), nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) error {
+	name, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+	// Size -1 lets the client stream the upload in multipart chunks
+	if _, err := s.client.PutObject(ctx, s.bucket, name, r, -1, minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.objectName(key)
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat surfaces a missing key before the caller starts reading
+	if _, err := s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{}); err != nil {
+		if isNoSuchKey(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("stat %s: %w", key, err)
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", key, err)
+	}
+	return obj, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	name, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{}); err != nil && !isNoSuchKey(err) {
+		return fmt.Errorf("delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3) DeletePrefix(ctx context.Context, prefix string) error {
+	prefix = strings.Trim(prefix, "/")
+	if err := validateKey(prefix); err != nil {
+		return err
+	}
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    Key(s.prefix, prefix) + "/",
+		Recursive: true,
+	})
+	for result := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			return fmt.Errorf("delete %s: %w", result.ObjectName, result.Err)
+		}
+	}
+	return nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	listPrefix := Key(s.prefix, prefix)
+	if s.prefix != "" && prefix == "" {
+		listPrefix += "/"
+	}
+	var objects []Object
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: listPrefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, info.Err)
+		}
+		key := info.Key
+		if s.prefix != "" {
+			key = strings.TrimPrefix(key, s.prefix+"/")
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size, ModTime: info.LastModified})
+	}
+	return objects, nil
+}
+
+func isNoSuchKey(err error) bool {
+	return minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a key does not exist in the storage backend
+var ErrNotFound = errors.New("storage: object not found")
+
+// Object describes a stored file
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage stores uploaded files under slash-separated keys such as
+// "companies/acme/periods/3/4f1c….xlsx". Keys never start with "/" and never
+// contain "..", so the same key works for local disk and object storage.
+type Storage interface {
+	// Put writes the content of r to key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open returns the content of key, or ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix removes every object below the directory-like prefix, so
+	// "periods/3" removes "periods/3/a.xlsx" but not "periods/30/b.xlsx"
+	DeletePrefix(ctx context.Context, prefix string) error
+	// List returns every object whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// localPather is implemented by backends whose objects are plain files, so
+// readers can open them in place instead of copying to a temporary file
+type localPather interface {
+	LocalPath(key string) (string, error)
+}
+
+// Key joins path segments into a storage key, dropping empty segments
+func Key(parts ...string) string {
+	cleaned := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = strings.Trim(strings.ReplaceAll(part, "\\", "/"), "/")
+		if part != "" {
+			cleaned = append(cleaned, part)
+		}
+	}
+	return strings.Join(cleaned, "/")
+}
+
+// TenantPrefix returns the key prefix isolating one tenant's files: the company
+// when the user belongs to one, otherwise the user itself
+func TenantPrefix(companyID string, userID *uint) string {
+	if companyID = strings.TrimSpace(companyID); companyID != "" {
+		return Key("companies", sanitizeSegment(companyID))
+	}
+	if userID != nil {
+		return Key("users", fmt.Sprintf("%d", *userID))
+	}
+	return "shared"
+}
+
+// sanitizeSegment keeps a tenant identifier usable as a single key segment
+func sanitizeSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.ReplaceAll(s, "..", "_"))
+}
+
+// validateKey rejects keys that could escape the storage root
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." || segment == "." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	if path.Clean(key) != key {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	return nil
+}
+
+// Fetch makes the object at key available as a local file, as the spreadsheet
+// readers need random access. Local backends return the file itself; other
+// backends download into a temporary file that cleanup removes.
+func Fetch(ctx context.Context, s Storage, key string) (localPath string, cleanup func(), err error) {
+	if lp, ok := s.(localPather); ok {
+		p, err := lp.LocalPath(key)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := os.Stat(p); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return "", nil, ErrNotFound
+			}
+			return "", nil, err
+		}
+		return p, func() {}, nil
+	}
+
+	src, err := s.Open(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() { _ = src.Close() }()
+
+	tmp, err := os.CreateTemp("", "siapp-*"+filepath.Ext(key))
+	if err != nil {
+		return "", nil, fmt.Errorf("create temp file: %w", err)
+	}
+	cleanup = func() { _ = os.Remove(tmp.Name()) }
+	if _, err := io.Copy(tmp, src); err != nil {
+		_ = tmp.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("download %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("download %s: %w", key, err)
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// NewFromEnv creates the storage backend selected by SIAPP_STORAGE:
+//
+//   - "local" (default): files under SIAPP_STORAGE_DIR (default ./uploads)
+//   - "s3": an S3-compatible bucket (AWS S3, MinIO) configured by SIAPP_S3_*
+func NewFromEnv() (Storage, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("SIAPP_STORAGE"))); backend {
+	case "", "local":
+		dir := os.Getenv("SIAPP_STORAGE_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		return NewLocal(dir)
+	case "s3":
+		return NewS3FromEnv()
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s (supported: local, s3)", backend)
+	}
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exerciseStorage 对任意后端执行相同的读写、列举与删除检查
+func exerciseStorage(t *testing.T, s Storage) {
+	t.Helper()
+	ctx := context.Background()
+
+	files := map[string]string{
+		"companies/acme/periods/3/a.xlsx":             "a",
+		"companies/acme/periods/3/adjustments/b.xlsx": "b",
+		"companies/acme/periods/30/c.xlsx":            "c",
+	}
+	for key, content := range files {
+		if err := s.Put(ctx, key, strings.NewReader(content)); err != nil {
+			t.Fatalf("写入 %s 失败: %v", key, err)
+		}
+	}
+
+	rc, err := s.Open(ctx, "companies/acme/periods/3/a.xlsx")
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(data) != "a" {
+		t.Errorf("读取内容不符: %q", data)
+	}
+
+	path, cleanup, err := Fetch(ctx, s, "companies/acme/periods/3/adjustments/b.xlsx")
+	if err != nil {
+		t.Fatalf("取到本地失败: %v", err)
+	}
+	local, _ := os.ReadFile(path)
+	cleanup()
+	if string(local) != "b" {
+		t.Errorf("本地文件内容不符: %q", local)
+	}
+
+	if _, err := s.Open(ctx, "companies/acme/periods/3/missing.xlsx"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("不存在的文件应返回 ErrNotFound，实际 %v", err)
+	}
+
+	objects, err := s.List(ctx, "companies/acme/")
+	if err != nil {
+		t.Fatalf("列举失败: %v", err)
+	}
+	if len(objects) != len(files) {
+		t.Errorf("应列出 %d 个文件，实际 %+v", len(files), objects)
+	}
+
+	// 按目录删除，不影响前缀相同的其他账期
+	if err := s.DeletePrefix(ctx, "companies/acme/periods/3"); err != nil {
+		t.Fatalf("按前缀删除失败: %v", err)
+	}
+	objects, _ = s.List(ctx, "companies/acme/")
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	sort.Strings(keys)
+	if len(keys) != 1 || keys[0] != "companies/acme/periods/30/c.xlsx" {
+		t.Errorf("删除后剩余文件不符: %v", keys)
+	}
+
+	if err := s.Delete(ctx, "companies/acme/periods/30/c.xlsx"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := s.Delete(ctx, "companies/acme/periods/30/c.xlsx"); err != nil {
+		t.Errorf("删除不存在的文件不应报错: %v", err)
+	}
+
+	if err := s.Put(ctx, "../escape.xlsx", strings.NewReader("x")); err == nil {
+		t.Error("包含 .. 的 key 应被拒绝")
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	s, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	exerciseStorage(t, s)
+}
+
+// TestS3Storage 需要可访问的 S3 兼容服务，例如本地 MinIO：
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	SIAPP_TEST_S3_ENDPOINT=localhost:9000 SIAPP_TEST_S3_ACCESS_KEY=minioadmin SIAPP_TEST_S3_SECRET_KEY=minioadmin go test ./internal/storage
+func TestS3Storage(t *testing.T) {
+	endpoint := os.Getenv("SIAPP_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("未设置 SIAPP_TEST_S3_ENDPOINT，跳过 S3 测试")
+	}
+	bucket := os.Getenv("SIAPP_TEST_S3_BUCKET")
+	if bucket == "" {
+		bucket = "siapp-test"
+	}
+	s, err := NewS3(context.Background(), S3Config{
+		Endpoint:  endpoint,
+		Bucket:    bucket,
+		AccessKey: os.Getenv("SIAPP_TEST_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("SIAPP_TEST_S3_SECRET_KEY"),
+		UseSSL:    os.Getenv("SIAPP_TEST_S3_USE_SSL") == "true",
+		Prefix:    fmt.Sprintf("test-%d", time.Now().UnixNano()),
+	})
+	if err != nil {
+		t.Fatalf("连接 S3 失败: %v", err)
+	}
+	exerciseStorage(t, s)
+}
+
+func TestTenantPrefix(t *testing.T) {
+	userID := uint(7)
+	cases := []struct {
+		company string
+		user    *uint
+		want    string
+	}{
+		{"acme", &userID, "companies/acme"},
+		{"a/../b", nil, "companies/a___b"},
+		{"", &userID, "users/7"},
+		{"", nil, "shared"},
+	}
+	for _, tc := range cases {
+		if got := TenantPrefix(tc.company, tc.user); got != tc.want {
+			t.Errorf("TenantPrefix(%q) = %q，期望 %q", tc.company, got, tc.want)
+		}
+	}
+	if got := Key("companies/acme/", "", "/periods", "3"); got != "companies/acme/periods/3" {
+		t.Errorf("Key 拼接结果不符: %q", got)
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -24,6 +27,7 @@ import (
 	auditmw "siapp/internal/middleware"
 	"siapp/internal/models"
 	"siapp/internal/service"
+	"siapp/internal/storage"
 	"siapp/internal/supabase"
 )
 
@@ -177,6 +181,43 @@ func initializeDefaultAdmin(db *gorm.DB) error {
 	return nil
 }
 
+// grantApprovers grants approver rights to the usernames in SIAPP_APPROVERS (comma-separated)
+// whose company has no approver yet. It only bootstraps the first approvers of a company and never
+// revokes rights; later changes go through PUT /api/users/{id}/approver.
+func grantApprovers(db *gorm.DB) error {
+	var usernames []string
+	for _, name := range strings.Split(os.Getenv("SIAPP_APPROVERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			usernames = append(usernames, name)
+		}
+	}
+	if len(usernames) == 0 {
+		return nil
+	}
+	result := db.Model(&models.User{}).
+		Where("username IN ? AND approver = ?", usernames, false).
+		Where("company_id NOT IN (?)", db.Model(&models.User{}).Select("company_id").Where("approver = ? AND company_id IS NOT NULL", true)).
+		Update("approver", true)
+	if result.Error != nil {
+		return fmt.Errorf("grant approvers: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Approver rights granted to %d user(s) from SIAPP_APPROVERS", result.RowsAffected)
+	}
+	return nil
+}
+
+// jobWorkers returns the background worker count from SIAPP_JOB_WORKERS (default 2)
+func jobWorkers() int {
+	if raw := os.Getenv("SIAPP_JOB_WORKERS"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			return n
+		}
+		log.Printf("invalid SIAPP_JOB_WORKERS %q, using default", raw)
+	}
+	return 2
+}
+
 func main() {
 	db, err := connectDatabase()
 	if err != nil {
@@ -193,8 +234,17 @@ func main() {
 		&models.PeriodSummary{},
 		&models.PersonalCharge{},
 		&models.UnitCharge{},
+		&models.HousingFundCharge{},
 		&models.RosterEntry{},
 		&models.Employee{},
+		&models.HeaderProfile{},
+		&models.HeaderMapping{},
+		&models.SchemeDefinition{},
+		&models.ContributionRuleSet{},
+		&models.CostCenterMapping{},
+		&models.CostCenterSplit{},
+		&models.Job{},
+		&models.PeriodApproval{},
 		&models.AuditLog{}, // Add audit log table
 	); err != nil {
 		log.Fatalf("auto migrate: %v", err)
@@ -205,6 +255,14 @@ func main() {
 		log.Fatalf("initialize default admin: %v", err)
 	}
 
+	if err := grantApprovers(db); err != nil {
+		log.Fatalf("grant approvers: %v", err)
+	}
+
+	if err := service.MigrateLegacyRounding(db); err != nil {
+		log.Fatalf("migrate contribution rounding: %v", err)
+	}
+
 	// Create JWT manager
 	jwtManager := auth.NewJWTManager()
 
@@ -215,8 +273,23 @@ func main() {
 	emailService := service.NewEmailService()
 	monitoringService := service.NewMonitoringService(db)
 
+	// File storage for uploaded workbooks (local disk or S3-compatible)
+	store, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatalf("init file storage: %v", err)
+	}
+	if err := service.MigrateLegacyStoredPaths(db); err != nil {
+		log.Fatalf("migrate stored paths: %v", err)
+	}
+
+	// Background jobs: requeue or fail jobs whose runner stopped heartbeating
+	jobRunner := service.NewJobRunner(db, jobWorkers())
+	if err := jobRunner.Recover(); err != nil {
+		log.Fatalf("recover jobs: %v", err)
+	}
+
 	// Create handlers
-	handler := api.NewHandler(db)
+	handler := api.NewHandler(db, jobRunner, store)
 	authHandler := api.NewAuthHandler(db, jwtManager, passwordResetService, emailVerificationService, emailService)
 	auditHandler := api.NewAuditHandler(db, auditService)
 	monitoringHandler := api.NewMonitoringHandler(db, monitoringService)
@@ -247,6 +320,12 @@ func main() {
 		},
 	)
 
+	// Background work stops on SIGINT/SIGTERM; resumable jobs interrupted by the shutdown are requeued
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	jobRunner.Start(ctx)
+	service.NewProcessor(db, store).StartFileRetention(ctx, service.FileRetentionFromEnv())
+
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
@@ -326,7 +405,27 @@ func main() {
 		dbTypeForLog = "sqlite"
 	}
 	log.Printf("social insurance server listening on %s (db: %s)", addr, dbTypeForLog)
-	if err := http.ListenAndServe(addr, r); err != nil {
+	server := &http.Server{Addr: addr, Handler: r}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		stop()
+		jobRunner.Wait()
 		log.Fatalf("server stopped: %v", err)
+	case <-ctx.Done():
+		log.Printf("shutting down")
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown server: %v", err)
 	}
+	jobRunner.Wait()
+	log.Printf("background jobs stopped")
 }
@@ -25,6 +25,7 @@ import {
 import type {
   Part,
   Period,
+  PeriodStatus,
   PeriodSummary,
   PersonalCharge,
   Scheme,
@@ -87,14 +88,15 @@ const SCHEME_LABELS: Record<Scheme, string> = {
   serious_illness: "大额医疗",
   unemployment: "失业保险",
   injury: "工伤保险",
+  housing_fund: "住房公积金",
 };
 
-const STATUS_LABELS: Record<string, string> = {
+const STATUS_LABELS: Record<PeriodStatus, string> = {
   draft: "草稿",
-  processing: "处理中",
+  uploaded: "已上传",
   processed: "已处理",
-  completed: "已完成",
-  archived: "已归档",
+  reviewed: "已审核",
+  closed: "已关账",
 };
 
 const SCHEME_OPTIONS: Array<{
@@ -681,6 +683,9 @@ export function InsuranceManagement({ className }: InsuranceManagementProps) {
     try {
       const result = await processPeriod(selectedPeriodId);
       toast.success("数据处理成功");
+      if (result.rounding_notice) {
+        toast.warning(result.rounding_notice);
+      }
       setSummary(result.summary);
       setPersonalCharges(applyEmployeeDepartment(result.personal));
       setUnitCharges(applyEmployeeDepartment(result.unit));
@@ -717,7 +722,7 @@ export function InsuranceManagement({ className }: InsuranceManagementProps) {
       const blob = await downloadSchemeChargesExcel(selectedPeriodId, selectedScheme, selectedPart);
       const url = URL.createObjectURL(blob);
       const link = document.createElement("a");
-      const schemeLabel = SCHEME_LABELS[selectedScheme];
+      const schemeLabel = SCHEME_LABELS[selectedScheme] ?? selectedScheme;
       const partLabel = selectedPart === "personal" ? "个人" : "单位";
       link.href = url;
       link.download = `${selectedPeriod?.year_month ?? "period"}-${schemeLabel}-${partLabel}明细.xlsx`;
@@ -873,10 +878,10 @@ export function InsuranceManagement({ className }: InsuranceManagementProps) {
                     <Badge
                       className={`text-xs font-medium ${
                         selectedPeriod.status === 'draft' ? 'bg-gray-100 text-gray-700 border-gray-300' :
-                        selectedPeriod.status === 'processing' ? 'bg-blue-100 text-blue-700 border-blue-300' :
+                        selectedPeriod.status === 'uploaded' ? 'bg-blue-100 text-blue-700 border-blue-300' :
                         selectedPeriod.status === 'processed' ? 'bg-green-100 text-green-700 border-green-300' :
-                        selectedPeriod.status === 'completed' ? 'bg-emerald-100 text-emerald-700 border-emerald-300' :
-                        selectedPeriod.status === 'archived' ? 'bg-orange-100 text-orange-700 border-orange-300' :
+                        selectedPeriod.status === 'reviewed' ? 'bg-emerald-100 text-emerald-700 border-emerald-300' :
+                        selectedPeriod.status === 'closed' ? 'bg-orange-100 text-orange-700 border-orange-300' :
                         'bg-gray-100 text-gray-700 border-gray-300'
                       }`}
                       variant="outline"
@@ -1069,7 +1074,7 @@ export function InsuranceManagement({ className }: InsuranceManagementProps) {
                               key={`${item.part}-${item.scheme}-${index}`}
                               className="flex items-center justify-between rounded-md border bg-muted/40 px-3 py-2"
                             >
-                              <span>{SCHEME_LABELS[item.scheme]}</span>
+                              <span>{SCHEME_LABELS[item.scheme] ?? item.scheme}</span>
                               <Badge>{PART_LABELS[item.part]}</Badge>
                             </div>
                           ))}
@@ -1339,7 +1344,7 @@ export function InsuranceManagement({ className }: InsuranceManagementProps) {
                               )
                               .map((file) => (
                                 <TableRow key={file.id}>
-                                  <TableCell>{SCHEME_LABELS[file.scheme]}</TableCell>
+                                  <TableCell>{SCHEME_LABELS[file.scheme] ?? file.scheme}</TableCell>
                                   <TableCell>{PART_LABELS[file.part]}</TableCell>
                                   <TableCell>{file.rows}</TableCell>
                                   <TableCell>{formatDate(file.uploaded_at)}</TableCell>
@@ -1554,7 +1559,7 @@ export function InsuranceManagement({ className }: InsuranceManagementProps) {
                                 <TableCell className="max-w-xs truncate" title={file.original_name}>
                                   {file.original_name}
                                 </TableCell>
-                                <TableCell>{SCHEME_LABELS[file.scheme]}</TableCell>
+                                <TableCell>{SCHEME_LABELS[file.scheme] ?? file.scheme}</TableCell>
                                 <TableCell>{PART_LABELS[file.part]}</TableCell>
                                 <TableCell>{file.rows}</TableCell>
                                 <TableCell>{formatDate(file.uploaded_at)}</TableCell>
@@ -1627,7 +1632,7 @@ export function InsuranceManagement({ className }: InsuranceManagementProps) {
                                     className="group inline-flex items-center gap-1 font-medium text-foreground transition-colors hover:text-primary focus:outline-none focus:ring-2 focus:ring-ring focus:ring-offset-2 rounded-sm px-1 py-0.5"
                                   >
                                     <span className="group-hover:text-primary transition-colors">
-                                      {SCHEME_LABELS[item.scheme]}
+                                      {SCHEME_LABELS[item.scheme] ?? item.scheme}
                                     </span>
                                     <svg
                                       className="w-3 h-3 opacity-0 group-hover:opacity-100 transition-opacity text-primary"
@@ -2002,7 +2007,7 @@ export function InsuranceManagement({ className }: InsuranceManagementProps) {
             <DialogTitle>
               {selectedScheme && selectedPart && (
                 <>
-                  {SCHEME_LABELS[selectedScheme]} - {selectedPart === "personal" ? "个人" : "单位"} 明细
+                  {SCHEME_LABELS[selectedScheme] ?? selectedScheme} - {selectedPart === "personal" ? "个人" : "单位"} 明细
                 </>
               )}
             </DialogTitle>
@@ -1,16 +1,36 @@
 "use client";
 
 import type {
+  AllocationGroup,
+  AllocationReport,
+  ArrearsLedger,
   AuditLog,
   AuditStats,
   BatchUploadItem,
+  ContributionCheckResult,
+  ContributionRuleSet,
+  ContributionStatement,
+  CostCenterMapping,
+  CostCenterShare,
+  CostCenterSplit,
   DatabaseStatus,
+  HousingFundCharge,
+  Job,
+  MissingUpload,
   Part,
+  PendingApproval,
   Period,
+  PeriodAdjustments,
+  PeriodApproval,
+  PeriodApprovalState,
+  PeriodDiff,
   PeriodSummary,
   PersonalCharge,
+  RateIssue,
+  ReconciliationReport,
   RosterEntry,
   Scheme,
+  SchemeDefinition,
   SourceFile,
   SystemInfo,
   SystemMetrics,
@@ -201,14 +221,174 @@ export async function resendVerificationEmail(email: string): Promise<{ message:
   );
 }
 
-export async function createPeriod(yearMonth: string, allowAdjustments = true): Promise<Period> {
+export async function createPeriod(yearMonth: string, allowAdjustments = true, city?: string): Promise<Period> {
   return request<Period>("/periods", {
     method: "POST",
     headers: { "Content-Type": "application/json" },
-    body: JSON.stringify({ year_month: yearMonth, allow_adjustments: allowAdjustments }),
+    body: JSON.stringify({ year_month: yearMonth, allow_adjustments: allowAdjustments, city }),
   });
 }
 
+export async function listSchemes(): Promise<SchemeDefinition[]> {
+  return request<SchemeDefinition[]>("/schemes");
+}
+
+export type SchemeDefinitionInput = Omit<SchemeDefinition, "id" | "builtin" | "enabled"> & { enabled?: boolean };
+
+export async function createScheme(input: SchemeDefinitionInput): Promise<SchemeDefinition> {
+  return request<SchemeDefinition>("/schemes", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(input),
+  });
+}
+
+export async function updateScheme(schemeId: number, input: SchemeDefinitionInput): Promise<SchemeDefinition> {
+  return request<SchemeDefinition>(`/schemes/${schemeId}`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(input),
+  });
+}
+
+export async function deleteScheme(schemeId: number): Promise<{ message: string }> {
+  return request<{ message: string }>(`/schemes/${schemeId}`, { method: "DELETE" });
+}
+
+export type ContributionRuleSetInput = Omit<ContributionRuleSet, "id" | "created_at" | "updated_at">;
+
+export async function listContributionRules(city?: string): Promise<ContributionRuleSet[]> {
+  const query = city ? `?city=${encodeURIComponent(city)}` : "";
+  return request<ContributionRuleSet[]>(`/contribution-rules${query}`);
+}
+
+export async function createContributionRule(input: ContributionRuleSetInput): Promise<ContributionRuleSet> {
+  return request<ContributionRuleSet>("/contribution-rules", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(input),
+  });
+}
+
+export async function updateContributionRule(ruleId: number, input: ContributionRuleSetInput): Promise<ContributionRuleSet> {
+  return request<ContributionRuleSet>(`/contribution-rules/${ruleId}`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(input),
+  });
+}
+
+export async function deleteContributionRule(ruleId: number): Promise<{ message: string }> {
+  return request<{ message: string }>(`/contribution-rules/${ruleId}`, { method: "DELETE" });
+}
+
+export async function checkContributions(periodId: number, city?: string): Promise<ContributionCheckResult> {
+  const query = city ? `?city=${encodeURIComponent(city)}` : "";
+  return request<ContributionCheckResult>(`/periods/${periodId}/contribution-check${query}`);
+}
+
+export async function listCostCenterMappings(): Promise<CostCenterMapping[]> {
+  return request<CostCenterMapping[]>("/cost-centers/mappings");
+}
+
+export type CostCenterMappingInput = Pick<CostCenterMapping, "department" | "cost_center" | "cost_center_name">;
+
+export async function createCostCenterMapping(input: CostCenterMappingInput): Promise<CostCenterMapping> {
+  return request<CostCenterMapping>("/cost-centers/mappings", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(input),
+  });
+}
+
+export async function updateCostCenterMapping(mappingId: number, input: CostCenterMappingInput): Promise<CostCenterMapping> {
+  return request<CostCenterMapping>(`/cost-centers/mappings/${mappingId}`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(input),
+  });
+}
+
+export async function deleteCostCenterMapping(mappingId: number): Promise<{ message: string }> {
+  return request<{ message: string }>(`/cost-centers/mappings/${mappingId}`, { method: "DELETE" });
+}
+
+export async function listCostCenterSplits(): Promise<CostCenterSplit[]> {
+  return request<CostCenterSplit[]>("/cost-centers/splits");
+}
+
+export interface CostCenterSplitInput {
+  id_number: string;
+  name: string;
+  shares: CostCenterShare[];
+}
+
+export async function createCostCenterSplit(input: CostCenterSplitInput): Promise<CostCenterSplit> {
+  return request<CostCenterSplit>("/cost-centers/splits", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(input),
+  });
+}
+
+export async function updateCostCenterSplit(splitId: number, input: CostCenterSplitInput): Promise<CostCenterSplit> {
+  return request<CostCenterSplit>(`/cost-centers/splits/${splitId}`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(input),
+  });
+}
+
+export async function deleteCostCenterSplit(splitId: number): Promise<{ message: string }> {
+  return request<{ message: string }>(`/cost-centers/splits/${splitId}`, { method: "DELETE" });
+}
+
+// 分摊报表范围：指定 periodId，或 from / to 月份范围
+export interface AllocationQuery {
+  periodId?: number;
+  from?: string;
+  to?: string;
+  groupBy?: AllocationGroup;
+}
+
+function allocationParams(query: AllocationQuery): URLSearchParams {
+  const params = new URLSearchParams();
+  if (query.periodId) params.set("period_id", String(query.periodId));
+  if (query.from) params.set("from", query.from);
+  if (query.to) params.set("to", query.to);
+  if (query.groupBy) params.set("group_by", query.groupBy);
+  return params;
+}
+
+export async function getAllocationReport(query: AllocationQuery): Promise<AllocationReport> {
+  return request<AllocationReport>(`/allocation?${allocationParams(query)}`);
+}
+
+export async function downloadAllocationReport(query: AllocationQuery, format: "xlsx" | "json" = "xlsx"): Promise<Blob> {
+  const token = localStorage.getItem("token");
+  const headers: Record<string, string> = token ? { Authorization: `Bearer ${token}` } : {};
+  const params = allocationParams(query);
+  if (format === "json") params.set("format", "json");
+
+  const res = await fetch(`${API_BASE}/allocation/export?${params}`, {
+    headers,
+    cache: "no-store",
+  });
+
+  if (!res.ok) {
+    let detail = await res.text();
+    try {
+      const data = JSON.parse(detail);
+      detail = data?.error || detail;
+    } catch {
+      // ignore
+    }
+    throw new Error(detail || "导出失败");
+  }
+
+  return res.blob();
+}
+
 export async function listFiles(periodId: number): Promise<SourceFile[]> {
   return request<SourceFile[]>(`/periods/${periodId}/files`);
 }
@@ -258,6 +438,93 @@ export async function uploadSourceFile({
   return (await res.json()) as { file: SourceFile; imported: number };
 }
 
+export async function downloadSourceFile(periodId: number, fileId: number): Promise<Blob> {
+  const token = localStorage.getItem("token");
+  const headers: Record<string, string> = token ? { Authorization: `Bearer ${token}` } : {};
+
+  const res = await fetch(`${API_BASE}/periods/${periodId}/files/${fileId}/download`, {
+    headers,
+    cache: "no-store",
+  });
+
+  if (!res.ok) {
+    let detail = await res.text();
+    try {
+      const data = JSON.parse(detail);
+      detail = data?.error || detail;
+    } catch {
+      // ignore
+    }
+    throw new Error(detail || "原始文件下载失败");
+  }
+
+  return res.blob();
+}
+
+export async function listFileVersions(periodId: number, scheme?: Scheme, part?: Part): Promise<SourceFile[]> {
+  const params = new URLSearchParams();
+  if (scheme) params.set("scheme", scheme);
+  if (part) params.set("part", part);
+  const query = params.toString();
+  return request<SourceFile[]>(`/periods/${periodId}/files/versions${query ? `?${query}` : ""}`);
+}
+
+export async function activateFileVersion(periodId: number, fileId: number): Promise<SourceFile> {
+  return request<SourceFile>(`/periods/${periodId}/files/${fileId}/activate`, { method: "POST" });
+}
+
+export async function reparseSourceFile(
+  periodId: number,
+  fileId: number,
+  headerProfileId?: number,
+): Promise<{ file: SourceFile; imported: number; rejected: number }> {
+  let url = `/periods/${periodId}/files/${fileId}/reparse`;
+  if (headerProfileId !== undefined) {
+    url += `?header_profile_id=${headerProfileId}`;
+  }
+  return request<{ file: SourceFile; imported: number; rejected: number }>(url, { method: "POST" });
+}
+
+export async function uploadHousingFundFile(
+  periodId: number,
+  file: File,
+  headerProfileId?: number,
+): Promise<{ file: SourceFile; imported: number }> {
+  const formData = new FormData();
+  formData.append("file", file);
+  if (headerProfileId !== undefined) {
+    formData.append("header_profile_id", String(headerProfileId));
+  }
+
+  const token = localStorage.getItem("token");
+  const headers: Record<string, string> = token ? { Authorization: `Bearer ${token}` } : {};
+
+  const res = await fetch(`${API_BASE}/periods/${periodId}/housing-fund`, {
+    method: "POST",
+    headers,
+    body: formData,
+  });
+
+  if (!res.ok) {
+    let detail = await res.text();
+    try {
+      const data = JSON.parse(detail);
+      detail = data?.error || detail;
+    } catch {
+      // ignore
+    }
+    throw new Error(detail || "公积金文件上传失败");
+  }
+
+  return (await res.json()) as { file: SourceFile; imported: number };
+}
+
+export async function getHousingFund(
+  periodId: number,
+): Promise<{ summary: PeriodSummary[]; charges: HousingFundCharge[] }> {
+  return request<{ summary: PeriodSummary[]; charges: HousingFundCharge[] }>(`/periods/${periodId}/housing-fund`);
+}
+
 export async function uploadRoster(
   periodId: number,
   file: File,
@@ -403,9 +670,80 @@ export async function importEmployees(file: File, token: string): Promise<Employ
   return (await res.json()) as EmployeeImportResponse;
 }
 
+export async function getEmployeeContributions(idNumber: string, year: number): Promise<ContributionStatement> {
+  return request<ContributionStatement>(`/employees/${encodeURIComponent(idNumber)}/contributions?year=${year}`);
+}
+
+export async function getEmployeeArrears(idNumber: string, from = "", to = ""): Promise<ArrearsLedger> {
+  const params = new URLSearchParams();
+  if (from) params.set("from", from);
+  if (to) params.set("to", to);
+  return request<ArrearsLedger>(`/employees/${encodeURIComponent(idNumber)}/arrears?${params}`);
+}
+
+// 补退台账导出
+export async function downloadArrearsLedger(idNumbers: string[] = [], from = "", to = ""): Promise<Blob> {
+  const token = localStorage.getItem("token");
+  const headers: Record<string, string> = token ? { Authorization: `Bearer ${token}` } : {};
+  const params = new URLSearchParams();
+  if (idNumbers.length > 0) params.set("id_number", idNumbers.join(","));
+  if (from) params.set("from", from);
+  if (to) params.set("to", to);
+
+  const res = await fetch(`${API_BASE}/employees/arrears/export?${params}`, {
+    headers,
+    cache: "no-store",
+  });
+
+  if (!res.ok) {
+    let detail = await res.text();
+    try {
+      const data = JSON.parse(detail);
+      detail = data?.error || detail;
+    } catch {
+      // ignore
+    }
+    throw new Error(detail || "导出失败");
+  }
+
+  return res.blob();
+}
+
+// 年度缴费明细导出：format 为 xlsx 时下载 Excel，为 html 时返回可打印的缴费证明
+export async function downloadContributionStatements(
+  year: number,
+  idNumbers: string[] = [],
+  format: "xlsx" | "html" = "xlsx"
+): Promise<Blob> {
+  const token = localStorage.getItem("token");
+  const headers: Record<string, string> = token ? { Authorization: `Bearer ${token}` } : {};
+  const params = new URLSearchParams({ year: String(year) });
+  if (idNumbers.length > 0) params.set("id_number", idNumbers.join(","));
+  const path = format === "html" ? "statements" : "export";
+
+  const res = await fetch(`${API_BASE}/employees/contributions/${path}?${params}`, {
+    headers,
+    cache: "no-store",
+  });
+
+  if (!res.ok) {
+    let detail = await res.text();
+    try {
+      const data = JSON.parse(detail);
+      detail = data?.error || detail;
+    } catch {
+      // ignore
+    }
+    throw new Error(detail || "导出失败");
+  }
+
+  return res.blob();
+}
+
 interface BatchUploadParams {
   periodId: number;
-  items: Array<{ scheme: Scheme; part: Part; file: File }>;
+  // scheme/part 留空时由后端按文件名与内容识别
+  items: Array<{ scheme?: Scheme; part?: Part; file: File }>;
 }
 
 export async function uploadSourceFilesBatch({
@@ -414,8 +752,8 @@ export async function uploadSourceFilesBatch({
 }: BatchUploadParams): Promise<{ items: BatchUploadItem[] }> {
   const formData = new FormData();
   items.forEach((item) => {
-    formData.append("scheme", item.scheme);
-    formData.append("part", item.part);
+    formData.append("scheme", item.scheme ?? "");
+    formData.append("part", item.part ?? "");
     formData.append("files", item.file);
   });
 
@@ -439,16 +777,115 @@ export async function uploadSourceFilesBatch({
     throw new Error(detail || "批量上传失败");
   }
 
-  return (await res.json()) as { items: BatchUploadItem[] };
+  const job = (await res.json()) as Job<{ items: BatchUploadItem[] }>;
+  return waitForJob(job.id);
 }
 
-export async function processPeriod(periodId: number): Promise<{
+const JOB_POLL_INTERVAL_MS = 1500;
+
+export async function getJob<T = unknown>(jobId: number): Promise<Job<T>> {
+  return request<Job<T>>(`/jobs/${jobId}`);
+}
+
+export async function listJobs(params?: { status?: string; periodId?: number }): Promise<Job[]> {
+  const search = new URLSearchParams();
+  if (params?.status) search.set("status", params.status);
+  if (params?.periodId) search.set("period_id", String(params.periodId));
+  const query = search.toString();
+  return request<Job[]>(`/jobs${query ? `?${query}` : ""}`);
+}
+
+// 轮询后台任务直到完成，成功时返回任务结果，失败时抛出任务错误
+export async function waitForJob<T>(
+  jobId: number,
+  onProgress?: (job: Job<T>) => void,
+): Promise<T> {
+  for (;;) {
+    const job = await getJob<T>(jobId);
+    onProgress?.(job);
+    if (job.status === "succeeded") {
+      return job.result as T;
+    }
+    if (job.status === "failed") {
+      throw new Error(job.error || "任务执行失败");
+    }
+    await new Promise((resolve) => setTimeout(resolve, JOB_POLL_INTERVAL_MS));
+  }
+}
+
+// provisional 为 true 时缺少必需险种也按已上传的文件预估处理
+export async function processPeriod(periodId: number, provisional = false): Promise<{
   period_id: number;
   summary: PeriodSummary[];
   personal: PersonalCharge[];
   unit: UnitCharge[];
+  housing_fund?: HousingFundCharge[];
+  rate_issues?: RateIssue[];
+  provisional?: boolean;
+  missing?: MissingUpload[];
+  rounding_notice?: string;
 }> {
-  return request(`/periods/${periodId}/process`, { method: "POST" });
+  const query = provisional ? "?mode=provisional" : "";
+  const job = await request<Job>(`/periods/${periodId}/process${query}`, { method: "POST" });
+  return waitForJob(job.id);
+}
+
+export async function reviewPeriod(periodId: number): Promise<Period> {
+  return request(`/periods/${periodId}/review`, { method: "POST" });
+}
+
+export async function closePeriod(periodId: number): Promise<Period> {
+  return request(`/periods/${periodId}/close`, { method: "POST" });
+}
+
+// 重新打开已关账的账期，reason 必填并写入审计日志
+export async function reopenPeriod(periodId: number, reason: string): Promise<Period> {
+  return request(`/periods/${periodId}/reopen`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ reason }),
+  });
+}
+
+export async function getApproval(periodId: number): Promise<PeriodApprovalState> {
+  return request(`/periods/${periodId}/approval`);
+}
+
+export async function submitApproval(periodId: number): Promise<PeriodApproval> {
+  return request(`/periods/${periodId}/approval/submit`, { method: "POST" });
+}
+
+export async function approvePeriod(periodId: number, comment = ""): Promise<PeriodApproval> {
+  return request(`/periods/${periodId}/approval/approve`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ comment }),
+  });
+}
+
+// 驳回须填写意见
+export async function rejectPeriod(periodId: number, comment: string): Promise<PeriodApproval> {
+  return request(`/periods/${periodId}/approval/reject`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ comment }),
+  });
+}
+
+export async function listPendingApprovals(): Promise<PendingApproval[]> {
+  return request("/approvals/pending");
+}
+
+export async function listCompanyUsers(): Promise<User[]> {
+  return request("/users");
+}
+
+export async function setUserApprover(userId: number, approver: boolean): Promise<User> {
+  return request(`/users/${userId}/approver`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ approver }),
+  });
 }
 
 export async function getSummary(
@@ -567,6 +1004,62 @@ export async function downloadSchemeChargesExcel(
   return res.blob();
 }
 
+export async function getReconciliation(periodId: number): Promise<ReconciliationReport> {
+  return request<ReconciliationReport>(`/periods/${periodId}/reconciliation`);
+}
+
+export async function downloadReconciliationExcel(periodId: number): Promise<Blob> {
+  const token = localStorage.getItem("token");
+  const headers: Record<string, string> = token ? { Authorization: `Bearer ${token}` } : {};
+
+  const res = await fetch(`${API_BASE}/periods/${periodId}/reconciliation/export`, {
+    headers,
+    cache: "no-store",
+  });
+
+  if (!res.ok) {
+    let detail = await res.text();
+    try {
+      const data = JSON.parse(detail);
+      detail = data?.error || detail;
+    } catch {
+      // ignore
+    }
+    throw new Error(detail || "导出失败");
+  }
+
+  return res.blob();
+}
+
+export async function getPeriodDiff(periodId: number, againstId?: number): Promise<PeriodDiff> {
+  const query = againstId ? `?against=${againstId}` : "";
+  return request<PeriodDiff>(`/periods/${periodId}/diff${query}`);
+}
+
+export async function downloadPeriodDiffExcel(periodId: number, againstId?: number): Promise<Blob> {
+  const token = localStorage.getItem("token");
+  const headers: Record<string, string> = token ? { Authorization: `Bearer ${token}` } : {};
+  const query = againstId ? `?against=${againstId}` : "";
+
+  const res = await fetch(`${API_BASE}/periods/${periodId}/diff/export${query}`, {
+    headers,
+    cache: "no-store",
+  });
+
+  if (!res.ok) {
+    let detail = await res.text();
+    try {
+      const data = JSON.parse(detail);
+      detail = data?.error || detail;
+    } catch {
+      // ignore
+    }
+    throw new Error(detail || "导出失败");
+  }
+
+  return res.blob();
+}
+
 export async function resetPeriod(periodId: number): Promise<{ message: string }> {
   return request<{ message: string }>(`/periods/${periodId}/reset`, {
     method: "POST",
@@ -619,7 +1112,13 @@ export async function processAdjustments(periodId: number): Promise<{
   personal: PersonalCharge[];
   unit: UnitCharge[];
 }> {
-  return request(`/periods/${periodId}/adjustments/process`, { method: "POST" });
+  const job = await request<Job>(`/periods/${periodId}/adjustments/process`, { method: "POST" });
+  return waitForJob(job.id);
+}
+
+// 账期补退按费款所属期汇总
+export async function getAdjustmentsByMonth(periodId: number): Promise<PeriodAdjustments> {
+  return request<PeriodAdjustments>(`/periods/${periodId}/adjustments/by-month`);
 }
 
 // 清空社保文件
@@ -5,7 +5,224 @@ export type Scheme =
   | "medical"
   | "serious_illness"
   | "unemployment"
-  | "injury";
+  | "injury"
+  | "housing_fund"
+  // 险种登记表中新增的险种
+  | (string & {});
+
+export interface SchemeDefinition {
+  id: number;
+  code: Scheme;
+  name: string;
+  parts: Part[];
+  required: boolean;
+  personal_column?: string;
+  unit_column?: string;
+  keywords?: string[];
+  sort_order: number;
+  enabled: boolean;
+  builtin: boolean;
+}
+
+export type SchemeAmounts = Record<string, number>;
+
+export interface ContributionRate {
+  scheme: Scheme;
+  part: Part;
+  rate: number;
+  fixed_amount?: number;
+}
+
+export type RoundingMode = "round" | "half_even" | "ceil" | "floor";
+export type RoundingUnit = "fen" | "jiao" | "yuan";
+
+export interface RoundingPolicy {
+  scheme: Scheme;
+  part?: Part;
+  mode: RoundingMode;
+  unit: RoundingUnit;
+  scope: "line" | "person" | "total";
+}
+
+export interface ContributionRuleSet {
+  id: number;
+  city: string;
+  effective_from: string;
+  average_wage: number;
+  floor_percent: number;
+  ceiling_percent: number;
+  base_floor: number;
+  base_ceiling: number;
+  rates: ContributionRate[];
+  tolerance: number;
+  notes: string;
+  rounding_policies: RoundingPolicy[];
+  created_at: string;
+  updated_at: string;
+}
+
+export interface CostCenterMapping {
+  id: number;
+  department: string;
+  cost_center: string;
+  cost_center_name: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface CostCenterShare {
+  cost_center: string;
+  percent: number;
+}
+
+export interface CostCenterSplit {
+  id: number;
+  id_number: string;
+  name: string;
+  shares: CostCenterShare[];
+  created_at: string;
+  updated_at: string;
+}
+
+export type AllocationGroup = "department" | "cost_center";
+
+export interface ChargeColumn {
+  label: string;
+  schemes: Scheme[];
+}
+
+export interface AllocationRow {
+  key: string;
+  name?: string;
+  headcount: number;
+  personal: SchemeAmounts;
+  unit: SchemeAmounts;
+  personal_total: number;
+  unit_total: number;
+  total: number;
+}
+
+export interface AllocationReport {
+  group_by: AllocationGroup;
+  from: string;
+  to: string;
+  periods: string[];
+  unprocessed: string[];
+  personal_columns: ChargeColumn[];
+  unit_columns: ChargeColumn[];
+  rows: AllocationRow[];
+  totals: AllocationRow;
+  unmapped: string[];
+}
+
+export interface StatementMonth {
+  year_month: string;
+  period_id: number;
+  department: string;
+  personal_base: number;
+  unit_base: number;
+  personal: SchemeAmounts;
+  unit: SchemeAmounts;
+  personal_adjustment: SchemeAmounts;
+  unit_adjustment: SchemeAmounts;
+  personal_adjustment_total: number;
+  unit_adjustment_total: number;
+  personal_total: number;
+  unit_total: number;
+  adjustment_paid_in?: string[];
+}
+
+export interface ContributionStatement {
+  id_number: string;
+  name: string;
+  department: string;
+  year: number;
+  months: StatementMonth[];
+  personal_columns: ChargeColumn[];
+  unit_columns: ChargeColumn[];
+  totals: {
+    personal: SchemeAmounts;
+    unit: SchemeAmounts;
+    personal_total: number;
+    unit_total: number;
+    total: number;
+  };
+}
+
+export interface AdjustmentMonth {
+  contribution_month: string;
+  headcount: number;
+  personal: SchemeAmounts;
+  unit: SchemeAmounts;
+  personal_total: number;
+  unit_total: number;
+  total: number;
+}
+
+export interface PeriodAdjustments {
+  period_id: number;
+  year_month: string;
+  months: AdjustmentMonth[];
+  personal_columns: ChargeColumn[];
+  unit_columns: ChargeColumn[];
+  personal_total: number;
+  unit_total: number;
+  total: number;
+}
+
+export interface ArrearsEntry {
+  contribution_month: string;
+  period_id: number;
+  paid_year_month: string;
+  personal_base: number;
+  unit_base: number;
+  personal: SchemeAmounts;
+  unit: SchemeAmounts;
+  personal_total: number;
+  unit_total: number;
+}
+
+export interface ArrearsLedger {
+  id_number: string;
+  name: string;
+  department: string;
+  entries: ArrearsEntry[];
+  months: string[];
+  personal_columns: ChargeColumn[];
+  unit_columns: ChargeColumn[];
+  personal_total: number;
+  unit_total: number;
+  total: number;
+}
+
+export interface ContributionIssue {
+  record_id: number;
+  source_file_id: number;
+  sequence: number;
+  name: string;
+  id_number: string;
+  scheme: Scheme;
+  part: Part;
+  pay_salary: number;
+  pay_base: number;
+  expected_base: number;
+  rate: number;
+  expected_amount: number;
+  amount_due: number;
+  difference: number;
+  reasons: string[];
+}
+
+export interface ContributionCheckResult {
+  rule_set: ContributionRuleSet;
+  base_floor: number;
+  base_ceiling: number;
+  checked: number;
+  mismatched: number;
+  skipped: number;
+  unrated_schemes?: string[];
+  issues: ContributionIssue[];
+}
 
 export interface User {
   id: number;
@@ -13,6 +230,7 @@ export interface User {
   email: string;
   full_name: string;
   active: boolean;
+  approver?: boolean;
   created_at: string;
   updated_at: string;
 }
@@ -34,15 +252,55 @@ export interface AuthResponse {
   user: User;
 }
 
+// 账期状态：draft → uploaded → processed → reviewed → closed，关账后数据只读
+export type PeriodStatus = "draft" | "uploaded" | "processed" | "reviewed" | "closed";
+
 export interface Period {
   id: number;
   year_month: string;
-  status: string;
+  city?: string;
+  status: PeriodStatus;
   allow_adjustments: boolean;
+  provisional?: boolean;
+  missing_uploads?: MissingUpload[];
   created_at: string;
   updated_at: string;
 }
 
+export interface MissingUpload {
+  scheme: Scheme;
+  part: Part;
+}
+
+export type ApprovalStatus = "pending" | "approved" | "rejected" | "invalidated";
+
+// 账期审批记录，summary_hash 为提交时处理结果的摘要，结果变化后状态为 invalidated
+export interface PeriodApproval {
+  id: number;
+  period_id: number;
+  status: ApprovalStatus;
+  summary_hash: string;
+  submitted_by: number;
+  submitted_at: string;
+  decided_by?: number;
+  decided_at?: string;
+  comment: string;
+  invalidated_at?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface PeriodApprovalState {
+  current: PeriodApproval | null;
+  history: PeriodApproval[];
+  watermark: "已审批" | "未审批";
+}
+
+export interface PendingApproval {
+  period: Period;
+  approval: PeriodApproval;
+}
+
 export interface SourceFile {
   id: number;
   period_id: number;
@@ -51,21 +309,145 @@ export interface SourceFile {
   scheme: Scheme;
   part: Part;
   file_type?: string;
+  version?: number;
+  active?: boolean;
   rows: number;
   status: string;
   original_name: string;
   uploaded_at: string;
+  purged_at?: string;
 }
 
 export interface PeriodSummary {
   id: number;
   period_id: number;
   scheme: Scheme;
+  scheme_name?: string;
   part: Part;
   headcount: number;
   base_total: number;
   amount_total: number;
+  effective_rate?: number;
   is_adjustment?: boolean;
+  provisional?: boolean;
+}
+
+export interface RateIssue {
+  record_id: number;
+  source_file_id: number;
+  sequence: number;
+  name: string;
+  id_number: string;
+  scheme: Scheme;
+  part: Part;
+  pay_base: number;
+  rate_text: string;
+  expected_amount: number;
+  amount_due: number;
+  difference: number;
+}
+
+export type ReconciliationKind =
+  | "missing_from_scheme"
+  | "not_on_roster"
+  | "name_mismatch"
+  | "department_mismatch"
+  | "part_mismatch";
+
+export interface ReconciliationItem {
+  kind: ReconciliationKind;
+  id_number: string;
+  roster_name?: string;
+  bureau_name?: string;
+  roster_department?: string;
+  bureau_department?: string;
+  missing?: { scheme: Scheme; part: Part }[];
+  detail: string;
+}
+
+export interface ReconciliationReport {
+  period_id: number;
+  roster_count: number;
+  bureau_count: number;
+  uploaded: { scheme: Scheme; part: Part }[];
+  counts: Partial<Record<ReconciliationKind, number>>;
+  items: ReconciliationItem[];
+}
+
+export interface DiffPerson {
+  id_number: string;
+  name: string;
+  department: string;
+  personal_base: number;
+  unit_base: number;
+  personal: number;
+  unit: number;
+}
+
+export interface DiffPeopleSection {
+  count: number;
+  personal_total: number;
+  unit_total: number;
+  people: DiffPerson[];
+}
+
+export interface DiffBaseChange {
+  id_number: string;
+  name: string;
+  department: string;
+  part: Part;
+  before: number;
+  after: number;
+  delta: number;
+}
+
+export interface DiffAmountChange extends DiffBaseChange {
+  scheme: Scheme;
+  scheme_name: string;
+}
+
+export interface DiffSchemeTotal {
+  scheme: Scheme;
+  scheme_name: string;
+  part: Part;
+  before: number;
+  after: number;
+  delta: number;
+  additions: number;
+  removals: number;
+  changes: number;
+}
+
+export interface PeriodDiff {
+  period_id: number;
+  year_month: string;
+  against_id: number;
+  against_year_month: string;
+  totals: {
+    part: Part;
+    before: number;
+    after: number;
+    delta: number;
+    adjustment_before: number;
+    adjustment_after: number;
+  }[];
+  additions: DiffPeopleSection;
+  removals: DiffPeopleSection;
+  base_changes: {
+    count: number;
+    personal_delta: number;
+    unit_delta: number;
+    changes: DiffBaseChange[];
+  };
+  amount_changes: {
+    count: number;
+    totals: DiffSchemeTotal[];
+    changes: DiffAmountChange[];
+  };
+  department_moves: {
+    count: number;
+    moves: { id_number: string; name: string; from: string; to: string }[];
+  };
 }
 
 export interface PersonalCharge {
@@ -79,6 +461,7 @@ export interface PersonalCharge {
   medical_maternity: number;
   serious_illness: number;
   unemployment: number;
+  amounts?: SchemeAmounts;
   subtotal: number;
   is_adjustment?: boolean;
 }
@@ -95,10 +478,24 @@ export interface UnitCharge {
   serious_illness: number;
   injury: number;
   unemployment: number;
+  amounts?: SchemeAmounts;
   subtotal: number;
   is_adjustment?: boolean;
 }
 
+export interface HousingFundCharge {
+  id: number;
+  period_id: number;
+  name: string;
+  id_number: string;
+  account_number: string;
+  department: string;
+  base: number;
+  personal: number;
+  unit: number;
+  total: number;
+}
+
 export interface RosterEntry {
   id: number;
   period_id: number;
@@ -109,15 +506,51 @@ export interface RosterEntry {
   remarks: string;
 }
 
+export interface Classification {
+  scheme?: Scheme;
+  part?: Part;
+  scheme_confidence: number;
+  part_confidence: number;
+  confidence: number;
+  source?: "content" | "form" | "mixed";
+  signals?: Array<{
+    kind: "file_name" | "title" | "rate";
+    text: string;
+    schemes?: Scheme[];
+    parts?: Part[];
+    weight: number;
+  }>;
+}
+
 export interface BatchUploadItem {
   file_name: string;
   original_name: string;
   scheme: Scheme;
   part: Part;
   imported: number;
+  classification?: Classification;
   error?: string;
 }
 
+export type JobStatus = "queued" | "running" | "succeeded" | "failed";
+
+export interface Job<T = unknown> {
+  id: number;
+  period_id?: number;
+  type: string;
+  status: JobStatus;
+  progress: number;
+  message: string;
+  result?: T;
+  error?: string;
+  attempts: number;
+  resumable: boolean;
+  started_at?: string;
+  finished_at?: string;
+  created_at: string;
+  updated_at: string;
+}
+
 export interface SchemeChargeDetail {
   name: string;
   id_number: string;